@@ -11,41 +11,14 @@ import (
 	"strings"
 
 	"go.starlark.net/syntax"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir/passes"
 )
 
 // indentPrefix is the string value used to indent a line by one level.
 const indentPrefix = "  "
 
-// bazelRuleToGNTemplate maps from Bazel rule names to GN template names. They can
-// be the same if Bazel and GN shared the same template name.
-//
-// This map is also used to check known Bazel rules that can be converted to GN.
-// i.e. Bazel rules not found in this map is not supported by bazel2gn yet.
-var bazelRuleToGNTemplate = map[string]string{
-	"go_binary":          "go_binary",
-	"go_library":         "go_library",
-	"go_test":            "go_test",
-	"install_host_tools": "install_host_tools",
-	"package":            "package",
-	"rust_binary":        "rustc_binary",
-	"rust_library":       "rustc_library",
-	"rustc_binary":       "rustc_binary",
-	"rustc_library":      "rustc_library",
-	"rust_proc_macro":    "rustc_macro",
-	"sdk_host_tool":      "sdk_host_tool",
-}
-
-// attrsToOmitByRules stores a mapping from known Bazel rules to attributes to
-// omit when converting them to GN.
-var attrsToOmitByRules = map[string]map[string]bool{
-	"go_library": {
-		// In GN we default cgo to true when compiling Go code, and explicitly disable
-		// it in very few places. However, in Bazel, cgo defaults to false, and
-		// require users to explicitly set when C sources are included.
-		"cgo": true,
-	},
-}
-
 // These identifiers with the same meanings are represented differently in Bazel
 // and GN. specialIdentifiers maps from their Bazel representations to GN
 // representations.
@@ -65,8 +38,54 @@ var bazelConstraintsToGNConditions = map[string]string{
 	"HOST_CONSTRAINTS": "is_host",
 }
 
+// selectDefaultLabel is the Bazel config label that select() falls back to
+// when no other key matches.
+const selectDefaultLabel = `"//conditions:default"`
+
+// configLabelToGNCondition maps Bazel config_setting/constraint labels, as
+// used in select() dict keys, to the equivalent GN condition expression.
+//
+// This map is necessarily incomplete: it only covers the config labels
+// bazel2gn has been taught about so far. Add entries here as new select()
+// conditions are encountered in BUILD.bazel files being converted.
+var configLabelToGNCondition = map[string]string{
+	`"//build/config:is_host"`:        "is_host",
+	`"//build/config/cpu:arm64"`:      `target_cpu == "arm64"`,
+	`"//build/config/cpu:x64"`:        `target_cpu == "x64"`,
+	`"//build/config/platform:linux"`: `target_os == "linux"`,
+	`"//build/config/platform:mac"`:   `target_os == "mac"`,
+}
+
 var thirdPartyRustCrateRE = regexp.MustCompile(`^"\/\/third_party\/rust_crates.+:`)
 
+// GNTemplateToBazelRule returns the inverse of ruleRegistry's GNTemplate
+// field, for use by gn2bazel so the two directions of conversion stay in
+// sync. Several Bazel rules map to the same GN template (e.g.
+// rust_library/rustc_library both become rustc_library); ties are broken in
+// favor of the canonically-named Bazel rule (the one GN's own template name
+// matches, or the first one encountered otherwise), since that's what a
+// BUILD.bazel author converting back from GN would actually write.
+func GNTemplateToBazelRule() map[string]string {
+	ret := map[string]string{}
+	for bazelRule, spec := range ruleRegistry {
+		if _, ok := ret[spec.GNTemplate]; !ok || bazelRule == spec.GNTemplate {
+			ret[spec.GNTemplate] = bazelRule
+		}
+	}
+	return ret
+}
+
+// GNConditionToConfigLabel returns the inverse of configLabelToGNCondition,
+// for use by gn2bazel when lowering a GN `if` condition back into a Bazel
+// select() key.
+func GNConditionToConfigLabel() map[string]string {
+	ret := map[string]string{}
+	for label, cond := range configLabelToGNCondition {
+		ret[cond] = label
+	}
+	return ret
+}
+
 // indent indents input lines by input levels.
 func indent(lines []string, level int) []string {
 	var indented []string
@@ -77,21 +96,379 @@ func indent(lines []string, level int) []string {
 	return indented
 }
 
-// StmtToGN converts a Bazel statement [0] to GN.
+// environment tracks module-scope names that have already been bound by an
+// assignment, so later statements (e.g. an `if` condition referencing a
+// previously assigned variable) can be converted without erroring. It's
+// threaded through StmtToGN and the statement converters it dispatches to,
+// rather than kept as package state, so independent conversions (e.g. the
+// isolated scope inside a macro body) don't see each other's bindings.
+type environment struct {
+	bound map[string]bool
+}
+
+// newEnvironment returns an empty environment.
+func newEnvironment() *environment {
+	return &environment{bound: map[string]bool{}}
+}
+
+// bind records name as having been assigned. A nil env is a no-op, so
+// callers that don't care about symbol tracking can pass nil throughout.
+func (e *environment) bind(name string) {
+	if e != nil {
+		e.bound[name] = true
+	}
+}
+
+// isBound reports whether name has previously been bound in e.
+func (e *environment) isBound(name string) bool {
+	return e != nil && e.bound[name]
+}
+
+// StmtToGN converts a Bazel statement [0] to GN. env tracks module-scope
+// variable bindings seen so far; pass newEnvironment() when converting a
+// whole file so that later statements can reference earlier ones.
 //
 // [0] https://github.com/bazelbuild/starlark/blob/master/spec.md#statements
-func StmtToGN(stmt syntax.Stmt) ([]string, error) {
+func StmtToGN(stmt syntax.Stmt, env *environment) ([]string, error) {
 	switch v := stmt.(type) {
 	case *syntax.LoadStmt:
 		// Load statements are ignored during conversion.
 		return nil, nil
 	case *syntax.ExprStmt:
 		return exprToGN(v.X, nil)
+	case *syntax.AssignStmt:
+		return assignStmtToGN(v, env)
+	case *syntax.IfStmt:
+		return ifStmtToGN(v, env)
+	case *syntax.DefStmt:
+		return defStmtToGN(v)
+	case *syntax.ForStmt:
+		return forStmtToGN(v, env)
+	case *syntax.ReturnStmt:
+		return returnStmtToGN(v)
 	default:
 		return nil, fmt.Errorf("statement of type %T is not supported to be converted to GN, node details: %#v", stmt, stmt)
 	}
 }
 
+// ConvertFile converts every top-level statement of a parsed BUILD.bazel
+// file to GN text, sharing one environment across statements so that e.g.
+// a target referencing a module-scope variable assigned earlier in the
+// file converts correctly.
+func ConvertFile(stmts []syntax.Stmt) ([]string, error) {
+	env := newEnvironment()
+	var ret []string
+	for _, stmt := range stmts {
+		lines, err := StmtToGN(stmt, env)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, lines...)
+	}
+	return ret, nil
+}
+
+// assignStmtToGN converts a module-scope Bazel assignment (e.g.
+// `COMMON_SRCS = [...]`) to a GN scope-level variable assignment.
+func assignStmtToGN(stmt *syntax.AssignStmt, env *environment) ([]string, error) {
+	ident, ok := stmt.LHS.(*syntax.Ident)
+	if !ok {
+		return nil, fmt.Errorf("only simple variable assignment (name = value) is supported at module scope, got lhs of type %T", stmt.LHS)
+	}
+	if stmt.Op != syntax.EQ {
+		return nil, fmt.Errorf("only plain `=` assignment is supported at module scope, got operator %s", stmt.Op)
+	}
+
+	lines, err := exprToGN(stmt.RHS, nil)
+	if err != nil {
+		return nil, fmt.Errorf("converting value of %q: %v", ident.Name, err)
+	}
+	lines[0] = fmt.Sprintf("%s = %s", ident.Name, lines[0])
+	env.bind(ident.Name)
+	return lines, nil
+}
+
+// ifStmtToGN converts a module-scope Bazel `if`/`else` to the GN
+// equivalent.
+func ifStmtToGN(stmt *syntax.IfStmt, env *environment) ([]string, error) {
+	cond, err := conditionToGN(stmt.Cond, env)
+	if err != nil {
+		return nil, fmt.Errorf("converting if condition: %v", err)
+	}
+
+	ret := []string{fmt.Sprintf("if (%s) {", cond)}
+	trueLines, err := stmtsToGN(stmt.True, env)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, indent(trueLines, 1)...)
+
+	if len(stmt.False) > 0 {
+		ret = append(ret, "} else {")
+		falseLines, err := stmtsToGN(stmt.False, env)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, indent(falseLines, 1)...)
+	}
+	ret = append(ret, "}")
+	return ret, nil
+}
+
+// stmtsToGN converts a sequence of statements sharing the same env, e.g. an
+// `if` branch body or a `for` loop body.
+func stmtsToGN(stmts []syntax.Stmt, env *environment) ([]string, error) {
+	var ret []string
+	for _, stmt := range stmts {
+		lines, err := StmtToGN(stmt, env)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, lines...)
+	}
+	return ret, nil
+}
+
+// conditionToGN converts a Bazel `if` condition expression to a single-line
+// GN condition expression, resolving identifiers through
+// bazelConstraintsToGNConditions first and falling back to a plain GN
+// identifier reference for names env has already bound.
+func conditionToGN(expr syntax.Expr, env *environment) (string, error) {
+	switch v := expr.(type) {
+	case *syntax.Ident:
+		if special, ok := specialIdentifiers[v.Name]; ok {
+			return special, nil
+		}
+		if cond, ok := bazelConstraintsToGNConditions[v.Name]; ok {
+			return cond, nil
+		}
+		if env.isBound(v.Name) {
+			return v.Name, nil
+		}
+		return "", fmt.Errorf("unresolved symbol %q in if condition; add it to bazelConstraintsToGNConditions or bind it with an earlier assignment", v.Name)
+	case *syntax.UnaryExpr:
+		if v.Op != syntax.NOT {
+			return "", fmt.Errorf("unsupported unary operator %s in if condition", v.Op)
+		}
+		inner, err := conditionToGN(v.X, env)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("!(%s)", inner), nil
+	case *syntax.BinaryExpr:
+		if v.Op == syntax.AND || v.Op == syntax.OR {
+			lhs, err := conditionToGN(v.X, env)
+			if err != nil {
+				return "", err
+			}
+			rhs, err := conditionToGN(v.Y, env)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %s %s", lhs, opToGN(v.Op), rhs), nil
+		}
+		lhsLines, err := exprToGN(v.X, nil)
+		if err != nil {
+			return "", fmt.Errorf("converting lhs of if condition: %v", err)
+		}
+		rhsLines, err := exprToGN(v.Y, nil)
+		if err != nil {
+			return "", fmt.Errorf("converting rhs of if condition: %v", err)
+		}
+		if len(lhsLines) != 1 || len(rhsLines) != 1 {
+			return "", errors.New("multi-line expressions are not supported inside if conditions")
+		}
+		return fmt.Sprintf("%s %s %s", lhsLines[0], opToGN(v.Op), rhsLines[0]), nil
+	case *syntax.Literal:
+		return v.Raw, nil
+	default:
+		return "", fmt.Errorf("unsupported expression of type %T in if condition", expr)
+	}
+}
+
+// substituteIdentsInExpr returns a copy of expr with every *syntax.Ident
+// whose name is a key of subs replaced by the corresponding expression. It
+// doesn't mutate expr, so the same AST node can be substituted more than
+// once, e.g. once per element when unrolling a `for` loop.
+func substituteIdentsInExpr(expr syntax.Expr, subs map[string]syntax.Expr) syntax.Expr {
+	switch v := expr.(type) {
+	case *syntax.Ident:
+		if repl, ok := subs[v.Name]; ok {
+			return repl
+		}
+		return v
+	case *syntax.BinaryExpr:
+		return &syntax.BinaryExpr{X: substituteIdentsInExpr(v.X, subs), Op: v.Op, Y: substituteIdentsInExpr(v.Y, subs)}
+	case *syntax.UnaryExpr:
+		return &syntax.UnaryExpr{Op: v.Op, X: substituteIdentsInExpr(v.X, subs)}
+	case *syntax.ListExpr:
+		newList := make([]syntax.Expr, len(v.List))
+		for i, e := range v.List {
+			newList[i] = substituteIdentsInExpr(e, subs)
+		}
+		return &syntax.ListExpr{List: newList}
+	case *syntax.CallExpr:
+		newArgs := make([]syntax.Expr, len(v.Args))
+		for i, a := range v.Args {
+			newArgs[i] = substituteIdentsInExpr(a, subs)
+		}
+		return &syntax.CallExpr{Fn: substituteIdentsInExpr(v.Fn, subs), Args: newArgs}
+	case *syntax.DictExpr:
+		newEntries := make([]syntax.Expr, len(v.List))
+		for i, e := range v.List {
+			de, ok := e.(*syntax.DictEntry)
+			if !ok {
+				newEntries[i] = e
+				continue
+			}
+			newEntries[i] = &syntax.DictEntry{Key: substituteIdentsInExpr(de.Key, subs), Value: substituteIdentsInExpr(de.Value, subs)}
+		}
+		return &syntax.DictExpr{List: newEntries}
+	default:
+		return expr
+	}
+}
+
+// substituteIdentsInStmt is substituteIdentsInExpr's statement-level
+// counterpart, used to rewrite a macro or for-loop body.
+func substituteIdentsInStmt(stmt syntax.Stmt, subs map[string]syntax.Expr) syntax.Stmt {
+	switch v := stmt.(type) {
+	case *syntax.ExprStmt:
+		return &syntax.ExprStmt{X: substituteIdentsInExpr(v.X, subs)}
+	case *syntax.AssignStmt:
+		return &syntax.AssignStmt{LHS: v.LHS, Op: v.Op, RHS: substituteIdentsInExpr(v.RHS, subs)}
+	case *syntax.IfStmt:
+		newTrue := make([]syntax.Stmt, len(v.True))
+		for i, s := range v.True {
+			newTrue[i] = substituteIdentsInStmt(s, subs)
+		}
+		newFalse := make([]syntax.Stmt, len(v.False))
+		for i, s := range v.False {
+			newFalse[i] = substituteIdentsInStmt(s, subs)
+		}
+		return &syntax.IfStmt{Cond: substituteIdentsInExpr(v.Cond, subs), True: newTrue, False: newFalse}
+	case *syntax.ReturnStmt:
+		if v.Result == nil {
+			return v
+		}
+		return &syntax.ReturnStmt{Result: substituteIdentsInExpr(v.Result, subs)}
+	default:
+		return stmt
+	}
+}
+
+// defStmtToGN converts a Bazel macro (`def name(...):`) into a GN
+// template("name") { ... }. Required parameters are referenced in the body
+// as `invoker.<name>`; parameters with a default value instead get a local
+// variable of the same name, populated from the invoker if set and falling
+// back to the converted default otherwise, so the default is preserved
+// without forcing every caller of the resulting template to pass it.
+func defStmtToGN(stmt *syntax.DefStmt) ([]string, error) {
+	subs := map[string]syntax.Expr{}
+	var preamble []string
+	for _, p := range stmt.Params {
+		switch pv := p.(type) {
+		case *syntax.Ident:
+			subs[pv.Name] = &syntax.Ident{Name: "invoker." + pv.Name}
+		case *syntax.BinaryExpr:
+			ident, ok := pv.X.(*syntax.Ident)
+			if !ok || pv.Op != syntax.EQ {
+				return nil, fmt.Errorf("unsupported parameter expression in def %q: %#v", stmt.Name.Name, p)
+			}
+			defaultLines, err := exprToGN(pv.Y, nil)
+			if err != nil {
+				return nil, fmt.Errorf("converting default value of parameter %q in def %q: %v", ident.Name, stmt.Name.Name, err)
+			}
+			defaultLines[0] = fmt.Sprintf("%s = %s", ident.Name, defaultLines[0])
+
+			preamble = append(preamble, fmt.Sprintf("if (defined(invoker.%s)) {", ident.Name))
+			preamble = append(preamble, indent([]string{fmt.Sprintf("%s = invoker.%s", ident.Name, ident.Name)}, 1)...)
+			preamble = append(preamble, "} else {")
+			preamble = append(preamble, indent(defaultLines, 1)...)
+			preamble = append(preamble, "}")
+			// Left unsubstituted: references to ident.Name in the body now
+			// resolve to the local variable set up above.
+		default:
+			return nil, fmt.Errorf("unsupported parameter expression in def %q: %#v", stmt.Name.Name, p)
+		}
+	}
+
+	ret := []string{fmt.Sprintf("template(%q) {", stmt.Name.Name)}
+	ret = append(ret, indent(preamble, 1)...)
+
+	// A macro's body is its own scope, independent of the module scope it's
+	// defined in.
+	bodyEnv := newEnvironment()
+	for _, bodyStmt := range stmt.Body {
+		lines, err := StmtToGN(substituteIdentsInStmt(bodyStmt, subs), bodyEnv)
+		if err != nil {
+			return nil, fmt.Errorf("converting body of def %q: %v", stmt.Name.Name, err)
+		}
+		ret = append(ret, indent(lines, 1)...)
+	}
+
+	ret = append(ret, "}")
+	return ret, nil
+}
+
+// forStmtToGN converts a module- or macro-scope Bazel `for` loop to GN. When
+// the iterable is a literal list, the loop is unrolled at conversion time,
+// one copy of the body per element with the loop variable substituted in.
+// Otherwise it's emitted as a GN foreach() block, which only supports a
+// single loop variable walking a runtime-evaluated list, not destructuring.
+func forStmtToGN(stmt *syntax.ForStmt, env *environment) ([]string, error) {
+	loopVar, ok := stmt.Vars.(*syntax.Ident)
+	if !ok {
+		return nil, fmt.Errorf("only a single loop variable is supported in for statements, got %#v", stmt.Vars)
+	}
+
+	if list, ok := stmt.X.(*syntax.ListExpr); ok {
+		var ret []string
+		for _, elem := range list.List {
+			subs := map[string]syntax.Expr{loopVar.Name: elem}
+			for _, bodyStmt := range stmt.Body {
+				lines, err := StmtToGN(substituteIdentsInStmt(bodyStmt, subs), env)
+				if err != nil {
+					return nil, fmt.Errorf("converting unrolled for-loop body: %v", err)
+				}
+				ret = append(ret, lines...)
+			}
+		}
+		return ret, nil
+	}
+
+	iterLines, err := exprToGN(stmt.X, nil)
+	if err != nil {
+		return nil, fmt.Errorf("converting for-loop iterable: %v", err)
+	}
+	if len(iterLines) != 1 {
+		return nil, errors.New("multi-line for-loop iterables are not supported")
+	}
+
+	loopEnv := newEnvironment()
+	loopEnv.bind(loopVar.Name)
+	ret := []string{fmt.Sprintf("foreach(%s, %s) {", loopVar.Name, iterLines[0])}
+	bodyLines, err := stmtsToGN(stmt.Body, loopEnv)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, indent(bodyLines, 1)...)
+	ret = append(ret, "}")
+	return ret, nil
+}
+
+// returnStmtToGN converts a Bazel `return` found inside a macro body. GN
+// templates have no equivalent control-flow construct, so a bare `return`
+// (commonly used as an early-exit guard, e.g. `if not enabled: return`) is
+// dropped rather than rejected; a `return` with a value has no GN
+// equivalent at all, since templates don't produce values.
+func returnStmtToGN(stmt *syntax.ReturnStmt) ([]string, error) {
+	if stmt.Result != nil {
+		return nil, errors.New("return statements with a value are not supported when converting macros to GN templates")
+	}
+	return nil, nil
+}
+
 // transformer is a function type that can be used by `exprToGN` to apply
 // special transformations to expression nodes before conversion.
 //
@@ -116,6 +493,12 @@ func exprToGN(expr syntax.Expr, transformers []transformer) ([]string, error) {
 
 	switch v := expr.(type) {
 	case *syntax.CallExpr:
+		if _, ok := v.Fn.(*syntax.DotExpr); ok {
+			return stringMethodCallToGN(v)
+		}
+		if ident, ok := v.Fn.(*syntax.Ident); ok && ident.Name == "glob" {
+			return globCallToGN(v)
+		}
 		// NOTE: I'm not sure whether we need to plumb transformers here, so far it
 		// is not necessary. callExprToGN should be a top-level entry point for
 		// macro and rules.
@@ -128,6 +511,8 @@ func exprToGN(expr syntax.Expr, transformers []transformer) ([]string, error) {
 		return []string{v.Raw}, nil
 	case *syntax.ListExpr:
 		return listExprToGN(v, transformers)
+	case *syntax.Comprehension:
+		return comprehensionToGN(v)
 	default:
 		return nil, fmt.Errorf("expression of type %T is not supported when converting to GN, node details: %#v", expr, expr)
 	}
@@ -209,7 +594,7 @@ func bazelDepToGN(expr syntax.Expr) (syntax.Expr, error) {
 func callExprToGN(expr *syntax.CallExpr) ([]string, error) {
 	fn := expr.Fn.(*syntax.Ident)
 	bazelRule := fn.Name
-	gnTemplateName, ok := bazelRuleToGNTemplate[bazelRule]
+	spec, ok := ruleSpec(bazelRule)
 	if !ok {
 		return nil, fmt.Errorf("%s is not a known Bazel rule to convert to GN", bazelRule)
 	}
@@ -219,12 +604,16 @@ func callExprToGN(expr *syntax.CallExpr) ([]string, error) {
 		return nil, nil
 	}
 
-	attrsToOmit := attrsToOmitByRules[bazelRule]
-
 	// Loops through all arguments to handle special ones first.
 	var name string
 	var remainingArgs []*syntax.BinaryExpr
+	var extraLines []string
 	var wrappingConditions []string
+	seenAttrs := map[string]bool{}
+	// bazelAttrNames maps a (possibly AttrRename'd) remainingArgs entry back
+	// to the Bazel attribute name it came from, so spec.Transformers (keyed
+	// pre-rename) can still be looked up after renaming.
+	bazelAttrNames := map[*syntax.BinaryExpr]string{}
 	for _, arg := range expr.Args {
 		binaryExpr, ok := arg.(*syntax.BinaryExpr)
 		if !ok || binaryExpr.Op != syntax.EQ {
@@ -234,9 +623,7 @@ func callExprToGN(expr *syntax.CallExpr) ([]string, error) {
 		if !ok {
 			return nil, fmt.Errorf("unexpected node type on the left hand side of binary expression in target definition, want syntax.Ident, got %T", binaryExpr.X)
 		}
-		if attrsToOmit[ident.Name] {
-			continue
-		}
+		seenAttrs[ident.Name] = true
 		if ident.Name == "name" {
 			lines, err := exprToGN(binaryExpr.Y, nil)
 			if err != nil {
@@ -253,23 +640,56 @@ func callExprToGN(expr *syntax.CallExpr) ([]string, error) {
 			}
 			continue
 		}
+		// genrule's `cmd` doesn't convert like a normal attribute: it splits
+		// into the `script`/`args` pair action targets use (see
+		// genruleCmdToScriptArgs), so it's handled here rather than through
+		// attrAssignmentToGN.
+		if bazelRule == "genrule" && ident.Name == "cmd" {
+			lines, err := genruleCmdToScriptArgs(binaryExpr.Y)
+			if err != nil {
+				return nil, fmt.Errorf("converting genrule `cmd`: %v", err)
+			}
+			extraLines = append(extraLines, lines...)
+			continue
+		}
+		if spec.AttrOmit[ident.Name] {
+			continue
+		}
+		bazelAttrNames[binaryExpr] = ident.Name
+		if gnName, ok := spec.AttrRename[ident.Name]; ok {
+			binaryExpr = &syntax.BinaryExpr{X: &syntax.Ident{Name: gnName}, Op: binaryExpr.Op, Y: binaryExpr.Y}
+			bazelAttrNames[binaryExpr] = ident.Name
+		}
 		remainingArgs = append(remainingArgs, binaryExpr)
 	}
 	if name == "" {
 		return nil, errors.New("missing `name` attribute in Bazel target")
 	}
+	for _, required := range spec.RequiredAttrs {
+		if !seenAttrs[required] {
+			return nil, fmt.Errorf("%s target %q is missing required attribute %q", bazelRule, name, required)
+		}
+	}
+
+	ret := []string{fmt.Sprintf("%s(%s) {", spec.GNTemplate, name)}
 
-	ret := []string{fmt.Sprintf("%s(%s) {", gnTemplateName, name)}
+	ret = append(ret, indent(extraLines, 1)...)
 
 	// Loop through all args again to actually build the content of this target.
 	for _, arg := range remainingArgs {
-		lines, err := attrAssignmentToGN(arg)
+		lines, err := attrAssignmentToGN(arg, spec.Transformers[bazelAttrNames[arg]])
 		if err != nil {
 			return nil, fmt.Errorf("converting Bazel attribute to GN: %v", err)
 		}
 		ret = append(ret, indent(lines, 1)...)
 	}
 
+	for attrName, defaultVal := range spec.AttrDefault {
+		if !seenAttrs[attrName] {
+			ret = append(ret, indent([]string{defaultVal}, 1)...)
+		}
+	}
+
 	ret = append(ret, "}")
 	if len(wrappingConditions) > 0 {
 		ret = append([]string{
@@ -289,8 +709,12 @@ func callExprToGN(expr *syntax.CallExpr) ([]string, error) {
 //
 // NOTE: Assignment is a special binary expression with operator =.
 //
+// extraTransformers are additional, rule-specific transformers (see
+// RuleSpec.Transformers) applied alongside the built-in ones bazel2gn always
+// uses for visibility/deps.
+//
 // [0] https://github.com/bazelbuild/starlark/blob/master/spec.md#assignments
-func attrAssignmentToGN(expr *syntax.BinaryExpr) ([]string, error) {
+func attrAssignmentToGN(expr *syntax.BinaryExpr, extraTransformers []transformer) ([]string, error) {
 	lhs, ok := expr.X.(*syntax.Ident)
 	if !ok {
 		return nil, fmt.Errorf("expecting an identifier on the left hand side of attribute assignment, got %T", expr.X)
@@ -304,10 +728,183 @@ func attrAssignmentToGN(expr *syntax.BinaryExpr) ([]string, error) {
 	case "deps":
 		transformers = append(transformers, bazelDepToGN)
 	}
+	transformers = append(transformers, extraTransformers...)
+
+	if containsSelect(expr.Y) {
+		node, err := liftAttrValue(attrName, expr.Y, transformers)
+		if err != nil {
+			return nil, fmt.Errorf("lifting attribute %q to IR: %v", attrName, err)
+		}
+		optimized, err := passes.Run([]ir.Node{node})
+		if err != nil {
+			return nil, fmt.Errorf("optimizing attribute %q: %v", attrName, err)
+		}
+		return ir.Emit(optimized)
+	}
 
 	return binaryExprToGN(expr, transformers)
 }
 
+// isSelectCall reports whether expr is a call to Bazel's select(), and
+// returns it as a *syntax.CallExpr if so.
+func isSelectCall(expr syntax.Expr) (*syntax.CallExpr, bool) {
+	call, ok := expr.(*syntax.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	ident, ok := call.Fn.(*syntax.Ident)
+	if !ok || ident.Name != "select" {
+		return nil, false
+	}
+	return call, true
+}
+
+// flattenAttrValue decomposes an attribute's value expression into an
+// ordered sequence of terms, splitting on `+` concatenation and on select()
+// calls found either directly or nested inside a list literal (as Bazel
+// allows e.g. `deps = [":a"] + select({...})` or
+// `deps = [":a", select({...})]`). Every returned term is either a
+// *syntax.ListExpr with select() calls removed, or a select() *syntax.CallExpr.
+func flattenAttrValue(expr syntax.Expr) []syntax.Expr {
+	if b, ok := expr.(*syntax.BinaryExpr); ok && b.Op == syntax.PLUS {
+		return append(flattenAttrValue(b.X), flattenAttrValue(b.Y)...)
+	}
+
+	list, ok := expr.(*syntax.ListExpr)
+	if !ok {
+		return []syntax.Expr{expr}
+	}
+
+	var terms []syntax.Expr
+	var literalElems []syntax.Expr
+	flushLiterals := func() {
+		if len(literalElems) > 0 {
+			terms = append(terms, &syntax.ListExpr{List: literalElems})
+			literalElems = nil
+		}
+	}
+	for _, elem := range list.List {
+		if _, ok := isSelectCall(elem); ok {
+			flushLiterals()
+			terms = append(terms, elem)
+			continue
+		}
+		literalElems = append(literalElems, elem)
+	}
+	if len(literalElems) > 0 || len(terms) == 0 {
+		flushLiterals()
+	}
+	return terms
+}
+
+// containsSelect reports whether expr, once flattened, includes a select()
+// call anywhere.
+func containsSelect(expr syntax.Expr) bool {
+	for _, term := range flattenAttrValue(expr) {
+		if _, ok := isSelectCall(term); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// liftAttrValue converts an attribute's value expression, known to contain
+// at least one select() term (see containsSelect), into an IR AssignNode
+// whose Value is a ConcatNode of the flattened terms. This is the only
+// entry point into bazel2gn's IR pipeline: everything downstream of it
+// (constant folding, select() distribution, dead-branch removal, and
+// finally GN emission) is handled by the ir/passes and ir packages, so
+// adding a new attribute-level optimization means adding a pass there
+// rather than touching this converter.
+func liftAttrValue(attrName string, rhs syntax.Expr, transformers []transformer) (*ir.AssignNode, error) {
+	terms := flattenAttrValue(rhs)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("attribute %q has an empty value", attrName)
+	}
+
+	irTerms := make([]ir.Node, len(terms))
+	for i, term := range terms {
+		node, err := liftTerm(term, transformers)
+		if err != nil {
+			return nil, fmt.Errorf("lifting term of attribute %q: %v", attrName, err)
+		}
+		irTerms[i] = node
+	}
+	return &ir.AssignNode{Name: attrName, Op: "=", Value: &ir.ConcatNode{Terms: irTerms}}, nil
+}
+
+// liftTerm lifts a single flattened attribute-value term: either a select()
+// call or a plain (select-free) expression.
+func liftTerm(term syntax.Expr, transformers []transformer) (ir.Node, error) {
+	if call, ok := isSelectCall(term); ok {
+		return liftSelect(call, transformers)
+	}
+	if list, ok := term.(*syntax.ListExpr); ok {
+		return liftList(list, transformers)
+	}
+	lines, err := exprToGN(term, transformers)
+	if err != nil {
+		return nil, err
+	}
+	return &ir.LiteralNode{Lines: lines}, nil
+}
+
+// liftList lifts a Bazel list literal into an ir.ListNode, converting each
+// element independently so later passes (e.g. FoldConstantConcat) can
+// inspect and merge element lists without re-parsing GN text.
+func liftList(list *syntax.ListExpr, transformers []transformer) (*ir.ListNode, error) {
+	elems := make([]ir.Node, len(list.List))
+	for i, elem := range list.List {
+		lines, err := exprToGN(elem, transformers)
+		if err != nil {
+			return nil, fmt.Errorf("converting list element: %v", err)
+		}
+		elems[i] = &ir.LiteralNode{Lines: lines}
+	}
+	return &ir.ListNode{Elems: elems}, nil
+}
+
+// liftSelect converts the dict argument of a select() call into an
+// ir.SelectNode, converting each branch's value with liftTerm so a select()
+// whose values are themselves lists still benefits from list-level passes.
+func liftSelect(call *syntax.CallExpr, transformers []transformer) (*ir.SelectNode, error) {
+	if len(call.Args) != 1 {
+		return nil, fmt.Errorf("select() takes exactly one argument, a dict, got %d", len(call.Args))
+	}
+	dict, ok := call.Args[0].(*syntax.DictExpr)
+	if !ok {
+		return nil, fmt.Errorf("select() argument must be a dict literal, got %T", call.Args[0])
+	}
+
+	var branches []ir.SelectBranch
+	for _, entry := range dict.List {
+		de, ok := entry.(*syntax.DictEntry)
+		if !ok {
+			return nil, fmt.Errorf("unexpected select() dict entry of type %T", entry)
+		}
+		keyLit, ok := de.Key.(*syntax.Literal)
+		if !ok {
+			return nil, fmt.Errorf("select() dict keys must be string literals naming a config label, got %T", de.Key)
+		}
+
+		value, err := liftTerm(de.Value, transformers)
+		if err != nil {
+			return nil, fmt.Errorf("converting select() value for %s: %v", keyLit.Raw, err)
+		}
+
+		if keyLit.Raw == selectDefaultLabel {
+			branches = append(branches, ir.SelectBranch{IsDefault: true, Value: value})
+			continue
+		}
+		cond, ok := configLabelToGNCondition[keyLit.Raw]
+		if !ok {
+			return nil, fmt.Errorf("no known GN condition for select() label %s, add it to configLabelToGNCondition", keyLit.Raw)
+		}
+		branches = append(branches, ir.SelectBranch{Condition: cond, Value: value})
+	}
+	return &ir.SelectNode{Branches: branches}, nil
+}
+
 // binaryExprToGN converts a general Bazel binary expression [0] to GN.
 //
 // [0] https://github.com/bazelbuild/starlark/blob/master/spec.md#binary-operators
@@ -0,0 +1,124 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bazel2gn
+
+import (
+	"fmt"
+
+	"go.starlark.net/syntax"
+)
+
+// comprehensionToGN converts a Bazel list comprehension, e.g.
+// `["lib/" + x for x in ["a.go", "a_test.go"] if not x.endswith("_test.go")]`,
+// to a GN list
+// literal. This only works when the iterable of every `for` clause is a
+// literal list, since GN has no comprehension syntax of its own and so the
+// whole thing must be unrolled and evaluated at conversion time; a
+// comprehension over anything else is rejected with an error naming the
+// unsupported clause, rather than silently producing a wrong or partial
+// list.
+func comprehensionToGN(comp *syntax.Comprehension) ([]string, error) {
+	if comp.Curly {
+		return nil, fmt.Errorf("dict/set comprehensions are not supported, only list comprehensions")
+	}
+
+	elems, err := expandComprehension(comp.Body, comp.Clauses, map[string]syntax.Expr{})
+	if err != nil {
+		return nil, fmt.Errorf("expanding list comprehension: %v", err)
+	}
+	return listExprToGN(&syntax.ListExpr{List: elems}, nil)
+}
+
+// expandComprehension recursively unrolls clauses (for/if, in source order)
+// against subs, the substitutions accumulated from enclosing `for` clauses,
+// and returns the flattened list of body expressions each element of the
+// comprehension evaluates to.
+func expandComprehension(body syntax.Expr, clauses []syntax.Node, subs map[string]syntax.Expr) ([]syntax.Expr, error) {
+	if len(clauses) == 0 {
+		return []syntax.Expr{substituteIdentsInExpr(body, subs)}, nil
+	}
+
+	switch clause := clauses[0].(type) {
+	case *syntax.ForClause:
+		loopVar, ok := clause.Vars.(*syntax.Ident)
+		if !ok {
+			return nil, fmt.Errorf("only a single loop variable is supported in comprehension `for` clauses, got %#v", clause.Vars)
+		}
+		iterable := substituteIdentsInExpr(clause.X, subs)
+		list, ok := iterable.(*syntax.ListExpr)
+		if !ok {
+			return nil, fmt.Errorf("comprehension `for` clause iterates over %T, which isn't a literal list; only constant iterables are supported", iterable)
+		}
+
+		var ret []syntax.Expr
+		for _, elem := range list.List {
+			iterSubs := map[string]syntax.Expr{}
+			for k, v := range subs {
+				iterSubs[k] = v
+			}
+			iterSubs[loopVar.Name] = elem
+			sub, err := expandComprehension(body, clauses[1:], iterSubs)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, sub...)
+		}
+		return ret, nil
+
+	case *syntax.IfClause:
+		cond := substituteIdentsInExpr(clause.Cond, subs)
+		keep, err := evalConstantBool(cond)
+		if err != nil {
+			return nil, fmt.Errorf("comprehension `if` clause: %v", err)
+		}
+		if !keep {
+			return nil, nil
+		}
+		return expandComprehension(body, clauses[1:], subs)
+
+	default:
+		return nil, fmt.Errorf("unsupported comprehension clause of type %T", clause)
+	}
+}
+
+// evalConstantBool evaluates a fully-substituted comprehension `if`
+// condition, supporting the boolean and string-method forms that show up
+// in BUILD.bazel file filtering (`not x.endswith(...)`, `x.startswith(...)`,
+// and the True/False identifiers). Other literals are rejected.
+func evalConstantBool(expr syntax.Expr) (bool, error) {
+	switch v := expr.(type) {
+	case *syntax.UnaryExpr:
+		if v.Op != syntax.NOT {
+			return false, fmt.Errorf("unsupported unary operator %s", v.Op)
+		}
+		inner, err := evalConstantBool(v.X)
+		if err != nil {
+			return false, err
+		}
+		return !inner, nil
+	case *syntax.CallExpr:
+		if _, ok := v.Fn.(*syntax.DotExpr); !ok {
+			return false, fmt.Errorf("unsupported call %#v in comprehension `if` clause, only string methods are supported", v.Fn)
+		}
+		lines, err := stringMethodCallToGN(v)
+		if err != nil {
+			return false, err
+		}
+		if len(lines) != 1 || (lines[0] != "true" && lines[0] != "false") {
+			return false, fmt.Errorf("condition %#v did not evaluate to a constant bool", expr)
+		}
+		return lines[0] == "true", nil
+	case *syntax.Ident:
+		switch v.Name {
+		case "True":
+			return true, nil
+		case "False":
+			return false, nil
+		}
+		return false, fmt.Errorf("unresolved identifier %q in constant comprehension condition", v.Name)
+	default:
+		return false, fmt.Errorf("unsupported expression of type %T in comprehension `if` clause", expr)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bazel2gn
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.starlark.net/syntax"
+)
+
+// locationRE matches Bazel's `$(location :label)`/`$(location //pkg:label)`
+// substitution syntax inside a genrule `cmd` string.
+var locationRE = regexp.MustCompile(`\$\(location\s+([^)]+)\)`)
+
+// genruleCmdToScriptArgs converts a genrule's `cmd` attribute, a shell
+// command string, into the GN action target's `script`/`args` pair. There's
+// no GN template for "run this inline shell string", so the command runs
+// through a hypothetical //build/gn/run_shell_command.sh wrapper that GN
+// invokes with `-c <cmd>`, mirroring how genrule itself runs cmd through
+// `/bin/sh -c`. Any `$(location ...)` reference is rewritten to
+// `rebase_path(<label>, root_build_dir)`, spliced into the command string
+// via GN string concatenation, since GN doesn't interpolate expressions
+// inside string literals the way Bazel's genrule does.
+func genruleCmdToScriptArgs(cmd syntax.Expr) ([]string, error) {
+	lit, ok := cmd.(*syntax.Literal)
+	if !ok || lit.Token != syntax.STRING {
+		return nil, fmt.Errorf("genrule `cmd` must be a string literal, got %T", cmd)
+	}
+	cmdStr := lit.Value.(string)
+
+	locs := locationRE.FindAllStringSubmatchIndex(cmdStr, -1)
+	ret := []string{`script = "//build/gn/run_shell_command.sh"`}
+	if len(locs) == 0 {
+		return append(ret, fmt.Sprintf("args = [ \"-c\", %q ]", cmdStr)), nil
+	}
+
+	// Build the command as a sequence of plain-text and rebase_path(...)
+	// pieces joined with `+`, so the genrule author's $(location) references
+	// keep resolving to real build-output paths after conversion.
+	var pieces []string
+	pos := 0
+	for _, m := range locs {
+		start, end, labelStart, labelEnd := m[0], m[1], m[2], m[3]
+		if start > pos {
+			pieces = append(pieces, fmt.Sprintf("%q", cmdStr[pos:start]))
+		}
+		label := cmdStr[labelStart:labelEnd]
+		pieces = append(pieces, fmt.Sprintf("rebase_path(%q, root_build_dir)", label))
+		pos = end
+	}
+	if pos < len(cmdStr) {
+		pieces = append(pieces, fmt.Sprintf("%q", cmdStr[pos:]))
+	}
+
+	argsLine := "args = [ \"-c\", " + joinWithPlus(pieces) + " ]"
+	return append(ret, argsLine), nil
+}
+
+func joinWithPlus(pieces []string) string {
+	out := pieces[0]
+	for _, p := range pieces[1:] {
+		out += " + " + p
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bazel2gn
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+// GlobStrategy selects how bazel2gn converts a Bazel `glob()` call.
+type GlobStrategy int
+
+const (
+	// GlobLazy emits a GN exec_script() call that resolves the glob at `gn
+	// gen` time, matching how the rest of the GN build already discovers
+	// file lists that aren't known until generation time.
+	GlobLazy GlobStrategy = iota
+	// GlobEager walks globBaseDir at conversion time and inlines the
+	// resulting file list, matching how Bazel itself resolves glob() during
+	// the loading phase.
+	GlobEager
+)
+
+// globStrategy and globBaseDir configure how glob() calls are converted.
+// There's no bazel2gn command-line entry point in this tree yet, so a
+// future `main` package wires its `--glob-strategy`/`--glob-base-dir` flags
+// to SetGlobStrategy before running any conversion.
+var (
+	globStrategy = GlobLazy
+	globBaseDir  string
+)
+
+// SetGlobStrategy configures how subsequent glob() conversions behave.
+// baseDir is only consulted when strategy is GlobEager, and should be the
+// directory the BUILD.bazel file being converted lives in.
+func SetGlobStrategy(strategy GlobStrategy, baseDir string) {
+	globStrategy = strategy
+	globBaseDir = baseDir
+}
+
+// globCallToGN converts a Bazel `glob(include, exclude = [...])` call to GN,
+// either as an exec_script() wrapper (GlobLazy) or an inlined file list
+// (GlobEager).
+func globCallToGN(call *syntax.CallExpr) ([]string, error) {
+	var include []string
+	var exclude []string
+	positionalSeen := false
+	for _, arg := range call.Args {
+		if binExpr, ok := arg.(*syntax.BinaryExpr); ok && binExpr.Op == syntax.EQ {
+			ident, ok := binExpr.X.(*syntax.Ident)
+			if !ok {
+				return nil, fmt.Errorf("unexpected keyword argument to glob(): %#v", binExpr.X)
+			}
+			patterns, err := stringListLiteral(binExpr.Y)
+			if err != nil {
+				return nil, fmt.Errorf("glob() %s argument: %v", ident.Name, err)
+			}
+			switch ident.Name {
+			case "exclude":
+				exclude = patterns
+			case "include":
+				include = patterns
+			default:
+				return nil, fmt.Errorf("unsupported glob() keyword argument %q", ident.Name)
+			}
+			continue
+		}
+		if positionalSeen {
+			return nil, fmt.Errorf("glob() takes at most one positional argument, got a second: %#v", arg)
+		}
+		patterns, err := stringListLiteral(arg)
+		if err != nil {
+			return nil, fmt.Errorf("glob() include argument: %v", err)
+		}
+		include = patterns
+		positionalSeen = true
+	}
+	if len(include) == 0 {
+		return nil, fmt.Errorf("glob() requires at least one include pattern")
+	}
+
+	if globStrategy == GlobEager {
+		return eagerGlobToGN(include, exclude)
+	}
+	return lazyGlobToGN(include, exclude)
+}
+
+// stringListLiteral converts a Bazel list-of-string-literals expression
+// (e.g. `["**/*.go"]`) into plain Go strings, the only form glob()'s
+// arguments support.
+func stringListLiteral(expr syntax.Expr) ([]string, error) {
+	list, ok := expr.(*syntax.ListExpr)
+	if !ok {
+		return nil, fmt.Errorf("expected a list literal, got %T", expr)
+	}
+	var ret []string
+	for _, elem := range list.List {
+		lit, ok := elem.(*syntax.Literal)
+		if !ok || lit.Token != syntax.STRING {
+			return nil, fmt.Errorf("expected a string literal list element, got %#v", elem)
+		}
+		ret = append(ret, lit.Value.(string))
+	}
+	return ret, nil
+}
+
+// lazyGlobToGN emits a GN exec_script() call that defers pattern resolution
+// to `gn gen` time, via a hypothetical //build/gn/glob.py helper script
+// shared by all glob() call sites.
+func lazyGlobToGN(include, exclude []string) ([]string, error) {
+	args := []string{`"--include"`}
+	for _, p := range include {
+		args = append(args, fmt.Sprintf("%q", p))
+	}
+	if len(exclude) > 0 {
+		args = append(args, `"--exclude"`)
+		for _, p := range exclude {
+			args = append(args, fmt.Sprintf("%q", p))
+		}
+	}
+	return []string{fmt.Sprintf(
+		`exec_script("//build/gn/glob.py", [ %s ], "list lines")`,
+		strings.Join(args, ", "),
+	)}, nil
+}
+
+// eagerGlobToGN walks globBaseDir and inlines the matching, sorted, relative
+// file paths as a GN list literal.
+func eagerGlobToGN(include, exclude []string) ([]string, error) {
+	if globBaseDir == "" {
+		return nil, fmt.Errorf("eager glob strategy requires a base directory; call SetGlobStrategy with one")
+	}
+
+	includeRE, err := compileGlobPatterns(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeRE, err := compileGlobPatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(globBaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(globBaseDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchesAny(includeRE, rel) || matchesAny(excludeRE, rel) {
+			return nil
+		}
+		matches = append(matches, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s for glob(): %v", globBaseDir, err)
+	}
+	sort.Strings(matches)
+
+	ret := []string{"["}
+	for _, m := range matches {
+		ret = append(ret, indent([]string{fmt.Sprintf("%q,", m)}, 1)...)
+	}
+	ret = append(ret, "]")
+	return ret, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, path string) bool {
+	for _, re := range patterns {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileGlobPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var ret []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := globPatternToRegexp(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %v", p, err)
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+// globPatternToRegexp translates a Bazel glob pattern into an equivalent
+// anchored regexp: `**` matches any number of path segments (including
+// none), `*` matches within a single segment, and `?` matches one
+// character within a segment.
+func globPatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			if i+2 < len(runes) && runes[i+1] == '*' && runes[i+2] == '/' {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '.', '+', '(', ')', '|', '^', '$', '[', ']', '{', '}', '\\':
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			b.WriteRune(runes[i])
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,295 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package ir defines an intermediate representation for bazel2gn's
+// conversion pipeline, mirroring mk2rbc's node-based approach. bazel2gn
+// lifts an attribute value that contains a select() into this IR, runs
+// independent optimization passes over it (dead-branch removal, constant
+// list folding, select() distribution), then emits GN text from the
+// optimized IR. Other statements and attributes are still converted
+// directly to GN text by exprToGN/callExprToGN, and no pass merges or
+// hoists conditions across attributes.
+//
+// This package knows nothing about Starlark; lifting Bazel syntax into IR
+// is bazel2gn's job. That keeps passes here generic and unit-testable
+// without a syntax tree in hand.
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is any IR node that can be emitted as GN text.
+type Node interface {
+	// isNode is unexported so Node can only be implemented by types in this
+	// package.
+	isNode()
+}
+
+// TargetNode is a single GN target definition, lifted from a Bazel rule
+// invocation (e.g. `go_library(name = "foo", ...)`).
+type TargetNode struct {
+	// GNTemplate is the GN template/function name, e.g. "source_set".
+	GNTemplate string
+	// Name is the already-converted GN target name expression.
+	Name string
+	// Attrs are the target's attribute assignments, in source order.
+	Attrs []Node
+	// Conditions, when non-empty, causes the whole target to be wrapped in
+	// `if (Conditions[0] && Conditions[1] && ...) { ... }`, mirroring Bazel's
+	// target_compatible_with.
+	Conditions []string
+}
+
+func (*TargetNode) isNode() {}
+
+// AssignNode is a single attribute assignment or append, e.g. `sources =
+// [...]` or `sources += [...]`.
+type AssignNode struct {
+	Name  string
+	Op    string // "=" or "+="
+	Value Node
+}
+
+func (*AssignNode) isNode() {}
+
+// IfNode is a GN `if`/`else` block.
+type IfNode struct {
+	Cond string
+	Then []Node
+	Else []Node
+}
+
+func (*IfNode) isNode() {}
+
+// ForeachNode is a GN `foreach` loop.
+type ForeachNode struct {
+	Var      string
+	Iterable Node
+	Body     []Node
+}
+
+func (*ForeachNode) isNode() {}
+
+// SelectBranch is one arm of a SelectNode: either a condition and the value
+// that applies under it, or the `//conditions:default` fallback.
+type SelectBranch struct {
+	Condition string
+	IsDefault bool
+	Value     Node
+}
+
+// SelectNode is a Bazel select() lifted to IR, still holding its condition
+// branches; the DistributeSelect pass lowers it into AssignNode(s) plus
+// IfNode(s) before Emit, which rejects an unlowered SelectNode.
+type SelectNode struct {
+	Branches []SelectBranch
+}
+
+func (*SelectNode) isNode() {}
+
+// ConcatNode is an ordered sequence of terms joined by Bazel `+`
+// concatenation at the top level of an attribute value, e.g. `["a"] +
+// select({...}) + ["b"]`. It only ever appears as an AssignNode's Value,
+// and must be lowered (by passes.DistributeSelect, after
+// passes.FoldConstantConcat has merged adjacent ListNode terms) before Emit
+// is called.
+type ConcatNode struct {
+	Terms []Node
+}
+
+func (*ConcatNode) isNode() {}
+
+// ListNode is a GN list literal.
+type ListNode struct {
+	Elems []Node
+}
+
+func (*ListNode) isNode() {}
+
+// LiteralNode is an already-rendered, possibly multi-line, GN text blob.
+// Most leaf expressions (string/bool literals, identifiers, dep labels)
+// reach the IR in this form, since bazel2gn's existing expression-level
+// converters already produce correct GN text for them.
+type LiteralNode struct {
+	Lines []string
+}
+
+func (*LiteralNode) isNode() {}
+
+// CallNode is a GN function/template call, e.g. `exec_script(...)`.
+type CallNode struct {
+	Name string
+	Args []Node
+}
+
+func (*CallNode) isNode() {}
+
+// DepNode is a single dependency label.
+type DepNode struct {
+	Label string
+}
+
+func (*DepNode) isNode() {}
+
+// VisibilityNode is a single converted GN visibility pattern.
+type VisibilityNode struct {
+	Pattern string
+}
+
+func (*VisibilityNode) isNode() {}
+
+const indentPrefix = "  "
+
+func indent(lines []string, level int) []string {
+	if level == 0 {
+		return lines
+	}
+	prefix := strings.Repeat(indentPrefix, level)
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = prefix + l
+	}
+	return out
+}
+
+// Emit renders nodes as GN text.
+func Emit(nodes []Node) ([]string, error) {
+	var ret []string
+	for _, n := range nodes {
+		lines, err := emitNode(n)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, lines...)
+	}
+	return ret, nil
+}
+
+func emitNode(n Node) ([]string, error) {
+	switch v := n.(type) {
+	case *TargetNode:
+		return emitTarget(v)
+	case *AssignNode:
+		return emitAssign(v)
+	case *IfNode:
+		return emitIf(v)
+	case *ForeachNode:
+		return emitForeach(v)
+	case *SelectNode:
+		return nil, fmt.Errorf("unlowered select() reached Emit; run the distributeSelect pass first")
+	case *ConcatNode:
+		return nil, fmt.Errorf("unlowered concatenation reached Emit; run the distributeSelect pass first")
+	case *ListNode:
+		return emitList(v)
+	case *LiteralNode:
+		return v.Lines, nil
+	case *CallNode:
+		return emitCall(v)
+	case *DepNode:
+		return []string{v.Label}, nil
+	case *VisibilityNode:
+		return []string{v.Pattern}, nil
+	default:
+		return nil, fmt.Errorf("unsupported IR node type %T", n)
+	}
+}
+
+func emitTarget(t *TargetNode) ([]string, error) {
+	ret := []string{fmt.Sprintf("%s(%s) {", t.GNTemplate, t.Name)}
+	for _, attr := range t.Attrs {
+		lines, err := emitNode(attr)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, indent(lines, 1)...)
+	}
+	ret = append(ret, "}")
+	if len(t.Conditions) > 0 {
+		ret = append([]string{fmt.Sprintf("if (%s) {", strings.Join(t.Conditions, " && "))}, indent(ret, 1)...)
+		ret = append(ret, "}")
+	}
+	return ret, nil
+}
+
+func emitAssign(a *AssignNode) ([]string, error) {
+	lines, err := emitNode(a.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	ret := append([]string{}, lines...)
+	ret[0] = fmt.Sprintf("%s %s %s", a.Name, a.Op, ret[0])
+	return ret, nil
+}
+
+func emitIf(i *IfNode) ([]string, error) {
+	ret := []string{fmt.Sprintf("if (%s) {", i.Cond)}
+	thenLines, err := Emit(i.Then)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, indent(thenLines, 1)...)
+	if len(i.Else) > 0 {
+		ret = append(ret, "} else {")
+		elseLines, err := Emit(i.Else)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, indent(elseLines, 1)...)
+	}
+	ret = append(ret, "}")
+	return ret, nil
+}
+
+func emitForeach(f *ForeachNode) ([]string, error) {
+	iterLines, err := emitNode(f.Iterable)
+	if err != nil {
+		return nil, err
+	}
+	if len(iterLines) != 1 {
+		return nil, fmt.Errorf("foreach iterable must render on a single line, got %d", len(iterLines))
+	}
+	ret := []string{fmt.Sprintf("foreach(%s, %s) {", f.Var, iterLines[0])}
+	bodyLines, err := Emit(f.Body)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, indent(bodyLines, 1)...)
+	ret = append(ret, "}")
+	return ret, nil
+}
+
+func emitList(l *ListNode) ([]string, error) {
+	ret := []string{"["}
+	for _, elem := range l.Elems {
+		lines, err := emitNode(elem)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		lines = append([]string{}, lines...)
+		lines[len(lines)-1] += ","
+		ret = append(ret, indent(lines, 1)...)
+	}
+	ret = append(ret, "]")
+	return ret, nil
+}
+
+func emitCall(c *CallNode) ([]string, error) {
+	var argStrs []string
+	for _, a := range c.Args {
+		lines, err := emitNode(a)
+		if err != nil {
+			return nil, err
+		}
+		argStrs = append(argStrs, strings.Join(lines, "\n"))
+	}
+	return []string{fmt.Sprintf("%s(%s)", c.Name, strings.Join(argStrs, ", "))}, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package passes
+
+import "go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+
+// RemoveDeadBranches drops select() branches that can never be taken: a
+// branch whose condition is a literal "false", and any branch after one
+// whose condition is a literal "true" (which always wins, making later
+// branches and the default unreachable).
+func RemoveDeadBranches(attrs []ir.Node) ([]ir.Node, error) {
+	var out []ir.Node
+	for _, n := range attrs {
+		out = append(out, removeDeadBranchesFromNode(n))
+	}
+	return out, nil
+}
+
+func removeDeadBranchesFromNode(n ir.Node) ir.Node {
+	a, ok := n.(*ir.AssignNode)
+	if !ok {
+		return n
+	}
+	concat, ok := a.Value.(*ir.ConcatNode)
+	if !ok {
+		return n
+	}
+	newTerms := make([]ir.Node, len(concat.Terms))
+	for i, t := range concat.Terms {
+		sel, ok := t.(*ir.SelectNode)
+		if !ok {
+			newTerms[i] = t
+			continue
+		}
+		newTerms[i] = &ir.SelectNode{Branches: pruneBranches(sel.Branches)}
+	}
+	return &ir.AssignNode{Name: a.Name, Op: a.Op, Value: &ir.ConcatNode{Terms: newTerms}}
+}
+
+func pruneBranches(branches []ir.SelectBranch) []ir.SelectBranch {
+	var kept []ir.SelectBranch
+	for _, b := range branches {
+		if b.Condition == "false" {
+			continue
+		}
+		kept = append(kept, b)
+		if b.Condition == "true" {
+			// Every later branch, including the default, is unreachable.
+			break
+		}
+	}
+	return kept
+}
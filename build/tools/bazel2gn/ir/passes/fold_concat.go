@@ -0,0 +1,52 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package passes
+
+import "go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+
+// FoldConstantConcat merges adjacent ListNode terms of a ConcatNode into a
+// single ListNode, e.g. `["a"] + ["b"]` folds to `["a", "b"]` before
+// select() distribution runs. This keeps DistributeSelect's output free of
+// the redundant `attr += []` lines that a naive term-by-term lowering would
+// otherwise produce for every literal list segment.
+func FoldConstantConcat(attrs []ir.Node) ([]ir.Node, error) {
+	var out []ir.Node
+	for _, n := range attrs {
+		out = append(out, foldConcatNode(n))
+	}
+	return out, nil
+}
+
+func foldConcatNode(n ir.Node) ir.Node {
+	a, ok := n.(*ir.AssignNode)
+	if !ok {
+		return n
+	}
+	concat, ok := a.Value.(*ir.ConcatNode)
+	if !ok {
+		return n
+	}
+
+	var folded []ir.Node
+	for _, t := range concat.Terms {
+		list, ok := t.(*ir.ListNode)
+		if !ok {
+			folded = append(folded, t)
+			continue
+		}
+		if len(folded) > 0 {
+			if prevList, ok := folded[len(folded)-1].(*ir.ListNode); ok {
+				folded[len(folded)-1] = &ir.ListNode{Elems: append(append([]ir.Node{}, prevList.Elems...), list.Elems...)}
+				continue
+			}
+		}
+		folded = append(folded, list)
+	}
+
+	if len(folded) == 1 {
+		return &ir.AssignNode{Name: a.Name, Op: a.Op, Value: folded[0]}
+	}
+	return &ir.AssignNode{Name: a.Name, Op: a.Op, Value: &ir.ConcatNode{Terms: folded}}
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package passes holds bazel2gn's IR optimization passes and the registry
+// that lets project-specific transforms (e.g. a third-party crate path
+// rewrite) be registered as independent, testable passes instead of living
+// as inline transformers deep in the converter.
+package passes
+
+import "go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+
+// Pass transforms a target's attribute nodes, returning the replacement
+// list. Passes run in registration order; each sees the output of the
+// previous one.
+type Pass func(attrs []ir.Node) ([]ir.Node, error)
+
+var registry []namedPass
+
+type namedPass struct {
+	name string
+	pass Pass
+}
+
+// Register adds a pass to the default pipeline run by Run. Registering the
+// same name twice replaces the earlier entry, so a project can override a
+// built-in pass by name if needed.
+func Register(name string, p Pass) {
+	for i, np := range registry {
+		if np.name == name {
+			registry[i].pass = p
+			return
+		}
+	}
+	registry = append(registry, namedPass{name: name, pass: p})
+}
+
+// Run applies every registered pass, in registration order, to attrs.
+func Run(attrs []ir.Node) ([]ir.Node, error) {
+	var err error
+	for _, np := range registry {
+		attrs, err = np.pass(attrs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+func init() {
+	Register("remove-dead-branches", RemoveDeadBranches)
+	Register("fold-constant-concat", FoldConstantConcat)
+	Register("distribute-select", DistributeSelect)
+}
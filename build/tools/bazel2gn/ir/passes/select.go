@@ -0,0 +1,119 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package passes
+
+import (
+	"errors"
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+)
+
+// DistributeSelect lowers every AssignNode whose Value is a *ir.ConcatNode
+// (i.e. it involves one or more select() terms) into a base `attr = [...]`
+// assignment followed by `attr += [...]` appends and if/else-if/else
+// blocks, one per select(). An attribute whose Value isn't a ConcatNode is
+// left untouched.
+func DistributeSelect(attrs []ir.Node) ([]ir.Node, error) {
+	var out []ir.Node
+	for _, n := range attrs {
+		a, ok := n.(*ir.AssignNode)
+		if !ok {
+			out = append(out, n)
+			continue
+		}
+		concat, ok := a.Value.(*ir.ConcatNode)
+		if !ok {
+			out = append(out, n)
+			continue
+		}
+		lowered, err := distributeConcat(a.Name, concat)
+		if err != nil {
+			return nil, fmt.Errorf("distributing select() for attribute %q: %w", a.Name, err)
+		}
+		out = append(out, lowered...)
+	}
+	return out, nil
+}
+
+func distributeConcat(attrName string, concat *ir.ConcatNode) ([]ir.Node, error) {
+	terms := concat.Terms
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("attribute has an empty value")
+	}
+
+	var out []ir.Node
+	remaining := terms
+	if _, ok := terms[0].(*ir.SelectNode); ok {
+		out = append(out, &ir.AssignNode{Name: attrName, Op: "=", Value: &ir.ListNode{}})
+	} else {
+		out = append(out, &ir.AssignNode{Name: attrName, Op: "=", Value: terms[0]})
+		remaining = terms[1:]
+	}
+
+	for _, term := range remaining {
+		sel, ok := term.(*ir.SelectNode)
+		if !ok {
+			out = append(out, &ir.AssignNode{Name: attrName, Op: "+=", Value: term})
+			continue
+		}
+		node, err := selectToIf(attrName, sel)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			out = append(out, node)
+		}
+	}
+	return out, nil
+}
+
+// selectToIf lowers a single SelectNode into an IfNode chain appending to
+// attrName under each condition, or nil if the select is a no-op (every
+// branch removed by RemoveDeadBranches).
+func selectToIf(attrName string, sel *ir.SelectNode) (ir.Node, error) {
+	var conds []ir.SelectBranch
+	var def *ir.SelectBranch
+	for _, b := range sel.Branches {
+		if b.IsDefault {
+			if def != nil {
+				return nil, errors.New("select() has more than one //conditions:default entry")
+			}
+			b := b
+			def = &b
+			continue
+		}
+		conds = append(conds, b)
+	}
+
+	if len(conds) == 0 {
+		if def == nil {
+			return nil, nil
+		}
+		return &ir.AssignNode{Name: attrName, Op: "+=", Value: def.Value}, nil
+	}
+
+	// Build the if/else-if/else chain from the innermost (last) branch out,
+	// so the result nests correctly as a single IfNode tree.
+	var elseBody []ir.Node
+	if def != nil {
+		elseBody = []ir.Node{&ir.AssignNode{Name: attrName, Op: "+=", Value: def.Value}}
+	}
+
+	var root *ir.IfNode
+	for i := len(conds) - 1; i >= 0; i-- {
+		b := conds[i]
+		node := &ir.IfNode{
+			Cond: b.Condition,
+			Then: []ir.Node{&ir.AssignNode{Name: attrName, Op: "+=", Value: b.Value}},
+			Else: elseBody,
+		}
+		if root != nil {
+			node.Else = []ir.Node{root}
+		}
+		root = node
+	}
+	return root, nil
+}
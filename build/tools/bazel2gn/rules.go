@@ -0,0 +1,109 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bazel2gn
+
+// RuleSpec describes how to convert one Bazel rule kind to GN: which GN
+// template it becomes, and how its attributes map over. callExprToGN
+// dispatches every target through the RuleSpec registered for its Bazel
+// rule name (see RegisterRule), so renaming, omitting, defaulting, or
+// otherwise transforming an attribute for a given rule is a matter of
+// registering a RuleSpec rather than special-casing callExprToGN itself.
+type RuleSpec struct {
+	// GNTemplate is the GN template/function name this rule converts to.
+	GNTemplate string
+	// AttrRename maps a Bazel attribute name to its GN equivalent, e.g.
+	// cc_library's "hdrs" -> "public".
+	AttrRename map[string]string
+	// AttrOmit lists Bazel attribute names (as written in Bazel, before
+	// AttrRename) to drop entirely rather than convert.
+	AttrOmit map[string]bool
+	// AttrDefault supplies already-converted GN text for an attribute (keyed
+	// by its Bazel name, before AttrRename) that should be emitted when the
+	// Bazel call didn't set it at all.
+	AttrDefault map[string]string
+	// RequiredAttrs lists Bazel attribute names that must be present on
+	// every instance of this rule; callExprToGN rejects a target missing one
+	// with a clear error rather than emitting a broken GN target.
+	RequiredAttrs []string
+	// Transformers are extra, rule-specific transformers applied to an
+	// attribute's value (keyed by its Bazel name, before AttrRename), in
+	// addition to the built-in visibility/deps transformers every rule gets.
+	Transformers map[string][]transformer
+}
+
+var ruleRegistry = map[string]RuleSpec{}
+
+// RegisterRule adds (or replaces) the RuleSpec used to convert bazelName
+// targets. Project-specific rules should call this from an init() in their
+// own package rather than requiring a change to bazel2gn itself.
+func RegisterRule(bazelName string, spec RuleSpec) {
+	ruleRegistry[bazelName] = spec
+}
+
+// ruleSpec looks up the RuleSpec for a Bazel rule name, reporting whether
+// the rule is known at all.
+func ruleSpec(bazelName string) (RuleSpec, bool) {
+	spec, ok := ruleRegistry[bazelName]
+	return spec, ok
+}
+
+// cLikeAttrRename is shared by the cc_* rules: all three take the same
+// hdrs/copts/linkopts attributes with the same GN equivalents.
+var cLikeAttrRename = map[string]string{
+	"hdrs":     "public",
+	"copts":    "cflags",
+	"linkopts": "ldflags",
+}
+
+func init() {
+	// Rules that map straight across with no per-attribute customization.
+	for bazelRule, gnTemplate := range map[string]string{
+		"go_binary":          "go_binary",
+		"go_test":            "go_test",
+		"install_host_tools": "install_host_tools",
+		"package":            "package",
+		"rust_binary":        "rustc_binary",
+		"rust_library":       "rustc_library",
+		"rustc_binary":       "rustc_binary",
+		"rustc_library":      "rustc_library",
+		"rust_proc_macro":    "rustc_macro",
+		"sdk_host_tool":      "sdk_host_tool",
+		"proto_library":      "proto_library",
+		"fuchsia_package":    "fuchsia_package",
+	} {
+		RegisterRule(bazelRule, RuleSpec{GNTemplate: gnTemplate})
+	}
+
+	RegisterRule("go_library", RuleSpec{
+		GNTemplate: "go_library",
+		AttrOmit: map[string]bool{
+			// In GN we default cgo to true when compiling Go code, and
+			// explicitly disable it in very few places. However, in Bazel,
+			// cgo defaults to false, and requires users to explicitly set it
+			// when C sources are included.
+			"cgo": true,
+		},
+	})
+
+	RegisterRule("cc_library", RuleSpec{GNTemplate: "source_set", AttrRename: cLikeAttrRename})
+	RegisterRule("cc_binary", RuleSpec{GNTemplate: "executable", AttrRename: cLikeAttrRename})
+	RegisterRule("cc_test", RuleSpec{GNTemplate: "test", AttrRename: cLikeAttrRename})
+
+	RegisterRule("filegroup", RuleSpec{
+		GNTemplate: "group",
+		AttrRename: map[string]string{"srcs": "public_deps"},
+	})
+
+	RegisterRule("genrule", RuleSpec{
+		GNTemplate:    "action",
+		RequiredAttrs: []string{"cmd", "outs"},
+		AttrRename:    map[string]string{"outs": "outputs"},
+		// genrule's "cmd" is a shell command string, but GN's action target
+		// runs a script; callExprToGN special-cases "cmd" into the
+		// "script"/"args" pair (see genruleCmdToScriptArgs) rather than
+		// converting it as a normal attribute.
+		AttrOmit: map[string]bool{"cmd": true},
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bazel2gn
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+// gnStringMethods maps a Bazel string method name to the GN helper function
+// that implements it at generation time, for calls whose receiver isn't a
+// compile-time constant (and so can't be folded by
+// constantStringMethodCall). These are hypothetical //build/gn helpers
+// mirrored 1:1 on the Bazel methods they replace.
+var gnStringMethods = map[string]string{
+	"replace":    "string_replace",
+	"startswith": "string_starts_with",
+	"endswith":   "string_ends_with",
+}
+
+// stringMethodCallToGN converts a Bazel string method call, e.g.
+// `x.replace("a", "b")` or `"lib/{}".format("a.go")` on a constant receiver,
+// to GN. expr.Fn must be a *syntax.DotExpr naming one of the methods this
+// function supports.
+func stringMethodCallToGN(expr *syntax.CallExpr) ([]string, error) {
+	dot := expr.Fn.(*syntax.DotExpr)
+
+	if recvLit, ok := dot.X.(*syntax.Literal); ok && recvLit.Token == syntax.STRING {
+		folded, ok, err := constantStringMethodCall(recvLit.Value.(string), dot.Name.Name, expr.Args)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return []string{folded}, nil
+		}
+	}
+
+	gnFn, ok := gnStringMethods[dot.Name.Name]
+	if !ok {
+		return nil, fmt.Errorf("string method %q is not supported on a non-constant receiver; add it to gnStringMethods", dot.Name.Name)
+	}
+
+	recvLines, err := exprToGN(dot.X, nil)
+	if err != nil {
+		return nil, fmt.Errorf("converting receiver of .%s(): %v", dot.Name.Name, err)
+	}
+	if len(recvLines) != 1 {
+		return nil, fmt.Errorf("receiver of .%s() must convert to a single line", dot.Name.Name)
+	}
+
+	args := []string{recvLines[0]}
+	for _, a := range expr.Args {
+		argLines, err := exprToGN(a, nil)
+		if err != nil {
+			return nil, fmt.Errorf("converting argument to .%s(): %v", dot.Name.Name, err)
+		}
+		if len(argLines) != 1 {
+			return nil, fmt.Errorf("argument to .%s() must convert to a single line", dot.Name.Name)
+		}
+		args = append(args, argLines[0])
+	}
+	return []string{fmt.Sprintf("%s(%s)", gnFn, strings.Join(args, ", "))}, nil
+}
+
+// constantStringMethodCall evaluates a string method call directly when
+// recv is a literal string, so e.g. `"a_test.go".endswith("_test.go")` folds
+// to `true` rather than surfacing as a GN runtime call. The returned string
+// is already final GN text (quoted for a string result, bare for a bool
+// one); ok is false when method isn't one this function knows how to fold.
+// An argument that isn't a string literal is an error, whatever the method.
+func constantStringMethodCall(recv, method string, args []syntax.Expr) (gnLiteral string, ok bool, err error) {
+	strArgs := make([]string, len(args))
+	for i, a := range args {
+		lit, ok := a.(*syntax.Literal)
+		if !ok || lit.Token != syntax.STRING {
+			return "", false, fmt.Errorf("argument %d to .%s() must be a string literal to fold a constant receiver, got %#v", i, method, a)
+		}
+		strArgs[i] = lit.Value.(string)
+	}
+
+	switch method {
+	case "format":
+		out := recv
+		for _, a := range strArgs {
+			out = strings.Replace(out, "{}", a, 1)
+		}
+		return fmt.Sprintf("%q", out), true, nil
+	case "replace":
+		if len(strArgs) != 2 {
+			return "", false, fmt.Errorf(".replace() requires exactly 2 arguments, got %d", len(strArgs))
+		}
+		return fmt.Sprintf("%q", strings.ReplaceAll(recv, strArgs[0], strArgs[1])), true, nil
+	case "startswith":
+		if len(strArgs) != 1 {
+			return "", false, fmt.Errorf(".startswith() requires exactly 1 argument, got %d", len(strArgs))
+		}
+		return fmt.Sprintf("%v", strings.HasPrefix(recv, strArgs[0])), true, nil
+	case "endswith":
+		if len(strArgs) != 1 {
+			return "", false, fmt.Errorf(".endswith() requires exactly 1 argument, got %d", len(strArgs))
+		}
+		return fmt.Sprintf("%v", strings.HasSuffix(recv, strArgs[0])), true, nil
+	case "upper":
+		return fmt.Sprintf("%q", strings.ToUpper(recv)), true, nil
+	case "lower":
+		return fmt.Sprintf("%q", strings.ToLower(recv)), true, nil
+	default:
+		return "", false, nil
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gn2bazel
+
+// Stmt is a parsed GN statement.
+type Stmt interface{ isStmt() }
+
+// CallStmt is a target or template invocation: `name(args) { body }`.
+type CallStmt struct {
+	Name string
+	Args []Expr
+	Body []Stmt
+}
+
+func (*CallStmt) isStmt() {}
+
+// AssignStmt is a scope-level `name = value` or `name += value`.
+type AssignStmt struct {
+	Name  string
+	Op    string
+	Value Expr
+}
+
+func (*AssignStmt) isStmt() {}
+
+// IfStmt is a GN `if`/`else` block. Cond is the condition rendered as a
+// single GN expression string (e.g. `target_cpu == "arm64"`), since that's
+// the form both configLabelToGNCondition and GNConditionToConfigLabel key
+// on.
+type IfStmt struct {
+	Cond string
+	Then []Stmt
+	Else []Stmt
+}
+
+func (*IfStmt) isStmt() {}
+
+// Expr is a parsed GN expression.
+type Expr interface{ isExpr() }
+
+// Literal is a string or bool literal.
+type Literal struct {
+	Str      string
+	IsString bool
+}
+
+func (*Literal) isExpr() {}
+
+// Ident is a bare identifier reference.
+type Ident struct {
+	Name string
+}
+
+func (*Ident) isExpr() {}
+
+// ListExpr is a GN list literal.
+type ListExpr struct {
+	Elems []Expr
+}
+
+func (*ListExpr) isExpr() {}
@@ -0,0 +1,111 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gn2bazel
+
+import (
+	"fmt"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn"
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+)
+
+const indentPrefix = "    "
+
+func indent(lines []string, level int) []string {
+	if level == 0 {
+		return lines
+	}
+	prefix := strings.Repeat(indentPrefix, level)
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = prefix + l
+	}
+	return out
+}
+
+// Emit renders IR nodes (as produced by Lift) as Bazel/Starlark text.
+func Emit(nodes []ir.Node) ([]string, error) {
+	var ret []string
+	for _, n := range nodes {
+		switch v := n.(type) {
+		case *ir.TargetNode:
+			lines, err := emitTarget(v)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, lines...)
+		case *ir.AssignNode:
+			lines, err := emitValue(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			lines[0] = fmt.Sprintf("%s = %s", v.Name, lines[0])
+			ret = append(ret, lines...)
+		default:
+			return nil, fmt.Errorf("unsupported top-level IR node of type %T", n)
+		}
+		ret = append(ret, "")
+	}
+	return ret, nil
+}
+
+func emitTarget(t *ir.TargetNode) ([]string, error) {
+	bazelRule, ok := bazel2gn.GNTemplateToBazelRule()[t.GNTemplate]
+	if !ok {
+		return nil, fmt.Errorf("no known Bazel rule for GN template %q; register one with bazel2gn.RegisterRule", t.GNTemplate)
+	}
+
+	ret := []string{fmt.Sprintf("%s(", bazelRule)}
+	ret = append(ret, indent([]string{fmt.Sprintf("name = %s,", t.Name)}, 1)...)
+
+	groups, err := groupAttrs(t.Attrs)
+	if err != nil {
+		return nil, fmt.Errorf("reconstructing attributes of target %s: %v", t.Name, err)
+	}
+	for _, g := range groups {
+		lines, err := emitAttrGroup(g)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, indent(lines, 1)...)
+	}
+
+	if len(t.Conditions) > 0 {
+		if len(t.Conditions) != 1 {
+			return nil, fmt.Errorf("target %s has more than one wrapping condition, which has no single-label Bazel equivalent", t.Name)
+		}
+		label, ok := bazel2gn.GNConditionToConfigLabel()[t.Conditions[0]]
+		if !ok {
+			return nil, fmt.Errorf("no known Bazel config_setting label for GN condition %q; add it to configLabelToGNCondition", t.Conditions[0])
+		}
+		ret = append(ret, indent([]string{fmt.Sprintf("target_compatible_with = [%s],", label)}, 1)...)
+	}
+
+	ret = append(ret, ")")
+	return ret, nil
+}
+
+func emitValue(n ir.Node) ([]string, error) {
+	switch v := n.(type) {
+	case *ir.LiteralNode:
+		return append([]string{}, v.Lines...), nil
+	case *ir.ListNode:
+		ret := []string{"["}
+		for _, e := range v.Elems {
+			lines, err := emitValue(e)
+			if err != nil {
+				return nil, err
+			}
+			lines = append([]string{}, lines...)
+			lines[len(lines)-1] += ","
+			ret = append(ret, indent(lines, 1)...)
+		}
+		ret = append(ret, "]")
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute value node of type %T", n)
+	}
+}
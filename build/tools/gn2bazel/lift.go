@@ -0,0 +1,162 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gn2bazel
+
+import (
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+)
+
+// Lift converts parsed GN statements into bazel2gn's shared IR, the same
+// node set bazel2gn's own select()-lowering passes operate on. Only the
+// shapes gn2bazel knows how to turn back into Bazel show up here: target
+// invocations (optionally wrapped in a single `if` for
+// target_compatible_with), their attribute assignments, and the `if`/
+// `else if`/`else` chains bazel2gn's own DistributeSelect pass produces
+// when lowering a select().
+func Lift(stmts []Stmt) ([]ir.Node, error) {
+	var nodes []ir.Node
+	for _, stmt := range stmts {
+		switch v := stmt.(type) {
+		case *CallStmt:
+			target, err := liftTarget(v)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, target)
+		case *AssignStmt:
+			node, err := liftAssign(v)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case *IfStmt:
+			target, err := liftConditionalTarget(v)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, target)
+		default:
+			return nil, fmt.Errorf("unsupported top-level GN statement of type %T", stmt)
+		}
+	}
+	return nodes, nil
+}
+
+// liftConditionalTarget lifts `if (cond) { single_target(...) { ... } }`,
+// the GN shape bazel2gn emits for a Bazel `target_compatible_with`. Any
+// `else` branch, or a `then` body that isn't exactly one target
+// invocation, is rejected: gn2bazel has no Bazel equivalent for it.
+func liftConditionalTarget(stmt *IfStmt) (*ir.TargetNode, error) {
+	if len(stmt.Else) != 0 {
+		return nil, fmt.Errorf("top-level `if` with an `else` branch has no Bazel equivalent (target_compatible_with is unconditional-or-absent)")
+	}
+	if len(stmt.Then) != 1 {
+		return nil, fmt.Errorf("top-level `if` must wrap exactly one target invocation, got %d statements", len(stmt.Then))
+	}
+	call, ok := stmt.Then[0].(*CallStmt)
+	if !ok {
+		return nil, fmt.Errorf("top-level `if` must wrap a target invocation, got %T", stmt.Then[0])
+	}
+	target, err := liftTarget(call)
+	if err != nil {
+		return nil, err
+	}
+	target.Conditions = []string{stmt.Cond}
+	return target, nil
+}
+
+func liftTarget(stmt *CallStmt) (*ir.TargetNode, error) {
+	if len(stmt.Args) != 1 {
+		return nil, fmt.Errorf("target invocation %q must take exactly one argument (its name), got %d", stmt.Name, len(stmt.Args))
+	}
+	nameLit, ok := stmt.Args[0].(*Literal)
+	if !ok || !nameLit.IsString {
+		return nil, fmt.Errorf("target invocation %q's argument must be a string literal name, got %#v", stmt.Name, stmt.Args[0])
+	}
+
+	attrs := make([]ir.Node, 0, len(stmt.Body))
+	for _, bodyStmt := range stmt.Body {
+		node, err := liftBodyStmt(bodyStmt)
+		if err != nil {
+			return nil, fmt.Errorf("lifting body of target %q: %v", nameLit.Str, err)
+		}
+		attrs = append(attrs, node)
+	}
+
+	return &ir.TargetNode{
+		GNTemplate: stmt.Name,
+		Name:       fmt.Sprintf("%q", nameLit.Str),
+		Attrs:      attrs,
+	}, nil
+}
+
+func liftBodyStmt(stmt Stmt) (ir.Node, error) {
+	switch v := stmt.(type) {
+	case *AssignStmt:
+		return liftAssign(v)
+	case *IfStmt:
+		return liftIf(v)
+	default:
+		return nil, fmt.Errorf("unsupported statement of type %T inside a target body", stmt)
+	}
+}
+
+func liftAssign(stmt *AssignStmt) (*ir.AssignNode, error) {
+	value, err := liftExpr(stmt.Value)
+	if err != nil {
+		return nil, fmt.Errorf("lifting value of %q: %v", stmt.Name, err)
+	}
+	return &ir.AssignNode{Name: stmt.Name, Op: stmt.Op, Value: value}, nil
+}
+
+func liftIf(stmt *IfStmt) (*ir.IfNode, error) {
+	then, err := liftStmtSlice(stmt.Then)
+	if err != nil {
+		return nil, err
+	}
+	els, err := liftStmtSlice(stmt.Else)
+	if err != nil {
+		return nil, err
+	}
+	return &ir.IfNode{Cond: stmt.Cond, Then: then, Else: els}, nil
+}
+
+func liftStmtSlice(stmts []Stmt) ([]ir.Node, error) {
+	var ret []ir.Node
+	for _, s := range stmts {
+		node, err := liftBodyStmt(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, node)
+	}
+	return ret, nil
+}
+
+func liftExpr(expr Expr) (ir.Node, error) {
+	switch v := expr.(type) {
+	case *Literal:
+		if v.IsString {
+			return &ir.LiteralNode{Lines: []string{fmt.Sprintf("%q", v.Str)}}, nil
+		}
+		return &ir.LiteralNode{Lines: []string{v.Str}}, nil
+	case *Ident:
+		return &ir.LiteralNode{Lines: []string{v.Name}}, nil
+	case *ListExpr:
+		elems := make([]ir.Node, len(v.Elems))
+		for i, e := range v.Elems {
+			node, err := liftExpr(e)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = node
+		}
+		return &ir.ListNode{Elems: elems}, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression of type %T", expr)
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package gn2bazel converts GN BUILD.gn files back to Bazel BUILD.bazel
+// files, the inverse of bazel2gn. It supports the subset of GN in active
+// use for targets bazel2gn itself can produce: `template(name) { ... }`
+// invocations (including the built-in target types bazel2gn already knows,
+// such as `source_set`/`executable`), `if`/`else` conditionals, and simple
+// scope-level variable assignment. There's no general GN interpreter here
+// (no `import()`, no user-defined templates, no `exec_script`) — anything
+// outside that subset is reported as a parse or lift error rather than
+// silently dropped.
+package gn2bazel
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokPunct // one of ( ) { } [ ] , = + += == && || !
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex tokenizes GN source, stripping `#` line comments.
+func lex(src string) ([]token, error) {
+	var toks []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					sb.WriteRune(runes[j+1])
+					j += 2
+					continue
+				}
+				sb.WriteRune(runes[j])
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string literal starting at offset %d", i)
+			}
+			toks = append(toks, token{tokString, sb.String()})
+			i = j + 1
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, string(runes[i:j])})
+			i = j
+		case strings.ContainsRune("(){}[],!", c):
+			toks = append(toks, token{tokPunct, string(c)})
+			i++
+		case c == '=':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				toks = append(toks, token{tokPunct, "=="})
+				i += 2
+			} else {
+				toks = append(toks, token{tokPunct, "="})
+				i++
+			}
+		case c == '+':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				toks = append(toks, token{tokPunct, "+="})
+				i += 2
+			} else {
+				toks = append(toks, token{tokPunct, "+"})
+				i++
+			}
+		case c == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			toks = append(toks, token{tokPunct, "&&"})
+			i += 2
+		case c == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			toks = append(toks, token{tokPunct, "||"})
+			i += 2
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tokEOF}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expectPunct(s string) error {
+	t := p.next()
+	if t.kind != tokPunct || t.text != s {
+		return fmt.Errorf("expected %q, got %q", s, t.text)
+	}
+	return nil
+}
+
+// ParseFile parses GN source into a sequence of top-level statements.
+func ParseFile(src string) ([]Stmt, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizing GN source: %v", err)
+	}
+	p := &parser{toks: toks}
+	stmts, err := p.parseStmts()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected trailing token %q", p.peek().text)
+	}
+	return stmts, nil
+}
+
+// parseStmts parses statements until `}` or EOF.
+func (p *parser) parseStmts() ([]Stmt, error) {
+	var stmts []Stmt
+	for {
+		t := p.peek()
+		if t.kind == tokEOF || (t.kind == tokPunct && t.text == "}") {
+			return stmts, nil
+		}
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+}
+
+func (p *parser) parseStmt() (Stmt, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("expected a statement, got %q", t.text)
+	}
+
+	if t.text == "if" {
+		return p.parseIf()
+	}
+
+	// Either `name(args) { body }` (a target/template invocation) or
+	// `name = value` / `name += value` (an assignment).
+	name := p.next().text
+	switch p.peek() {
+	case token{tokPunct, "("}:
+		p.next()
+		var args []Expr
+		for p.peek() != (token{tokPunct, ")"}) {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() == (token{tokPunct, ","}) {
+				p.next()
+			}
+		}
+		p.next() // ")"
+		if err := p.expectPunct("{"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseStmts()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("}"); err != nil {
+			return nil, err
+		}
+		return &CallStmt{Name: name, Args: args, Body: body}, nil
+	case token{tokPunct, "="}, token{tokPunct, "+="}:
+		op := p.next().text
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &AssignStmt{Name: name, Op: op, Value: value}, nil
+	default:
+		return nil, fmt.Errorf("unexpected token %q after identifier %q", p.peek().text, name)
+	}
+}
+
+func (p *parser) parseIf() (Stmt, error) {
+	p.next() // "if"
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	thenBody, err := p.parseStmts()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("}"); err != nil {
+		return nil, err
+	}
+
+	var elseBody []Stmt
+	if p.peek() == (token{tokIdent, "else"}) {
+		p.next()
+		if p.peek() == (token{tokIdent, "if"}) {
+			elseIf, err := p.parseIf()
+			if err != nil {
+				return nil, err
+			}
+			elseBody = []Stmt{elseIf}
+		} else {
+			if err := p.expectPunct("{"); err != nil {
+				return nil, err
+			}
+			elseBody, err = p.parseStmts()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct("}"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &IfStmt{Cond: cond, Then: thenBody, Else: elseBody}, nil
+}
+
+// parseCondition parses a `&&`/`||`-joined sequence of comparisons or bare
+// identifiers, left-associatively, which is all GN `if` conditions in
+// practice use.
+func (p *parser) parseCondition() (string, error) {
+	var sb strings.Builder
+	for {
+		term, err := p.parseConditionTerm()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(term)
+		if p.peek().kind == tokPunct && (p.peek().text == "&&" || p.peek().text == "||") {
+			sb.WriteString(" " + p.next().text + " ")
+			continue
+		}
+		return sb.String(), nil
+	}
+}
+
+func (p *parser) parseConditionTerm() (string, error) {
+	lhsTok := p.next()
+	var lhs string
+	switch lhsTok.kind {
+	case tokIdent:
+		lhs = lhsTok.text
+	case tokString:
+		lhs = fmt.Sprintf("%q", lhsTok.text)
+	default:
+		return "", fmt.Errorf("unexpected token %q in condition", lhsTok.text)
+	}
+	if p.peek() == (token{tokPunct, "=="}) {
+		p.next()
+		rhsTok := p.next()
+		var rhs string
+		switch rhsTok.kind {
+		case tokIdent:
+			rhs = rhsTok.text
+		case tokString:
+			rhs = fmt.Sprintf("%q", rhsTok.text)
+		default:
+			return "", fmt.Errorf("unexpected token %q in condition", rhsTok.text)
+		}
+		return fmt.Sprintf("%s == %s", lhs, rhs), nil
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokString:
+		p.next()
+		return &Literal{Str: t.text, IsString: true}, nil
+	case t.kind == tokIdent && (t.text == "true" || t.text == "false"):
+		p.next()
+		return &Literal{Str: t.text}, nil
+	case t.kind == tokIdent:
+		p.next()
+		return &Ident{Name: t.text}, nil
+	case t.kind == tokPunct && t.text == "[":
+		return p.parseList()
+	default:
+		return nil, fmt.Errorf("unexpected token %q while parsing an expression", t.text)
+	}
+}
+
+func (p *parser) parseList() (Expr, error) {
+	p.next() // "["
+	var elems []Expr
+	for p.peek() != (token{tokPunct, "]"}) {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+		if p.peek() == (token{tokPunct, ","}) {
+			p.next()
+		}
+	}
+	p.next() // "]"
+	return &ListExpr{Elems: elems}, nil
+}
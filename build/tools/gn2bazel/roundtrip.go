@@ -0,0 +1,104 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gn2bazel
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/syntax"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn"
+)
+
+// RoundtripResult holds the intermediate and final artifacts of a Bazel ->
+// GN -> Bazel roundtrip, so a caller (e.g. a `bazel2gn roundtrip`
+// subcommand) can print whichever stage is useful for debugging a lossy
+// rule.
+type RoundtripResult struct {
+	GN    string
+	Bazel string
+	// Diff is empty when Bazel, re-run through bazel2gn a second time,
+	// produces the same GN text as GN. A non-empty Diff means the
+	// conversion lost or changed information somewhere in the round trip.
+	Diff string
+}
+
+// Roundtrip converts Bazel source to GN, then the resulting GN back to
+// Bazel, and checks the result for semantic drift by converting it to GN
+// a second time and comparing: lossless rules produce identical GN both
+// times even though the reconstructed Bazel text may differ cosmetically
+// (e.g. attribute order) from the original.
+func Roundtrip(bazelSrc string) (*RoundtripResult, error) {
+	gnText, err := bazelToGN(bazelSrc)
+	if err != nil {
+		return nil, fmt.Errorf("converting Bazel to GN: %v", err)
+	}
+
+	gnStmts, err := ParseFile(gnText)
+	if err != nil {
+		return nil, fmt.Errorf("parsing intermediate GN: %v", err)
+	}
+	nodes, err := Lift(gnStmts)
+	if err != nil {
+		return nil, fmt.Errorf("lifting intermediate GN to IR: %v", err)
+	}
+	bazelLines, err := Emit(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("emitting Bazel from IR: %v", err)
+	}
+	bazelText := strings.Join(bazelLines, "\n")
+
+	gnText2, err := bazelToGN(bazelText)
+	if err != nil {
+		return nil, fmt.Errorf("converting reconstructed Bazel back to GN: %v", err)
+	}
+
+	result := &RoundtripResult{GN: gnText, Bazel: bazelText}
+	if gnText != gnText2 {
+		result.Diff = diffLines(gnText, gnText2)
+	}
+	return result, nil
+}
+
+func bazelToGN(src string) (string, error) {
+	f, err := syntax.Parse("roundtrip.bzl", src, 0)
+	if err != nil {
+		return "", err
+	}
+	lines, err := bazel2gn.ConvertFile(f.Stmts)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// diffLines renders a minimal line-oriented diff between two GN texts.
+// It's intentionally simple (no LCS alignment) since it only needs to
+// point a developer at roughly where a roundtrip went lossy, not produce a
+// submittable patch.
+func diffLines(a, b string) string {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+	var sb strings.Builder
+	max := len(aLines)
+	if len(bLines) > max {
+		max = len(bLines)
+	}
+	for i := 0; i < max; i++ {
+		var al, bl string
+		if i < len(aLines) {
+			al = aLines[i]
+		}
+		if i < len(bLines) {
+			bl = bLines[i]
+		}
+		if al == bl {
+			continue
+		}
+		fmt.Fprintf(&sb, "-%s\n+%s\n", al, bl)
+	}
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gn2bazel
+
+import (
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn"
+	"go.fuchsia.dev/fuchsia/build/tools/bazel2gn/ir"
+)
+
+// attrGroup collects every IR node contributing to a single Bazel
+// attribute, in source order: this is the inverse of what bazel2gn's
+// DistributeSelect pass produces, so reassembling one requires walking the
+// flat `attrName = [...]` / `attrName += [...]` / `if (...) { attrName +=
+// [...] } else { ... }` sequence back into a single `attrName = [...] +
+// select({...}) + [...]` expression.
+type attrGroup struct {
+	name  string
+	terms []attrTerm
+}
+
+// attrTerm is either a plain value to concatenate, or a lowered select()
+// recovered from an if/else-if/else chain.
+type attrTerm struct {
+	value    ir.Node           // set when this term is a plain value
+	branches []ir.SelectBranch // set when this term is a select()
+}
+
+// groupAttrs walks a target's lifted attribute nodes and regroups them by
+// attribute name, reconstructing any select() chain it finds.
+func groupAttrs(attrs []ir.Node) ([]attrGroup, error) {
+	var groups []attrGroup
+	index := map[string]int{}
+
+	for _, n := range attrs {
+		switch v := n.(type) {
+		case *ir.AssignNode:
+			i, ok := index[v.Name]
+			if !ok {
+				i = len(groups)
+				index[v.Name] = i
+				groups = append(groups, attrGroup{name: v.Name})
+			}
+			groups[i].terms = append(groups[i].terms, attrTerm{value: v.Value})
+		case *ir.IfNode:
+			name, branches, err := collectSelectBranches(v)
+			if err != nil {
+				return nil, err
+			}
+			i, ok := index[name]
+			if !ok {
+				i = len(groups)
+				index[name] = i
+				groups = append(groups, attrGroup{name: name})
+			}
+			groups[i].terms = append(groups[i].terms, attrTerm{branches: branches})
+		default:
+			return nil, fmt.Errorf("unsupported attribute node of type %T", n)
+		}
+	}
+	return groups, nil
+}
+
+// collectSelectBranches unwinds an if/else-if/else chain (as produced by
+// bazel2gn's passes.DistributeSelect) back into an ordered list of
+// ir.SelectBranch, returning the attribute name every branch appends to.
+func collectSelectBranches(node *ir.IfNode) (string, []ir.SelectBranch, error) {
+	if len(node.Then) != 1 {
+		return "", nil, fmt.Errorf("select()-derived `if` body must assign exactly one attribute, got %d statements", len(node.Then))
+	}
+	assign, ok := node.Then[0].(*ir.AssignNode)
+	if !ok || assign.Op != "+=" {
+		return "", nil, fmt.Errorf("select()-derived `if` body must be a single `+=` append, got %#v", node.Then[0])
+	}
+	branches := []ir.SelectBranch{{Condition: node.Cond, Value: assign.Value}}
+
+	switch len(node.Else) {
+	case 0:
+		return assign.Name, branches, nil
+	case 1:
+		if nested, ok := node.Else[0].(*ir.IfNode); ok {
+			_, nestedBranches, err := collectSelectBranches(nested)
+			if err != nil {
+				return "", nil, err
+			}
+			return assign.Name, append(branches, nestedBranches...), nil
+		}
+		elseAssign, ok := node.Else[0].(*ir.AssignNode)
+		if !ok || elseAssign.Op != "+=" || elseAssign.Name != assign.Name {
+			return "", nil, fmt.Errorf("select()-derived `else` body must be a single `+=` append to %q, got %#v", assign.Name, node.Else[0])
+		}
+		branches = append(branches, ir.SelectBranch{IsDefault: true, Value: elseAssign.Value})
+		return assign.Name, branches, nil
+	default:
+		return "", nil, fmt.Errorf("select()-derived `else` body must be a single statement, got %d", len(node.Else))
+	}
+}
+
+// emitAttrGroup renders a regrouped attribute back as a single Bazel
+// assignment, concatenating its terms with `+` and lowering any recovered
+// select() term into a Bazel select({...}) call.
+func emitAttrGroup(g attrGroup) ([]string, error) {
+	if len(g.terms) == 0 {
+		return nil, fmt.Errorf("attribute %q has no terms", g.name)
+	}
+
+	var pieces [][]string
+	for _, t := range g.terms {
+		if t.branches != nil {
+			lines, err := emitSelect(t.branches)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %v", g.name, err)
+			}
+			pieces = append(pieces, lines)
+			continue
+		}
+		lines, err := emitValue(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %v", g.name, err)
+		}
+		pieces = append(pieces, lines)
+	}
+
+	joined := append([]string{}, pieces[0]...)
+	for _, p := range pieces[1:] {
+		joined[len(joined)-1] += " +"
+		joined = append(joined, p...)
+	}
+	joined[0] = fmt.Sprintf("%s = %s", g.name, joined[0])
+	joined[len(joined)-1] += ","
+	return joined, nil
+}
+
+// emitSelect renders a recovered select() as Bazel text, translating each
+// branch's condition back to a config_setting label via
+// bazel2gn.GNConditionToConfigLabel.
+func emitSelect(branches []ir.SelectBranch) ([]string, error) {
+	ret := []string{"select({"}
+	for _, b := range branches {
+		var key string
+		if b.IsDefault {
+			key = `"//conditions:default"`
+		} else {
+			label, ok := bazel2gn.GNConditionToConfigLabel()[b.Condition]
+			if !ok {
+				return nil, fmt.Errorf("no known Bazel label for GN condition %q; add it to configLabelToGNCondition", b.Condition)
+			}
+			key = label
+		}
+		lines, err := emitValue(b.Value)
+		if err != nil {
+			return nil, err
+		}
+		lines = append([]string{}, lines...)
+		lines[0] = fmt.Sprintf("%s: %s", key, lines[0])
+		lines[len(lines)-1] += ","
+		ret = append(ret, indent(lines, 1)...)
+	}
+	ret = append(ret, "})")
+	return ret, nil
+}
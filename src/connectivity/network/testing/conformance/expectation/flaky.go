@@ -0,0 +1,49 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+import "time"
+
+// FlakyPolicy replaces the opaque Flaky outcome with a structured retry
+// budget: the runner should attempt the case up to MaxAttempts times and
+// report Pass only if at least RequiredPasses of those attempts succeeded.
+type FlakyPolicy struct {
+	MaxAttempts     int
+	RequiredPasses  int
+	TrackingBug     string
+	LastSeenFailure time.Time
+}
+
+// Evaluate reports whether a case governed by this policy should be
+// considered passing, given the pass/fail results of each attempt made so
+// far (in order). It returns false until either RequiredPasses have
+// succeeded or MaxAttempts have been spent without reaching that bar.
+func (p FlakyPolicy) Evaluate(attemptResults []bool) (pass bool, done bool) {
+	passes := 0
+	for _, ok := range attemptResults {
+		if ok {
+			passes++
+		}
+	}
+	if passes >= p.RequiredPasses {
+		return true, true
+	}
+	if len(attemptResults) >= p.MaxAttempts {
+		return false, true
+	}
+	return false, false
+}
+
+// ipv6FlakyPolicies holds the FlakyPolicy for each case whose outcome is
+// Flaky, keyed the same way as ipv6Expectations. A case missing from this
+// map but present as Flaky in an expectation map is a bug: every Flaky
+// outcome must have a tracked policy.
+var ipv6FlakyPolicies = map[AnvlCaseNumber]FlakyPolicy{
+	{8, 17}: {
+		MaxAttempts:    5,
+		RequiredPasses: 3,
+		TrackingBug:    "https://fxbug.dev/42000002",
+	},
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+import (
+	"fmt"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation/history"
+)
+
+const (
+	promoteToPassAfterConsecutivePasses  = 20
+	promoteToFailAfterConsecutiveFailing = 5
+)
+
+// TestFlakyPoliciesAreTracked ensures every Flaky outcome in ipv6Expectations
+// and ipv6ExpectationsNS3Overrides has a corresponding FlakyPolicy, so the
+// Flaky bucket never silently becomes an untracked escape hatch again.
+func TestFlakyPoliciesAreTracked(t *testing.T) {
+	for c, o := range ipv6Expectations {
+		if o == Flaky {
+			if _, ok := ipv6FlakyPolicies[c]; !ok {
+				t.Errorf("case %v is Flaky in ipv6Expectations but has no FlakyPolicy", c)
+			}
+		}
+	}
+	for c, o := range ipv6ExpectationsNS3Overrides {
+		if o == Flaky {
+			if _, ok := ipv6FlakyPolicies[c]; !ok {
+				t.Errorf("case %v is Flaky in ipv6ExpectationsNS3Overrides but has no FlakyPolicy", c)
+			}
+		}
+	}
+}
+
+// TestFlakyHistorySuggestsPromotion is a linter, not a correctness check: it
+// reads the checked-in run history and fails with a suggestion when a case
+// has been stable enough, in either direction, that its expectation should
+// be updated by hand.
+func TestFlakyHistorySuggestsPromotion(t *testing.T) {
+	h, err := history.Load("history/ipv6.json")
+	if err != nil {
+		t.Fatalf("loading history: %v", err)
+	}
+	for c := range ipv6FlakyPolicies {
+		key := fmt.Sprintf("%d.%d", c.Major, c.Minor)
+		if n := h.ConsecutivePasses(key); n >= promoteToPassAfterConsecutivePasses {
+			t.Errorf("case %v has passed %d consecutive runs; consider promoting it to Pass in data/ipv6.yaml", c, n)
+		}
+		if n := h.ConsecutiveFailures(key); n >= promoteToFailAfterConsecutiveFailing {
+			t.Errorf("case %v has failed %d consecutive runs within its retry budget; promote it to Fail in data/ipv6.yaml", c, n)
+		}
+	}
+}
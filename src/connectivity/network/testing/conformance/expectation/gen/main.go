@@ -0,0 +1,176 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Regenerating: `go run ./gen`.
+// Verifying the checked-in output is up to date: `go run ./gen -verify`.
+var verify = flag.Bool("verify", false, "check that the generated file matches the data files instead of writing it")
+
+const tmplText = `// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Code generated by expectation/gen from data/{{.Source}}. DO NOT EDIT.
+
+package expectation
+
+import "go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation/outcome"
+
+var {{.BaseVar}} map[AnvlCaseNumber]outcome.Outcome = map[AnvlCaseNumber]outcome.Outcome{
+{{- range .Base}}
+{{.Comment}}	{{.CaseLiteral}}: {{.Outcome}},
+{{- end}}
+}
+
+// {{.OverlayVar}} holds only the cases where NS3's outcome diverges from
+// the base {{.BaseVar}}; ipv6NS3Set composes the two via ExpectationSet.
+var {{.OverlayVar}} map[AnvlCaseNumber]outcome.Outcome = map[AnvlCaseNumber]outcome.Outcome{
+{{- range .Overlay}}
+{{.Comment}}	{{.CaseLiteral}}: {{.Outcome}},
+{{- end}}
+}
+`
+
+type renderedEntry struct {
+	CaseLiteral string
+	Outcome     string
+	Comment     string
+}
+
+type templateData struct {
+	Source     string
+	BaseVar    string
+	OverlayVar string
+	Base       []renderedEntry
+	Overlay    []renderedEntry
+}
+
+func loadFile(path string) (file, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return file{}, err
+	}
+	var f file
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return file{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	sort.Slice(f.Cases, func(i, j int) bool {
+		if f.Cases[i].Case.Major != f.Cases[j].Case.Major {
+			return f.Cases[i].Case.Major < f.Cases[j].Case.Major
+		}
+		return f.Cases[i].Case.Minor < f.Cases[j].Case.Minor
+	})
+	for _, e := range f.Cases {
+		if err := e.validate(); err != nil {
+			return file{}, err
+		}
+	}
+	return f, nil
+}
+
+func renderComment(e entry) string {
+	if e.Comment == "" {
+		return ""
+	}
+	return fmt.Sprintf("\t// %s\n", e.Comment)
+}
+
+// renderBase renders every case at its default outcome; this becomes the
+// base ExpectationSet.
+func renderBase(f file) []renderedEntry {
+	var out []renderedEntry
+	for _, e := range f.Cases {
+		out = append(out, renderedEntry{
+			CaseLiteral: fmt.Sprintf("{%d, %d}", e.Case.Major, e.Case.Minor),
+			Outcome:     e.Default,
+			Comment:     renderComment(e),
+		})
+	}
+	return out
+}
+
+// renderOverlay renders only the cases where the NS3 outcome diverges from
+// the default, so the resulting map is a set of overrides on top of the
+// base ExpectationSet rather than a full duplicate of it.
+func renderOverlay(f file) []renderedEntry {
+	var out []renderedEntry
+	for _, e := range f.Cases {
+		if e.NS3 == "" || e.NS3 == e.Default {
+			continue
+		}
+		out = append(out, renderedEntry{
+			CaseLiteral: fmt.Sprintf("{%d, %d}", e.Case.Major, e.Case.Minor),
+			Outcome:     e.NS3,
+			Comment:     renderComment(e),
+		})
+	}
+	return out
+}
+
+func generate(dataFile, outFile string) ([]byte, error) {
+	f, err := loadFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("expectations").Parse(tmplText)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{
+		Source:     filepath.Base(dataFile),
+		BaseVar:    "ipv6Expectations",
+		OverlayVar: "ipv6ExpectationsNS3Overrides",
+		Base:       renderBase(f),
+		Overlay:    renderOverlay(f),
+	}); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	flag.Parse()
+
+	const dataFile = "data/ipv6.yaml"
+	const outFile = "ipv6.go"
+
+	generated, err := generate(dataFile, outFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *verify {
+		existing, err := os.ReadFile(outFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !bytes.Equal(existing, generated) {
+			fmt.Fprintf(os.Stderr, "%s is stale; run `go generate` in %s\n", outFile, filepath.Dir(outFile))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := os.WriteFile(outFile, generated, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
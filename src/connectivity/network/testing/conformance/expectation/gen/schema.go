@@ -0,0 +1,96 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Command gen regenerates the Go expectation maps in package expectation
+// from the declarative YAML files in expectation/data, and can verify that
+// the checked-in Go is byte-identical to what regeneration would produce.
+package main
+
+import "fmt"
+
+// SkipReason enumerates the reasons an entry may be AnvlSkip or Skip. This
+// is the exhaustive set recognized by the schema; any other string in a
+// `skip_reason` field is a validation error.
+type SkipReason string
+
+const (
+	// ROUTER_ONLY marks a case that only applies to the router role but is
+	// being evaluated against the host suite.
+	ROUTER_ONLY SkipReason = "ROUTER_ONLY"
+	// RFC5095_COVERED_ELSEWHERE marks a case suppressed because RFC 5095
+	// (deprecation of the type 0 routing header) support makes it
+	// redundant with another, already-covered case.
+	RFC5095_COVERED_ELSEWHERE SkipReason = "RFC5095_COVERED_ELSEWHERE"
+	// DUT_MUST_BE_ROUTER marks a case that should only run when the DUT is
+	// configured as a router.
+	DUT_MUST_BE_ROUTER SkipReason = "DUT_MUST_BE_ROUTER"
+	// DRIVER_SCOPE marks a case whose behavior is properly the
+	// responsibility of a device driver rather than the netstack under
+	// test.
+	DRIVER_SCOPE SkipReason = "DRIVER_SCOPE"
+)
+
+var validSkipReasons = map[SkipReason]bool{
+	ROUTER_ONLY:               true,
+	RFC5095_COVERED_ELSEWHERE: true,
+	DUT_MUST_BE_ROUTER:        true,
+	DRIVER_SCOPE:              true,
+}
+
+// caseNumber mirrors expectation.AnvlCaseNumber but is defined locally so
+// this tool has no Go-source dependency on the package it generates code
+// for.
+type caseNumber struct {
+	Major int `yaml:"major"`
+	Minor int `yaml:"minor"`
+}
+
+// entry is the YAML schema for a single ANVL case.
+type entry struct {
+	Case       caseNumber `yaml:"case"`
+	Default    string     `yaml:"default"`
+	NS3        string     `yaml:"ns3,omitempty"`
+	SkipReason SkipReason `yaml:"skip_reason,omitempty"`
+	Bug        string     `yaml:"bug,omitempty"`
+	Comment    string     `yaml:"comment,omitempty"`
+}
+
+// file is the top-level YAML schema for an expectation/data/*.yaml file.
+type file struct {
+	Cases []entry `yaml:"cases"`
+}
+
+var outcomesRequiringBug = map[string]bool{
+	"Fail":  true,
+	"Flaky": true,
+}
+
+var skippyOutcomes = map[string]bool{
+	"AnvlSkip": true,
+	"Skip":     true,
+}
+
+// validate enforces the invariants described at the top of data/ipv6.yaml: skip
+// reasons must come from the known enum, and Fail/Flaky outcomes (whether
+// the default or an override) must carry a bug link.
+func (e entry) validate() error {
+	outcomes := []string{e.Default}
+	if e.NS3 != "" {
+		outcomes = append(outcomes, e.NS3)
+	}
+	for _, o := range outcomes {
+		if outcomesRequiringBug[o] && e.Bug == "" {
+			return fmt.Errorf("case {%d,%d}: outcome %s requires a bug link", e.Case.Major, e.Case.Minor, o)
+		}
+	}
+	if skippyOutcomes[e.Default] {
+		if e.SkipReason == "" {
+			return fmt.Errorf("case {%d,%d}: outcome %s requires a skip_reason", e.Case.Major, e.Case.Minor, e.Default)
+		}
+		if !validSkipReasons[e.SkipReason] {
+			return fmt.Errorf("case {%d,%d}: unknown skip_reason %q", e.Case.Major, e.Case.Minor, e.SkipReason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package history persists per-case run outcomes for cases governed by an
+// expectation.FlakyPolicy, so a linter can suggest promoting a case back to
+// Pass once it's been reliable for a while, or promoting it to Fail once its
+// retry budget has stopped being enough. The linter only reports; no
+// expectation is changed automatically.
+package history
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Run records whether a case's FlakyPolicy was satisfied (the runner
+// reported an overall Pass after retries) for one conformance run.
+type Run struct {
+	Passed bool `json:"passed"`
+}
+
+// Record is one case's run history, most recent run last.
+type Record struct {
+	Runs []Run `json:"runs"`
+}
+
+// History maps a case's string key (e.g. "8.17") to its Record. It's kept
+// as a plain map, rather than keyed on expectation.AnvlCaseNumber, so this
+// package has no Go-source dependency on package expectation.
+type History map[string]Record
+
+// Load reads a History from a JSON file under expectation/history/. A
+// missing file is not an error: it means no history has been recorded yet.
+func Load(path string) (History, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return History{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var h History
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Save writes h to path as indented JSON.
+func Save(path string, h History) error {
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Append records one more run for key, keeping at most lastN runs.
+func (h History) Append(key string, passed bool, lastN int) {
+	r := h[key]
+	r.Runs = append(r.Runs, Run{Passed: passed})
+	if len(r.Runs) > lastN {
+		r.Runs = r.Runs[len(r.Runs)-lastN:]
+	}
+	h[key] = r
+}
+
+// ConsecutivePasses returns the number of consecutive passing runs at the
+// end of key's history.
+func (h History) ConsecutivePasses(key string) int {
+	runs := h[key].Runs
+	n := 0
+	for i := len(runs) - 1; i >= 0 && runs[i].Passed; i-- {
+		n++
+	}
+	return n
+}
+
+// ConsecutiveFailures returns the number of consecutive failing runs at the
+// end of key's history.
+func (h History) ConsecutiveFailures(key string) int {
+	runs := h[key].Runs
+	n := 0
+	for i := len(runs) - 1; i >= 0 && !runs[i].Passed; i-- {
+		n++
+	}
+	return n
+}
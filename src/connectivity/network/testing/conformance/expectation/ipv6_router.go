@@ -0,0 +1,75 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+import "go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation/outcome"
+
+// ipv6RouterExpectations holds router-role outcomes for cases that are
+// AnvlSkip or Skip in ipv6Expectations because they only apply when the DUT
+// is configured as a router. Not every such case is listed: 6.2, 6.6, 7.2
+// and 7.3 are ROUTER_ONLY in data/ipv6.yaml but have no entry here. A
+// conformance run against a router DUT should consult this map instead of
+// ipv6Expectations for these cases; see Role.
+var ipv6RouterExpectations map[AnvlCaseNumber]outcome.Outcome = map[AnvlCaseNumber]outcome.Outcome{
+	{1, 2}:  Pass,
+	{2, 1}:  Pass,
+	{3, 3}:  Pass,
+	{3, 8}:  Pass,
+	{4, 1}:  Pass,
+	{4, 2}:  Pass,
+	{5, 1}:  Pass,
+	{5, 3}:  Pass,
+	{5, 5}:  Pass,
+	{5, 6}:  Pass,
+	{5, 9}:  Pass,
+	{5, 10}: Pass,
+	{5, 12}: Pass,
+	{5, 13}: Pass,
+	{5, 16}: Pass,
+	{5, 18}: Pass,
+	{5, 20}: Pass,
+	{5, 21}: Pass,
+	{5, 24}: Pass,
+	{5, 25}: Pass,
+	{5, 28}: Pass,
+	{5, 30}: Pass,
+	{5, 32}: Pass,
+	{9, 1}:  Pass,
+	{9, 2}:  Pass,
+	{11, 2}: Pass,
+	{11, 5}: Pass,
+	{11, 6}: Pass,
+	{12, 2}: Pass,
+	{12, 4}: Pass,
+	{16, 1}: Pass,
+	{16, 2}: Pass,
+	{16, 3}: Pass,
+	{16, 4}: Pass,
+	{16, 5}: Pass,
+	{16, 6}: Pass,
+	{16, 7}: Pass,
+}
+
+// ipv6RouterExpectationsNS3 is ipv6RouterExpectations' NS3 counterpart.
+// NS3 has no divergence from the base router results at this time, but the
+// map is kept separate (rather than reusing ipv6RouterExpectations) so a
+// future NS3-specific router regression has somewhere to go without
+// re-introducing base/NS3 duplication.
+var ipv6RouterExpectationsNS3 map[AnvlCaseNumber]outcome.Outcome = ipv6RouterExpectations
+
+// RoleSet returns the ExpectationSet the conformance runner should consult
+// for the given DUT role and netstack variant.
+func RoleSet(role Role, ns3 bool) *ExpectationSet {
+	if role == Router {
+		if ns3 {
+			return &ExpectationSet{Entries: ipv6RouterExpectationsNS3}
+		}
+		return &ExpectationSet{Entries: ipv6RouterExpectations}
+	}
+	if ns3 {
+		return ipv6NS3Set
+	}
+	return ipv6BaseSet
+}
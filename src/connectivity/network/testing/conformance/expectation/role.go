@@ -0,0 +1,34 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+// Role identifies which DUT configuration a conformance case applies to.
+// Most ANVL cases are written against a specific role; running them against
+// the other role either doesn't exercise the behavior under test or isn't
+// meaningful (e.g. a router-only case against a host DUT).
+type Role int
+
+const (
+	// Host is the default role: the DUT under test is acting as a plain
+	// host, not forwarding packets between interfaces.
+	Host Role = iota
+	// Router is a DUT configured to forward packets between interfaces.
+	Router
+	// Both indicates the case is meaningful against either role.
+	Both
+)
+
+func (r Role) String() string {
+	switch r {
+	case Host:
+		return "host"
+	case Router:
+		return "router"
+	case Both:
+		return "both"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+import "go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation/outcome"
+
+// Provenance describes where a looked-up outcome came from.
+type Provenance int
+
+const (
+	// Local means the outcome was found directly in the set that was
+	// queried.
+	Local Provenance = iota
+	// Inherited means the outcome was not present in the set that was
+	// queried and was instead found on an ancestor.
+	Inherited
+)
+
+// ExpectationSet is a set of ANVL case expectations that may be defined as
+// overrides on top of a Parent set. This lets a netstack variant (e.g. NS3)
+// be expressed purely as its divergence from a base set, rather than as a
+// full duplicate of it.
+type ExpectationSet struct {
+	Parent  *ExpectationSet
+	Entries map[AnvlCaseNumber]outcome.Outcome
+}
+
+// Lookup walks the set's ancestry, starting at s, and returns the first
+// outcome found for c along with whether it was found locally or
+// inherited from an ancestor. The second return value is false if no set
+// in the chain has an entry for c.
+func (s *ExpectationSet) Lookup(c AnvlCaseNumber) (outcome.Outcome, Provenance, bool) {
+	for set, provenance := s, Local; set != nil; set, provenance = set.Parent, Inherited {
+		if o, ok := set.Entries[c]; ok {
+			return o, provenance, true
+		}
+	}
+	var zero outcome.Outcome
+	return zero, Local, false
+}
+
+// ipv6BaseSet is the ExpectationSet for the default netstack.
+var ipv6BaseSet = &ExpectationSet{Entries: ipv6Expectations}
+
+// ipv6NS3Set is the ExpectationSet for NS3, defined purely as overrides on
+// top of ipv6BaseSet. Lookups that aren't in ipv6ExpectationsNS3Overrides
+// fall through to the base set.
+var ipv6NS3Set = &ExpectationSet{Parent: ipv6BaseSet, Entries: ipv6ExpectationsNS3Overrides}
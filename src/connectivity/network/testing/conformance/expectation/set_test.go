@@ -0,0 +1,32 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package expectation
+
+import "testing"
+
+// TestNS3OverridesAreLive flags dead overrides: entries in
+// ipv6ExpectationsNS3Overrides that happen to match the base outcome don't
+// express any real divergence and should be deleted so the overlay only
+// ever documents where NS3 actually differs.
+func TestNS3OverridesAreLive(t *testing.T) {
+	for c, override := range ipv6ExpectationsNS3Overrides {
+		base, ok := ipv6Expectations[c]
+		if ok && base == override {
+			t.Errorf("case %v: NS3 override %v is identical to the base outcome; remove the dead override", c, override)
+		}
+	}
+}
+
+// TestNS3OverridesHaveBaseCase flags overrides for case numbers that don't
+// exist in the base set at all; an override only makes sense as a
+// divergence from something, so an orphaned one is almost certainly a typo
+// in the case number.
+func TestNS3OverridesHaveBaseCase(t *testing.T) {
+	for c := range ipv6ExpectationsNS3Overrides {
+		if _, ok := ipv6Expectations[c]; !ok {
+			t.Errorf("case %v: NS3 override has no corresponding entry in ipv6Expectations", c)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package results renders the outcome of an ANVL conformance run against an
+// expectation.ExpectationSet into the machine- and human-readable formats
+// CI consumes: JUnit XML per netstack variant, and a reStructuredText
+// summary grouped by ANVL category.
+package results
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/expectation/outcome"
+)
+
+// junitTestSuite and junitTestCase mirror the subset of the JUnit XML schema
+// that LUCI/Sponge understands.
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Skip    *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func caseName(c expectation.AnvlCaseNumber) string {
+	return fmt.Sprintf("case %d.%d", c.Major, c.Minor)
+}
+
+// JUnitXML renders observed, one JUnit <testsuite> per call, named for the
+// netstack variant the results came from.
+func JUnitXML(variant string, observed map[expectation.AnvlCaseNumber]outcome.Outcome, set *expectation.ExpectationSet) ([]byte, error) {
+	suite := junitTestSuite{Name: variant}
+	for _, c := range sortedCases(observed) {
+		o := observed[c]
+		tc := junitTestCase{Name: caseName(c)}
+		suite.Tests++
+		switch o {
+		case expectation.Fail:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: "observed outcome was Fail"}
+		case expectation.Skip, expectation.AnvlSkip:
+			suite.Skipped++
+			tc.Skip = &junitSkipped{Message: skipMessage(c, set)}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	out, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling JUnit XML for %s: %w", variant, err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// skipMessage marks whether a skipped case's expectation was inherited from
+// a parent set. The skip reason itself is not included: ExpectationSet does
+// not carry it.
+func skipMessage(c expectation.AnvlCaseNumber, set *expectation.ExpectationSet) string {
+	if set == nil {
+		return "skipped"
+	}
+	if _, provenance, ok := set.Lookup(c); ok {
+		if provenance == expectation.Inherited {
+			return "skipped (inherited)"
+		}
+		return "skipped"
+	}
+	return "skipped"
+}
+
+// category is case.Major; ANVL groups related cases under a shared leading
+// number (1..16 for IPv6).
+func category(c expectation.AnvlCaseNumber) int {
+	return c.Major
+}
+
+func sortedCases(m map[expectation.AnvlCaseNumber]outcome.Outcome) []expectation.AnvlCaseNumber {
+	cases := make([]expectation.AnvlCaseNumber, 0, len(m))
+	for c := range m {
+		cases = append(cases, c)
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		if cases[i].Major != cases[j].Major {
+			return cases[i].Major < cases[j].Major
+		}
+		return cases[i].Minor < cases[j].Minor
+	})
+	return cases
+}
+
+func outcomeLabel(o outcome.Outcome) string {
+	switch o {
+	case expectation.Pass:
+		return "OK"
+	case expectation.Fail:
+		return "FAIL"
+	case expectation.Skip, expectation.AnvlSkip:
+		return "SKIP"
+	case expectation.Flaky:
+		return "FLAKY"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// RSTSummary renders a reStructuredText summary of observed, grouped by
+// ANVL category, with a trailing diff section listing cases whose observed
+// outcome didn't match set.
+func RSTSummary(variant string, observed map[expectation.AnvlCaseNumber]outcome.Outcome, set *expectation.ExpectationSet) []byte {
+	var b strings.Builder
+	title := fmt.Sprintf("%s conformance results", variant)
+	fmt.Fprintf(&b, "%s\n%s\n\n", title, strings.Repeat("=", len(title)))
+
+	cases := sortedCases(observed)
+	var diffs []expectation.AnvlCaseNumber
+	currentCategory := -1
+	for _, c := range cases {
+		if category(c) != currentCategory {
+			currentCategory = category(c)
+			fmt.Fprintf(&b, "Category %d\n%s\n", currentCategory, strings.Repeat("-", len(fmt.Sprintf("Category %d", currentCategory))))
+		}
+		o := observed[c]
+		fmt.Fprintf(&b, "case %d.%d ... %s\n", c.Major, c.Minor, outcomeLabel(o))
+
+		if set != nil {
+			if expected, _, ok := set.Lookup(c); ok && expected != o {
+				diffs = append(diffs, c)
+			}
+		}
+	}
+
+	if len(diffs) > 0 {
+		fmt.Fprintf(&b, "\nDiff from expectations\n-----------------------\n")
+		for _, c := range diffs {
+			expected, _, _ := set.Lookup(c)
+			fmt.Fprintf(&b, "case %d.%d: expected %s, observed %s\n", c.Major, c.Minor, outcomeLabel(expected), outcomeLabel(observed[c]))
+		}
+	}
+
+	return []byte(b.String())
+}
@@ -3,13 +3,15 @@
 // found in the LICENSE file.
 
 // This library implements a *very basic* fuchsia.io implementation for directories, files, and
-// services. Most functionality is not available, nor does this library enforce any kind of
-// connection rights. However, nodes are read-only from a client perspective (e.g. writing to files
-// is not supported), and no new nodes can be created by clients.
+// services. Most functionality is not available. Writes, creation, and unlinking are only
+// available for nodes whose File or Directory implementation additionally implements
+// WritableFile or WritableDirectory; everything else remains read-only from a client
+// perspective, and no new nodes can be created underneath it.
 
-// TODO(https://fxbug.dev/356225729): This library does not perform any rights checks, nor does it
-// enforce hierarchal rights. This is mainly used for publishing services and read-only directory
-// entries from components.
+// TODO(https://fxbug.dev/356225729): Rights enforcement only covers the operations a connection
+// was itself granted when opened; it does not yet additionally cap those against the rights of
+// the node actually being served (e.g. a writable connection to a read-only file). This is mainly
+// used for publishing services and directory entries from components.
 
 package component
 
@@ -17,12 +19,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"fmt"
 	stdio "io"
 	"log"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"syscall/zx"
 	"syscall/zx/fdio"
@@ -59,11 +62,21 @@ func logError(err error) {
 }
 
 type Node interface {
-	getIO() (io.NodeWithCtx, func() error, error)
+	// getIO returns an io.NodeWithCtx for serving this node directly,
+	// in-process, rather than over a channel (e.g. when forwarding a path
+	// traversal to a child directory). rights are the operations the
+	// caller has already been granted and that the returned connection
+	// should itself enforce.
+	getIO(rights io.Operations) (io.NodeWithCtx, func() error, error)
 	addConnection(flags io.Flags, channel zx.Channel) error
 	Representation() io.Representation
 	addConnectionDeprecated(flags io.OpenFlags, mode io.ModeType, req io.NodeWithCtxInterfaceRequest) error
 	DescribeDeprecated() io.NodeInfoDeprecated
+
+	// Type returns the io.DirentType this Node should be reported as in a
+	// parent directory's ReadDirents, without needing a GetAttr round trip
+	// (or, for a FileWrapper, opening its Reader just to learn its size).
+	Type() io.DirentType
 }
 
 func noop() error {
@@ -79,7 +92,7 @@ type Service struct {
 var _ Node = (*Service)(nil)
 var _ io.NodeWithCtx = (*Service)(nil)
 
-func (s *Service) getIO() (io.NodeWithCtx, func() error, error) {
+func (s *Service) getIO(io.Operations) (io.NodeWithCtx, func() error, error) {
 	return s, noop, nil
 }
 
@@ -131,6 +144,10 @@ func (*Service) Representation() io.Representation {
 	return io.Representation{}
 }
 
+func (*Service) Type() io.DirentType {
+	return io.DirentTypeService
+}
+
 func (*Service) GetConnectionInfo(fidl.Context) (io.ConnectionInfo, error) {
 	var connectionInfo io.ConnectionInfo
 	connectionInfo.SetRights(io.OperationsConnect)
@@ -209,6 +226,77 @@ type Directory interface {
 	ForEach(func(string, Node) error) error
 }
 
+// WritableDirectory is implemented by Directory types that additionally
+// support creating and removing entries. A DirectoryWrapper whose Directory
+// also implements WritableDirectory serves Open with OpenFlagsCreate,
+// OpenFlagsCreateIfAbsent, and OpenFlagsTruncate, as well as Unlink, for
+// real, instead of returning ErrNotSupported.
+type WritableDirectory interface {
+	Directory
+
+	// Create creates and returns a new entry named name. If exclusive is
+	// true, Create fails with ErrAlreadyExists if name is already present.
+	Create(name string, exclusive bool) (Node, error)
+
+	// Remove removes the entry named name.
+	Remove(name string) error
+}
+
+// WritableFile is implemented by File types that additionally support
+// mutation. A FileWrapper whose File also implements WritableFile serves
+// Write, WriteAt, and Resize for real, instead of returning
+// ErrNotSupported.
+type WritableFile interface {
+	File
+
+	// WriteAt writes len(b) bytes from b into the file starting at offset,
+	// growing the file if offset+len(b) exceeds its current size, and
+	// returns the number of bytes written.
+	WriteAt(b []byte, offset int64) (int, error)
+
+	// Truncate resizes the file to size, discarding any data beyond it and
+	// zero-filling any gap if size is larger than the file's current
+	// length.
+	Truncate(size uint64) error
+}
+
+// operationsFromOpenFlags returns the io.Operations a connection opened
+// with flags should be granted, mirroring the OPEN_RIGHT_* semantics of the
+// deprecated fuchsia.io/Directory.DeprecatedOpen.
+func operationsFromOpenFlags(flags io.OpenFlags) io.Operations {
+	var rights io.Operations
+	if flags&io.OpenRightReadable != 0 {
+		rights |= io.OperationsReadBytes | io.OperationsGetAttributes | io.OperationsEnumerate | io.OperationsTraverse
+	}
+	if flags&io.OpenRightWritable != 0 {
+		rights |= io.OperationsWriteBytes | io.OperationsModifyDirectory | io.OperationsUpdateAttributes
+	}
+	if flags&io.OpenRightExecutable != 0 {
+		rights |= io.OperationsExecute
+	}
+	if flags&io.OpenRightAdmin != 0 {
+		rights |= io.OperationsAdmin
+	}
+	return rights
+}
+
+// operationsFromFlags returns the io.Operations granted by the permission
+// bits set in flags, for connections opened through the newer
+// fuchsia.io/Directory.Open.
+func operationsFromFlags(flags io.Flags) io.Operations {
+	var rights io.Operations
+	if flags&io.FlagsPermRead != 0 {
+		rights |= io.OperationsReadBytes | io.OperationsGetAttributes | io.OperationsEnumerate | io.OperationsTraverse
+	}
+	if flags&io.FlagsPermWrite != 0 {
+		rights |= io.OperationsWriteBytes | io.OperationsModifyDirectory | io.OperationsUpdateAttributes
+	}
+	if flags&io.FlagsPermExecute != 0 {
+		rights |= io.OperationsExecute
+	}
+	return rights
+}
+
 var _ Directory = mapDirectory(nil)
 
 type mapDirectory map[string]Node
@@ -227,32 +315,29 @@ func (md mapDirectory) ForEach(fn func(string, Node) error) error {
 	return nil
 }
 
-var _ Directory = (*pprofDirectory)(nil)
-
-type pprofDirectory struct{}
-
-func (*pprofDirectory) Get(name string) (Node, bool) {
-	if p := pprof.Lookup(name); p != nil {
-		return &FileWrapper{
-			File: &pprofFile{
-				p: p,
-			},
-		}, true
+// NewPprofDirectory returns a LazyDirectory exposing the process's
+// registered pprof profiles ("goroutine", "heap", "allocs", ...) as files,
+// without pre-materializing a Node per profile up front.
+func NewPprofDirectory() *LazyDirectory {
+	toNode := func(p *pprof.Profile) Node {
+		return &FileWrapper{File: &pprofFile{p: p}}
 	}
-	return nil, false
-}
-
-func (*pprofDirectory) ForEach(fn func(string, Node) error) error {
-	for _, p := range pprof.Profiles() {
-		if err := fn(p.Name(), &FileWrapper{
-			File: &pprofFile{
-				p: p,
-			},
-		}); err != nil {
-			return err
-		}
+	return &LazyDirectory{
+		GetNode: func(name string) (Node, bool) {
+			if p := pprof.Lookup(name); p != nil {
+				return toNode(p), true
+			}
+			return nil, false
+		},
+		ForEachNode: func(fn func(string, Node) error) error {
+			for _, p := range pprof.Profiles() {
+				if err := fn(p.Name(), toNode(p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
 	}
-	return nil
 }
 
 type DirectoryWrapper struct {
@@ -261,16 +346,18 @@ type DirectoryWrapper struct {
 
 var _ Node = (*DirectoryWrapper)(nil)
 
-func (dir *DirectoryWrapper) GetDirectory() io.DirectoryWithCtx {
-	return &directoryState{DirectoryWrapper: dir}
+// GetDirectory returns an io.DirectoryWithCtx for serving dir's contents to
+// a connection granted rights.
+func (dir *DirectoryWrapper) GetDirectory(rights io.Operations) io.DirectoryWithCtx {
+	return &directoryState{DirectoryWrapper: dir, rights: rights}
 }
 
-func (dir *DirectoryWrapper) getIO() (io.NodeWithCtx, func() error, error) {
-	return dir.GetDirectory(), noop, nil
+func (dir *DirectoryWrapper) getIO(rights io.Operations) (io.NodeWithCtx, func() error, error) {
+	return dir.GetDirectory(rights), noop, nil
 }
 
 func (dir *DirectoryWrapper) addConnection(flags io.Flags, channel zx.Channel) error {
-	ioDir := dir.GetDirectory()
+	ioDir := dir.GetDirectory(operationsFromFlags(flags))
 	stub := io.DirectoryWithCtxStub{Impl: ioDir}
 	go Serve(context.Background(), &stub, channel, ServeOptions{
 		OnError: logError,
@@ -283,7 +370,7 @@ func (dir *DirectoryWrapper) addConnection(flags io.Flags, channel zx.Channel) e
 }
 
 func (dir *DirectoryWrapper) addConnectionDeprecated(flags io.OpenFlags, mode io.ModeType, req io.NodeWithCtxInterfaceRequest) error {
-	ioDir := dir.GetDirectory()
+	ioDir := dir.GetDirectory(operationsFromOpenFlags(flags))
 	stub := io.DirectoryWithCtxStub{Impl: ioDir}
 	go Serve(context.Background(), &stub, req.Channel, ServeOptions{
 		OnError: logError,
@@ -296,8 +383,20 @@ var _ io.DirectoryWithCtx = (*directoryState)(nil)
 type directoryState struct {
 	*DirectoryWrapper
 
-	reading bool
-	dirents bytes.Buffer
+	// rights are the operations this connection was granted when opened,
+	// per TODO(https://fxbug.dev/356225729): operations this connection
+	// didn't request (or that its parent didn't itself hold) are rejected
+	// rather than silently permitted.
+	rights io.Operations
+
+	// reading is true between a ReadDirents call that starts an
+	// enumeration and the Rewind (or exhaustion) that ends it; direntNames
+	// is the sorted snapshot of names taken when reading became true
+	// (direntNames[0] is always dot), and direntPos is the index of the
+	// next name to serialize.
+	reading     bool
+	direntNames []string
+	direntPos   int
 }
 
 func (dirState *directoryState) DeprecatedClone(ctx fidl.Context, flags io.OpenFlags, req io.NodeWithCtxInterfaceRequest) error {
@@ -305,7 +404,7 @@ func (dirState *directoryState) DeprecatedClone(ctx fidl.Context, flags io.OpenF
 }
 
 func (dirState *directoryState) Clone(ctx fidl.Context, req unknown.CloneableWithCtxInterfaceRequest) error {
-	return dirState.addConnection(io.Flags(0), req.Channel)
+	return dirState.addConnection(io.Flags(dirState.rights), req.Channel)
 }
 
 func (*directoryState) Close(fidl.Context) (unknown.CloseableCloseResult, error) {
@@ -318,16 +417,19 @@ func (*DirectoryWrapper) Representation() io.Representation {
 	return repr
 }
 
+func (*DirectoryWrapper) Type() io.DirentType {
+	return io.DirentTypeDirectory
+}
+
 func (*DirectoryWrapper) DescribeDeprecated() io.NodeInfoDeprecated {
 	var nodeInfo io.NodeInfoDeprecated
 	nodeInfo.SetDirectory(io.DirectoryObject{})
 	return nodeInfo
 }
 
-func (*directoryState) GetConnectionInfo(fidl.Context) (io.ConnectionInfo, error) {
+func (dirState *directoryState) GetConnectionInfo(fidl.Context) (io.ConnectionInfo, error) {
 	var connectionInfo io.ConnectionInfo
-	rights := io.RStarDir
-	connectionInfo.SetRights(rights)
+	connectionInfo.SetRights(dirState.rights)
 	return connectionInfo, nil
 }
 
@@ -376,18 +478,71 @@ func (*directoryState) RemoveExtendedAttribute(fidl.Context, []uint8) (io.NodeRe
 
 const dot = "."
 
+// toZxError wraps a generic error as a *zx.Error, so it's always safe to
+// pass to respondDeprecated, which panics on anything else.
+func toZxError(err error) *zx.Error {
+	if err == nil {
+		return nil
+	}
+	if zerr, ok := err.(*zx.Error); ok {
+		return zerr
+	}
+	return &zx.Error{Status: zx.ErrIo, Text: err.Error()}
+}
+
+// checkOpenFlags reports an access-denied error if flags requests any
+// operations dirState's own connection wasn't itself granted, per
+// TODO(https://fxbug.dev/356225729).
+func (dirState *directoryState) checkOpenFlags(flags io.OpenFlags) error {
+	if requested := operationsFromOpenFlags(flags); requested&^dirState.rights != 0 {
+		return &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	return nil
+}
+
+// checkFlags is checkOpenFlags for the newer fuchsia.io/Directory.Open.
+func (dirState *directoryState) checkFlags(flags io.Flags) error {
+	if requested := operationsFromFlags(flags); requested&^dirState.rights != 0 {
+		return &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	return nil
+}
+
+// createEntry creates name within dirState's directory, if the directory
+// supports it and this connection holds ModifyDirectory rights, honoring
+// exclusive (create-if-absent) semantics.
+func (dirState *directoryState) createEntry(name string, exclusive bool) (Node, error) {
+	wd, ok := dirState.Directory.(WritableDirectory)
+	if !ok {
+		return nil, &zx.Error{Status: zx.ErrNotSupported}
+	}
+	if dirState.rights&io.OperationsModifyDirectory == 0 {
+		return nil, &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	return wd.Create(name, exclusive)
+}
+
 func (dirState *directoryState) DeprecatedOpen(ctx fidl.Context, flags io.OpenFlags, mode io.ModeType, path string, req io.NodeWithCtxInterfaceRequest) error {
 	if path == dot {
+		if err := dirState.checkOpenFlags(flags); err != nil {
+			return respondDeprecated(flags, req, toZxError(err), dirState)
+		}
 		return dirState.addConnectionDeprecated(flags, mode, req)
 	}
 	const slash = "/"
 	if strings.HasSuffix(path, slash) {
 		path = path[:len(path)-len(slash)]
 	}
+	if err := dirState.checkOpenFlags(flags); err != nil {
+		return respondDeprecated(flags, req, toZxError(err), dirState)
+	}
 
 	if i := strings.Index(path, slash); i != -1 {
 		if node, ok := dirState.Directory.Get(path[:i]); ok {
-			proxy, cleanup, err := node.getIO()
+			if rd, ok := node.(*RemoteDirectory); ok {
+				return rd.Dir.DeprecatedOpen(ctx, flags, mode, path[i+len(slash):], req)
+			}
+			proxy, cleanup, err := node.getIO(dirState.rights)
 			if err != nil {
 				return err
 			}
@@ -398,6 +553,28 @@ func (dirState *directoryState) DeprecatedOpen(ctx fidl.Context, flags io.OpenFl
 			return respondDeprecated(flags, req, &zx.Error{Status: zx.ErrNotDir}, node)
 		}
 	} else if node, ok := dirState.Directory.Get(path); ok {
+		if flags&io.OpenFlagsCreate != 0 && flags&io.OpenFlagsCreateIfAbsent != 0 {
+			return respondDeprecated(flags, req, &zx.Error{Status: zx.ErrAlreadyExists}, dirState)
+		}
+		if flags&io.OpenFlagsTruncate != 0 {
+			fw, ok := node.(*FileWrapper)
+			if !ok || flags&io.OpenRightWritable == 0 {
+				return respondDeprecated(flags, req, &zx.Error{Status: zx.ErrNotSupported}, dirState)
+			}
+			wf, ok := fw.File.(WritableFile)
+			if !ok {
+				return respondDeprecated(flags, req, &zx.Error{Status: zx.ErrNotSupported}, dirState)
+			}
+			if err := wf.Truncate(0); err != nil {
+				return respondDeprecated(flags, req, toZxError(err), dirState)
+			}
+		}
+		return node.addConnectionDeprecated(flags, mode, req)
+	} else if flags&io.OpenFlagsCreate != 0 {
+		node, err := dirState.createEntry(path, flags&io.OpenFlagsCreateIfAbsent != 0)
+		if err != nil {
+			return respondDeprecated(flags, req, toZxError(err), dirState)
+		}
 		return node.addConnectionDeprecated(flags, mode, req)
 	}
 
@@ -406,16 +583,25 @@ func (dirState *directoryState) DeprecatedOpen(ctx fidl.Context, flags io.OpenFl
 
 func (dirState *directoryState) Open(ctx fidl.Context, path string, flags io.Flags, options io.Options, channel zx.Channel) error {
 	if path == dot {
+		if err := dirState.checkFlags(flags); err != nil {
+			return CloseWithEpitaph(channel, toZxError(err).Status)
+		}
 		return dirState.addConnection(flags, channel)
 	}
 	const slash = "/"
 	if strings.HasSuffix(path, slash) {
 		path = path[:len(path)-len(slash)]
 	}
+	if err := dirState.checkFlags(flags); err != nil {
+		return CloseWithEpitaph(channel, toZxError(err).Status)
+	}
 
 	if i := strings.Index(path, slash); i != -1 {
 		if node, ok := dirState.Directory.Get(path[:i]); ok {
-			proxy, cleanup, err := node.getIO()
+			if rd, ok := node.(*RemoteDirectory); ok {
+				return rd.Dir.Open(ctx, path[i+len(slash):], flags, options, channel)
+			}
+			proxy, cleanup, err := node.getIO(dirState.rights)
 			if err != nil {
 				return err
 			}
@@ -426,81 +612,115 @@ func (dirState *directoryState) Open(ctx fidl.Context, path string, flags io.Fla
 			return CloseWithEpitaph(channel, zx.ErrNotDir)
 		}
 	} else if node, ok := dirState.Directory.Get(path); ok {
+		if flags&io.FlagsFlagCreateExclusive != 0 {
+			return CloseWithEpitaph(channel, zx.ErrAlreadyExists)
+		}
+		return node.addConnection(flags, channel)
+	} else if flags&(io.FlagsFlagMaybeCreate|io.FlagsFlagCreateExclusive) != 0 {
+		node, err := dirState.createEntry(path, flags&io.FlagsFlagCreateExclusive != 0)
+		if err != nil {
+			return CloseWithEpitaph(channel, toZxError(err).Status)
+		}
 		return node.addConnection(flags, channel)
 	}
 	return CloseWithEpitaph(channel, zx.ErrNotFound)
 }
 
-func (*directoryState) Unlink(fidl.Context, string, io.UnlinkOptions) (io.DirectoryUnlinkResult, error) {
-	return io.DirectoryUnlinkResultWithErr(int32(zx.ErrNotSupported)), nil
+func (dirState *directoryState) Unlink(_ fidl.Context, name string, _ io.UnlinkOptions) (io.DirectoryUnlinkResult, error) {
+	wd, ok := dirState.Directory.(WritableDirectory)
+	if !ok {
+		return io.DirectoryUnlinkResultWithErr(int32(zx.ErrNotSupported)), nil
+	}
+	if dirState.rights&io.OperationsModifyDirectory == 0 {
+		return io.DirectoryUnlinkResultWithErr(int32(zx.ErrAccessDenied)), nil
+	}
+	if err := wd.Remove(name); err != nil {
+		return io.DirectoryUnlinkResultWithErr(int32(toZxError(err).Status)), nil
+	}
+	return io.DirectoryUnlinkResultWithResponse(io.DirectoryUnlinkResponse{}), nil
 }
 
 func (*directoryState) CreateSymlink(fidl.Context, string, []uint8, io.SymlinkWithCtxInterfaceRequest) (io.DirectoryCreateSymlinkResult, error) {
 	return io.DirectoryCreateSymlinkResultWithErr(int32(zx.ErrNotSupported)), nil
 }
 
-func (dirState *directoryState) ReadDirents(ctx fidl.Context, maxOut uint64) (int32, []uint8, error) {
+// MaxFilename is the longest name a single dirent may encode, matching
+// the MAX_FILENAME limit documented by fuchsia.io.
+const MaxFilename = 255
+
+// direntHeaderSize is the fixed (ino, size, type) portion of a
+// syscall.Dirent record, with its embedded max-length Name array
+// excluded; a serialized dirent is this many bytes plus len(name).
+var direntHeaderSize = int(unsafe.Sizeof(syscall.Dirent{})) - int(unsafe.Sizeof(syscall.Dirent{}.Name))
+
+func (dirState *directoryState) ReadDirents(_ fidl.Context, maxOut uint64) (int32, []uint8, error) {
+	if maxOut > io.MaxBuf {
+		return int32(zx.ErrInvalidArgs), nil, nil
+	}
 	if !dirState.reading {
-		writeFn := func(name string, node Node) error {
-			ioNode, cleanup, err := node.getIO()
-			if err != nil {
-				return err
-			}
-			defer cleanup()
-			status, attr, err := ioNode.GetAttr(ctx)
-			if err != nil {
-				return err
-			}
-			if status := zx.Status(status); status != zx.ErrOk {
-				return fmt.Errorf("io.Node.GetAttr returned non-ok zx.Status %s", status)
+		names := []string{dot}
+		if err := dirState.Directory.ForEach(func(name string, _ Node) error {
+			if len(name) > MaxFilename {
+				return &zx.Error{Status: zx.ErrInvalidArgs}
 			}
-			dirent := syscall.Dirent{
-				Ino:  attr.Id,
-				Size: uint8(len(name)),
-				Type: uint8(func() io.DirentType {
-					switch modeType := attr.Mode & io.ModeTypeMask; modeType {
-					case io.ModeTypeDirectory:
-						return io.DirentTypeDirectory
-					case io.ModeTypeFile:
-						return io.DirentTypeFile
-					case io.ModeTypeService:
-						return io.DirentTypeService
-					default:
-						panic(fmt.Sprintf("unknown mode type: %b", modeType))
-					}
-				}()),
-			}
-			if err := binary.Write(&dirState.dirents, binary.LittleEndian, dirent); err != nil {
-				return err
+			names = append(names, name)
+			return nil
+		}); err != nil {
+			if zerr, ok := err.(*zx.Error); ok {
+				return int32(zerr.Status), nil, nil
 			}
-			dirState.dirents.Truncate(dirState.dirents.Len() - int(unsafe.Sizeof(syscall.Dirent{}.Name)))
-			if _, err := dirState.dirents.WriteString(name); err != nil {
-				return err
+			return 0, nil, err
+		}
+		sort.Strings(names[1:])
+		dirState.direntNames = names
+		dirState.direntPos = 0
+		dirState.reading = true
+	} else if dirState.direntPos >= len(dirState.direntNames) {
+		// A prior call drained the snapshot; behave as though Rewind had
+		// been called so the next ReadDirents re-enumerates instead of
+		// returning empty forever.
+		dirState.reading = false
+		dirState.direntNames = nil
+		return int32(zx.ErrOk), nil, nil
+	}
+
+	var buf bytes.Buffer
+	for dirState.direntPos < len(dirState.direntNames) {
+		name := dirState.direntNames[dirState.direntPos]
+		if uint64(buf.Len()+direntHeaderSize+len(name)) > maxOut {
+			break
+		}
+		node := Node(dirState)
+		if name != dot {
+			n, ok := dirState.Directory.Get(name)
+			if !ok {
+				// Removed since the snapshot was taken; skip it.
+				dirState.direntPos++
+				continue
 			}
-			return nil
+			node = n
 		}
-		if err := writeFn(dot, dirState); err != nil {
-			return 0, nil, err
+		dirent := syscall.Dirent{
+			Ino:  io.InoUnknown,
+			Size: uint8(len(name)),
+			Type: uint8(node.Type()),
 		}
-		if err := dirState.Directory.ForEach(writeFn); err != nil {
+		if err := binary.Write(&buf, binary.LittleEndian, dirent); err != nil {
 			return 0, nil, err
 		}
-		dirState.reading = true
-	} else if dirState.dirents.Len() == 0 {
-		status, err := dirState.Rewind(ctx)
-		if err != nil {
+		buf.Truncate(buf.Len() - int(unsafe.Sizeof(syscall.Dirent{}.Name)))
+		if _, err := buf.WriteString(name); err != nil {
 			return 0, nil, err
 		}
-		if status := zx.Status(status); status != zx.ErrOk {
-			return 0, nil, fmt.Errorf("dirState.Rewind(_) = %s", status)
-		}
+		dirState.direntPos++
 	}
-	return int32(zx.ErrOk), dirState.dirents.Next(int(maxOut)), nil
+	return int32(zx.ErrOk), buf.Bytes(), nil
 }
 
 func (dirState *directoryState) Rewind(fidl.Context) (int32, error) {
 	dirState.reading = false
-	dirState.dirents.Reset()
+	dirState.direntNames = nil
+	dirState.direntPos = 0
 	return int32(zx.ErrOk), nil
 }
 
@@ -516,11 +736,8 @@ func (*directoryState) Link(fidl.Context, string, zx.Handle, string) (int32, err
 	return int32(zx.ErrNotSupported), nil
 }
 
-func (*directoryState) Watch(_ fidl.Context, _ io.WatchMask, _ uint32, watcher io.DirectoryWatcherWithCtxInterfaceRequest) (int32, error) {
-	if err := watcher.Close(); err != nil {
-		logError(err)
-	}
-	return int32(zx.ErrNotSupported), nil
+func (dirState *directoryState) Watch(_ fidl.Context, mask io.WatchMask, _ uint32, watcher io.DirectoryWatcherWithCtxInterfaceRequest) (int32, error) {
+	return dirState.watch(mask, watcher)
 }
 
 func (*directoryState) DeprecatedGetFlags(fidl.Context) (int32, io.OpenFlags, error) {
@@ -557,6 +774,20 @@ type File interface {
 	GetReader() (Reader, uint64, error)
 }
 
+// BackingMemoryFile is implemented by File types that can hand a client a
+// VMO directly via fuchsia.io/File.GetBackingMemory, honoring the
+// requested io.VmoFlags, rather than falling back to duplicating whatever
+// VMO (if any) the Reader returned by GetReader happens to expose.
+type BackingMemoryFile interface {
+	File
+
+	// GetBackingMemory returns a VMO satisfying flags, e.g. a reduced-rights
+	// duplicate for a read-only request or a copy-on-write child for
+	// VmoFlagsPrivateClone. It returns a *zx.Error wrapping ErrAccessDenied
+	// if flags requests rights the file cannot grant.
+	GetBackingMemory(flags io.VmoFlags) (zx.VMO, error)
+}
+
 var _ File = (*pprofFile)(nil)
 
 type pprofFile struct {
@@ -592,9 +823,20 @@ var _ Node = (*FileWrapper)(nil)
 
 type FileWrapper struct {
 	File File
+
+	// Executable marks this file as eligible to be opened with
+	// OperationsExecute (OpenRightExecutable / FlagsPermExecute), e.g. for
+	// publishing an ELF binary that will be mapped executable by the
+	// dynamic linker. Requesting exec rights on a FileWrapper with
+	// Executable false is rejected with ZX_ERR_ACCESS_DENIED.
+	Executable bool
 }
 
-func (file *FileWrapper) getFileState() (*fileState, error) {
+// fullFileRights are the operations granted to connections obtained
+// in-process via GetFile, which bypass rights negotiation entirely.
+const fullFileRights = io.OperationsReadBytes | io.OperationsWriteBytes | io.OperationsGetAttributes | io.OperationsUpdateAttributes | io.OperationsGetBackingMemory
+
+func (file *FileWrapper) getFileState(rights io.Operations, appending bool) (*fileState, error) {
 	reader, size, err := file.File.GetReader()
 	if err != nil {
 		return nil, err
@@ -603,29 +845,38 @@ func (file *FileWrapper) getFileState() (*fileState, error) {
 		FileWrapper: file,
 		reader:      reader,
 		size:        size,
+		rights:      rights,
+		appending:   appending,
 	}, nil
 }
 
 func (file *FileWrapper) GetFile() (io.FileWithCtx, error) {
-	return file.getFileState()
+	rights := io.Operations(fullFileRights)
+	if file.Executable {
+		rights |= io.OperationsExecute
+	}
+	return file.getFileState(rights, false)
 }
 
-func (file *FileWrapper) getIO() (io.NodeWithCtx, func() error, error) {
-	state, err := file.getFileState()
+func (file *FileWrapper) getIO(rights io.Operations) (io.NodeWithCtx, func() error, error) {
+	state, err := file.getFileState(rights, false)
 	if err != nil {
 		return nil, noop, err
 	}
-	return state, state.reader.Close, nil
+	return state, state.close, nil
 }
 
 func (file *FileWrapper) addConnection(flags io.Flags, channel zx.Channel) error {
-	ioFile, err := file.getFileState()
+	if flags&io.FlagsPermExecute != 0 && !file.Executable {
+		return CloseWithEpitaph(channel, zx.ErrAccessDenied)
+	}
+	ioFile, err := file.getFileState(operationsFromFlags(flags), false)
 	if err != nil {
 		return err
 	}
 	stub := io.FileWithCtxStub{Impl: ioFile}
 	go func() {
-		defer ioFile.reader.Close()
+		defer ioFile.close()
 		Serve(context.Background(), &stub, channel, ServeOptions{
 			OnError: logError,
 		})
@@ -638,13 +889,16 @@ func (file *FileWrapper) addConnection(flags io.Flags, channel zx.Channel) error
 }
 
 func (file *FileWrapper) addConnectionDeprecated(flags io.OpenFlags, mode io.ModeType, req io.NodeWithCtxInterfaceRequest) error {
-	ioFile, err := file.getFileState()
+	if flags&io.OpenRightExecutable != 0 && !file.Executable {
+		return respondDeprecated(flags, req, &zx.Error{Status: zx.ErrAccessDenied}, file)
+	}
+	ioFile, err := file.getFileState(operationsFromOpenFlags(flags), flags&io.OpenFlagsAppend != 0)
 	if err != nil {
 		return err
 	}
 	stub := io.FileWithCtxStub{Impl: ioFile}
 	go func() {
-		defer ioFile.reader.Close()
+		defer ioFile.close()
 		Serve(context.Background(), &stub, req.Channel, ServeOptions{
 			OnError: logError,
 		})
@@ -652,6 +906,13 @@ func (file *FileWrapper) addConnectionDeprecated(flags io.OpenFlags, mode io.Mod
 	return respondDeprecated(flags, req, nil, ioFile)
 }
 
+// close releases any advisory lock fState holds and closes its reader; it
+// runs once per connection, when that connection's Serve loop returns.
+func (fState *fileState) close() error {
+	fState.releaseLocks()
+	return fState.reader.Close()
+}
+
 var _ io.FileWithCtx = (*fileState)(nil)
 
 type ReaderWithoutCloser interface {
@@ -701,6 +962,20 @@ type fileState struct {
 	*FileWrapper
 	reader Reader
 	size   uint64
+
+	// rights are the operations this connection was granted when opened;
+	// see the identically-named field on directoryState.
+	rights io.Operations
+	// appending is true if this connection was opened with
+	// OpenFlagsAppend, causing writes to target the end of the file
+	// regardless of the requested offset.
+	appending bool
+
+	// verity is non-nil once EnableVerity has sealed this file: Write,
+	// WriteAt, Resize and writable/executable GetBackingMemory requests
+	// are refused, and Read/ReadAt verify every block they serve against
+	// it.
+	verity *merkleTree
 }
 
 func (fState *fileState) DeprecatedClone(ctx fidl.Context, flags io.OpenFlags, req io.NodeWithCtxInterfaceRequest) error {
@@ -708,7 +983,7 @@ func (fState *fileState) DeprecatedClone(ctx fidl.Context, flags io.OpenFlags, r
 }
 
 func (fState *fileState) Clone(ctx fidl.Context, req unknown.CloneableWithCtxInterfaceRequest) error {
-	return fState.addConnection(io.Flags(0), req.Channel)
+	return fState.addConnection(io.Flags(fState.rights), req.Channel)
 }
 
 func (fState *fileState) Close(fidl.Context) (unknown.CloseableCloseResult, error) {
@@ -721,6 +996,10 @@ func (*FileWrapper) Representation() io.Representation {
 	return repr
 }
 
+func (*FileWrapper) Type() io.DirentType {
+	return io.DirentTypeFile
+}
+
 func (*FileWrapper) DescribeDeprecated() io.NodeInfoDeprecated {
 	var nodeInfo io.NodeInfoDeprecated
 	nodeInfo.SetFile(io.FileObject{})
@@ -738,8 +1017,7 @@ func (*fileState) LinkInto(fidl.Context, zx.Event, string) (io.LinkableLinkIntoR
 
 func (fState *fileState) GetConnectionInfo(fidl.Context) (io.ConnectionInfo, error) {
 	var connectionInfo io.ConnectionInfo
-	rights := io.RStarDir
-	connectionInfo.SetRights(rights)
+	connectionInfo.SetRights(fState.rights)
 	return connectionInfo, nil
 }
 
@@ -748,8 +1026,12 @@ func (*fileState) Sync(fidl.Context) (io.NodeSyncResult, error) {
 }
 
 func (fState *fileState) GetAttr(fidl.Context) (int32, io.NodeAttributes, error) {
+	mode := uint32(io.ModeTypeFile) | uint32(fdio.VtypeIRUSR)
+	if fState.Executable {
+		mode |= uint32(fdio.VtypeIXUSR)
+	}
 	return int32(zx.ErrOk), io.NodeAttributes{
-		Mode:        uint32(io.ModeTypeFile) | uint32(fdio.VtypeIRUSR),
+		Mode:        mode,
 		Id:          io.InoUnknown,
 		ContentSize: fState.size,
 		LinkCount:   1,
@@ -760,10 +1042,20 @@ func (*fileState) SetAttr(fidl.Context, io.NodeAttributeFlags, io.NodeAttributes
 	return int32(zx.ErrNotSupported), nil
 }
 
-func (*fileState) GetAttributes(fidl.Context, io.NodeAttributesQuery) (io.NodeGetAttributesResult, error) {
+func (fState *fileState) GetAttributes(fidl.Context, io.NodeAttributesQuery) (io.NodeGetAttributesResult, error) {
 	attrs := io.NodeAttributes2{}
 	attrs.ImmutableAttributes.SetProtocols(io.NodeProtocolKindsFile)
-	attrs.ImmutableAttributes.SetAbilities(io.OperationsReadBytes | io.OperationsGetAttributes)
+	abilities := io.OperationsReadBytes | io.OperationsGetAttributes
+	if _, ok := fState.File.(WritableFile); ok {
+		abilities |= io.OperationsWriteBytes | io.OperationsUpdateAttributes
+	}
+	if _, ok := fState.File.(BackingMemoryFile); ok {
+		abilities |= io.OperationsGetBackingMemory
+	}
+	if fState.Executable {
+		abilities |= io.OperationsExecute
+	}
+	attrs.ImmutableAttributes.SetAbilities(abilities)
 	return io.NodeGetAttributesResultWithResponse(attrs), nil
 }
 
@@ -771,40 +1063,112 @@ func (*fileState) UpdateAttributes(fidl.Context, io.MutableNodeAttributes) (io.N
 	return io.NodeUpdateAttributesResultWithErr(int32(zx.ErrNotSupported)), nil
 }
 
-func (*fileState) ListExtendedAttributes(_ fidl.Context, request io.ExtendedAttributeIteratorWithCtxInterfaceRequest) error {
-	return CloseWithEpitaph(request.Channel, zx.ErrNotSupported)
-}
-
-func (*fileState) GetExtendedAttribute(fidl.Context, []uint8) (io.NodeGetExtendedAttributeResult, error) {
-	return io.NodeGetExtendedAttributeResultWithErr(int32(zx.ErrNotSupported)), nil
-}
-
-func (*fileState) SetExtendedAttribute(fidl.Context, []uint8, io.ExtendedAttributeValue, io.SetExtendedAttributeMode) (io.NodeSetExtendedAttributeResult, error) {
-	return io.NodeSetExtendedAttributeResultWithErr(int32(zx.ErrNotSupported)), nil
-}
-
-func (*fileState) RemoveExtendedAttribute(fidl.Context, []uint8) (io.NodeRemoveExtendedAttributeResult, error) {
-	return io.NodeRemoveExtendedAttributeResultWithErr(int32(zx.ErrNotSupported)), nil
-}
+// ListExtendedAttributes, GetExtendedAttribute, SetExtendedAttribute and
+// RemoveExtendedAttribute are implemented in xattr.go.
 
 func (*fileState) Allocate(fidl.Context, uint64, uint64, io.AllocateMode) (io.FileAllocateResult, error) {
 	return io.FileAllocateResultWithErr(int32(zx.ErrNotSupported)), nil
 }
 
-func (*fileState) EnableVerity(fidl.Context, io.VerificationOptions) (io.FileEnableVerityResult, error) {
-	return io.FileEnableVerityResultWithErr(int32(zx.ErrNotSupported)), nil
+func (fState *fileState) EnableVerity(_ fidl.Context, options io.VerificationOptions) (io.FileEnableVerityResult, error) {
+	if fState.verity != nil {
+		return io.FileEnableVerityResultWithErr(int32(zx.ErrBadState)), nil
+	}
+	blockSize := uint64(verityDefaultBlockSize)
+	if options.HasBlockSize() {
+		blockSize = options.GetBlockSize()
+	}
+	var salt []byte
+	if options.HasSalt() {
+		salt = options.GetSalt()
+	}
+	mt, err := buildMerkleTree(fState.reader, fState.size, blockSize, salt)
+	if err != nil {
+		return io.FileEnableVerityResult{}, err
+	}
+	fState.verity = mt
+	return io.FileEnableVerityResultWithResponse(io.FileEnableVerityResponse{}), nil
+}
+
+// GetVerityDigest returns the root hash EnableVerity committed to, for
+// callers that want to attest to this file's contents out of band. It
+// stands in for fuchsia.io/Node.GetVerityDigest, which this binding
+// snapshot doesn't expose; wire it up directly once it is. This digest is
+// specific to this package's own Merkle tree (see merkleTree's doc
+// comment) and isn't comparable to a real fsverity measurement of the
+// same file.
+func (fState *fileState) GetVerityDigest() ([]byte, error) {
+	if fState.verity == nil {
+		return nil, &zx.Error{Status: zx.ErrBadState}
+	}
+	digest := make([]byte, len(fState.verity.root))
+	copy(digest, fState.verity.root[:])
+	return digest, nil
+}
+
+// readBufferPool holds reusable io.MaxTransferSize-capacity buffers for
+// Read/ReadAt, so serving large pseudo files doesn't allocate (and GC) a
+// fresh slice on every FIDL call.
+var readBufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, io.MaxTransferSize)
+		return &b
+	},
+}
+
+// readInto borrows a pooled buffer, fills up to count bytes of it either
+// straight out of vmo (when the reader exposes one, skipping the
+// intermediate stdio.Reader copy) or via readAt, and returns a right-sized
+// copy safe to hand to the FIDL layer after the pooled buffer is returned.
+func readInto(readAt func([]byte) (int, error), vmo *zx.VMO, vmoOffset uint64, count uint64) ([]byte, error) {
+	bufp := readBufferPool.Get().(*[]byte)
+	defer readBufferPool.Put(bufp)
+	buf := (*bufp)[:count]
+
+	var n int
+	if vmo != nil {
+		if err := vmo.Read(buf, vmoOffset); err != nil {
+			return nil, err
+		}
+		n = len(buf)
+	} else {
+		var err error
+		n, err = readAt(buf)
+		if err != nil && err != stdio.EOF {
+			return nil, err
+		}
+	}
+	b := make([]byte, n)
+	copy(b, buf[:n])
+	return b, nil
 }
 
 func (fState *fileState) Read(_ fidl.Context, count uint64) (io.ReadableReadResult, error) {
-	if l := fState.size; l < count {
+	offset, err := fState.reader.Seek(0, stdio.SeekCurrent)
+	if err != nil {
+		return io.ReadableReadResult{}, err
+	}
+	if l := fState.size - uint64(offset); l < count {
 		count = l
 	}
-	b := make([]byte, count)
-	n, err := fState.reader.Read(b)
-	if err != nil && err != stdio.EOF {
+	if count > io.MaxTransferSize {
+		count = io.MaxTransferSize
+	}
+	vmo := fState.reader.GetVMO()
+	b, err := readInto(fState.reader.Read, vmo, uint64(offset), count)
+	if err != nil {
 		return io.ReadableReadResult{}, err
 	}
-	b = b[:n]
+	if vmo != nil {
+		if _, err := fState.reader.Seek(int64(len(b)), stdio.SeekCurrent); err != nil {
+			return io.ReadableReadResult{}, err
+		}
+	}
+	if fState.verity != nil {
+		if err := fState.verifyRange(offset, b); err != nil {
+			return io.ReadableReadResult{}, err
+		}
+	}
 	return io.ReadableReadResultWithResponse(io.ReadableReadResponse{
 		Data: b,
 	}), nil
@@ -814,23 +1178,67 @@ func (fState *fileState) ReadAt(_ fidl.Context, count uint64, offset uint64) (io
 	if l := fState.size - offset; l < count {
 		count = l
 	}
-	b := make([]byte, count)
-	n, err := fState.reader.ReadAt(b, int64(offset))
-	if err != nil && err != stdio.EOF {
+	if count > io.MaxTransferSize {
+		count = io.MaxTransferSize
+	}
+	b, err := readInto(func(p []byte) (int, error) {
+		return fState.reader.ReadAt(p, int64(offset))
+	}, fState.reader.GetVMO(), offset, count)
+	if err != nil {
 		return io.FileReadAtResult{}, err
 	}
-	b = b[:n]
+	if fState.verity != nil {
+		if err := fState.verifyRange(int64(offset), b); err != nil {
+			return io.FileReadAtResult{}, err
+		}
+	}
 	return io.FileReadAtResultWithResponse(io.FileReadAtResponse{
 		Data: b,
 	}), nil
 }
 
-func (*fileState) Write(fidl.Context, []uint8) (io.WritableWriteResult, error) {
-	return io.WritableWriteResultWithErr(int32(zx.ErrNotSupported)), nil
+func (fState *fileState) Write(_ fidl.Context, data []uint8) (io.WritableWriteResult, error) {
+	writable, ok := fState.File.(WritableFile)
+	if !ok || fState.rights&io.OperationsWriteBytes == 0 || fState.verity != nil {
+		return io.WritableWriteResultWithErr(int32(zx.ErrNotSupported)), nil
+	}
+	offset := int64(fState.size)
+	if !fState.appending {
+		var err error
+		if offset, err = fState.reader.Seek(0, stdio.SeekCurrent); err != nil {
+			return io.WritableWriteResult{}, err
+		}
+	}
+	n, err := writable.WriteAt(data, offset)
+	if err != nil {
+		return io.WritableWriteResult{}, err
+	}
+	if newEnd := uint64(offset) + uint64(n); newEnd > fState.size {
+		fState.size = newEnd
+	}
+	if _, err := fState.reader.Seek(offset+int64(n), stdio.SeekStart); err != nil {
+		return io.WritableWriteResult{}, err
+	}
+	return io.WritableWriteResultWithResponse(io.WritableWriteResponse{
+		ActualCount: uint64(n),
+	}), nil
 }
 
-func (*fileState) WriteAt(fidl.Context, []uint8, uint64) (io.FileWriteAtResult, error) {
-	return io.FileWriteAtResultWithErr(int32(zx.ErrNotSupported)), nil
+func (fState *fileState) WriteAt(_ fidl.Context, data []uint8, offset uint64) (io.FileWriteAtResult, error) {
+	writable, ok := fState.File.(WritableFile)
+	if !ok || fState.rights&io.OperationsWriteBytes == 0 || fState.verity != nil {
+		return io.FileWriteAtResultWithErr(int32(zx.ErrNotSupported)), nil
+	}
+	n, err := writable.WriteAt(data, int64(offset))
+	if err != nil {
+		return io.FileWriteAtResult{}, err
+	}
+	if newEnd := offset + uint64(n); newEnd > fState.size {
+		fState.size = newEnd
+	}
+	return io.FileWriteAtResultWithResponse(io.FileWriteAtResponse{
+		ActualCount: uint64(n),
+	}), nil
 }
 
 func (fState *fileState) Seek(_ fidl.Context, origin io.SeekOrigin, offset int64) (io.FileSeekResult, error) {
@@ -841,8 +1249,16 @@ func (fState *fileState) Seek(_ fidl.Context, origin io.SeekOrigin, offset int64
 		}), err
 }
 
-func (*fileState) Resize(fidl.Context, uint64) (io.FileResizeResult, error) {
-	return io.FileResizeResultWithErr(int32(zx.ErrNotSupported)), nil
+func (fState *fileState) Resize(_ fidl.Context, length uint64) (io.FileResizeResult, error) {
+	writable, ok := fState.File.(WritableFile)
+	if !ok || fState.rights&io.OperationsWriteBytes == 0 || fState.verity != nil {
+		return io.FileResizeResultWithErr(int32(zx.ErrNotSupported)), nil
+	}
+	if err := writable.Truncate(length); err != nil {
+		return io.FileResizeResult{}, err
+	}
+	fState.size = length
+	return io.FileResizeResultWithResponse(io.FileResizeResponse{}), nil
 }
 
 func (*fileState) DeprecatedGetFlags(fidl.Context) (int32, io.OpenFlags, error) {
@@ -869,19 +1285,38 @@ func (*fileState) Query(fidl.Context) ([]byte, error) {
 	return []byte(io.FileProtocolName_), nil
 }
 
-func (fState *fileState) AdvisoryLock(fidl.Context, io.AdvisoryLockRequest) (io.AdvisoryLockingAdvisoryLockResult, error) {
-	return io.AdvisoryLockingAdvisoryLockResult{}, &zx.Error{Status: zx.ErrNotSupported, Text: fmt.Sprintf("%T", fState)}
-}
+// AdvisoryLock is implemented in lock.go.
 
-func (fState *fileState) GetBackingMemory(fidl.Context, io.VmoFlags) (io.FileGetBackingMemoryResult, error) {
+func (fState *fileState) GetBackingMemory(_ fidl.Context, flags io.VmoFlags) (io.FileGetBackingMemoryResult, error) {
+	if fState.verity != nil && flags&(io.VmoFlagsWrite|io.VmoFlagsExecute) != 0 {
+		// A VMO mapped writable or executable lets the caller (or anyone
+		// they share it with) diverge from the sealed, hashed contents
+		// without going through Write/Read, defeating verity entirely.
+		return io.FileGetBackingMemoryResultWithErr(int32(zx.ErrAccessDenied)), nil
+	}
+	if flags&io.VmoFlagsWrite != 0 && fState.rights&io.OperationsWriteBytes == 0 ||
+		flags&io.VmoFlagsExecute != 0 && fState.rights&io.OperationsExecute == 0 {
+		return io.FileGetBackingMemoryResultWithErr(int32(zx.ErrAccessDenied)), nil
+	}
+	if bm, ok := fState.FileWrapper.File.(BackingMemoryFile); ok {
+		vmo, err := bm.GetBackingMemory(flags)
+		switch err := err.(type) {
+		case nil:
+			return io.FileGetBackingMemoryResultWithResponse(io.FileGetBackingMemoryResponse{
+				Vmo: vmo,
+			}), nil
+		case *zx.Error:
+			return io.FileGetBackingMemoryResultWithErr(int32(err.Status)), nil
+		default:
+			return io.FileGetBackingMemoryResult{}, err
+		}
+	}
 	if vmo := fState.reader.GetVMO(); vmo != nil {
-		// TODO(https://fxbug.dev/356225729): The rights on the VMO we return here should be capped at
-		// the intersection of the rights in the request and those on this connection.
-		h, err := vmo.Handle().Duplicate(zx.RightSameRights)
+		h, err := fState.capBackingMemoryRights(vmo, flags)
 		switch err := err.(type) {
 		case nil:
 			return io.FileGetBackingMemoryResultWithResponse(io.FileGetBackingMemoryResponse{
-				Vmo: zx.VMO(h),
+				Vmo: h,
 			}), nil
 		case *zx.Error:
 			return io.FileGetBackingMemoryResultWithErr(int32(err.Status)), nil
@@ -891,3 +1326,37 @@ func (fState *fileState) GetBackingMemory(fidl.Context, io.VmoFlags) (io.FileGet
 	}
 	return io.FileGetBackingMemoryResultWithErr(int32(zx.ErrNotSupported)), nil
 }
+
+// capBackingMemoryRights derives a zx.Rights mask from flags, refusing any
+// right the connection itself wasn't granted, and returns either a
+// copy-on-write child of vmo (VmoFlagsPrivateClone) or a duplicate handle
+// reduced to that mask. It's the fallback used when the underlying File
+// isn't a BackingMemoryFile and so can't cap rights itself; see
+// fxbug.dev/356225729.
+func (fState *fileState) capBackingMemoryRights(vmo *zx.VMO, flags io.VmoFlags) (zx.VMO, error) {
+	if flags&io.VmoFlagsWrite != 0 && fState.rights&io.OperationsWriteBytes == 0 {
+		return zx.VMO(zx.HandleInvalid), &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	if flags&io.VmoFlagsExecute != 0 && fState.rights&io.OperationsExecute == 0 {
+		return zx.VMO(zx.HandleInvalid), &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	if flags&io.VmoFlagsPrivateClone != 0 {
+		child, err := vmo.CreateChild(zx.VMOChildOptionSnapshotAtLeastOnWrite, 0, fState.size)
+		if err != nil {
+			return zx.VMO(zx.HandleInvalid), err
+		}
+		return child, nil
+	}
+	rights := zx.RightRead | zx.RightMap | zx.RightGetProperty | zx.RightDuplicate | zx.RightTransfer
+	if flags&io.VmoFlagsWrite != 0 {
+		rights |= zx.RightWrite
+	}
+	if flags&io.VmoFlagsExecute != 0 {
+		rights |= zx.RightExecute
+	}
+	h, err := vmo.Handle().Duplicate(rights)
+	if err != nil {
+		return zx.VMO(zx.HandleInvalid), err
+	}
+	return zx.VMO(h), nil
+}
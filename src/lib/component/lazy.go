@@ -0,0 +1,66 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import "sync"
+
+// LazyDirectory is a Directory whose entries are produced on demand by a
+// caller-supplied factory rather than held in a fixed map, for publishing
+// collections whose membership isn't known up front: per-PID
+// subdirectories, /proc-style virtual trees, or (see NewPprofDirectory)
+// the process's registered pprof profiles.
+type LazyDirectory struct {
+	// GetNode resolves name to a Node, returning false if no such entry
+	// currently exists; returning false is what makes Open yield
+	// ErrNotFound for an unknown name. Required.
+	GetNode func(name string) (Node, bool)
+
+	// ForEachNode enumerates the directory's current entries, e.g. for
+	// ReadDirents. (Watch is not supported on a LazyDirectory; it only
+	// serves a NotifyingDirectory.) If nil, the directory
+	// enumerates as empty even though GetNode may still resolve names
+	// within it.
+	ForEachNode func(fn func(name string, node Node) error) error
+
+	// Cache, if true, memoizes nodes returned by GetNode so repeated Get
+	// calls for the same name return the identical Node rather than
+	// invoking GetNode again. Leave false when GetNode's Node is already
+	// cheap to construct or must reflect the entry's current state on
+	// every lookup.
+	Cache bool
+
+	mu     sync.Mutex
+	cached map[string]Node
+}
+
+var _ Directory = (*LazyDirectory)(nil)
+
+func (ld *LazyDirectory) Get(name string) (Node, bool) {
+	if ld.Cache {
+		ld.mu.Lock()
+		defer ld.mu.Unlock()
+		if node, ok := ld.cached[name]; ok {
+			return node, true
+		}
+	}
+	node, ok := ld.GetNode(name)
+	if !ok {
+		return nil, false
+	}
+	if ld.Cache {
+		if ld.cached == nil {
+			ld.cached = make(map[string]Node)
+		}
+		ld.cached[name] = node
+	}
+	return node, true
+}
+
+func (ld *LazyDirectory) ForEach(fn func(name string, node Node) error) error {
+	if ld.ForEachNode == nil {
+		return nil
+	}
+	return ld.ForEachNode(fn)
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import (
+	"sync"
+	"syscall/zx"
+	"syscall/zx/fidl"
+
+	"fidl/fuchsia/io"
+)
+
+// fileLockState is the fuchsia.io/AdvisoryLocking state shared by every
+// fileState connected to the same underlying File, keyed on the File
+// value's identity in fileLocks below. Locks are whole-file (this binding
+// doesn't carry a byte range), so holders just need their lock type
+// tracked against every other holder.
+type fileLockState struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	holders map[*fileState]io.AdvisoryLockType
+}
+
+// fileLocks maps a File to the fileLockState its connections share. A
+// sync.Map is used over a plain map+mutex since entries are looked up far
+// more often (every AdvisoryLock call) than created (once per distinct
+// File that ever takes a lock).
+var fileLocks sync.Map // File -> *fileLockState
+
+func lockStateFor(file File) *fileLockState {
+	if v, ok := fileLocks.Load(file); ok {
+		return v.(*fileLockState)
+	}
+	locks := &fileLockState{holders: make(map[*fileState]io.AdvisoryLockType)}
+	locks.cond = sync.NewCond(&locks.mu)
+	v, _ := fileLocks.LoadOrStore(file, locks)
+	return v.(*fileLockState)
+}
+
+// conflicts reports whether granting want to holder would conflict with
+// some other connection's current hold: two Read holders coexist, but a
+// Write holder conflicts with everyone else and everyone else conflicts
+// with a Write holder.
+func (locks *fileLockState) conflicts(holder *fileState, want io.AdvisoryLockType) bool {
+	for h, t := range locks.holders {
+		if h == holder {
+			continue
+		}
+		if want == io.AdvisoryLockTypeWrite || t == io.AdvisoryLockTypeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// release drops holder's lock, if any, and wakes up any connection
+// blocked in AdvisoryLock waiting for it to go away. It's called both by
+// an explicit AdvisoryLockTypeUnlock and by fileState's connection
+// teardown, so a client that closes without unlocking doesn't wedge
+// everyone else out.
+func (locks *fileLockState) release(holder *fileState) {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if _, ok := locks.holders[holder]; !ok {
+		return
+	}
+	delete(locks.holders, holder)
+	locks.cond.Broadcast()
+}
+
+// AdvisoryLock implements fuchsia.io/AdvisoryLocking.AdvisoryLock for
+// pseudo files. Overlapping Read holders succeed, a Write request
+// conflicts with any other holder, and with wait=false a conflicting
+// request returns ErrShouldWait immediately rather than blocking; with
+// wait=true it blocks until the conflicting holder releases.
+func (fState *fileState) AdvisoryLock(_ fidl.Context, request io.AdvisoryLockRequest) (io.AdvisoryLockingAdvisoryLockResult, error) {
+	if !request.HasType() {
+		return io.AdvisoryLockingAdvisoryLockResultWithErr(int32(zx.ErrInvalidArgs)), nil
+	}
+
+	locks := lockStateFor(fState.FileWrapper.File)
+	lockType := request.GetType()
+	if lockType == io.AdvisoryLockTypeUnlock {
+		locks.release(fState)
+		return io.AdvisoryLockingAdvisoryLockResultWithResponse(io.AdvisoryLockingAdvisoryLockResponse{}), nil
+	}
+
+	wait := request.HasWait() && request.GetWait()
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	for locks.conflicts(fState, lockType) {
+		if !wait {
+			return io.AdvisoryLockingAdvisoryLockResultWithErr(int32(zx.ErrShouldWait)), nil
+		}
+		locks.cond.Wait()
+	}
+	locks.holders[fState] = lockType
+	return io.AdvisoryLockingAdvisoryLockResultWithResponse(io.AdvisoryLockingAdvisoryLockResponse{}), nil
+}
+
+// releaseLocks drops any advisory lock fState holds, for connection
+// teardown. It's a no-op if fState never took a lock, and cheap even
+// then: lockStateFor only allocates a fileLockState the first time a
+// given File is locked.
+func (fState *fileState) releaseLocks() {
+	if v, ok := fileLocks.Load(fState.FileWrapper.File); ok {
+		v.(*fileLockState).release(fState)
+	}
+}
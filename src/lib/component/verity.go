@@ -0,0 +1,130 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import (
+	"crypto/sha256"
+	stdio "io"
+
+	"syscall/zx"
+)
+
+// verityDefaultBlockSize is the Merkle-tree block size EnableVerity uses
+// when the caller's VerificationOptions doesn't specify one.
+const verityDefaultBlockSize = 4096
+
+// merkleTree is the sealed hash tree a fileState commits to when
+// EnableVerity is called. Read and ReadAt check every block they serve
+// against leaves before returning it, so a file enabled for verity keeps
+// proving its contents weren't tampered with after the fact rather than
+// only at the moment EnableVerity ran.
+//
+// This is a simple binary Merkle tree over per-block SHA-256 leaves, not
+// the on-disk fsverity format: real fsverity fans each level out
+// blockSize/digestSize-to-a-block (e.g. 128-ary for 4K blocks with
+// SHA-256) and its final measurement is sha256 of an fs_verity_descriptor
+// wrapping the tree root plus size, algorithm, and salt, rather than the
+// bare root GetVerityDigest returns here. A digest produced by this code
+// will not match `fsverity digest`/a kernel fs-verity measurement of the
+// same bytes.
+type merkleTree struct {
+	blockSize uint64
+	salt      []byte
+	leaves    [][sha256.Size]byte
+	root      [sha256.Size]byte
+}
+
+// buildMerkleTree hashes size bytes read from reader in blockSize chunks,
+// zero-padding the final short chunk, then folds the leaf digests bottom
+// up into a single root, duplicating the odd node out at each level. See
+// merkleTree's doc comment for how this construction (and the digest it
+// produces) differs from real fsverity.
+func buildMerkleTree(reader ReaderWithoutCloser, size, blockSize uint64, salt []byte) (*merkleTree, error) {
+	if blockSize == 0 {
+		blockSize = verityDefaultBlockSize
+	}
+	numBlocks := (size + blockSize - 1) / blockSize
+	if numBlocks == 0 {
+		numBlocks = 1
+	}
+
+	leaves := make([][sha256.Size]byte, numBlocks)
+	block := make([]byte, blockSize)
+	for i := uint64(0); i < numBlocks; i++ {
+		for j := range block {
+			block[j] = 0
+		}
+		if _, err := reader.ReadAt(block, int64(i*blockSize)); err != nil && err != stdio.EOF {
+			return nil, err
+		}
+		leaves[i] = hashBlock(salt, block)
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([][sha256.Size]byte, (len(level)+1)/2)
+		for i := range next {
+			left := level[2*i]
+			right := left
+			if 2*i+1 < len(level) {
+				right = level[2*i+1]
+			}
+			h := sha256.New()
+			h.Write(salt)
+			h.Write(left[:])
+			h.Write(right[:])
+			copy(next[i][:], h.Sum(nil))
+		}
+		level = next
+	}
+
+	return &merkleTree{blockSize: blockSize, salt: salt, leaves: leaves, root: level[0]}, nil
+}
+
+func hashBlock(salt, block []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(block)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// verifyBlock reports whether data, zero-padded out to mt.blockSize,
+// hashes to the leaf digest recorded for the block at index.
+func (mt *merkleTree) verifyBlock(index uint64, data []byte) bool {
+	if index >= uint64(len(mt.leaves)) {
+		return false
+	}
+	padded := data
+	if uint64(len(data)) < mt.blockSize {
+		padded = make([]byte, mt.blockSize)
+		copy(padded, data)
+	}
+	return hashBlock(mt.salt, padded) == mt.leaves[index]
+}
+
+// verifyRange re-reads every block of fState's underlying reader that
+// overlaps [offset, offset+len(data)) and checks it against fState.verity,
+// so a Read/ReadAt can't hand back bytes that have drifted from the
+// digest EnableVerity sealed, even if the underlying File mutated them
+// out from under a stale in-memory copy.
+func (fState *fileState) verifyRange(offset int64, data []byte) error {
+	mt := fState.verity
+	blockSize := int64(mt.blockSize)
+	block := make([]byte, mt.blockSize)
+	for start := offset - offset%blockSize; start < offset+int64(len(data)); start += blockSize {
+		for i := range block {
+			block[i] = 0
+		}
+		if _, err := fState.reader.ReadAt(block, start); err != nil && err != stdio.EOF {
+			return err
+		}
+		if !mt.verifyBlock(uint64(start)/mt.blockSize, block) {
+			return &zx.Error{Status: zx.ErrIoDataIntegrity}
+		}
+	}
+	return nil
+}
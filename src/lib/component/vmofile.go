@@ -0,0 +1,135 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import (
+	stdio "io"
+	"syscall/zx"
+
+	"fidl/fuchsia/io"
+)
+
+// VMOFile is a File backed directly by a zx.VMO, for serving large payloads
+// (e.g. pprof profiles, ELF binaries) to clients without copying through a
+// []byte Reader first. It implements BackingMemoryFile so
+// fuchsia.io/File.GetBackingMemory hands out a VMO honoring the flags
+// requested instead of a plain duplicate of whatever GetReader exposes.
+type VMOFile struct {
+	// VMO is the backing memory object. VMOFile does not take ownership of
+	// it; callers remain responsible for closing their own handle.
+	VMO zx.VMO
+
+	// Size is the number of bytes of vmo that make up the file's contents.
+	Size uint64
+
+	// Executable indicates vmo was created with ZX_RIGHT_EXECUTE, allowing
+	// GetBackingMemory to grant VmoFlagsExecute requests.
+	Executable bool
+}
+
+var _ File = (*VMOFile)(nil)
+var _ BackingMemoryFile = (*VMOFile)(nil)
+
+// NewVMOFile returns a VMOFile serving the first size bytes of vmo. exec
+// should be true only if vmo was created with ZX_RIGHT_EXECUTE.
+func NewVMOFile(vmo zx.VMO, size uint64, exec bool) *VMOFile {
+	return &VMOFile{VMO: vmo, Size: size, Executable: exec}
+}
+
+func (f *VMOFile) GetReader() (Reader, uint64, error) {
+	h, err := f.VMO.Handle().Duplicate(zx.RightSameRights)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &vmoReader{vmo: zx.VMO(h), size: f.Size}, f.Size, nil
+}
+
+// GetBackingMemory honors flags directly rather than handing back an
+// unconditional duplicate: VmoFlagsPrivateClone gets a copy-on-write child
+// so the client can't observe or cause mutation of the shared VMO,
+// VmoFlagsExecute is refused unless f.Executable, and the plain duplicate
+// case is capped to the rights flags actually asked for.
+func (f *VMOFile) GetBackingMemory(flags io.VmoFlags) (zx.VMO, error) {
+	if flags&io.VmoFlagsExecute != 0 && !f.Executable {
+		return zx.VMO(zx.HandleInvalid), &zx.Error{Status: zx.ErrAccessDenied}
+	}
+	if flags&io.VmoFlagsPrivateClone != 0 {
+		child, err := f.VMO.CreateChild(zx.VMOChildOptionSnapshotAtLeastOnWrite, 0, f.Size)
+		if err != nil {
+			return zx.VMO(zx.HandleInvalid), err
+		}
+		return child, nil
+	}
+	rights := zx.RightRead | zx.RightMap | zx.RightGetProperty | zx.RightDuplicate | zx.RightTransfer
+	if flags&io.VmoFlagsWrite != 0 {
+		rights |= zx.RightWrite
+	}
+	if flags&io.VmoFlagsExecute != 0 {
+		rights |= zx.RightExecute
+	}
+	h, err := f.VMO.Handle().Duplicate(rights)
+	if err != nil {
+		return zx.VMO(zx.HandleInvalid), err
+	}
+	return zx.VMO(h), nil
+}
+
+// vmoReader is the Reader returned by VMOFile.GetReader, serving content
+// straight out of its own duplicated VMO handle.
+type vmoReader struct {
+	vmo    zx.VMO
+	size   uint64
+	offset int64
+}
+
+func (r *vmoReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || uint64(off) >= r.size {
+		return 0, stdio.EOF
+	}
+	n := len(p)
+	if remaining := r.size - uint64(off); uint64(n) > remaining {
+		n = int(remaining)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := r.vmo.Read(p[:n], uint64(off)); err != nil {
+		return 0, err
+	}
+	if n < len(p) {
+		return n, stdio.EOF
+	}
+	return n, nil
+}
+
+func (r *vmoReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *vmoReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case stdio.SeekStart:
+		abs = offset
+	case stdio.SeekCurrent:
+		abs = r.offset + offset
+	case stdio.SeekEnd:
+		abs = int64(r.size) + offset
+	default:
+		return 0, &zx.Error{Status: zx.ErrInvalidArgs}
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *vmoReader) Close() error {
+	return r.vmo.Handle().Close()
+}
+
+func (r *vmoReader) GetVMO() *zx.VMO {
+	return &r.vmo
+}
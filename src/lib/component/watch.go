@@ -0,0 +1,198 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import (
+	"bytes"
+	"sync"
+	"syscall/zx"
+
+	"fidl/fuchsia/io"
+)
+
+// watchBufferSize bounds how many pending mutation notifications a watcher
+// channel's goroutine will buffer before new events are dropped rather than
+// blocking the Add/Remove call that produced them.
+const watchBufferSize = 128
+
+type watchEvent struct {
+	kind io.WatchEvent
+	name string
+}
+
+// NotifyingDirectory is a mapDirectory whose Add and Remove methods notify
+// any watchers registered via directoryState.Watch, implementing the
+// fuchsia.io/Directory.Watch semantics for otherwise ordinary directories.
+type NotifyingDirectory struct {
+	mapDirectory
+
+	mu       sync.Mutex
+	watchers map[chan watchEvent]struct{}
+}
+
+var _ Directory = (*NotifyingDirectory)(nil)
+
+// NewNotifyingDirectory returns a NotifyingDirectory initially populated
+// with entries, which may be nil.
+func NewNotifyingDirectory(entries map[string]Node) *NotifyingDirectory {
+	return &NotifyingDirectory{mapDirectory: mapDirectory(entries)}
+}
+
+// Add inserts node under name, replacing any existing entry, and notifies
+// watchers of the addition.
+func (nd *NotifyingDirectory) Add(name string, node Node) {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+	if nd.mapDirectory == nil {
+		nd.mapDirectory = make(mapDirectory)
+	}
+	nd.mapDirectory[name] = node
+	nd.notifyLocked(io.WatchEventAdded, name)
+}
+
+// Remove deletes the entry named name, if present, and notifies watchers
+// of the removal.
+func (nd *NotifyingDirectory) Remove(name string) {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+	if _, ok := nd.mapDirectory[name]; !ok {
+		return
+	}
+	delete(nd.mapDirectory, name)
+	nd.notifyLocked(io.WatchEventRemoved, name)
+}
+
+func (nd *NotifyingDirectory) notifyLocked(kind io.WatchEvent, name string) {
+	for ch := range nd.watchers {
+		select {
+		case ch <- watchEvent{kind: kind, name: name}:
+		default:
+			// The watcher isn't keeping up; drop the event rather than
+			// block every other mutation on a slow reader.
+		}
+	}
+}
+
+func (nd *NotifyingDirectory) addWatcher(ch chan watchEvent) {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+	if nd.watchers == nil {
+		nd.watchers = make(map[chan watchEvent]struct{})
+	}
+	nd.watchers[ch] = struct{}{}
+}
+
+func (nd *NotifyingDirectory) removeWatcher(ch chan watchEvent) {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+	if _, ok := nd.watchers[ch]; !ok {
+		return
+	}
+	delete(nd.watchers, ch)
+	close(ch)
+}
+
+// watchDirentMaxLen is the largest name watchDirentEncoder can encode,
+// since fuchsia.io packs a watch event's name length into a single byte.
+const watchDirentMaxLen = 1<<8 - 1
+
+// watchDirentEncoder packs {event: u8, len: u8, name: [len]u8} records into
+// buf, flushing to the watcher channel via write whenever the next record
+// wouldn't fit within io.MaxBuf.
+type watchDirentEncoder struct {
+	buf   bytes.Buffer
+	write func([]byte) error
+}
+
+func (e *watchDirentEncoder) append(kind io.WatchEvent, name string) error {
+	if len(name) > watchDirentMaxLen {
+		name = name[:watchDirentMaxLen]
+	}
+	if e.buf.Len()+2+len(name) > io.MaxBuf {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte(uint8(kind))
+	e.buf.WriteByte(uint8(len(name)))
+	e.buf.WriteString(name)
+	return nil
+}
+
+func (e *watchDirentEncoder) flush() error {
+	if e.buf.Len() == 0 {
+		return nil
+	}
+	defer e.buf.Reset()
+	return e.write(e.buf.Bytes())
+}
+
+// watch implements directoryState.Watch for a dirState.Directory that
+// supports it: it streams an initial WATCH_EVENT_EXISTING per current
+// entry (if MaskExisting is set) followed by a WATCH_EVENT_IDLE marker (if
+// MaskIdle is set), then ADDED/REMOVED events as they occur, until the
+// watcher channel is closed.
+func (dirState *directoryState) watch(mask io.WatchMask, watcher io.DirectoryWatcherWithCtxInterfaceRequest) (int32, error) {
+	nd, ok := dirState.Directory.(*NotifyingDirectory)
+	if !ok {
+		if err := watcher.Close(); err != nil {
+			logError(err)
+		}
+		return int32(zx.ErrNotSupported), nil
+	}
+
+	var events chan watchEvent
+	if mask&(io.WatchMaskAdded|io.WatchMaskRemoved) != 0 {
+		events = make(chan watchEvent, watchBufferSize)
+		nd.addWatcher(events)
+	}
+
+	go func() {
+		if events != nil {
+			defer nd.removeWatcher(events)
+		}
+		defer func() {
+			if err := watcher.Close(); err != nil {
+				logError(err)
+			}
+		}()
+
+		enc := &watchDirentEncoder{write: func(b []byte) error {
+			return watcher.Channel.Write(b, nil, 0)
+		}}
+
+		if mask&io.WatchMaskExisting != 0 {
+			if err := nd.ForEach(func(name string, _ Node) error {
+				return enc.append(io.WatchEventExisting, name)
+			}); err != nil {
+				logError(err)
+				return
+			}
+		}
+		if mask&io.WatchMaskIdle != 0 {
+			if err := enc.append(io.WatchEventIdle, ""); err != nil {
+				logError(err)
+				return
+			}
+		}
+		if err := enc.flush(); err != nil {
+			logError(err)
+			return
+		}
+
+		for ev := range events {
+			if err := enc.append(ev.kind, ev.name); err != nil {
+				logError(err)
+				return
+			}
+			if err := enc.flush(); err != nil {
+				logError(err)
+				return
+			}
+		}
+	}()
+
+	return int32(zx.ErrOk), nil
+}
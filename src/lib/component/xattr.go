@@ -0,0 +1,204 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package component
+
+import (
+	"context"
+	"sync"
+	"syscall/zx"
+	"syscall/zx/fidl"
+
+	"fidl/fuchsia/io"
+)
+
+// xattrMaxNameSize and xattrMaxTotalSize cap what inMemoryXattrStore will
+// hold for a single node, mirroring fuchsia.io's own per-name and
+// per-node extended-attribute limits.
+const (
+	xattrMaxNameSize  = 255
+	xattrMaxTotalSize = 64 * 1024
+)
+
+// xattrListBatchSize bounds how many names a single
+// ExtendedAttributeIterator.GetNext response carries, keeping each
+// response comfortably within a FIDL message.
+const xattrListBatchSize = 128
+
+// XattrStore is implemented by File types that want to own their
+// extended-attribute storage (e.g. to back it with something other than
+// memory, or share it with a non-pseudo representation of the same
+// file) rather than falling back to fileState's in-memory default.
+type XattrStore interface {
+	GetExtendedAttribute(name []byte) ([]byte, error)
+	SetExtendedAttribute(name, value []byte, mode io.SetExtendedAttributeMode) error
+	RemoveExtendedAttribute(name []byte) error
+	ListExtendedAttributes() ([][]byte, error)
+}
+
+// xattrStores holds the default in-memory XattrStore for every File that
+// doesn't implement XattrStore itself, keyed on the File value's
+// identity so every connection to the same node shares one store.
+var xattrStores sync.Map // File -> *inMemoryXattrStore
+
+func (fState *fileState) xattrStore() XattrStore {
+	if xs, ok := fState.File.(XattrStore); ok {
+		return xs
+	}
+	if v, ok := xattrStores.Load(fState.File); ok {
+		return v.(*inMemoryXattrStore)
+	}
+	store := &inMemoryXattrStore{}
+	v, _ := xattrStores.LoadOrStore(fState.File, store)
+	return v.(*inMemoryXattrStore)
+}
+
+// inMemoryXattrStore is a plain map-backed XattrStore, enforcing the same
+// name-length and total-size caps fuchsia.io's own filesystems do.
+type inMemoryXattrStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (s *inMemoryXattrStore) GetExtendedAttribute(name []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[string(name)]
+	if !ok {
+		return nil, &zx.Error{Status: zx.ErrNotFound}
+	}
+	out := make([]byte, len(value))
+	copy(out, value)
+	return out, nil
+}
+
+func (s *inMemoryXattrStore) SetExtendedAttribute(name, value []byte, mode io.SetExtendedAttributeMode) error {
+	if len(name) == 0 || len(name) > xattrMaxNameSize {
+		return &zx.Error{Status: zx.ErrInvalidArgs}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.values[string(name)]
+	switch mode {
+	case io.SetExtendedAttributeModeCreate:
+		if exists {
+			return &zx.Error{Status: zx.ErrAlreadyExists}
+		}
+	case io.SetExtendedAttributeModeReplace:
+		if !exists {
+			return &zx.Error{Status: zx.ErrNotFound}
+		}
+	}
+	total := len(value)
+	for n, v := range s.values {
+		if n != string(name) {
+			total += len(v)
+		}
+	}
+	if total > xattrMaxTotalSize {
+		return &zx.Error{Status: zx.ErrNoSpace}
+	}
+	if s.values == nil {
+		s.values = make(map[string][]byte)
+	}
+	stored := make([]byte, len(value))
+	copy(stored, value)
+	s.values[string(name)] = stored
+	return nil
+}
+
+func (s *inMemoryXattrStore) RemoveExtendedAttribute(name []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[string(name)]; !ok {
+		return &zx.Error{Status: zx.ErrNotFound}
+	}
+	delete(s.values, string(name))
+	return nil
+}
+
+func (s *inMemoryXattrStore) ListExtendedAttributes() ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([][]byte, 0, len(s.values))
+	for n := range s.values {
+		names = append(names, []byte(n))
+	}
+	return names, nil
+}
+
+func (fState *fileState) GetExtendedAttribute(_ fidl.Context, name []byte) (io.NodeGetExtendedAttributeResult, error) {
+	value, err := fState.xattrStore().GetExtendedAttribute(name)
+	if err != nil {
+		if zerr, ok := err.(*zx.Error); ok {
+			return io.NodeGetExtendedAttributeResultWithErr(int32(zerr.Status)), nil
+		}
+		return io.NodeGetExtendedAttributeResult{}, err
+	}
+	return io.NodeGetExtendedAttributeResultWithResponse(io.NodeGetExtendedAttributeResponse{
+		Value: io.ExtendedAttributeValueWithBytes(value),
+	}), nil
+}
+
+func (fState *fileState) SetExtendedAttribute(_ fidl.Context, name []byte, value io.ExtendedAttributeValue, mode io.SetExtendedAttributeMode) (io.NodeSetExtendedAttributeResult, error) {
+	if value.Which() != io.ExtendedAttributeValueBytes {
+		// Buffer-backed (VMO) values are part of the protocol for
+		// attribute values too large to inline, which none of our
+		// in-process xattr stores need to support yet.
+		return io.NodeSetExtendedAttributeResultWithErr(int32(zx.ErrNotSupported)), nil
+	}
+	if err := fState.xattrStore().SetExtendedAttribute(name, value.Bytes, mode); err != nil {
+		if zerr, ok := err.(*zx.Error); ok {
+			return io.NodeSetExtendedAttributeResultWithErr(int32(zerr.Status)), nil
+		}
+		return io.NodeSetExtendedAttributeResult{}, err
+	}
+	return io.NodeSetExtendedAttributeResultWithResponse(io.NodeSetExtendedAttributeResponse{}), nil
+}
+
+func (fState *fileState) RemoveExtendedAttribute(_ fidl.Context, name []byte) (io.NodeRemoveExtendedAttributeResult, error) {
+	if err := fState.xattrStore().RemoveExtendedAttribute(name); err != nil {
+		if zerr, ok := err.(*zx.Error); ok {
+			return io.NodeRemoveExtendedAttributeResultWithErr(int32(zerr.Status)), nil
+		}
+		return io.NodeRemoveExtendedAttributeResult{}, err
+	}
+	return io.NodeRemoveExtendedAttributeResultWithResponse(io.NodeRemoveExtendedAttributeResponse{}), nil
+}
+
+func (fState *fileState) ListExtendedAttributes(_ fidl.Context, request io.ExtendedAttributeIteratorWithCtxInterfaceRequest) error {
+	names, err := fState.xattrStore().ListExtendedAttributes()
+	if err != nil {
+		return CloseWithEpitaph(request.Channel, zx.ErrInternal)
+	}
+	stub := io.ExtendedAttributeIteratorWithCtxStub{Impl: &extendedAttributeIterator{names: names}}
+	go Serve(context.Background(), &stub, request.Channel, ServeOptions{
+		OnError: logError,
+	})
+	return nil
+}
+
+// extendedAttributeIterator serves fuchsia.io/ExtendedAttributeIterator
+// over a snapshot of the node's attribute names taken when
+// ListExtendedAttributes was called, paging xattrListBatchSize names out
+// per GetNext call.
+type extendedAttributeIterator struct {
+	names [][]byte
+	pos   int
+}
+
+var _ io.ExtendedAttributeIteratorWithCtx = (*extendedAttributeIterator)(nil)
+
+func (it *extendedAttributeIterator) GetNext(fidl.Context) (io.ExtendedAttributeIteratorGetNextResult, error) {
+	end := it.pos + xattrListBatchSize
+	if end > len(it.names) {
+		end = len(it.names)
+	}
+	batch := it.names[it.pos:end]
+	it.pos = end
+	return io.ExtendedAttributeIteratorGetNextResultWithResponse(io.ExtendedAttributeIteratorGetNextResponse{
+		Attributes: batch,
+		Last:       it.pos >= len(it.names),
+	}), nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package accel selects and configures a compiler-acceleration backend
+// (ccache, cxx-rbe, sccache, or a local network cache) for `fx set`. Exactly
+// one backend prefixes the compiler at a time, so providers are tried in
+// order and the first one that's available wins. Vendor overlays can
+// register additional providers with Register without editing fx-set.
+package accel
+
+import (
+	"context"
+	"fmt"
+)
+
+// Synthetic keys that fx-set sets in the env map passed to Available,
+// alongside real OS environment variables, to convey RBE capabilities
+// probed via //tools/build/fx-set/rbe. Providers that condition on RBE
+// access (e.g. cxx-rbe) read these instead of probing RBE themselves.
+const (
+	RBESupportedEnvVar  = "_FX_SET_RBE_SUPPORTED"
+	RBERemoteExecEnvVar = "_FX_SET_RBE_REMOTE_EXEC"
+	RBECacheReadEnvVar  = "_FX_SET_RBE_CACHE_READ"
+)
+
+// Provider is a pluggable compiler-prefix accelerator.
+type Provider interface {
+	// Name identifies the provider, used in --accel=<name> and to key
+	// disabled/forced provider sets.
+	Name() string
+
+	// Available reports whether this provider can be used given the
+	// environment, e.g. whether its cache directory or daemon is reachable.
+	Available(ctx context.Context, env map[string]string) (bool, error)
+
+	// GnArgs returns the GN args to append when this provider is selected.
+	GnArgs() []string
+}
+
+var registry []Provider
+
+// Register adds a provider to the set resolved by Resolve. Called from
+// package init functions, including those of vendor overlays that import
+// this package solely for the side effect of registering a provider.
+func Register(p Provider) {
+	registry = append(registry, p)
+}
+
+// Resolve picks the first available provider from order (a preference list
+// of provider names, e.g. from --accel=sccache,ccache), skipping any name in
+// disabled. An empty order considers every registered provider, in
+// registration order. Resolve returns a nil Provider, not an error, if none
+// of the candidates are available.
+func Resolve(ctx context.Context, env map[string]string, order []string, disabled map[string]bool) (Provider, error) {
+	candidates := registry
+	if len(order) != 0 {
+		byName := make(map[string]Provider, len(registry))
+		for _, p := range registry {
+			byName[p.Name()] = p
+		}
+		candidates = make([]Provider, 0, len(order))
+		for _, name := range order {
+			p, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown --accel provider %q", name)
+			}
+			candidates = append(candidates, p)
+		}
+	}
+
+	for _, p := range candidates {
+		if disabled[p.Name()] {
+			continue
+		}
+		ok, err := p.Available(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s availability: %w", p.Name(), err)
+		}
+		if ok {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
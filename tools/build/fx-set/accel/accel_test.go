@@ -0,0 +1,82 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package accel
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeProvider struct {
+	name      string
+	available bool
+	err       error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Available(ctx context.Context, env map[string]string) (bool, error) {
+	return p.available, p.err
+}
+
+func (p *fakeProvider) GnArgs() []string { return []string{p.name + "_enable=true"} }
+
+func TestResolvePicksFirstAvailableInOrder(t *testing.T) {
+	a := &fakeProvider{name: "a", available: false}
+	b := &fakeProvider{name: "b", available: true}
+	c := &fakeProvider{name: "c", available: true}
+
+	got, err := resolveAmong(t, []Provider{a, b, c}, []string{"a", "b", "c"}, nil)
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got == nil || got.Name() != "b" {
+		t.Errorf("Resolve() = %v, want provider %q", got, "b")
+	}
+}
+
+func TestResolveSkipsDisabled(t *testing.T) {
+	a := &fakeProvider{name: "a", available: true}
+	b := &fakeProvider{name: "b", available: true}
+
+	got, err := resolveAmong(t, []Provider{a, b}, []string{"a", "b"}, map[string]bool{"a": true})
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got == nil || got.Name() != "b" {
+		t.Errorf("Resolve() = %v, want provider %q", got, "b")
+	}
+}
+
+func TestResolveNoneAvailable(t *testing.T) {
+	a := &fakeProvider{name: "a", available: false}
+
+	got, err := resolveAmong(t, []Provider{a}, []string{"a"}, nil)
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got != nil {
+		t.Errorf("Resolve() = %v, want nil", got)
+	}
+}
+
+func TestResolveUnknownOrderName(t *testing.T) {
+	a := &fakeProvider{name: "a", available: true}
+
+	if _, err := resolveAmong(t, []Provider{a}, []string{"nonexistent"}, nil); err == nil {
+		t.Error("Resolve() with an unregistered name succeeded, want an error")
+	}
+}
+
+// resolveAmong runs Resolve against a temporary registry containing only
+// providers, restoring the real registry afterwards so tests don't leak
+// state into the package-level provider list used by production code.
+func resolveAmong(t *testing.T, providers []Provider, order []string, disabled map[string]bool) (Provider, error) {
+	t.Helper()
+	saved := registry
+	registry = providers
+	t.Cleanup(func() { registry = saved })
+	return Resolve(context.Background(), nil, order, disabled)
+}
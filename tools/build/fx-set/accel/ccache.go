@@ -0,0 +1,45 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package accel
+
+import (
+	"context"
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/osmisc"
+)
+
+// ccacheDirEnvVar points at the directory in which ccache artifacts should
+// be cached between builds.
+const ccacheDirEnvVar = "CCACHE_DIR"
+
+func init() {
+	Register(&ccacheProvider{})
+}
+
+// ccacheProvider is available whenever CCACHE_DIR is set to an existing
+// directory.
+type ccacheProvider struct{}
+
+func (*ccacheProvider) Name() string { return "ccache" }
+
+func (*ccacheProvider) Available(ctx context.Context, env map[string]string) (bool, error) {
+	dir := env[ccacheDirEnvVar]
+	if dir == "" {
+		return false, nil
+	}
+	isDir, err := osmisc.IsDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("checking existence of $%s: %w", ccacheDirEnvVar, err)
+	}
+	if !isDir {
+		return false, fmt.Errorf("$%s=%s does not exist or is a regular file", ccacheDirEnvVar, dir)
+	}
+	return true, nil
+}
+
+func (*ccacheProvider) GnArgs() []string {
+	return []string{"use_ccache=true"}
+}
@@ -0,0 +1,28 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package accel
+
+import "context"
+
+func init() {
+	Register(&cxxRbeProvider{})
+}
+
+// cxxRbeProvider is available whenever RBE remote execution is supported
+// and the caller has access to it. Unlike the other providers, selecting
+// cxx-rbe doesn't just append a GN arg: it also flips fintpb.Static's
+// dedicated CxxRbeEnable field, which callers handle specially by checking
+// Name() == "cxx-rbe" after resolution.
+type cxxRbeProvider struct{}
+
+func (*cxxRbeProvider) Name() string { return "cxx-rbe" }
+
+func (*cxxRbeProvider) Available(ctx context.Context, env map[string]string) (bool, error) {
+	return env[RBESupportedEnvVar] == "1" && env[RBERemoteExecEnvVar] == "1", nil
+}
+
+func (*cxxRbeProvider) GnArgs() []string {
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package accel
+
+import (
+	"context"
+	"fmt"
+)
+
+// netCacheAddrEnvVar points at a distcc-style local network compilation
+// cache, e.g. "cache.lan:8086". Set by a vendor's site-local tooling.
+const netCacheAddrEnvVar = "FUCHSIA_NETCACHE_ADDR"
+
+func init() {
+	Register(&netCacheProvider{})
+}
+
+// netCacheProvider is available whenever FUCHSIA_NETCACHE_ADDR points at a
+// site-local compilation cache, for teams that run their own distcc-style
+// cache rather than ccache or RBE.
+type netCacheProvider struct {
+	// addr is recorded by Available so GnArgs can embed it; fx-set resolves
+	// a single provider per invocation, so this isn't meant to be reused
+	// across concurrent resolutions.
+	addr string
+}
+
+func (*netCacheProvider) Name() string { return "netcache" }
+
+func (p *netCacheProvider) Available(ctx context.Context, env map[string]string) (bool, error) {
+	p.addr = env[netCacheAddrEnvVar]
+	return p.addr != "", nil
+}
+
+func (p *netCacheProvider) GnArgs() []string {
+	return []string{
+		"netcache_enable=true",
+		fmt.Sprintf("netcache_addr=%q", p.addr),
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package accel
+
+import (
+	"context"
+	"os/exec"
+)
+
+// sccacheBinEnvVar optionally overrides the sccache binary used to probe
+// availability; defaults to looking up "sccache" on $PATH.
+const sccacheBinEnvVar = "SCCACHE_BIN"
+
+func init() {
+	Register(&sccacheProvider{})
+}
+
+// sccacheProvider is available whenever an sccache binary can be found,
+// either via $SCCACHE_BIN or on $PATH. sccache is Mozilla's ccache
+// successor with native Rust support, and many contributors already have
+// it installed for other Rust projects.
+type sccacheProvider struct{}
+
+func (*sccacheProvider) Name() string { return "sccache" }
+
+func (*sccacheProvider) Available(ctx context.Context, env map[string]string) (bool, error) {
+	bin := env[sccacheBinEnvVar]
+	if bin == "" {
+		bin = "sccache"
+	}
+	_, err := exec.LookPath(bin)
+	return err == nil, nil
+}
+
+func (*sccacheProvider) GnArgs() []string {
+	return []string{"use_sccache=true"}
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -16,9 +17,14 @@ import (
 	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	flag "github.com/spf13/pflag"
 
+	"go.fuchsia.dev/fuchsia/tools/build/fx-set/accel"
+	"go.fuchsia.dev/fuchsia/tools/build/fx-set/history"
+	"go.fuchsia.dev/fuchsia/tools/build/fx-set/rbe"
+	"go.fuchsia.dev/fuchsia/tools/build/gnlabel"
 	"go.fuchsia.dev/fuchsia/tools/integration/fint"
 	fintpb "go.fuchsia.dev/fuchsia/tools/integration/fint/proto"
 	"go.fuchsia.dev/fuchsia/tools/lib/color"
@@ -38,12 +44,19 @@ const (
 	// Populated when fx's top-level `--dir` flag is set. Guaranteed to be absolute.
 	buildDirEnvVar = "_FX_BUILD_DIR"
 
+	// Optional env var letting a developer or vendor overlay point at a
+	// non-default RBE instance for the access probe.
+	rbeInstanceEnvVar = "FUCHSIA_RBE_INSTANCE"
+
 	// We'll fall back to using this build dir if neither `fx --dir` nor `fx set
 	// --auto-dir` is specified.
 	defaultBuildDir = "out/default"
 
 	// When unspecified, this is used for --rbe-mode.
 	defaultRbeMode = "auto"
+
+	// Used for --rbe-instance when rbeInstanceEnvVar isn't set.
+	defaultRbeInstance = "projects/fuchsia-infra/instances/default_instance"
 )
 
 type subprocessRunner interface {
@@ -107,23 +120,64 @@ func mainImpl(ctx context.Context) error {
 		}
 	}
 
+	historyPath := history.Path(args.checkoutDir)
+
+	if args.listHistory {
+		entries, err := history.Load(historyPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("loading set history: %w", err)
+		}
+		fmt.Print(history.Format(entries))
+		return nil
+	}
+
+	if len(args.diffHistory) != 0 {
+		entries, err := history.Load(historyPath)
+		if err != nil {
+			return fmt.Errorf("loading set history: %w", err)
+		}
+		a, err := history.Resolve(entries, args.diffHistory[0])
+		if err != nil {
+			return err
+		}
+		b, err := history.Resolve(entries, args.diffHistory[1])
+		if err != nil {
+			return err
+		}
+		fmt.Print(history.Diff(a, b))
+		return nil
+	}
+
 	fx := fxRunner{
 		sr:          &subprocess.Runner{},
 		checkoutDir: args.checkoutDir,
 	}
 
 	var staticSpec *fintpb.Static
-	canUseRbe, err := canAccessRbe(args.checkoutDir)
-	if err != nil {
-		fmt.Printf("Unable to determine RBE access, assuming False.")
-		canUseRbe = false
-	}
-	if args.fintParamsPath == "" {
-		staticSpec, err = constructStaticSpec(args.checkoutDir, args, canUseRbe)
+	if args.restoreSpec != "" {
+		entries, err := history.Load(historyPath)
+		if err != nil {
+			return fmt.Errorf("loading set history: %w", err)
+		}
+		entry, err := history.Resolve(entries, args.restoreSpec)
 		if err != nil {
 			return err
 		}
-	} else {
+		staticSpec = entry.Static
+		contextSpec := &fintpb.Context{
+			CheckoutDir: args.checkoutDir,
+			BuildDir:    filepath.Join(args.checkoutDir, args.buildDir),
+		}
+		return runSet(ctx, &fx, args, historyPath, staticSpec, contextSpec)
+	}
+
+	access, err := rbe.Probe(ctx, args.rbeInstance)
+	if err != nil {
+		fmt.Printf("Unable to determine RBE access, assuming none: %s\n", err)
+		access = rbe.Access{}
+	}
+	switch {
+	case args.fintParamsPath != "":
 		path := args.fintParamsPath
 		if !filepath.IsAbs(path) {
 			path = filepath.Join(args.checkoutDir, path)
@@ -133,10 +187,33 @@ func mainImpl(ctx context.Context) error {
 			return err
 		}
 		staticSpec.GnArgs = append(staticSpec.GnArgs, args.gnArgs...)
-		staticSpec, err = applyRbeSettings(staticSpec, args, canUseRbe)
+		staticSpec, err = applyRbeSettings(ctx, staticSpec, args, access)
+		if err != nil {
+			return err
+		}
+	case args.profileName != "":
+		profilePath, err := findSetProfile(args.checkoutDir, args.profileName)
+		if err != nil {
+			return err
+		}
+		staticSpec, err = fint.ReadStatic(profilePath)
 		if err != nil {
 			return err
 		}
+		staticSpec.GnArgs = append(staticSpec.GnArgs, args.gnArgs...)
+		staticSpec, err = applyRbeSettings(ctx, staticSpec, args, access)
+		if err != nil {
+			return err
+		}
+	default:
+		staticSpec, err = constructStaticSpec(ctx, args.checkoutDir, args, access)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := preflightValidateLabels(args); err != nil {
+		return err
 	}
 
 	contextSpec := &fintpb.Context{
@@ -144,7 +221,61 @@ func mainImpl(ctx context.Context) error {
 		BuildDir:    filepath.Join(args.checkoutDir, args.buildDir),
 	}
 
-	_, err = fint.Set(ctx, staticSpec, contextSpec, args.skipLocalArgs, args.assemblyOverrideStrings)
+	return runSet(ctx, &fx, args, historyPath, staticSpec, contextSpec)
+}
+
+// preflightValidateLabels syntactically parses every user-supplied GN label
+// and variant selector and, for concrete (non-wildcard) labels, checks that
+// they plausibly refer to a real target. This catches a typo like
+// `--with //src/foo:bar` in milliseconds instead of minutes later inside
+// `gn gen`.
+func preflightValidateLabels(args *setArgs) error {
+	var errs []string
+
+	checkLabels := func(flagName string, labels []string) {
+		for _, raw := range labels {
+			label, err := gnlabel.Parse(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q: %s", flagName, raw, err))
+				continue
+			}
+			if label.Wildcard {
+				// Wildcards match an unknown set of targets generated by
+				// GN templates, so they're accepted without any check,
+				// not even of the directory existing.
+				continue
+			}
+			if err := gnlabel.CheckExists(args.checkoutDir, label); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q: %s", flagName, raw, err))
+			}
+		}
+	}
+	checkLabels("--with", args.universePackages)
+	checkLabels("--with-host", args.hostLabels)
+	checkLabels("--with-test", args.testLabels)
+
+	for _, v := range args.variants {
+		if !strings.HasPrefix(v, "{") {
+			// A bare variant name, e.g. --variant=asan, rather than a
+			// scoped selector; nothing to parse.
+			continue
+		}
+		if _, err := gnlabel.ParseVariantSelector(v); err != nil {
+			errs = append(errs, fmt.Sprintf("--variant %q: %s", v, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid GN label(s):\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// runSet runs fint.Set against the given static and context specs, points
+// subsequent fx commands at the resulting build dir, and records the
+// resolved configuration to the set history at historyPath.
+func runSet(ctx context.Context, fx *fxRunner, args *setArgs, historyPath string, staticSpec *fintpb.Static, contextSpec *fintpb.Context) error {
+	artifacts, err := fint.Set(ctx, staticSpec, contextSpec, args.skipLocalArgs, args.assemblyOverrideStrings)
 	if err != nil {
 		return err
 	}
@@ -158,17 +289,114 @@ func mainImpl(ctx context.Context) error {
 		return fmt.Errorf("failed to set build directory: %w", err)
 	}
 
+	if args.emitArtifactsPath != "" {
+		if err := writeSetSummary(args.emitArtifactsPath, staticSpec, artifacts, buildDir); err != nil {
+			return fmt.Errorf("failed to write --emit-artifacts output: %w", err)
+		}
+	}
+
+	entry := history.Entry{
+		Timestamp:       time.Now(),
+		IntegrationHead: gitHead(filepath.Join(args.checkoutDir, "integration")),
+		RawArgs:         os.Args[1:],
+		Static:          staticSpec,
+	}
+	if err := history.Append(historyPath, entry); err != nil {
+		fmt.Printf("Warning: failed to record set history: %s\n", err)
+	}
+
 	return nil
 }
 
+// gitHead returns the current HEAD commit hash of the git repository rooted
+// at dir, or "" if it can't be determined, e.g. because //integration isn't
+// checked out as its own git repository in this checkout layout.
+func gitHead(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// setSummary is a stable, machine-readable summary of a resolved `fx set`
+// configuration, written by --emit-artifacts so that IDE plugins and other
+// tooling can reflect the active configuration without having to parse
+// args.gn or log output.
+type setSummary struct {
+	Product         string               `json:"product"`
+	Board           string               `json:"board"`
+	CompilationMode string               `json:"compilation_mode"`
+	RbeMode         string               `json:"rbe_mode"`
+	BuildDir        string               `json:"build_dir"`
+	Variants        []string             `json:"variants"`
+	GnArgs          []string             `json:"gn_args"`
+	Artifacts       *fintpb.SetArtifacts `json:"artifacts,omitempty"`
+}
+
+// writeSetSummary writes a JSON-encoded setSummary for the resolved
+// configuration to path.
+func writeSetSummary(path string, static *fintpb.Static, artifacts *fintpb.SetArtifacts, buildDir string) error {
+	summary := setSummary{
+		Product:         static.Product,
+		Board:           static.Board,
+		CompilationMode: static.CompilationMode.String(),
+		RbeMode:         rbeModeFromGnArgs(static.GnArgs),
+		BuildDir:        buildDir,
+		Variants:        static.Variants,
+		GnArgs:          static.GnArgs,
+		Artifacts:       artifacts,
+	}
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// rbeModeFromGnArgs recovers the rbe_mode GN arg that applyRbeSettings
+// always appends, so --emit-artifacts can report the resolved mode without
+// re-deriving it.
+func rbeModeFromGnArgs(gnArgs []string) string {
+	const prefix = `rbe_mode="`
+	for _, a := range gnArgs {
+		if strings.HasPrefix(a, prefix) && strings.HasSuffix(a, `"`) {
+			return strings.TrimSuffix(strings.TrimPrefix(a, prefix), `"`)
+		}
+	}
+	return ""
+}
+
 type setArgs struct {
 	verbose        bool
 	fintParamsPath string
 
+	// profileName is the name of a checked-in "set profile" to load, i.e.
+	// the basename of a file in build/set-profiles (or a vendor overlay's
+	// build/set-profiles). Any `--args` passed alongside `--profile` are
+	// appended to the profile's GN args, the same way they are for
+	// `--fint-params-path`.
+	profileName string
+
 	checkoutDir   string
 	buildDir      string
 	skipLocalArgs bool
 
+	// rbeInstance is the RBE instance to probe for access when resolving
+	// --rbe-mode=auto; see rbeInstanceEnvVar.
+	rbeInstance string
+
+	// emitArtifactsPath, if set, is where a JSON setSummary of the resolved
+	// configuration is written after a successful `fx set`.
+	emitArtifactsPath string
+
+	// listHistory, restoreSpec, and diffHistory select the `--list-history`,
+	// `--restore`, and `--diff` history subcommands; see
+	// //tools/build/fx-set/history.
+	listHistory bool
+	restoreSpec string
+	diffHistory []string
+
 	// Flags passed to GN.
 	board     string
 	product   string
@@ -188,6 +416,18 @@ type setArgs struct {
 	enableCxxRbe  bool
 	disableCxxRbe bool
 
+	enableSccache  bool
+	disableSccache bool
+
+	enableNetCache  bool
+	disableNetCache bool
+
+	// accelOrder is the --accel preference list of compiler-acceleration
+	// provider names to try, in order; see //tools/build/fx-set/accel.
+	// Empty means the default order ccache, cxx-rbe, sccache; see
+	// resolveAccel.
+	accelOrder []string
+
 	buildEventService string
 
 	mainPbLabel string
@@ -223,6 +463,11 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 
 	cmd.buildDir = env[buildDirEnvVar] // Not required.
 
+	cmd.rbeInstance = env[rbeInstanceEnvVar]
+	if cmd.rbeInstance == "" {
+		cmd.rbeInstance = defaultRbeInstance
+	}
+
 	flagSet := flag.NewFlagSet("fx set", flag.ExitOnError)
 	// TODO(olivernewman): Decide whether to have this tool print usage or
 	// to let //tools/devshell/set handle usage.
@@ -240,6 +485,11 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 	flagSet.BoolVar(&cmd.verbose, "verbose", false, "")
 	flagSet.BoolVar(&autoDir, "auto-dir", false, "")
 	flagSet.StringVar(&cmd.fintParamsPath, "fint-params-path", "", "")
+	flagSet.StringVar(&cmd.profileName, "profile", "", "")
+	flagSet.StringVar(&cmd.emitArtifactsPath, "emit-artifacts", "", "")
+	flagSet.BoolVar(&cmd.listHistory, "list-history", false, "")
+	flagSet.StringVar(&cmd.restoreSpec, "restore", "", "")
+	flagSet.StringSliceVar(&cmd.diffHistory, "diff", []string{}, "")
 	flagSet.BoolVar(&cmd.useCcache, "ccache", false, "")
 	flagSet.BoolVar(&cmd.noCcache, "no-ccache", false, "")
 	flagSet.BoolVar(&cmd.includeClippy, "include-clippy", true, "")
@@ -250,6 +500,11 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 	flagSet.BoolVar(&cmd.disableCxxRbe, "no-cxx-rbe", false, "")
 	flagSet.BoolVar(&cmd.enableLinkRbe, "link-rbe", false, "")
 	flagSet.BoolVar(&cmd.enableBazelRbe, "bazel-rbe", false, "")
+	flagSet.BoolVar(&cmd.enableSccache, "sccache", false, "")
+	flagSet.BoolVar(&cmd.disableSccache, "no-sccache", false, "")
+	flagSet.BoolVar(&cmd.enableNetCache, "netcache", false, "")
+	flagSet.BoolVar(&cmd.disableNetCache, "no-netcache", false, "")
+	flagSet.StringSliceVar(&cmd.accelOrder, "accel", []string{}, "")
 
 	flagSet.StringVar(&cmd.buildEventService, "bes", "", "")
 
@@ -278,6 +533,32 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 		return nil, err
 	}
 
+	if cmd.fintParamsPath != "" && cmd.profileName != "" {
+		return nil, fmt.Errorf("--fint-params-path and --profile are mutually exclusive")
+	}
+
+	// --list-history, --restore, and --diff are history subcommands. Only
+	// --restore sets up a build, and it takes its whole configuration from
+	// the history entry, so they skip all the other validation below.
+	if cmd.listHistory || cmd.restoreSpec != "" || len(cmd.diffHistory) != 0 {
+		if cmd.buildDir == "" {
+			cmd.buildDir = defaultBuildDir
+		}
+		if len(cmd.diffHistory) != 0 && len(cmd.diffHistory) != 2 {
+			return nil, fmt.Errorf("--diff takes exactly two history references, got %d", len(cmd.diffHistory))
+		}
+		numSelected := 0
+		for _, selected := range []bool{cmd.listHistory, cmd.restoreSpec != "", len(cmd.diffHistory) != 0} {
+			if selected {
+				numSelected++
+			}
+		}
+		if numSelected > 1 {
+			return nil, fmt.Errorf("--list-history, --restore, and --diff are mutually exclusive")
+		}
+		return cmd, nil
+	}
+
 	if len(cmd.basePackages) != 0 || len(cmd.cachePackages) != 0 {
 		message := "The --with-base and --with-cache arguments have been removed.\n" +
 			"\n" +
@@ -306,6 +587,16 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 		return cmd, nil
 	}
 
+	// Like --fint-params-path, a --profile fully specifies product/board and
+	// everything else that would normally come from the PRODUCT.BOARD
+	// argument and GN-related flags, so skip the rest of the validation.
+	if cmd.profileName != "" {
+		if autoDir {
+			return nil, fmt.Errorf("--auto-dir is not supported with --profile")
+		}
+		return cmd, nil
+	}
+
 	if cmd.useCcache && cmd.noCcache {
 		return nil, fmt.Errorf("--ccache and --no-ccache are mutually exclusive")
 	}
@@ -316,6 +607,12 @@ func parseArgsAndEnv(args []string, env map[string]string) (*setArgs, error) {
 	if cmd.enableCxxRbe && cmd.disableCxxRbe {
 		return nil, fmt.Errorf("--cxx-rbe and --no-cxx-rbe are mutually exclusive")
 	}
+	if cmd.enableSccache && cmd.disableSccache {
+		return nil, fmt.Errorf("--sccache and --no-sccache are mutually exclusive")
+	}
+	if cmd.enableNetCache && cmd.disableNetCache {
+		return nil, fmt.Errorf("--netcache and --no-netcache are mutually exclusive")
+	}
 
 	if flagSet.NArg() == 0 {
 		return nil, fmt.Errorf("missing a PRODUCT.BOARD argument")
@@ -368,7 +665,7 @@ func rbeHostType() string {
 	}
 }
 
-func constructStaticSpec(checkoutDir string, args *setArgs, canUseRbe bool) (*fintpb.Static, error) {
+func constructStaticSpec(ctx context.Context, checkoutDir string, args *setArgs, access rbe.Access) (*fintpb.Static, error) {
 	productPath, err := findGNIFile(checkoutDir, "products", args.product)
 	if err != nil {
 		productPath, err = findGNIFile(checkoutDir, filepath.Join("products", "tests"), args.product)
@@ -432,16 +729,21 @@ func constructStaticSpec(checkoutDir string, args *setArgs, canUseRbe bool) (*fi
 		JsonIdeScripts:      args.jsonIDEScripts,
 		ExportRustProject:   true,
 	}
-	return applyRbeSettings(static, args, canUseRbe)
+	return applyRbeSettings(ctx, static, args, access)
 }
 
-func applyRbeSettings(static *fintpb.Static, args *setArgs, canUseRbe bool) (*fintpb.Static, error) {
+func applyRbeSettings(ctx context.Context, static *fintpb.Static, args *setArgs, access rbe.Access) (*fintpb.Static, error) {
 	rbeSupported := rbeIsSupported()
 	rbeMode := args.rbeMode
 	if rbeMode == "auto" {
-		if rbeSupported && canUseRbe {
+		switch {
+		case !rbeSupported:
+			rbeMode = "off"
+		case access.RemoteExec:
 			rbeMode = rbeHostType()
-		} else {
+		case access.CacheRead:
+			rbeMode = "cache-only"
+		default:
 			rbeMode = "off"
 		}
 	}
@@ -452,52 +754,27 @@ func applyRbeSettings(static *fintpb.Static, args *setArgs, canUseRbe bool) (*fi
 		if !rbeSupported {
 			return nil, fmt.Errorf("Sorry, RBE is only supported on linux-x64 at this time.")
 		}
-		if !canUseRbe {
-			fmt.Printf("Note: RBE is not publicly accessible at this time.")
+		if rbeMode == "cache-only" && !access.CacheRead {
+			return nil, fmt.Errorf("--rbe-mode=cache-only requires RBE cache-read access, which this account does not have")
 		}
-	}
-
-	var (
-		// These variables eventually represent our final decisions of whether
-		// to use a compiler prefix, since the logic is somewhat convoluted.
-		useCxxRbeFinal bool
-		useCcacheFinal bool
-	)
-
-	// Check CCACHE_DIR if it is specified.
-	if !(args.useCcache || args.noCcache) {
-		if args.ccacheDir != "" {
-			isDir, err := osmisc.IsDir(args.ccacheDir)
-			if err != nil {
-				return nil, fmt.Errorf("failed to check existence of $%s: %w", ccacheDirEnvVar, err)
-			}
-			if !isDir {
-				return nil, fmt.Errorf("$%s=%s does not exist or is a regular file", ccacheDirEnvVar, args.ccacheDir)
+		if rbeMode != "cache-only" && !access.RemoteExec {
+			if access.CacheRead {
+				return nil, fmt.Errorf("this account only has RBE cache-read access; pass --rbe-mode=cache-only or request remote-execution access")
 			}
-			useCcacheFinal = true
-		}
-	}
-
-	// The old behavior enabled Goma by default, but now that Goma
-	// is deprecated, we replace it by enabling --cxx-rbe by default
-	// only on supported platforms.
-	if args.enableCxxRbe {
-		useCxxRbeFinal = true
-	} else if !args.disableCxxRbe {
-		if rbeSupported && canUseRbe && !args.useCcache && rbeMode != "off" {
-			useCxxRbeFinal = true
+			fmt.Printf("Note: RBE is not publicly accessible at this time.")
 		}
 	}
 
-	if args.useCcache {
-		useCcacheFinal = true
-	} else if args.noCcache {
-		useCcacheFinal = false
+	provider, err := resolveAccel(ctx, args, rbeSupported, rbeMode, access)
+	if err != nil {
+		return nil, err
 	}
 
 	gnArgs := static.GnArgs
-	if useCcacheFinal {
-		gnArgs = append(gnArgs, "use_ccache=true")
+	cxxRbeEnable := false
+	if provider != nil {
+		gnArgs = append(gnArgs, provider.GnArgs()...)
+		cxxRbeEnable = provider.Name() == "cxx-rbe"
 	}
 
 	// Always write out rbe_mode, even if it is the default "off".
@@ -505,10 +782,71 @@ func applyRbeSettings(static *fintpb.Static, args *setArgs, canUseRbe bool) (*fi
 	gnArgs = append(gnArgs, fmt.Sprintf("rbe_mode=\"%s\"", rbeMode))
 
 	static.GnArgs = gnArgs
-	static.CxxRbeEnable = useCxxRbeFinal
+	static.CxxRbeEnable = cxxRbeEnable
 	return static, nil
 }
 
+// resolveAccel picks the single compiler-acceleration provider (if any) to
+// use, given the providers registered in //tools/build/fx-set/accel. The
+// old behavior enabled Goma by default, but now that Goma is deprecated, we
+// replace it by preferring cxx-rbe by default only on supported platforms,
+// the same way the pre-refactor useCxxRbeFinal/useCcacheFinal booleans did.
+func resolveAccel(ctx context.Context, args *setArgs, rbeSupported bool, rbeMode string, access rbe.Access) (accel.Provider, error) {
+	env := map[string]string{ccacheDirEnvVar: args.ccacheDir}
+	if rbeSupported {
+		env[accel.RBESupportedEnvVar] = "1"
+	}
+	if access.RemoteExec && rbeMode != "off" {
+		env[accel.RBERemoteExecEnvVar] = "1"
+	}
+	if access.CacheRead {
+		env[accel.RBECacheReadEnvVar] = "1"
+	}
+
+	disabled := map[string]bool{}
+	if args.noCcache {
+		disabled["ccache"] = true
+	}
+	if args.disableCxxRbe {
+		disabled["cxx-rbe"] = true
+	}
+	if args.disableSccache {
+		disabled["sccache"] = true
+	}
+	if args.disableNetCache {
+		disabled["netcache"] = true
+	}
+
+	var forced []string
+	if args.useCcache {
+		forced = append(forced, "ccache")
+	}
+	if args.enableCxxRbe {
+		forced = append(forced, "cxx-rbe")
+	}
+	if args.enableSccache {
+		forced = append(forced, "sccache")
+	}
+	if args.enableNetCache {
+		forced = append(forced, "netcache")
+	}
+	if len(forced) > 1 {
+		return nil, fmt.Errorf("only one compiler accelerator may be explicitly requested at a time, got %s", strings.Join(forced, ", "))
+	}
+
+	order := args.accelOrder
+	if len(forced) == 1 {
+		order = forced
+	} else if len(order) == 0 {
+		// Default preference order when nothing was requested explicitly:
+		// ccache if CCACHE_DIR is already set up, otherwise cxx-rbe if
+		// available, otherwise sccache if installed.
+		order = []string{"ccache", "cxx-rbe", "sccache"}
+	}
+
+	return accel.Resolve(ctx, env, order, disabled)
+}
+
 // fuzzerVariants produces the variants for enabling a sanitizer on fuzzers.
 func fuzzerVariants(sanitizer string) []string {
 	return []string{
@@ -547,6 +885,36 @@ func findGNIFile(checkoutDir, dirname, basename string) (string, error) {
 	return "", fmt.Errorf("no such file %s.gni", basename)
 }
 
+// setProfilesDir is where checked-in "set profile" recipes live, relative to
+// a checkout root or a vendor overlay root.
+const setProfilesDir = "build/set-profiles"
+
+// findSetProfile returns the path to a named "set profile" textproto
+// (encoding a fintpb.Static), using the same vendor-overlay-then-checkout
+// search order as findGNIFile.
+func findSetProfile(checkoutDir, name string) (string, error) {
+	dirs, err := filepath.Glob(filepath.Join(checkoutDir, "vendor", "*", setProfilesDir))
+	if err != nil {
+		return "", err
+	}
+	// Prefer vendor profiles in alphabetical order.
+	sort.Strings(dirs)
+	dirs = append(dirs, filepath.Join(checkoutDir, setProfilesDir))
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, fmt.Sprintf("%s.textpb", name))
+		exists, err := osmisc.FileExists(path)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("no such set profile %q", name)
+}
+
 func allEnvVars() map[string]string {
 	env := make(map[string]string)
 	for _, keyAndValue := range os.Environ() {
@@ -556,36 +924,3 @@ func allEnvVars() map[string]string {
 	}
 	return env
 }
-
-// canAccessRbe returns true if there is evidence from the user's environment
-// and source checkout that suggests they have RBE access privileges.
-// Note: This is not perfect because it does not actually check against ACL
-// but it avoids the problem of external developers accidentally
-// configuring use of RBE.
-// TODO(b/356896318): distinguish between cache-reading and remote execution
-// privileges.
-func canAccessRbe(checkoutDir string) (bool, error) {
-	cmd := exec.Command("git", "remote", "-v")
-	cmd.Dir = checkoutDir + "/integration"
-	out, err := cmd.Output()
-	if err != nil {
-		return false, err
-	}
-	lines := strings.Split(string(out), "\n")
-	if len(lines) < 1 {
-		return false, fmt.Errorf("Failed to read 'git remote -v'")
-	}
-	// Check all remotes.  If any have SSO access, then assume user
-	// can access RBE.
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		// Expect lines like:
-		//   "origin	sso://.../integration (fetch)"
-		// or
-		//   "origin	https://.../integration (fetch)"
-		if len(fields) >= 2 && strings.HasPrefix(fields[1], "sso://") {
-			return true, nil
-		}
-	}
-	return false, nil
-}
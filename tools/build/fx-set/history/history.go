@@ -0,0 +1,193 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package history records a bounded log of fully-resolved `fx set`
+// invocations so that developers can reproduce a coworker's exact
+// configuration, or bisect when their build args changed, without
+// reconstructing the invocation from shell history.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	fintpb "go.fuchsia.dev/fuchsia/tools/integration/fint/proto"
+)
+
+// MaxEntries bounds how many entries are retained in the history file;
+// the oldest entries are dropped as new ones are appended.
+const MaxEntries = 50
+
+// RelPath is where the history file lives, relative to $FUCHSIA_DIR.
+const RelPath = ".fx/set-history.jsonl"
+
+// Entry is a single recorded `fx set` invocation.
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	// IntegrationHead is the git HEAD of //integration at the time of the
+	// set, used to correlate a configuration with the source state it was
+	// resolved against. Empty if it couldn't be determined.
+	IntegrationHead string `json:"integration_head"`
+
+	// RawArgs is the literal argv passed to `fx set`, for display purposes.
+	RawArgs []string `json:"raw_args"`
+
+	// Static is the fully-resolved fint Static spec that was passed to
+	// fint.Set, i.e. after all flags, profiles, and RBE settings have been
+	// applied.
+	Static *fintpb.Static `json:"static"`
+}
+
+// Path returns the history file path for a checkout rooted at checkoutDir.
+func Path(checkoutDir string) string {
+	return filepath.Join(checkoutDir, RelPath)
+}
+
+// Append adds entry to the history file at path, creating it if necessary
+// and dropping the oldest entries beyond MaxEntries.
+func Append(path string, entry Entry) error {
+	entries, err := Load(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entries = append(entries, entry)
+	if len(entries) > MaxEntries {
+		entries = entries[len(entries)-MaxEntries:]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads all entries from the history file at path, oldest first. It
+// returns an error satisfying os.IsNotExist if the history file doesn't
+// exist yet, i.e. no `fx set` has recorded history in this checkout.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("parsing set history entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Resolve finds the entry matching spec, which is either a 0-based index
+// counting back from the most recent entry (0 is the most recent entry, 1
+// is the one before it, etc.) or a prefix of an entry's IntegrationHead.
+func Resolve(entries []Entry, spec string) (Entry, error) {
+	if idx, err := strconv.Atoi(spec); err == nil {
+		if idx < 0 {
+			return Entry{}, fmt.Errorf("history index %q must not be negative", spec)
+		}
+		pos := len(entries) - 1 - idx
+		if pos < 0 {
+			return Entry{}, fmt.Errorf("history index %s out of range (have %d entries)", spec, len(entries))
+		}
+		return entries[pos], nil
+	}
+
+	var match *Entry
+	for i := range entries {
+		if entries[i].IntegrationHead != "" && strings.HasPrefix(entries[i].IntegrationHead, spec) {
+			if match != nil {
+				return Entry{}, fmt.Errorf("integration hash %q is ambiguous", spec)
+			}
+			match = &entries[i]
+		}
+	}
+	if match == nil {
+		return Entry{}, fmt.Errorf("no history entry matches %q", spec)
+	}
+	return *match, nil
+}
+
+// Format renders entries as a human-readable table, most recent first.
+func Format(entries []Entry) string {
+	var b strings.Builder
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		idx := len(entries) - 1 - i
+		fmt.Fprintf(&b, "%3d  %s  %s  %s.%s\n",
+			idx, e.Timestamp.Format(time.RFC3339), shortHash(e.IntegrationHead), e.Static.GetProduct(), e.Static.GetBoard())
+	}
+	return b.String()
+}
+
+// Diff renders a human-readable diff of the GN args and variants between
+// two entries.
+func Diff(a, b Entry) string {
+	var out strings.Builder
+	diffSet(&out, "gn_args", a.Static.GetGnArgs(), b.Static.GetGnArgs())
+	diffSet(&out, "variant", a.Static.GetVariants(), b.Static.GetVariants())
+	return out.String()
+}
+
+// diffSet prints the elements of a that are missing from b as removed, and
+// the elements of b that are missing from a as added, under label.
+func diffSet(out *strings.Builder, label string, a, b []string) {
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+	inA := make(map[string]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	for _, v := range a {
+		if !inB[v] {
+			fmt.Fprintf(out, "- [%s] %s\n", label, v)
+		}
+	}
+	for _, v := range b {
+		if !inA[v] {
+			fmt.Fprintf(out, "+ [%s] %s\n", label, v)
+		}
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 10 {
+		return hash[:10]
+	}
+	return hash
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package history
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fintpb "go.fuchsia.dev/fuchsia/tools/integration/fint/proto"
+)
+
+func TestAppendAndLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set-history.jsonl")
+
+	for i := 0; i < 3; i++ {
+		entry := Entry{
+			Timestamp:       time.Now(),
+			IntegrationHead: strconv.Itoa(i),
+			Static:          &fintpb.Static{Product: "core", Board: "x64"},
+		}
+		if err := Append(path, entry); err != nil {
+			t.Fatalf("Append() failed: %s", err)
+		}
+	}
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %s", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Load() returned %d entries, want 3", len(entries))
+	}
+}
+
+func TestAppendBoundsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set-history.jsonl")
+
+	for i := 0; i < MaxEntries+5; i++ {
+		entry := Entry{IntegrationHead: strconv.Itoa(i), Static: &fintpb.Static{}}
+		if err := Append(path, entry); err != nil {
+			t.Fatalf("Append() failed: %s", err)
+		}
+	}
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %s", err)
+	}
+	if len(entries) != MaxEntries {
+		t.Errorf("Load() returned %d entries, want %d", len(entries), MaxEntries)
+	}
+	// The oldest entries should have been dropped, so the last entry
+	// appended should be the most recent one loaded back.
+	if want := strconv.Itoa(MaxEntries + 4); entries[len(entries)-1].IntegrationHead != want {
+		t.Errorf("most recent entry = %q, want %q", entries[len(entries)-1].IntegrationHead, want)
+	}
+}
+
+func TestResolveByIndex(t *testing.T) {
+	entries := []Entry{
+		{IntegrationHead: "aaa111"},
+		{IntegrationHead: "bbb222"},
+		{IntegrationHead: "ccc333"},
+	}
+
+	got, err := Resolve(entries, "0")
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got.IntegrationHead != "ccc333" {
+		t.Errorf("Resolve(0) = %q, want the most recent entry", got.IntegrationHead)
+	}
+
+	got, err = Resolve(entries, "2")
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got.IntegrationHead != "aaa111" {
+		t.Errorf("Resolve(2) = %q, want the oldest entry", got.IntegrationHead)
+	}
+
+	if _, err := Resolve(entries, "3"); err == nil {
+		t.Error("Resolve(3) succeeded, want an out-of-range error")
+	}
+}
+
+func TestResolveByHashPrefix(t *testing.T) {
+	entries := []Entry{
+		{IntegrationHead: "aaa111"},
+		{IntegrationHead: "bbb222"},
+	}
+
+	got, err := Resolve(entries, "bbb")
+	if err != nil {
+		t.Fatalf("Resolve() failed: %s", err)
+	}
+	if got.IntegrationHead != "bbb222" {
+		t.Errorf("Resolve(%q) = %q, want %q", "bbb", got.IntegrationHead, "bbb222")
+	}
+
+	if _, err := Resolve(entries, "zzz"); err == nil {
+		t.Error("Resolve() with no matching hash succeeded, want an error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := Entry{Static: &fintpb.Static{GnArgs: []string{"foo=true", "bar=false"}}}
+	b := Entry{Static: &fintpb.Static{GnArgs: []string{"foo=true", "baz=true"}}}
+
+	diff := Diff(a, b)
+	if !strings.Contains(diff, `- [gn_args] bar=false`) {
+		t.Errorf("Diff() = %q, want a removed line for bar=false", diff)
+	}
+	if !strings.Contains(diff, `+ [gn_args] baz=true`) {
+		t.Errorf("Diff() = %q, want an added line for baz=true", diff)
+	}
+	if strings.Contains(diff, "foo=true") {
+		t.Errorf("Diff() = %q, should not mention unchanged args", diff)
+	}
+}
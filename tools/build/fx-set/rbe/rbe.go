@@ -0,0 +1,210 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package rbe probes whether the calling user has access to a Remote Build
+// Execution (RBE) instance, and if so which capabilities (cache reads, cache
+// writes, remote execution) are available to them. Unlike a heuristic such
+// as grepping for an internal git remote, this performs an authenticated
+// Capabilities RPC against the instance itself, the same check Bazel and
+// Goma clients perform before submitting work to a backend.
+package rbe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/status"
+
+	"golang.org/x/oauth2/google"
+
+	remoteexecution "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+)
+
+// Access describes which RBE capabilities are available to the calling user
+// for a given instance.
+type Access struct {
+	// CacheRead is true if the user can read from the RBE action/CAS cache.
+	CacheRead bool
+	// CacheWrite is true if the user can write to the RBE action/CAS cache.
+	CacheWrite bool
+	// RemoteExec is true if the user can submit actions for remote
+	// execution, as opposed to cache-only usage.
+	RemoteExec bool
+}
+
+// probeTimeout bounds how long a single Capabilities RPC may take. `fx set`
+// should never hang waiting on RBE access before falling back to "off".
+const probeTimeout = 3 * time.Second
+
+// cacheTTL is how long a cached probe result is trusted before a fresh RPC
+// is made. RBE ACLs change rarely, so this is generous in favor of keeping
+// `fx set` fast.
+const cacheTTL = 24 * time.Hour
+
+// cacheRelPath is where cached probe results are stored, relative to the
+// user's cache directory (respects $XDG_CACHE_HOME on Linux).
+const cacheRelPath = "fuchsia/rbe-access.json"
+
+// rbeAuthScope is the OAuth2 scope requested when probing ambient
+// application default credentials. RBE itself only ever needs
+// cloud-platform, regardless of which capabilities the identity ends up
+// having.
+const rbeAuthScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// cacheEntry is the on-disk representation of a single cached probe result,
+// keyed by instance and identity.
+type cacheEntry struct {
+	Instance string    `json:"instance"`
+	Identity string    `json:"identity"`
+	Access   Access    `json:"access"`
+	ProbedAt time.Time `json:"probed_at"`
+}
+
+// Probe returns the caller's access to the given RBE instance, using ambient
+// credentials (gcloud application default credentials). Results are cached
+// under $XDG_CACHE_HOME/fuchsia/rbe-access.json, keyed by instance and
+// identity, so that repeated `fx set` invocations don't each pay for an RPC.
+func Probe(ctx context.Context, instance string) (Access, error) {
+	identity, err := ambientIdentity()
+	if err != nil {
+		return Access{}, fmt.Errorf("determining ambient RBE identity: %w", err)
+	}
+
+	cachePath, cacheErr := cacheFilePath()
+	if cacheErr == nil {
+		if entry, ok := readCache(cachePath, instance, identity); ok {
+			return entry.Access, nil
+		}
+	}
+
+	access, err := probeCapabilities(ctx, instance)
+	if err != nil {
+		return Access{}, err
+	}
+
+	if cacheErr == nil {
+		writeCache(cachePath, cacheEntry{
+			Instance: instance,
+			Identity: identity,
+			Access:   access,
+			ProbedAt: time.Now(),
+		})
+	}
+
+	return access, nil
+}
+
+// ambientIdentity returns a string identifying the credentials that will be
+// used to authenticate the probe, so that cached results don't leak across
+// accounts on a shared machine.
+func ambientIdentity() (string, error) {
+	out, err := exec.Command("gcloud", "config", "get-value", "account").Output()
+	if err != nil {
+		return "", fmt.Errorf("running gcloud to determine active account: %w", err)
+	}
+	identity := strings.TrimSpace(string(out))
+	if identity == "" {
+		return "", fmt.Errorf("no active gcloud account; run `gcloud auth login`")
+	}
+	return identity, nil
+}
+
+func cacheFilePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cacheRelPath), nil
+}
+
+func readCache(path, instance, identity string) (cacheEntry, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return cacheEntry{}, false
+	}
+	if entry.Instance != instance || entry.Identity != identity {
+		return cacheEntry{}, false
+	}
+	if time.Since(entry.ProbedAt) > cacheTTL {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// writeCache best-effort persists a probe result; failures to cache aren't
+// fatal, since the probe itself already succeeded.
+func writeCache(path string, entry cacheEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, b, 0o600)
+}
+
+// probeCapabilities performs the actual GetCapabilities RPC against the RBE
+// instance, translating the response into an Access.
+func probeCapabilities(ctx context.Context, instance string) (Access, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	creds, err := google.FindDefaultCredentials(ctx, rbeAuthScope)
+	if err != nil {
+		// No ambient credentials at all means the user hasn't authenticated
+		// for RBE; that's indistinguishable from "off" as far as `fx set`
+		// is concerned.
+		return Access{}, nil
+	}
+
+	conn, err := grpc.DialContext(ctx, rbeBackendAddr,
+		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, "")),
+		grpc.WithPerRPCCredentials(oauth.TokenSource{TokenSource: creds.TokenSource}),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		return Access{}, fmt.Errorf("connecting to RBE backend: %w", err)
+	}
+	defer conn.Close()
+
+	client := remoteexecution.NewCapabilitiesClient(conn)
+	resp, err := client.GetCapabilities(ctx, &remoteexecution.GetCapabilitiesRequest{
+		InstanceName: instance,
+	})
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			// Authenticated, but this identity has no access to the
+			// instance: no access rather than a tool failure.
+			return Access{}, nil
+		}
+		return Access{}, fmt.Errorf("querying RBE capabilities: %w", err)
+	}
+
+	access := Access{CacheRead: true}
+	if cache := resp.GetCacheCapabilities(); cache != nil {
+		if update := cache.GetActionCacheUpdateCapabilities(); update != nil {
+			access.CacheWrite = update.GetUpdateEnabled()
+		}
+	}
+	access.RemoteExec = resp.GetExecutionCapabilities().GetExecEnabled()
+	return access, nil
+}
+
+// rbeBackendAddr is the default RBE remote execution endpoint.
+const rbeBackendAddr = "remotebuildexecution.googleapis.com:443"
@@ -0,0 +1,69 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rbe
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbe-access.json")
+	want := Access{CacheRead: true, CacheWrite: true, RemoteExec: true}
+
+	writeCache(path, cacheEntry{
+		Instance: "projects/fuchsia/instances/default",
+		Identity: "user@example.com",
+		Access:   want,
+		ProbedAt: time.Now(),
+	})
+
+	got, ok := readCache(path, "projects/fuchsia/instances/default", "user@example.com")
+	if !ok {
+		t.Fatalf("readCache() did not find the entry we just wrote")
+	}
+	if got.Access != want {
+		t.Errorf("readCache() access = %+v, want %+v", got.Access, want)
+	}
+}
+
+func TestReadCacheMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbe-access.json")
+	writeCache(path, cacheEntry{
+		Instance: "projects/fuchsia/instances/default",
+		Identity: "user@example.com",
+		Access:   Access{RemoteExec: true},
+		ProbedAt: time.Now(),
+	})
+
+	if _, ok := readCache(path, "projects/fuchsia/instances/default", "other@example.com"); ok {
+		t.Errorf("readCache() matched a cache entry for a different identity")
+	}
+	if _, ok := readCache(path, "projects/other/instances/default", "user@example.com"); ok {
+		t.Errorf("readCache() matched a cache entry for a different instance")
+	}
+}
+
+func TestReadCacheExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbe-access.json")
+	writeCache(path, cacheEntry{
+		Instance: "projects/fuchsia/instances/default",
+		Identity: "user@example.com",
+		Access:   Access{RemoteExec: true},
+		ProbedAt: time.Now().Add(-2 * cacheTTL),
+	})
+
+	if _, ok := readCache(path, "projects/fuchsia/instances/default", "user@example.com"); ok {
+		t.Errorf("readCache() returned an entry older than cacheTTL")
+	}
+}
+
+func TestReadCacheMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist.json")
+	if _, ok := readCache(path, "projects/fuchsia/instances/default", "user@example.com"); ok {
+		t.Errorf("readCache() found an entry for a nonexistent cache file")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gnlabel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// targetNamePattern matches a GN target declaration's name argument, e.g.
+// `executable("foo")` or `group("foo") {`. It's a cheap heuristic, not a
+// real GN parse: it can't tell whether "foo" is actually a target name vs.
+// some other string literal, but false positives here just mean a typo
+// slips through to `gn gen` instead of being caught early, which is the
+// status quo this package improves on.
+var targetNamePattern = regexp.MustCompile(`\(\s*"([^"]+)"`)
+
+// CheckExists verifies that a concrete (non-wildcard) label plausibly
+// refers to a real target: that <checkoutDir>/<l.Dir>/BUILD.gn exists and
+// contains a declaration naming l.Name. It does not attempt to resolve GN
+// imports, templates, or generated targets, so it can have false negatives
+// for targets defined indirectly; callers should treat a failure here as a
+// likely typo to report quickly, not a guarantee.
+func CheckExists(checkoutDir string, l Label) error {
+	if l.Wildcard {
+		return fmt.Errorf("gnlabel: CheckExists doesn't support wildcard labels (%s)", l)
+	}
+
+	buildFile := filepath.Join(checkoutDir, l.Dir, "BUILD.gn")
+	contents, err := os.ReadFile(buildFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no such directory or missing BUILD.gn for label %s (expected %s)", l, buildFile)
+		}
+		return fmt.Errorf("reading %s: %w", buildFile, err)
+	}
+
+	for _, match := range targetNamePattern.FindAllSubmatch(contents, -1) {
+		if string(match[1]) == l.Name {
+			return nil
+		}
+	}
+	return fmt.Errorf("no target named %q found in %s", l.Name, buildFile)
+}
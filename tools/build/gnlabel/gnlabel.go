@@ -0,0 +1,124 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package gnlabel parses GN labels well enough to catch typos before they
+// reach `gn gen`, which today is the first place a malformed or
+// nonexistent `--with //src/foo:bar` label is reported, minutes into a
+// build. It intentionally doesn't understand the full GN label grammar
+// (toolchain suffixes, "." path segments, etc.) -- just enough of
+// "//dir/path", "//dir/path:name", and "//dir/path/*" to validate the
+// labels fx-set accepts on the command line.
+package gnlabel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Label is a parsed GN label.
+type Label struct {
+	// Dir is the slash-separated path the label points at, relative to the
+	// checkout root, e.g. "src/foo/bar" for "//src/foo/bar:baz".
+	Dir string
+
+	// Name is the target name. Empty when Wildcard is true, otherwise
+	// defaults to the last path component when the label omits ":name"
+	// (GN's shorthand rule).
+	Name string
+
+	// Wildcard is true for a "//dir/path/*" selector, which matches every
+	// target in dir.
+	Wildcard bool
+}
+
+// Parse parses s as a GN label. Only the subset of GN's label grammar
+// described in the package doc comment is supported; anything else is a
+// parse error.
+func Parse(s string) (Label, error) {
+	if !strings.HasPrefix(s, "//") {
+		return Label{}, fmt.Errorf("gnlabel: label %q must start with //", s)
+	}
+	rest := s[len("//"):]
+
+	name := ""
+	hasName := false
+	if idx := strings.IndexByte(rest, ':'); idx >= 0 {
+		rest, name = rest[:idx], rest[idx+1:]
+		hasName = true
+		if name == "" {
+			return Label{}, fmt.Errorf("gnlabel: label %q has an empty target name after ':'", s)
+		}
+		if err := validateIdent(name); err != nil {
+			return Label{}, fmt.Errorf("gnlabel: label %q has an invalid target name: %w", s, err)
+		}
+	}
+
+	if rest == "" {
+		return Label{}, fmt.Errorf("gnlabel: label %q has an empty path", s)
+	}
+
+	segments := strings.Split(rest, "/")
+	wildcard := false
+	for i, seg := range segments {
+		if seg == "*" {
+			if i != len(segments)-1 {
+				return Label{}, fmt.Errorf("gnlabel: label %q may only use '*' as the last path segment", s)
+			}
+			if hasName {
+				return Label{}, fmt.Errorf("gnlabel: label %q combines a wildcard path with an explicit target name", s)
+			}
+			wildcard = true
+			continue
+		}
+		if err := validateIdent(seg); err != nil {
+			return Label{}, fmt.Errorf("gnlabel: label %q has an invalid path segment %q: %w", s, seg, err)
+		}
+		if seg == "." || seg == ".." {
+			// CheckExists joins Dir onto a checkout root; a "." or ".."
+			// segment would be interpreted by the filesystem instead of
+			// naming a literal directory, letting a label escape the
+			// checkout.
+			return Label{}, fmt.Errorf("gnlabel: label %q has a disallowed %q path segment", s, seg)
+		}
+	}
+
+	dir := rest
+	if wildcard {
+		dir = strings.TrimSuffix(rest, "/*")
+		if dir == "" {
+			return Label{}, fmt.Errorf("gnlabel: label %q has no directory before the wildcard", s)
+		}
+	} else if !hasName {
+		// GN's shorthand: "//dir/path" names the target the same as the
+		// last path segment.
+		name = segments[len(segments)-1]
+	}
+
+	return Label{Dir: dir, Name: name, Wildcard: wildcard}, nil
+}
+
+// validateIdent reports an error if s isn't a valid GN identifier segment:
+// non-empty and restricted to letters, digits, '_', '-', and '.'.
+func validateIdent(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty path segment")
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '-' || r == '.':
+		default:
+			return fmt.Errorf("disallowed character %q", r)
+		}
+	}
+	return nil
+}
+
+// String renders the label back to GN label syntax.
+func (l Label) String() string {
+	if l.Wildcard {
+		return fmt.Sprintf("//%s/*", l.Dir)
+	}
+	return fmt.Sprintf("//%s:%s", l.Dir, l.Name)
+}
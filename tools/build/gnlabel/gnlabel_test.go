@@ -0,0 +1,122 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gnlabel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Label
+	}{
+		{"//src/foo:bar", Label{Dir: "src/foo", Name: "bar"}},
+		{"//src/foo", Label{Dir: "src/foo", Name: "foo"}},
+		{"//src/foo/*", Label{Dir: "src/foo", Wildcard: true}},
+		{"//src", Label{Dir: "src", Name: "src"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	tests := []string{
+		"src/foo:bar",       // missing leading //
+		"//",                // empty path
+		"//src/foo:",        // empty name
+		"//src/*/foo",       // wildcard not in last position
+		"//src/*:foo",       // wildcard with explicit name
+		"//src/foo:bar/baz", // disallowed character in name
+		"//src//foo",        // empty path segment
+		"//src/..",          // ".." path segment
+		"//src/./foo",       // "." path segment
+	}
+	for _, in := range tests {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestCheckExists(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "foo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	buildGN := `executable("bar") {
+  sources = [ "main.cc" ]
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "src", "foo", "BUILD.gn"), []byte(buildGN), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	label, err := Parse("//src/foo:bar")
+	if err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+	if err := CheckExists(dir, label); err != nil {
+		t.Errorf("CheckExists() failed for a target that exists: %s", err)
+	}
+
+	typo, err := Parse("//src/foo:baz")
+	if err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+	if err := CheckExists(dir, typo); err == nil {
+		t.Error("CheckExists() succeeded for a target that doesn't exist, want an error")
+	}
+
+	missingDir, err := Parse("//src/nonexistent:baz")
+	if err != nil {
+		t.Fatalf("Parse() failed: %s", err)
+	}
+	if err := CheckExists(dir, missingDir); err == nil {
+		t.Error("CheckExists() succeeded for a missing BUILD.gn, want an error")
+	}
+}
+
+func TestParseVariantSelector(t *testing.T) {
+	sel, err := ParseVariantSelector(`{variant="asan-fuzzer" target_type=["fuzzer_engine","executable"]}`)
+	if err != nil {
+		t.Fatalf("ParseVariantSelector() failed: %s", err)
+	}
+	if got := sel.Values["variant"]; len(got) != 1 || got[0] != "asan-fuzzer" {
+		t.Errorf("variant = %v, want [asan-fuzzer]", got)
+	}
+	if got := sel.Values["target_type"]; len(got) != 2 || got[0] != "fuzzer_engine" || got[1] != "executable" {
+		t.Errorf("target_type = %v, want [fuzzer_engine executable]", got)
+	}
+}
+
+func TestParseVariantSelectorRejectsUnknownKey(t *testing.T) {
+	if _, err := ParseVariantSelector(`{traget_type=["executable"]}`); err == nil {
+		t.Error("ParseVariantSelector() accepted an unknown key, want an error")
+	}
+}
+
+func TestParseVariantSelectorRejectsMalformed(t *testing.T) {
+	tests := []string{
+		`variant="asan"`,          // missing braces
+		`{variant=}`,              // missing value
+		`{variant="unterminated}`, // unterminated string
+	}
+	for _, in := range tests {
+		if _, err := ParseVariantSelector(in); err == nil {
+			t.Errorf("ParseVariantSelector(%q) succeeded, want an error", in)
+		}
+	}
+}
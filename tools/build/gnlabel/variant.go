@@ -0,0 +1,126 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package gnlabel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variantKeys are the scope keys fint/GN's variant selector syntax
+// recognizes; see //build/config/BUILDCONFIG.gn's variant_selector scope.
+// Anything else is rejected so a typo like "traget_type" is caught here
+// instead of being silently ignored by GN.
+var variantKeys = map[string]bool{
+	"variant":     true,
+	"target_type": true,
+	"label":       true,
+	"output_name": true,
+	"name":        true,
+}
+
+// VariantSelector is a parsed `{key="value" key2=["v1","v2"] ...}` variant
+// selector, as accepted by `fx set --variant`.
+type VariantSelector struct {
+	// Values holds each key's right-hand side values, unquoted. A bare
+	// `key="value"` assignment is recorded as a single-element slice.
+	Values map[string][]string
+}
+
+// ParseVariantSelector parses a scoped-value variant selector of the form
+// `{key="value" key2=["v1", "v2"]}`. Keys not in variantKeys are rejected.
+func ParseVariantSelector(s string) (VariantSelector, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return VariantSelector{}, fmt.Errorf("gnlabel: variant selector %q must be wrapped in { }", s)
+	}
+	body := strings.TrimSpace(s[1 : len(s)-1])
+
+	sel := VariantSelector{Values: map[string][]string{}}
+	for body != "" {
+		key, rest, err := consumeIdent(body)
+		if err != nil {
+			return VariantSelector{}, fmt.Errorf("gnlabel: variant selector %q: %w", s, err)
+		}
+		if !variantKeys[key] {
+			return VariantSelector{}, fmt.Errorf("gnlabel: variant selector %q: unknown key %q", s, key)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "=") {
+			return VariantSelector{}, fmt.Errorf("gnlabel: variant selector %q: expected '=' after %q", s, key)
+		}
+		rest = strings.TrimSpace(rest[1:])
+
+		var values []string
+		values, rest, err = consumeValue(rest)
+		if err != nil {
+			return VariantSelector{}, fmt.Errorf("gnlabel: variant selector %q: %w", s, err)
+		}
+		sel.Values[key] = values
+
+		body = strings.TrimSpace(rest)
+	}
+	return sel, nil
+}
+
+// consumeIdent reads a leading identifier from s, returning it and the
+// remainder of s.
+func consumeIdent(s string) (ident string, rest string, err error) {
+	i := 0
+	for i < len(s) {
+		r := s[i]
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || (i > 0 && r >= '0' && r <= '9') {
+			i++
+			continue
+		}
+		break
+	}
+	if i == 0 {
+		return "", s, fmt.Errorf("expected an identifier near %q", s)
+	}
+	return s[:i], s[i:], nil
+}
+
+// consumeValue reads either a single quoted string or a bracketed,
+// comma-separated list of quoted strings from the start of s, returning the
+// unquoted values and the remainder of s.
+func consumeValue(s string) ([]string, string, error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, s, fmt.Errorf("unterminated list near %q", s)
+		}
+		inner := s[1:end]
+		var values []string
+		for _, part := range strings.Split(inner, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			v, err := unquote(part)
+			if err != nil {
+				return nil, s, err
+			}
+			values = append(values, v)
+		}
+		return values, s[end+1:], nil
+	}
+
+	if !strings.HasPrefix(s, `"`) {
+		return nil, s, fmt.Errorf("expected a quoted string or list near %q", s)
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return nil, s, fmt.Errorf("unterminated string near %q", s)
+	}
+	return []string{s[1 : end+1]}, s[end+2:], nil
+}
+
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %q", s)
+	}
+	return s[1 : len(s)-1], nil
+}
@@ -0,0 +1,326 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// actionDelta is the change between a base and head action that were
+// matched to the same logical action, or an addition/removal if one side is
+// nil.
+type actionDelta struct {
+	// Key identifies the action: its base output path if there is one
+	// (even when the head action was matched to it via a command-hash
+	// fallback because its outputs were renamed), otherwise its head
+	// output path for newly added actions.
+	Key string
+	// Base and Head are nil when the action was added or removed,
+	// respectively.
+	Base, Head *action
+
+	DurationDelta time.Duration
+	DragDelta     time.Duration
+}
+
+func (d actionDelta) baseDuration() time.Duration {
+	if d.Base == nil {
+		return 0
+	}
+	return d.Base.End - d.Base.Start
+}
+
+func (d actionDelta) headDuration() time.Duration {
+	if d.Head == nil {
+		return 0
+	}
+	return d.Head.End - d.Head.Start
+}
+
+// categoryDelta is the change between base and head catBuildTime entries
+// for the same category.
+type categoryDelta struct {
+	Category                             string
+	CountDelta                           int32
+	BuildTimeDelta                       time.Duration
+	MinBuildTimeDelta, MaxBuildTimeDelta time.Duration
+}
+
+// criticalPathChurn summarizes how the set of actions on the critical path
+// changed between base and head.
+type criticalPathChurn struct {
+	// Added are actions on head's critical path that weren't on base's.
+	Added []action
+	// Removed are actions on base's critical path that aren't on head's.
+	Removed []action
+	// DragDelta is the total change in drag among actions present on both
+	// critical paths.
+	DragDelta time.Duration
+}
+
+// regressionReport is the structured result of comparing two buildStats
+// runs of the same build.
+type regressionReport struct {
+	ActionDeltas      []actionDelta
+	CategoryDeltas    []categoryDelta
+	CriticalPathChurn criticalPathChurn
+	// TopRegressions are the ActionDeltas with the largest duration growth,
+	// limited to those at or above the configured thresholds, sorted
+	// largest growth first.
+	TopRegressions []actionDelta
+}
+
+// actionOutputKey is the primary matching key for an action: its joined set
+// of outputs.
+func actionOutputKey(a action) string {
+	return strings.Join(a.Outputs, ",")
+}
+
+// cmdHash is the fallback matching key used when an action's output set
+// changed (e.g. the target was renamed) but its command didn't.
+func cmdHash(a action) string {
+	h := fnv.New64a()
+	io.WriteString(h, a.Command)
+	return fmt.Sprintf("cmd:%x", h.Sum64())
+}
+
+// matchActions pairs up base and head actions by output path, falling back
+// to command hash for actions whose output set doesn't match anything,
+// tolerating renamed outputs as long as the command is unchanged. Unmatched
+// base actions are removed, unmatched head actions are added.
+func matchActions(base, head []action) []actionDelta {
+	baseByOutput := make(map[string]*action, len(base))
+	baseByCmd := make(map[string]*action, len(base))
+	for i := range base {
+		baseByOutput[actionOutputKey(base[i])] = &base[i]
+		baseByCmd[cmdHash(base[i])] = &base[i]
+	}
+	matched := make(map[*action]bool, len(base))
+
+	var deltas []actionDelta
+	for i := range head {
+		h := &head[i]
+		key := actionOutputKey(*h)
+		b, ok := baseByOutput[key]
+		if !ok || matched[b] {
+			if cb, ok2 := baseByCmd[cmdHash(*h)]; ok2 && !matched[cb] {
+				b, ok = cb, true
+				key = actionOutputKey(*b)
+			} else {
+				b, ok = nil, false
+			}
+		}
+		d := actionDelta{Key: key, Head: h}
+		if ok {
+			matched[b] = true
+			d.Base = b
+		}
+		d.DurationDelta = d.headDuration() - d.baseDuration()
+		if ok {
+			d.DragDelta = h.Drag - b.Drag
+		} else {
+			d.DragDelta = h.Drag
+		}
+		deltas = append(deltas, d)
+	}
+	for i := range base {
+		if matched[&base[i]] {
+			continue
+		}
+		deltas = append(deltas, actionDelta{
+			Key:           actionOutputKey(base[i]),
+			Base:          &base[i],
+			DurationDelta: -(base[i].End - base[i].Start),
+			DragDelta:     -base[i].Drag,
+		})
+	}
+	return deltas
+}
+
+// diffCategories pairs up base and head catBuildTime entries by category.
+func diffCategories(base, head []catBuildTime) []categoryDelta {
+	baseByCat := make(map[string]catBuildTime, len(base))
+	for _, c := range base {
+		baseByCat[c.Category] = c
+	}
+	seen := make(map[string]bool, len(head))
+
+	var deltas []categoryDelta
+	for _, h := range head {
+		seen[h.Category] = true
+		b := baseByCat[h.Category]
+		deltas = append(deltas, categoryDelta{
+			Category:          h.Category,
+			CountDelta:        h.Count - b.Count,
+			BuildTimeDelta:    h.BuildTime - b.BuildTime,
+			MinBuildTimeDelta: h.MinBuildTime - b.MinBuildTime,
+			MaxBuildTimeDelta: h.MaxBuildTime - b.MaxBuildTime,
+		})
+	}
+	for _, b := range base {
+		if seen[b.Category] {
+			continue
+		}
+		deltas = append(deltas, categoryDelta{
+			Category:          b.Category,
+			CountDelta:        -b.Count,
+			BuildTimeDelta:    -b.BuildTime,
+			MinBuildTimeDelta: -b.MinBuildTime,
+			MaxBuildTimeDelta: -b.MaxBuildTime,
+		})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Category < deltas[j].Category })
+	return deltas
+}
+
+// diffCriticalPath reports which actions entered or left the critical path,
+// and the total drag change among actions that stayed on it.
+func diffCriticalPath(base, head []action) criticalPathChurn {
+	baseKeys := make(map[string]*action, len(base))
+	for i := range base {
+		baseKeys[actionOutputKey(base[i])] = &base[i]
+	}
+	headKeys := make(map[string]bool, len(head))
+
+	var churn criticalPathChurn
+	for i := range head {
+		key := actionOutputKey(head[i])
+		headKeys[key] = true
+		if b, ok := baseKeys[key]; ok {
+			churn.DragDelta += head[i].Drag - b.Drag
+		} else {
+			churn.Added = append(churn.Added, head[i])
+		}
+	}
+	for i := range base {
+		if !headKeys[actionOutputKey(base[i])] {
+			churn.Removed = append(churn.Removed, base[i])
+		}
+	}
+	return churn
+}
+
+// compareBuildStats computes a regressionReport between a base and head
+// buildStats. An actionDelta is included in TopRegressions when its
+// duration grew by at least absThreshold, and by at least relThreshold
+// relative to its base duration (an added action is always a 100% relative
+// regression, so relThreshold alone would always include it; absThreshold
+// guards against that for trivially short actions).
+func compareBuildStats(base, head buildStats, topN int, absThreshold time.Duration, relThreshold float64) regressionReport {
+	report := regressionReport{
+		ActionDeltas:      matchActions(base.Actions, head.Actions),
+		CategoryDeltas:    diffCategories(base.CatBuildTimes, head.CatBuildTimes),
+		CriticalPathChurn: diffCriticalPath(base.CriticalPath, head.CriticalPath),
+	}
+
+	var regressions []actionDelta
+	for _, d := range report.ActionDeltas {
+		if d.DurationDelta < absThreshold {
+			continue
+		}
+		if base := d.baseDuration(); base > 0 && float64(d.DurationDelta)/float64(base) < relThreshold {
+			continue
+		}
+		regressions = append(regressions, d)
+	}
+	sort.Slice(regressions, func(i, j int) bool { return regressions[i].DurationDelta > regressions[j].DurationDelta })
+	if len(regressions) > topN {
+		regressions = regressions[:topN]
+	}
+	report.TopRegressions = regressions
+
+	return report
+}
+
+// signedDuration formats d with an explicit leading sign, since
+// time.Duration.String() only signals negative values.
+func signedDuration(d time.Duration) string {
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+// renderRegressionReportTable renders report as a human-readable table.
+func renderRegressionReportTable(report regressionReport, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "CATEGORY\tCOUNT Δ\tBUILD TIME Δ\tMIN Δ\tMAX Δ")
+	for _, c := range report.CategoryDeltas {
+		fmt.Fprintf(tw, "%s\t%+d\t%s\t%s\t%s\n", c.Category, c.CountDelta, signedDuration(c.BuildTimeDelta), signedDuration(c.MinBuildTimeDelta), signedDuration(c.MaxBuildTimeDelta))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "critical path: %d added, %d removed, drag %s\n", len(report.CriticalPathChurn.Added), len(report.CriticalPathChurn.Removed), signedDuration(report.CriticalPathChurn.DragDelta))
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "TOP REGRESSIONS\tDURATION Δ\tDRAG Δ")
+	for _, d := range report.TopRegressions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Key, signedDuration(d.DurationDelta), signedDuration(d.DragDelta))
+	}
+
+	return tw.Flush()
+}
+
+// runDiff implements the `buildstats diff` subcommand: it reads two
+// JSON-serialized buildStats produced by serializeBuildStats and prints a
+// regressionReport comparing them.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	basePath := fs.String("base", "", "path of the base (before) JSON build stats")
+	headPath := fs.String("head", "", "path of the head (after) JSON build stats")
+	diffFormat := fs.String("diff_format", "table", "report encoding, can be table or json")
+	topN := fs.Int("top", 20, "number of top regressions to report")
+	absThreshold := fs.Duration("threshold_abs", 0, "minimum absolute duration growth for an action to count as a regression")
+	relThreshold := fs.Float64("threshold_rel", 0, "minimum relative duration growth (e.g. 0.2 for 20%) for an action to count as a regression")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *basePath == "" || *headPath == "" {
+		return fmt.Errorf("--base and --head are both required")
+	}
+
+	base, err := readBuildStatsJSON(*basePath)
+	if err != nil {
+		return fmt.Errorf("reading --base: %w", err)
+	}
+	head, err := readBuildStatsJSON(*headPath)
+	if err != nil {
+		return fmt.Errorf("reading --head: %w", err)
+	}
+
+	report := compareBuildStats(base, head, *topN, *absThreshold, *relThreshold)
+
+	switch *diffFormat {
+	case "table":
+		return renderRegressionReportTable(report, os.Stdout)
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(report)
+	default:
+		return fmt.Errorf("unknown --diff_format %q, must be table or json", *diffFormat)
+	}
+}
+
+func readBuildStatsJSON(path string) (buildStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return buildStats{}, err
+	}
+	defer f.Close()
+	var s buildStats
+	if err := json.NewDecoder(f).Decode(&s); err != nil {
+		return buildStats{}, fmt.Errorf("decoding %q: %w", path, err)
+	}
+	return s, nil
+}
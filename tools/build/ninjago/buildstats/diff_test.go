@@ -0,0 +1,159 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMatchActions(t *testing.T) {
+	for _, v := range []struct {
+		name string
+		base []action
+		head []action
+		want []actionDelta
+	}{
+		{
+			name: "added action",
+			base: nil,
+			head: []action{
+				{Outputs: []string{"new"}, Command: "cc new.o", Start: 0, End: time.Second},
+			},
+			want: []actionDelta{
+				{
+					Key:           "new",
+					Head:          &action{Outputs: []string{"new"}, Command: "cc new.o", Start: 0, End: time.Second},
+					DurationDelta: time.Second,
+					DragDelta:     0,
+				},
+			},
+		},
+		{
+			name: "removed action",
+			base: []action{
+				{Outputs: []string{"old"}, Command: "cc old.o", Start: 0, End: time.Second},
+			},
+			head: nil,
+			want: []actionDelta{
+				{
+					Key:           "old",
+					Base:          &action{Outputs: []string{"old"}, Command: "cc old.o", Start: 0, End: time.Second},
+					DurationDelta: -time.Second,
+					DragDelta:     0,
+				},
+			},
+		},
+		{
+			name: "cmd-hash-stable rename",
+			base: []action{
+				{Outputs: []string{"foo.o"}, Command: "cc foo.cc", Start: 0, End: time.Second},
+			},
+			head: []action{
+				{Outputs: []string{"bar.o"}, Command: "cc foo.cc", Start: 0, End: 2 * time.Second},
+			},
+			want: []actionDelta{
+				{
+					Key:           "foo.o",
+					Base:          &action{Outputs: []string{"foo.o"}, Command: "cc foo.cc", Start: 0, End: time.Second},
+					Head:          &action{Outputs: []string{"bar.o"}, Command: "cc foo.cc", Start: 0, End: 2 * time.Second},
+					DurationDelta: time.Second,
+					DragDelta:     0,
+				},
+			},
+		},
+		{
+			name: "unchanged action",
+			base: []action{
+				{Outputs: []string{"stable.o"}, Command: "cc stable.cc", Start: 0, End: time.Second, Drag: 100 * time.Millisecond},
+			},
+			head: []action{
+				{Outputs: []string{"stable.o"}, Command: "cc stable.cc", Start: 0, End: time.Second, Drag: 100 * time.Millisecond},
+			},
+			want: []actionDelta{
+				{
+					Key:           "stable.o",
+					Base:          &action{Outputs: []string{"stable.o"}, Command: "cc stable.cc", Start: 0, End: time.Second, Drag: 100 * time.Millisecond},
+					Head:          &action{Outputs: []string{"stable.o"}, Command: "cc stable.cc", Start: 0, End: time.Second, Drag: 100 * time.Millisecond},
+					DurationDelta: 0,
+					DragDelta:     0,
+				},
+			},
+		},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			got := matchActions(v.base, v.head)
+			if diff := cmp.Diff(v.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("matchActions(%#v, %#v) got diff (-want +got):\n%s", v.base, v.head, diff)
+			}
+		})
+	}
+}
+
+func TestDiffCriticalPath(t *testing.T) {
+	base := []action{
+		{Outputs: []string{"a"}, Drag: 100 * time.Millisecond},
+		{Outputs: []string{"b"}, Drag: 200 * time.Millisecond},
+	}
+	head := []action{
+		{Outputs: []string{"a"}, Drag: 150 * time.Millisecond},
+		{Outputs: []string{"c"}, Drag: 50 * time.Millisecond},
+	}
+
+	got := diffCriticalPath(base, head)
+	want := criticalPathChurn{
+		Added:     []action{{Outputs: []string{"c"}, Drag: 50 * time.Millisecond}},
+		Removed:   []action{{Outputs: []string{"b"}, Drag: 200 * time.Millisecond}},
+		DragDelta: 50 * time.Millisecond,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diffCriticalPath() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareBuildStatsTopRegressions(t *testing.T) {
+	base := buildStats{
+		Actions: []action{
+			{Outputs: []string{"slow"}, Command: "cc slow.cc", Start: 0, End: time.Second},
+			{Outputs: []string{"fast"}, Command: "cc fast.cc", Start: 0, End: 10 * time.Millisecond},
+		},
+	}
+	head := buildStats{
+		Actions: []action{
+			{Outputs: []string{"slow"}, Command: "cc slow.cc", Start: 0, End: 5 * time.Second},
+			{Outputs: []string{"fast"}, Command: "cc fast.cc", Start: 0, End: 11 * time.Millisecond},
+		},
+	}
+
+	report := compareBuildStats(base, head, 5, time.Second, 0.5)
+	if len(report.TopRegressions) != 1 {
+		t.Fatalf("got %d top regressions, want 1: %#v", len(report.TopRegressions), report.TopRegressions)
+	}
+	if report.TopRegressions[0].Key != "slow" {
+		t.Errorf("top regression key = %q, want %q", report.TopRegressions[0].Key, "slow")
+	}
+}
+
+func TestDiffCategories(t *testing.T) {
+	base := []catBuildTime{
+		{Category: "cxx", Count: 10, BuildTime: 5 * time.Second, MinBuildTime: time.Millisecond, MaxBuildTime: time.Second},
+	}
+	head := []catBuildTime{
+		{Category: "cxx", Count: 12, BuildTime: 6 * time.Second, MinBuildTime: time.Millisecond, MaxBuildTime: 2 * time.Second},
+		{Category: "link", Count: 1, BuildTime: time.Second, MinBuildTime: time.Second, MaxBuildTime: time.Second},
+	}
+
+	want := []categoryDelta{
+		{Category: "cxx", CountDelta: 2, BuildTimeDelta: time.Second, MaxBuildTimeDelta: time.Second},
+		{Category: "link", CountDelta: 1, BuildTimeDelta: time.Second, MinBuildTimeDelta: time.Second, MaxBuildTimeDelta: time.Second},
+	}
+	got := diffCategories(base, head)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diffCategories() got diff (-want +got):\n%s", diff)
+	}
+}
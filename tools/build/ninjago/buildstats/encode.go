@@ -0,0 +1,85 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// outputFormat selects the encoding serializeBuildStats writes.
+type outputFormat string
+
+const (
+	formatJSON   outputFormat = "json"
+	formatNDJSON outputFormat = "ndjson"
+	formatGob    outputFormat = "gob"
+	formatPBtext outputFormat = "protobuf"
+)
+
+// String and Set make outputFormat usable with flag.Var.
+func (f *outputFormat) String() string {
+	if *f == "" {
+		return string(formatJSON)
+	}
+	return string(*f)
+}
+
+func (f *outputFormat) Set(v string) error {
+	switch outputFormat(v) {
+	case formatJSON, formatNDJSON, formatGob, formatPBtext:
+		*f = outputFormat(v)
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q, must be one of json, ndjson, gob, protobuf", v)
+	}
+}
+
+// encodeBuildStats writes s to w using the given format. ndjson emits the
+// same shape as json but one top-level field per line, which is friendlier
+// to streaming log pipelines that don't want to buffer the whole object.
+func encodeBuildStats(s buildStats, w io.Writer, format outputFormat) error {
+	switch format {
+	case "", formatJSON:
+		return json.NewEncoder(w).Encode(s)
+	case formatNDJSON:
+		return encodeBuildStatsNDJSON(s, w)
+	case formatGob:
+		return gob.NewEncoder(w).Encode(s)
+	case formatPBtext:
+		return encodeBuildStatsProto(s, w)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// encodeBuildStatsNDJSON writes one JSON object per top-level buildStats
+// field, each on its own line, in field declaration order.
+func encodeBuildStatsNDJSON(s buildStats, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"CriticalPath", s.CriticalPath},
+		{"Slowests", s.Slowests},
+		{"CatBuildTimes", s.CatBuildTimes},
+		{"TotalBuildTime", s.TotalBuildTime},
+		{"BuildDuration", s.BuildDuration},
+		{"All", s.All},
+		{"Actions", s.Actions},
+		{"Subtraces", s.Subtraces},
+		{"WorkerTimelines", s.WorkerTimelines},
+		{"Contention", s.Contention},
+	}
+	for _, f := range fields {
+		if err := enc.Encode(map[string]interface{}{f.name: f.value}); err != nil {
+			return fmt.Errorf("encoding %s as NDJSON: %w", f.name, err)
+		}
+	}
+	return nil
+}
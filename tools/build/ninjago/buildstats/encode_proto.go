@@ -0,0 +1,83 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/encoding/prototext"
+
+	pb "go.fuchsia.dev/fuchsia/tools/build/ninjago/buildstats/buildstatspb"
+)
+
+// encodeBuildStatsProto encodes s as the textproto form of the
+// buildstats.BuildStats message defined in buildstats.proto. Textproto is
+// used rather than wire-format binary so `protobuf`-encoded output, like
+// the other formats, stays directly readable.
+func encodeBuildStatsProto(s buildStats, w io.Writer) error {
+	b, err := prototext.MarshalOptions{Multiline: true}.Marshal(toProto(s))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func toProto(s buildStats) *pb.BuildStats {
+	return &pb.BuildStats{
+		CriticalPath:        toProtoActions(s.CriticalPath),
+		Slowests:            toProtoActions(s.Slowests),
+		CatBuildTimes:       toProtoCatBuildTimes(s.CatBuildTimes),
+		TotalBuildTimeNanos: s.TotalBuildTime.Nanoseconds(),
+		BuildDurationNanos:  s.BuildDuration.Nanoseconds(),
+		Actions:             toProtoActions(s.Actions),
+		Subtraces:           toProtoSubtraces(s.Subtraces),
+	}
+}
+
+func toProtoActions(as []action) []*pb.Action {
+	out := make([]*pb.Action, 0, len(as))
+	for _, a := range as {
+		out = append(out, &pb.Action{
+			Command:         a.Command,
+			Outputs:         a.Outputs,
+			StartNanos:      a.Start.Nanoseconds(),
+			EndNanos:        a.End.Nanoseconds(),
+			Rule:            a.Rule,
+			Category:        a.Category,
+			TotalFloatNanos: a.TotalFloat.Nanoseconds(),
+			DragNanos:       a.Drag.Nanoseconds(),
+		})
+	}
+	return out
+}
+
+func toProtoCatBuildTimes(cs []catBuildTime) []*pb.CatBuildTime {
+	out := make([]*pb.CatBuildTime, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, &pb.CatBuildTime{
+			Category:          c.Category,
+			Count:             c.Count,
+			BuildTimeNanos:    c.BuildTime.Nanoseconds(),
+			MinBuildTimeNanos: c.MinBuildTime.Nanoseconds(),
+			MaxBuildTimeNanos: c.MaxBuildTime.Nanoseconds(),
+		})
+	}
+	return out
+}
+
+func toProtoSubtraces(ss []subtrace) []*pb.Subtrace {
+	out := make([]*pb.Subtrace, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, &pb.Subtrace{
+			Category:   s.Category,
+			Name:       s.Name,
+			StartNanos: s.Start.Nanoseconds(),
+			EndNanos:   s.End.Nanoseconds(),
+			Output:     s.Output,
+		})
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package exporter pushes a build's derived stats to external metrics
+// systems (Prometheus, StatsD) so dashboards can track build-time trends
+// without having to scrape buildstats' JSON/gob output files directly. It's
+// modeled on mtail-style exporters that fan a single in-memory metric store
+// out to multiple push targets.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CategoryMetrics is the per-category summary of a build's actions.
+type CategoryMetrics struct {
+	Category  string
+	Count     int32
+	BuildTime time.Duration
+	MinTime   time.Duration
+	MaxTime   time.Duration
+}
+
+// Metrics is a flattened, export-friendly view of a build's derived stats,
+// decoupled from buildstats' internal buildStats representation so sinks
+// don't need to import package main.
+type Metrics struct {
+	// Host and BuilderID are attached to every exported series as labels so
+	// dashboards can slice by machine or builder.
+	Host      string
+	BuilderID string
+
+	TotalBuildTime time.Duration
+	BuildDuration  time.Duration
+
+	// CriticalPathLength is the number of actions on the critical path.
+	CriticalPathLength int
+	// CriticalPathDrag is the sum of every critical-path action's drag,
+	// i.e. the total time the critical path is adding to the build.
+	CriticalPathDrag time.Duration
+
+	Categories []CategoryMetrics
+
+	// ActionDurations is every action duration in the build, used by sinks
+	// that support histograms.
+	ActionDurations []time.Duration
+}
+
+// Sink publishes a single Metrics snapshot to some destination.
+type Sink interface {
+	// Name identifies the sink, used in error messages.
+	Name() string
+	// Push publishes m. Implementations should treat Push as one-shot: a
+	// single flush of the current snapshot, not a streaming session.
+	Push(ctx context.Context, m Metrics) error
+}
+
+// PushAll pushes m to every sink, returning a combined error naming every
+// sink that failed so that one unreachable pushgateway doesn't hide
+// failures from the others.
+func PushAll(ctx context.Context, sinks []Sink, m Metrics) error {
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Push(ctx, m); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%d of %d push target(s) failed:", len(errs), len(sinks))
+	for _, err := range errs {
+		msg += "\n  " + err.Error()
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// Run pushes the Metrics produced by snapshot on every tick of interval,
+// until ctx is canceled, for long-running callers that want to stream
+// metrics rather than flush once at exit. buildstats itself always does a
+// one-shot PushAll at the end of a run; Run exists for embedders (e.g. a
+// build daemon) that keep producing fresh snapshots over time.
+func Run(ctx context.Context, sinks []Sink, interval time.Duration, snapshot func() Metrics) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := PushAll(ctx, sinks, snapshot()); err != nil {
+				return err
+			}
+		}
+	}
+}
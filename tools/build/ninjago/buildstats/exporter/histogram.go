@@ -0,0 +1,56 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exporter
+
+import (
+	"fmt"
+	"time"
+)
+
+// durationBucketBoundsSeconds are the (inclusive) upper bounds of the
+// cumulative action-duration histogram buckets, chosen to cover the range
+// from sub-second actions up to multi-minute linker/codegen outliers.
+var durationBucketBoundsSeconds = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+// bucket is one cumulative histogram bucket: count is the number of
+// observations <= le ("less than or equal"), following Prometheus histogram
+// conventions.
+type bucket struct {
+	le    string
+	count int
+}
+
+// actionDurationHistogram buckets durations into a cumulative histogram,
+// with a final "+Inf" bucket covering everything.
+func actionDurationHistogram(durations []time.Duration) []bucket {
+	counts := make([]int, len(durationBucketBoundsSeconds)+1)
+	for _, d := range durations {
+		seconds := d.Seconds()
+		placed := false
+		for i, bound := range durationBucketBoundsSeconds {
+			if seconds <= bound {
+				counts[i]++
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			counts[len(counts)-1]++
+		}
+	}
+
+	// Convert per-bucket counts into Prometheus-style cumulative counts.
+	cumulative := 0
+	buckets := make([]bucket, 0, len(counts))
+	for i, c := range counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(durationBucketBoundsSeconds) {
+			le = fmt.Sprintf("%g", durationBucketBoundsSeconds[i])
+		}
+		buckets = append(buckets, bucket{le: le, count: cumulative})
+	}
+	return buckets
+}
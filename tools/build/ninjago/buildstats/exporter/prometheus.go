@@ -0,0 +1,77 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// PrometheusSink pushes a Metrics snapshot to a Prometheus pushgateway
+// (https://github.com/prometheus/pushgateway) as a single batch in the
+// Prometheus text exposition format.
+type PrometheusSink struct {
+	// GatewayAddr is the pushgateway's host:port.
+	GatewayAddr string
+	// Job is the pushgateway job name these metrics are grouped under.
+	Job string
+}
+
+func (s *PrometheusSink) Name() string {
+	return fmt.Sprintf("prometheus://%s/job/%s", s.GatewayAddr, s.Job)
+}
+
+func (s *PrometheusSink) Push(ctx context.Context, m Metrics) error {
+	body := renderPrometheusText(m)
+
+	url := fmt.Sprintf("http://%s/metrics/job/%s", s.GatewayAddr, s.Job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushing to pushgateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// renderPrometheusText renders m as a Prometheus text-exposition-format
+// batch, labeled with host and builder_id, plus category for the
+// per-category series.
+func renderPrometheusText(m Metrics) []byte {
+	var buf bytes.Buffer
+	labels := fmt.Sprintf(`host=%q,builder_id=%q`, m.Host, m.BuilderID)
+
+	fmt.Fprintf(&buf, "ninja_build_total_build_time_seconds{%s} %f\n", labels, m.TotalBuildTime.Seconds())
+	fmt.Fprintf(&buf, "ninja_build_duration_seconds{%s} %f\n", labels, m.BuildDuration.Seconds())
+	fmt.Fprintf(&buf, "ninja_build_critical_path_length{%s} %d\n", labels, m.CriticalPathLength)
+	fmt.Fprintf(&buf, "ninja_build_critical_path_drag_seconds{%s} %f\n", labels, m.CriticalPathDrag.Seconds())
+
+	categories := append([]CategoryMetrics(nil), m.Categories...)
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Category < categories[j].Category })
+	for _, c := range categories {
+		catLabels := fmt.Sprintf(`%s,category=%q`, labels, c.Category)
+		fmt.Fprintf(&buf, "ninja_build_category_count{%s} %d\n", catLabels, c.Count)
+		fmt.Fprintf(&buf, "ninja_build_category_build_time_seconds{%s} %f\n", catLabels, c.BuildTime.Seconds())
+		fmt.Fprintf(&buf, "ninja_build_category_min_build_time_seconds{%s} %f\n", catLabels, c.MinTime.Seconds())
+		fmt.Fprintf(&buf, "ninja_build_category_max_build_time_seconds{%s} %f\n", catLabels, c.MaxTime.Seconds())
+	}
+
+	for _, bucket := range actionDurationHistogram(m.ActionDurations) {
+		fmt.Fprintf(&buf, "ninja_build_action_duration_seconds_bucket{%s,le=%q} %d\n", labels, bucket.le, bucket.count)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,63 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// StatsDSink pushes a Metrics snapshot to a StatsD/DogStatsD listener over
+// UDP, using DogStatsD-style tags (`|#tag:value`) for host, builder_id, and
+// category, which both DogStatsD and modern StatsD-compatible collectors
+// understand.
+type StatsDSink struct {
+	// Addr is the listener's host:port.
+	Addr string
+}
+
+func (s *StatsDSink) Name() string {
+	return fmt.Sprintf("statsd://%s", s.Addr)
+}
+
+func (s *StatsDSink) Push(ctx context.Context, m Metrics) error {
+	conn, err := net.Dial("udp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("dialing statsd listener: %w", err)
+	}
+	defer conn.Close()
+
+	tags := fmt.Sprintf("host:%s,builder_id:%s", m.Host, m.BuilderID)
+	lines := []string{
+		gauge("ninja_build.total_build_time_ms", float64(m.TotalBuildTime.Milliseconds()), tags),
+		gauge("ninja_build.duration_ms", float64(m.BuildDuration.Milliseconds()), tags),
+		gauge("ninja_build.critical_path.length", float64(m.CriticalPathLength), tags),
+		gauge("ninja_build.critical_path.drag_ms", float64(m.CriticalPathDrag.Milliseconds()), tags),
+	}
+	for _, c := range m.Categories {
+		catTags := fmt.Sprintf("%s,category:%s", tags, c.Category)
+		lines = append(lines,
+			gauge("ninja_build.category.count", float64(c.Count), catTags),
+			gauge("ninja_build.category.build_time_ms", float64(c.BuildTime.Milliseconds()), catTags),
+			gauge("ninja_build.category.min_build_time_ms", float64(c.MinTime.Milliseconds()), catTags),
+			gauge("ninja_build.category.max_build_time_ms", float64(c.MaxTime.Milliseconds()), catTags),
+		)
+	}
+	for _, d := range m.ActionDurations {
+		lines = append(lines, gauge("ninja_build.action.duration_ms", float64(d.Milliseconds()), tags))
+	}
+
+	if _, err := conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("writing to statsd listener: %w", err)
+	}
+	return nil
+}
+
+// gauge renders a single DogStatsD gauge line: "name:value|g|#tags".
+func gauge(name string, value float64, tags string) string {
+	return fmt.Sprintf("%s:%g|g|#%s", name, value, tags)
+}
@@ -0,0 +1,51 @@
+// Copyright 2026 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package exporter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseTarget parses a --push target string into a Sink. Supported forms:
+//
+//	prometheus://host:port/job/<name>  - push to a Prometheus pushgateway
+//	statsd://host:port                 - push to a StatsD/DogStatsD listener
+func ParseTarget(raw string) (Sink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing push target %q: %w", raw, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("push target %q is missing a host:port", raw)
+	}
+
+	switch u.Scheme {
+	case "prometheus":
+		job := strings.TrimPrefix(u.Path, "/job/")
+		if job == "" || job == u.Path {
+			return nil, fmt.Errorf("push target %q must have a /job/<name> path", raw)
+		}
+		return &PrometheusSink{GatewayAddr: u.Host, Job: job}, nil
+	case "statsd":
+		return &StatsDSink{Addr: u.Host}, nil
+	default:
+		return nil, fmt.Errorf("push target %q has unknown scheme %q, want prometheus or statsd", raw, u.Scheme)
+	}
+}
+
+// ParseTargets parses each of raws with ParseTarget.
+func ParseTargets(raws []string) ([]Sink, error) {
+	sinks := make([]Sink, 0, len(raws))
+	for _, raw := range raws {
+		s, err := ParseTarget(raw)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
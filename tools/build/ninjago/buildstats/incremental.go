@@ -0,0 +1,84 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/ninjalog"
+)
+
+// incrementalCriticalPath computes a running estimate of the build's
+// critical path as steps complete, rather than waiting for the full Ninja
+// graph to be available and recomputing over it from scratch. This is
+// meant to be fed steps parsed live from Ninja's status stream (e.g. via
+// -o status), so a long-running build's critical path so far can be
+// inspected without waiting for it to finish.
+//
+// The estimate is necessarily partial: it only reflects completion times
+// implied by steps seen so far, without the full dependency graph, so it
+// approximates "the longest chain of steps observed to have run
+// back-to-back on an output's dependency chain" rather than the true
+// graph-theoretic critical path.
+type incrementalCriticalPath struct {
+	// finishTime is, for each output produced so far, the time at which
+	// the longest chain of steps ending in that output finished.
+	finishTime map[string]time.Duration
+	// chainLen mirrors finishTime, tracking the number of steps in that
+	// chain so consumers can report both duration and depth.
+	chainLen map[string]int
+
+	// latestOutput is the output of the step with the latest finish time
+	// seen so far; latestFinish and latestChainLen describe it.
+	latestOutput   string
+	latestFinish   time.Duration
+	latestChainLen int
+}
+
+func newIncrementalCriticalPath() *incrementalCriticalPath {
+	return &incrementalCriticalPath{
+		finishTime: make(map[string]time.Duration),
+		chainLen:   make(map[string]int),
+	}
+}
+
+// AddStep folds one more completed step into the running estimate. Steps
+// must be added in the order Ninja reports them finishing.
+func (p *incrementalCriticalPath) AddStep(step ninjalog.Step) {
+	var chainStart time.Duration
+	chainLen := 0
+	for _, in := range step.Ins {
+		if f, ok := p.finishTime[in]; ok && f > chainStart {
+			chainStart = f
+			chainLen = p.chainLen[in]
+		}
+	}
+
+	finish := chainStart + step.Duration()
+	chainLen++
+
+	outs := append(append([]string{}, step.Outs...), step.Out)
+	for _, out := range outs {
+		if out == "" {
+			continue
+		}
+		p.finishTime[out] = finish
+		p.chainLen[out] = chainLen
+	}
+
+	if finish > p.latestFinish {
+		p.latestFinish = finish
+		p.latestChainLen = chainLen
+		if len(outs) > 0 {
+			p.latestOutput = outs[0]
+		}
+	}
+}
+
+// Snapshot returns the critical path length and step count observed so
+// far.
+func (p *incrementalCriticalPath) Snapshot() (length time.Duration, steps int) {
+	return p.latestFinish, p.latestChainLen
+}
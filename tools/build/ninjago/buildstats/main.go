@@ -29,6 +29,7 @@ package main
 
 import (
 	"container/heap"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -40,6 +41,7 @@ import (
 	"strings"
 	"time"
 
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/buildstats/exporter"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/chrometrace"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/compdb"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/ninjagraph"
@@ -56,6 +58,11 @@ var (
 	graphPath          = flag.String("graph", "", "path of graphviz dot file for ninja targets")
 	outputPath         = flag.String("output", "", "path to output the serialized build stats")
 	minActionBuildTime = flag.Duration("min_action_build_time", 5*time.Second, "actions that took longer than or equal to this time granularity are included in output")
+	format             outputFormat
+
+	pushTargets  pushTargetsFlag
+	pushInterval = flag.Duration("push_interval", 0, "ignored by this tool, which logs a warning and pushes to --push targets once at exit; interval pushing is done by exporter.Run in long-running processes")
+	builderID    = flag.String("builder_id", "", "builder identifier attached to every metric pushed to --push targets")
 
 	colors color.EnableColor
 	level  logger.LogLevel
@@ -66,6 +73,24 @@ func init() {
 	level = logger.ErrorLevel
 	flag.Var(&colors, "color", "use color in output, can be never, auto, always")
 	flag.Var(&level, "level", "output verbosity, can be fatal, error, warning, info, debug or trace")
+	flag.Var(&format, "format", "output encoding, can be json, ndjson, gob, or protobuf")
+	flag.Var(&pushTargets, "push", "push derived build stats to this metrics sink, e.g. prometheus://host:port/job/ninja or statsd://host:port; repeatable")
+}
+
+// pushTargetsFlag is a flag.Value collecting every occurrence of --push, in
+// the order given.
+type pushTargetsFlag []string
+
+func (p *pushTargetsFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, ",")
+}
+
+func (p *pushTargetsFlag) Set(value string) error {
+	*p = append(*p, value)
+	return nil
 }
 
 type inputs struct {
@@ -122,6 +147,18 @@ type buildStats struct {
 	All []action
 	// All build actions from this build that took longer to finish than granularity.
 	Actions []action
+	// Subtraces are the RBE and clang sub-phases found nested inside
+	// actions, interleaved into a single timeline and attributed back to
+	// the output of the action they belong to. Only populated when stats
+	// are extracted from a chrome trace.
+	Subtraces []subtrace
+	// WorkerTimelines is the per-worker-thread sequence of actions,
+	// only populated when stats are extracted from a chrome trace.
+	WorkerTimelines []workerTimeline
+	// Contention summarizes how many workers were simultaneously busy
+	// over the life of the build, only populated when stats are
+	// extracted from a chrome trace.
+	Contention contentionStats
 }
 
 // constructGraph constructs a ninjagraph based on files from input paths, and
@@ -418,6 +455,9 @@ func extractBuildStatsFromTrace(ninjaTracePath string, minActionBuildTime time.D
 	}
 
 	ret := buildStats{}
+	ret.Subtraces = extractSubtraces(traces)
+	ret.WorkerTimelines = perWorkerTimelines(traces)
+	ret.Contention = computeContention(ret.WorkerTimelines)
 	for _, trace := range traces {
 		if strings.Contains(trace.Category, "critical_path") {
 			action := traceToAction(trace)
@@ -475,10 +515,64 @@ func extractBuildStatsFromTrace(ninjaTracePath string, minActionBuildTime time.D
 }
 
 func serializeBuildStats(s buildStats, w io.Writer) error {
-	return json.NewEncoder(w).Encode(s)
+	return encodeBuildStats(s, w, format)
+}
+
+// toMetrics flattens s into the export-friendly shape that the exporter
+// package's sinks understand.
+func toMetrics(s buildStats, host, builderID string) exporter.Metrics {
+	m := exporter.Metrics{
+		Host:               host,
+		BuilderID:          builderID,
+		TotalBuildTime:     s.TotalBuildTime,
+		BuildDuration:      s.BuildDuration,
+		CriticalPathLength: len(s.CriticalPath),
+	}
+	for _, a := range s.CriticalPath {
+		m.CriticalPathDrag += a.Drag
+	}
+	for _, c := range s.CatBuildTimes {
+		m.Categories = append(m.Categories, exporter.CategoryMetrics{
+			Category:  c.Category,
+			Count:     c.Count,
+			BuildTime: c.BuildTime,
+			MinTime:   c.MinBuildTime,
+			MaxTime:   c.MaxBuildTime,
+		})
+	}
+	for _, a := range s.Actions {
+		m.ActionDurations = append(m.ActionDurations, a.End-a.Start)
+	}
+	return m
+}
+
+// pushMetrics parses --push targets and flushes m to all of them, returning
+// a combined error naming every target that failed.
+func pushMetrics(ctx context.Context, targets []string, m exporter.Metrics) error {
+	sinks, err := exporter.ParseTargets(targets)
+	if err != nil {
+		return fmt.Errorf("parsing --push targets: %w", err)
+	}
+	return pushToSinks(ctx, sinks, m)
+}
+
+// pushToSinks flushes m to every sink. Split out from pushMetrics so tests
+// can exercise it with fake sinks without going through --push's URL syntax.
+func pushToSinks(ctx context.Context, sinks []exporter.Sink, m exporter.Metrics) error {
+	if len(sinks) == 0 {
+		return nil
+	}
+	return exporter.PushAll(ctx, sinks, m)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := runDiff(os.Args[2:]); err != nil {
+			log.Fatalf("buildstats diff: %v", err)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	painter := color.NewColor(colors)
@@ -561,5 +655,19 @@ func main() {
 	if err := serializeBuildStats(stats, outputFile); err != nil {
 		log.Fatalf("Failed to serialize build stats: %v", err)
 	}
+
+	if len(pushTargets) > 0 {
+		if *pushInterval != 0 {
+			log.Warningf("--push_interval is ignored by this single-shot run; it only takes effect when the exporter package is embedded in a long-running process")
+		}
+		host, err := os.Hostname()
+		if err != nil {
+			log.Errorf("Failed to get hostname, pushing metrics with an empty host label: %v", err)
+		}
+		if err := pushMetrics(context.Background(), pushTargets, toMetrics(stats, host, *builderID)); err != nil {
+			log.Errorf("Failed to push metrics: %v", err)
+		}
+	}
+
 	log.Infof("Done.")
 }
@@ -7,6 +7,7 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/buildstats/exporter"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/chrometrace"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/compdb"
 	"go.fuchsia.dev/fuchsia/tools/build/ninjago/ninjalog"
@@ -609,3 +611,85 @@ func TestExtractStatsFromTrace(t *testing.T) {
 		})
 	}
 }
+
+// fakeSink is an exporter.Sink that records the last Metrics pushed to it,
+// so tests can assert on what main would have exported.
+type fakeSink struct {
+	pushed exporter.Metrics
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) Push(ctx context.Context, m exporter.Metrics) error {
+	s.pushed = m
+	return nil
+}
+
+func testBuildStats() buildStats {
+	return buildStats{
+		CriticalPath: []action{
+			{Outputs: []string{"a"}, Category: "cxx", Start: 0, End: time.Second, Drag: 200 * time.Millisecond},
+			{Outputs: []string{"b"}, Category: "link", Start: time.Second, End: 2 * time.Second, Drag: 100 * time.Millisecond},
+		},
+		CatBuildTimes: []catBuildTime{
+			{Category: "cxx", Count: 10, BuildTime: 5 * time.Second, MinBuildTime: 100 * time.Millisecond, MaxBuildTime: time.Second},
+		},
+		TotalBuildTime: 5 * time.Second,
+		BuildDuration:  2 * time.Second,
+		Actions: []action{
+			{Outputs: []string{"a"}, Category: "cxx", Start: 0, End: time.Second},
+			{Outputs: []string{"b"}, Category: "link", Start: time.Second, End: 2 * time.Second},
+		},
+	}
+}
+
+// TestToMetrics verifies that every field populated in a buildStats maps to
+// at least one field on the exported exporter.Metrics.
+func TestToMetrics(t *testing.T) {
+	stats := testBuildStats()
+	got := toMetrics(stats, "test-host", "builder-123")
+
+	if got.Host != "test-host" {
+		t.Errorf("Host = %q, want %q", got.Host, "test-host")
+	}
+	if got.BuilderID != "builder-123" {
+		t.Errorf("BuilderID = %q, want %q", got.BuilderID, "builder-123")
+	}
+	if got.TotalBuildTime != stats.TotalBuildTime {
+		t.Errorf("TotalBuildTime = %s, want %s", got.TotalBuildTime, stats.TotalBuildTime)
+	}
+	if got.BuildDuration != stats.BuildDuration {
+		t.Errorf("BuildDuration = %s, want %s", got.BuildDuration, stats.BuildDuration)
+	}
+	if got.CriticalPathLength != len(stats.CriticalPath) {
+		t.Errorf("CriticalPathLength = %d, want %d", got.CriticalPathLength, len(stats.CriticalPath))
+	}
+	wantDrag := 300 * time.Millisecond
+	if got.CriticalPathDrag != wantDrag {
+		t.Errorf("CriticalPathDrag = %s, want %s", got.CriticalPathDrag, wantDrag)
+	}
+	wantCategories := []exporter.CategoryMetrics{
+		{Category: "cxx", Count: 10, BuildTime: 5 * time.Second, MinTime: 100 * time.Millisecond, MaxTime: time.Second},
+	}
+	if diff := cmp.Diff(wantCategories, got.Categories); diff != "" {
+		t.Errorf("Categories diff (-want +got):\n%s", diff)
+	}
+	wantDurations := []time.Duration{time.Second, time.Second}
+	if diff := cmp.Diff(wantDurations, got.ActionDurations); diff != "" {
+		t.Errorf("ActionDurations diff (-want +got):\n%s", diff)
+	}
+}
+
+// TestPushToSinks verifies that pushToSinks flushes the converted Metrics to
+// every sink, and that a fake sink observes every field toMetrics set.
+func TestPushToSinks(t *testing.T) {
+	sink := &fakeSink{}
+	stats := testBuildStats()
+	want := toMetrics(stats, "test-host", "builder-123")
+	if err := pushToSinks(context.Background(), []exporter.Sink{sink}, want); err != nil {
+		t.Fatalf("pushToSinks() got error: %v", err)
+	}
+	if diff := cmp.Diff(want, sink.pushed); diff != "" {
+		t.Errorf("sink received Metrics diff (-want +got):\n%s", diff)
+	}
+}
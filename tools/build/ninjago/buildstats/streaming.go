@@ -0,0 +1,90 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/chrometrace"
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/readerwriters"
+)
+
+// concurrentTraceWorkers is the default number of goroutines used to
+// unmarshal trace events off the decode channel. Chrome traces for large
+// builds can be hundreds of MiB to multiple GiB, and unmarshaling each
+// event is independent work once its raw bytes have been split off the
+// stream, so it parallelizes well.
+var concurrentTraceWorkers = runtime.GOMAXPROCS(0)
+
+// readChromeTraceConcurrent reads tracePath the same way readChromeTrace
+// does, but splits the single-threaded JSON tokenization (which must stay
+// sequential) from unmarshaling individual events (which doesn't), and
+// fans the latter out across a worker pool. The returned channel is closed
+// once the stream has been read to its end, or a read error has stopped
+// it, and every worker has finished. An event that fails to unmarshal is
+// skipped; errc holds at most one error, and later ones are dropped.
+func readChromeTraceConcurrent(tracePath string) (<-chan *chrometrace.Trace, <-chan error) {
+	out := make(chan *chrometrace.Trace, concurrentTraceWorkers*4)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+
+		traceFile, err := readerwriters.Open(tracePath)
+		if err != nil {
+			errc <- fmt.Errorf("failed to read Ninja trace %q: %v", tracePath, err)
+			return
+		}
+		defer traceFile.Close()
+
+		decoder := json.NewDecoder(traceFile)
+		if _, err := decoder.Token(); err != nil {
+			errc <- fmt.Errorf("error decoding opening bracket: %v", err)
+			return
+		}
+
+		raw := make(chan json.RawMessage, concurrentTraceWorkers*4)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrentTraceWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for msg := range raw {
+					var trace chrometrace.Trace
+					if err := json.Unmarshal(msg, &trace); err != nil {
+						select {
+						case errc <- fmt.Errorf("error decoding trace event: %v", err):
+						default:
+						}
+						continue
+					}
+					if trace.EventType == chrometrace.FlowEventStart || trace.EventType == chrometrace.FlowEventEnd {
+						continue
+					}
+					out <- &trace
+				}
+			}()
+		}
+
+		for decoder.More() {
+			var msg json.RawMessage
+			if err := decoder.Decode(&msg); err != nil {
+				select {
+				case errc <- fmt.Errorf("error decoding trace event: %v", err):
+				default:
+				}
+				break
+			}
+			raw <- msg
+		}
+		close(raw)
+		wg.Wait()
+	}()
+
+	return out, errc
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/chrometrace"
+)
+
+// subtraceCategoryPrefixes lists the trace category labels that identify a
+// sub-phase of an action worth reporting on its own, rather than folded
+// into the action's top-level category. RBE emits "rbe" for remote
+// execution round-trips, and clang emits "clang" for compiler-internal
+// phases (e.g. -ftime-trace); both currently get lost inside the action's
+// overall wall time.
+var subtraceCategoryPrefixes = []string{"rbe", "clang"}
+
+// subtrace is a named, timed interval nested inside a larger build action,
+// such as the RBE round-trip or a clang compilation phase.
+//
+// All fields are exported so this struct can be serialized by json.
+type subtrace struct {
+	// Category is the subtrace category, e.g. "rbe" or "clang".
+	Category string
+	// Name identifies the subtrace within its category, taken from the
+	// trace event's name.
+	Name       string
+	Start, End time.Duration
+	// Output is the build output of the parent action this subtrace
+	// belongs to, used to interleave subtraces back into their parent's
+	// timeline.
+	Output string
+}
+
+func subtraceCategory(eventCategories []string) (string, bool) {
+	for _, c := range eventCategories {
+		for _, prefix := range subtraceCategoryPrefixes {
+			if c == prefix {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// extractSubtraces pulls out the RBE and clang subtraces from traces,
+// attributing each to the build output its parent action produced so
+// downstream consumers can interleave them on a per-action timeline.
+func extractSubtraces(traces []*chrometrace.Trace) []subtrace {
+	var out []subtrace
+	for _, t := range traces {
+		eventCategories := strings.Split(t.Category, ",")
+		category, ok := subtraceCategory(eventCategories)
+		if !ok {
+			continue
+		}
+		var output string
+		if outputs := traceToOutputs(t); len(outputs) > 0 {
+			output = outputs[0]
+		}
+		out = append(out, subtrace{
+			Category: category,
+			Name:     t.Name,
+			Start:    time.Duration(t.TimestampMicros) * time.Microsecond,
+			End:      time.Duration(t.TimestampMicros+t.DurationMicros) * time.Microsecond,
+			Output:   output,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build/ninjago/chrometrace"
+)
+
+// workerInterval is one action's slice of a worker's timeline.
+//
+// All fields are exported so this struct can be serialized by json.
+type workerInterval struct {
+	Start, End time.Duration
+	Output     string
+}
+
+// workerTimeline is the sequence of actions that ran on a single Ninja
+// worker thread and how long that worker was busy in total. How many
+// workers were busy at the same time is summarized separately, in
+// contentionStats.
+//
+// All fields are exported so this struct can be serialized by json.
+type workerTimeline struct {
+	// Tid is the thread ID Ninja's trace assigned this worker.
+	Tid       int64
+	Intervals []workerInterval
+	// BusyTime is the sum of this worker's interval durations.
+	BusyTime time.Duration
+}
+
+// contentionStats summarizes how many workers were simultaneously busy
+// over the life of the build, bucketed by concurrency level.
+//
+// All fields are exported so this struct can be serialized by json.
+type contentionStats struct {
+	// MaxConcurrency is the largest number of workers observed busy at
+	// once.
+	MaxConcurrency int
+	// TimeAtConcurrency maps a concurrency level to the amount of build
+	// wall time spent at that level.
+	TimeAtConcurrency map[int]time.Duration
+}
+
+// perWorkerTimelines groups traces by thread ID into a timeline per
+// worker, so tools can plot what each Ninja worker was doing over the
+// course of the build.
+func perWorkerTimelines(traces []*chrometrace.Trace) []workerTimeline {
+	byTid := make(map[int64]*workerTimeline)
+	var order []int64
+	for _, t := range traces {
+		tl, ok := byTid[t.Tid]
+		if !ok {
+			tl = &workerTimeline{Tid: t.Tid}
+			byTid[t.Tid] = tl
+			order = append(order, t.Tid)
+		}
+		start := time.Duration(t.TimestampMicros) * time.Microsecond
+		end := time.Duration(t.TimestampMicros+t.DurationMicros) * time.Microsecond
+		var output string
+		if outputs := traceToOutputs(t); len(outputs) > 0 {
+			output = outputs[0]
+		}
+		tl.Intervals = append(tl.Intervals, workerInterval{Start: start, End: end, Output: output})
+		tl.BusyTime += end - start
+	}
+
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	out := make([]workerTimeline, 0, len(order))
+	for _, tid := range order {
+		tl := byTid[tid]
+		sort.Slice(tl.Intervals, func(i, j int) bool { return tl.Intervals[i].Start < tl.Intervals[j].Start })
+		out = append(out, *tl)
+	}
+	return out
+}
+
+// timelinePoint is a start (+1) or end (-1) event used to sweep for
+// concurrency, keyed by time so sorting yields a chronological sweep line.
+type timelinePoint struct {
+	t     time.Duration
+	delta int
+}
+
+// computeContention sweeps all worker intervals in time order to compute
+// how many were simultaneously busy throughout the build.
+func computeContention(timelines []workerTimeline) contentionStats {
+	var points []timelinePoint
+	for _, tl := range timelines {
+		for _, iv := range tl.Intervals {
+			points = append(points, timelinePoint{t: iv.Start, delta: 1})
+			points = append(points, timelinePoint{t: iv.End, delta: -1})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].t < points[j].t })
+
+	stats := contentionStats{TimeAtConcurrency: make(map[int]time.Duration)}
+	concurrency := 0
+	last := time.Duration(0)
+	for _, p := range points {
+		if p.t > last && concurrency > 0 {
+			stats.TimeAtConcurrency[concurrency] += p.t - last
+		}
+		last = p.t
+		concurrency += p.delta
+		if concurrency > stats.MaxConcurrency {
+			stats.MaxConcurrency = concurrency
+		}
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package attestation builds in-toto v1 provenance statements describing a
+// shard's generated package repository, so that downstream consumers
+// (swarming tasks, result processors) can verify which blobs a shard was
+// expected to access without trusting the contents of the repo itself.
+package attestation
+
+import "sort"
+
+const (
+	statementType = "https://in-toto.io/Statement/v1"
+	predicateType = "https://slsa.dev/provenance/v1"
+
+	// merkleRootHashName keys Subject.Digest with a Fuchsia-specific
+	// algorithm name rather than the standardized "sha256": a package
+	// blob's merkle root is Fuchsia's own Merkle-tree construction, not
+	// the plain SHA-256 of the blob's bytes, so labeling it "sha256"
+	// would make any consumer that recomputes sha256(blob) and compares
+	// it against the stated digest see a mismatch on every blob.
+	merkleRootHashName = "fuchsia-merkle-root"
+)
+
+// Subject is a single in-toto subject: one blob in the shard's repository,
+// named by its merkle digest.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate records everything a consumer needs in order to judge whether a
+// shard's package repository contains what that shard was expected to
+// access: the shard identity, the manifests that contributed blobs, and
+// which tests pulled in which manifest.
+type Predicate struct {
+	ShardName             string              `json:"shardName"`
+	EnvironmentDimensions map[string]string   `json:"environmentDimensions,omitempty"`
+	ProductBundle         string              `json:"productBundle,omitempty"`
+	PackageManifests      []string            `json:"packageManifests"`
+	TestsByManifest       map[string][]string `json:"testsByManifest"`
+}
+
+// Statement is an in-toto v1 provenance statement for a shard's package
+// repository.
+type Statement struct {
+	Type          string    `json:"_type"`
+	PredicateType string    `json:"predicateType"`
+	Subject       []Subject `json:"subject"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// New builds a Statement for a shard's package repository. manifestsByTest
+// maps each test name that contributed to the repository to the package
+// manifest paths it pulled in, mirroring the pkgManifestsPerTest map
+// CreatePackageRepo already builds. blobMerkles lists every blob, by merkle
+// digest, that was added to the repo's blobs directory; the hashes are
+// reused as-is rather than rehashing blob bytes, since CreatePackageRepo
+// already computed them while walking package manifests.
+func New(shardName string, envDimensions map[string]string, productBundle string, manifestsByTest map[string][]string, blobMerkles []string) Statement {
+	manifestSet := make(map[string]struct{})
+	testsByManifest := make(map[string][]string)
+	for test, manifests := range manifestsByTest {
+		for _, m := range manifests {
+			manifestSet[m] = struct{}{}
+			testsByManifest[m] = append(testsByManifest[m], test)
+		}
+	}
+	manifests := make([]string, 0, len(manifestSet))
+	for m := range manifestSet {
+		manifests = append(manifests, m)
+	}
+	sort.Strings(manifests)
+	for _, tests := range testsByManifest {
+		sort.Strings(tests)
+	}
+
+	subjects := make([]Subject, 0, len(blobMerkles))
+	for _, merkle := range blobMerkles {
+		subjects = append(subjects, Subject{Name: merkle, Digest: map[string]string{merkleRootHashName: merkle}})
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Name < subjects[j].Name })
+
+	return Statement{
+		Type:          statementType,
+		PredicateType: predicateType,
+		Subject:       subjects,
+		Predicate: Predicate{
+			ShardName:             shardName,
+			EnvironmentDimensions: envDimensions,
+			ProductBundle:         productBundle,
+			PackageManifests:      manifests,
+			TestsByManifest:       testsByManifest,
+		},
+	}
+}
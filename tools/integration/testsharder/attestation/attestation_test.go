@@ -0,0 +1,29 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package attestation
+
+import "testing"
+
+func TestNewDedupesManifestsAndSortsTests(t *testing.T) {
+	manifestsByTest := map[string][]string{
+		"test-b": {"pkg/a/manifest.json", "pkg/c/manifest.json"},
+		"test-a": {"pkg/a/manifest.json"},
+	}
+	stmt := New("my-shard", map[string]string{"device_type": "QEMU"}, "core.x64", manifestsByTest, []string{"deadbeef", "abcdef12"})
+
+	if stmt.PredicateType != predicateType {
+		t.Errorf("PredicateType = %q, want %q", stmt.PredicateType, predicateType)
+	}
+	if len(stmt.Predicate.PackageManifests) != 2 {
+		t.Fatalf("PackageManifests = %v, want 2 deduped entries", stmt.Predicate.PackageManifests)
+	}
+	tests := stmt.Predicate.TestsByManifest["pkg/a/manifest.json"]
+	if len(tests) != 2 || tests[0] != "test-a" || tests[1] != "test-b" {
+		t.Errorf("TestsByManifest[pkg/a/manifest.json] = %v, want sorted [test-a test-b]", tests)
+	}
+	if len(stmt.Subject) != 2 || stmt.Subject[0].Digest[merkleRootHashName] != "abcdef12" {
+		t.Errorf("unexpected subjects: %+v", stmt.Subject)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// deliveryBlobSubdir returns the directory, relative to a repository's
+// root, under which blobs encoded as the given delivery-blob type are
+// stored. Type 0 (uncompressed) blobs live directly under "blobs"; every
+// other type gets its own numbered subdirectory, mirroring the layout
+// blobfs expects of a multi-type delivery blob config.
+func deliveryBlobSubdir(blobType int) string {
+	if blobType == 0 {
+		return "blobs"
+	}
+	return filepath.Join("blobs", strconv.Itoa(blobType))
+}
+
+// deliveryBlobLocksMu guards deliveryBlobLocks.
+var deliveryBlobLocksMu sync.Mutex
+
+// deliveryBlobLocks holds one *sync.Mutex per destination path ever passed
+// to ensureDeliveryBlob, so that concurrent calls racing to produce the
+// same (repoRoot, blobType, merkle) serialize on its stat-or-create
+// sequence instead of both invoking deliveryBlobToolPath against the same
+// dst at once. This matters when repoRoot is a pool shared across shards
+// prepared concurrently by MakePackageRepos; entries are never removed,
+// but they're bounded by the number of distinct typed blobs a single
+// testsharder invocation ever ensures.
+var deliveryBlobLocks = make(map[string]*sync.Mutex)
+
+// deliveryBlobLock returns the mutex serializing ensureDeliveryBlob calls
+// for dst, creating it if this is the first call for that destination.
+func deliveryBlobLock(dst string) *sync.Mutex {
+	deliveryBlobLocksMu.Lock()
+	defer deliveryBlobLocksMu.Unlock()
+	mu, ok := deliveryBlobLocks[dst]
+	if !ok {
+		mu = &sync.Mutex{}
+		deliveryBlobLocks[dst] = mu
+	}
+	return mu
+}
+
+// ensureDeliveryBlob ensures that merkle is present, encoded as blobType,
+// under repoRoot/deliveryBlobSubdir(blobType)/merkle. If that encoding is
+// already present somewhere in globalRepoMetadata's tree, it's linked or
+// copied from there; otherwise it's generated by invoking
+// deliveryBlobToolPath against sourcePath, the blob's uncompressed source,
+// as indicated by its package manifest. Already-generated blobs are left
+// untouched, so it's safe to call repeatedly (including concurrently, for
+// the same or distinct merkles) as shards are prepared.
+func ensureDeliveryBlob(merkle, sourcePath string, blobType int, globalRepoMetadata, repoRoot, deliveryBlobToolPath string) error {
+	dst := filepath.Join(repoRoot, deliveryBlobSubdir(blobType), merkle)
+
+	mu := deliveryBlobLock(dst)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	// It may already have been generated elsewhere in the build (e.g. by
+	// a prior build step, or another delivery-blob-type config).
+	globalTyped := filepath.Join(globalRepoMetadata, deliveryBlobSubdir(blobType), merkle)
+	if err := linkOrCopy(globalTyped, dst); err == nil {
+		return nil
+	}
+
+	if deliveryBlobToolPath == "" {
+		return fmt.Errorf("blob %s is not available as delivery-blob type %d and no delivery-blob tool was provided to generate it", merkle, blobType)
+	}
+	cmd := exec.Command(deliveryBlobToolPath, "create", "--type", strconv.Itoa(blobType), "--compress", sourcePath, dst)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to generate delivery blob %s as type %d: %w: %s", merkle, blobType, err, out)
+	}
+	return nil
+}
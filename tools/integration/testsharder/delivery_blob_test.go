@@ -0,0 +1,61 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeliveryBlobSubdir(t *testing.T) {
+	if got := deliveryBlobSubdir(0); got != "blobs" {
+		t.Errorf("deliveryBlobSubdir(0) = %q, want %q", got, "blobs")
+	}
+	if got, want := deliveryBlobSubdir(1), filepath.Join("blobs", "1"); got != want {
+		t.Errorf("deliveryBlobSubdir(1) = %q, want %q", got, want)
+	}
+}
+
+func TestEnsureDeliveryBlobGeneratesMissingBlob(t *testing.T) {
+	repoRoot := t.TempDir()
+	globalRepoMetadata := t.TempDir()
+
+	srcDir := t.TempDir()
+	src := filepath.Join(srcDir, "uncompressed-blob")
+	if err := os.WriteFile(src, []byte("blob contents"), 0o600); err != nil {
+		t.Fatalf("failed to write source blob: %v", err)
+	}
+
+	// A trivial "compressor" that just copies its input to its output,
+	// standing in for the real delivery-blob host tool.
+	toolPath := filepath.Join(t.TempDir(), "fake-delivery-blob.sh")
+	script := "#!/bin/sh\ncp \"$5\" \"$6\"\n"
+	if err := os.WriteFile(toolPath, []byte(script), 0o700); err != nil {
+		t.Fatalf("failed to write fake tool: %v", err)
+	}
+
+	if err := ensureDeliveryBlob("deadbeef", src, 1, globalRepoMetadata, repoRoot, toolPath); err != nil {
+		t.Fatalf("ensureDeliveryBlob() = %v", err)
+	}
+
+	dst := filepath.Join(repoRoot, deliveryBlobSubdir(1), "deadbeef")
+	contents, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read generated blob: %v", err)
+	}
+	if string(contents) != "blob contents" {
+		t.Errorf("generated blob contents = %q, want %q", contents, "blob contents")
+	}
+
+	// Calling again should be a no-op; clear the tool so any attempt to
+	// re-invoke it would fail.
+	if err := os.Remove(toolPath); err != nil {
+		t.Fatalf("failed to remove fake tool: %v", err)
+	}
+	if err := ensureDeliveryBlob("deadbeef", src, 1, globalRepoMetadata, repoRoot, toolPath); err != nil {
+		t.Errorf("ensureDeliveryBlob() on already-generated blob = %v, want nil", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/maps"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/lib/jsonutil"
+)
+
+const (
+	// sharedRepoName is the directory, relative to the build directory,
+	// under which MakePackageRepos pools blobs shared across shards when
+	// RepoOptions.SharedBlobPool is set.
+	sharedRepoName = "repo_shared"
+
+	// allowlistFileName is the name of the file, within a shard's
+	// repository, that lists the merkles of the blobs that shard is
+	// permitted to access from the shared pool.
+	allowlistFileName = "allowlist"
+
+	// repoConcurrency bounds how many shards' repositories are prepared
+	// at once; the work is I/O-bound, so this can comfortably exceed
+	// GOMAXPROCS.
+	repoConcurrency = 8
+)
+
+// RepoOptions configures how MakePackageRepos materializes package
+// repositories for a set of shards.
+type RepoOptions struct {
+	// CacheTestPackages indicates that each shard's repository should be
+	// populated with the blobs its tests are expected to access.
+	CacheTestPackages bool
+
+	// EmitAttestations indicates that an in-toto provenance statement
+	// should be written alongside each shard's repository. Only takes
+	// effect if CacheTestPackages is also set.
+	EmitAttestations bool
+
+	// SharedBlobPool, combined with CacheTestPackages, causes blobs to be
+	// deduplicated into a single content-addressed pool under
+	// buildDir/repo_shared/blobs rather than hardlinked into every
+	// shard's own repository. Each shard's repository instead gets a
+	// blobs symlink (a directory junction on Windows) into the pool,
+	// plus an allowlist file naming the merkles it's permitted to
+	// access. This avoids the hardlink and inode fan-out of copying
+	// every blob into every shard that shares it.
+	//
+	// Leave this unset for executors that can't follow a symlink that
+	// crosses out of the shard's own repository directory; doing so
+	// reproduces the historical per-shard-copy behavior of
+	// CreatePackageRepo.
+	SharedBlobPool bool
+
+	// DeliveryBlobToolPath is the path to the host delivery-blob
+	// compressor tool, used to generate a shard's requested
+	// Shard.DeliveryBlobType on the fly if it isn't already present in
+	// globalRepoMetadata. May be left empty if no shard sets
+	// DeliveryBlobType.
+	DeliveryBlobToolPath string
+}
+
+// MakePackageRepos creates a package repository for each of shards. Shards
+// are prepared concurrently, since the work is dominated by file I/O.
+//
+// If opts.SharedBlobPool or opts.CacheTestPackages is unset, this is
+// equivalent to calling Shard.CreatePackageRepo on each shard
+// independently. If both are set, blobs
+// shared between shards are hardlinked into a single pool exactly once,
+// and each shard's repository references that pool rather than duplicating
+// the blobs itself; see RepoOptions.SharedBlobPool.
+func MakePackageRepos(shards []*Shard, buildDir, globalRepoMetadata string, opts RepoOptions) error {
+	if !opts.SharedBlobPool || !opts.CacheTestPackages {
+		return forEachShard(shards, func(s *Shard) error {
+			return s.CreatePackageRepo(buildDir, globalRepoMetadata, opts.CacheTestPackages, opts.EmitAttestations, opts.DeliveryBlobToolPath)
+		})
+	}
+
+	globalRepoMetadataAbs := filepath.Join(buildDir, globalRepoMetadata)
+	blobsDirRel, err := build.GetBlobsDir(filepath.Join(buildDir, deliveryBlobConfigName))
+	if err != nil {
+		return fmt.Errorf("failed to get blobs dir: %w", err)
+	}
+
+	sharedRepoRoot := filepath.Join(buildDir, sharedRepoName)
+	poolDir := filepath.Join(sharedRepoRoot, blobsDirRel)
+	if err := os.MkdirAll(poolDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	var poolMu sync.Mutex
+	pool := make(map[string]struct{})
+
+	return forEachShard(shards, func(s *Shard) error {
+		return s.createPooledPackageRepo(buildDir, globalRepoMetadataAbs, blobsDirRel, sharedRepoRoot, poolDir, pool, &poolMu, opts.EmitAttestations, opts.DeliveryBlobToolPath)
+	})
+}
+
+// forEachShard invokes f on every shard in shards, at most repoConcurrency
+// at a time, and returns the first error encountered (if any), after all
+// invocations have completed.
+func forEachShard(shards []*Shard, f func(*Shard) error) error {
+	sem := make(chan struct{}, repoConcurrency)
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, s := range shards {
+		i, s := i, s
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = f(s)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %s: %w", shards[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// createPooledPackageRepo creates this shard's repository with its blobs
+// served from the shared pool at poolDir, rather than copied into the
+// shard's own repository. Every blob this shard's tests reference is added
+// to pool (guarded by poolMu) and hardlinked into poolDir the first time
+// any shard references it. If the shard sets DeliveryBlobType, its blobs
+// are additionally ensured, in that type, under sharedRepoRoot, generating
+// them via deliveryBlobToolPath as needed.
+func (s *Shard) createPooledPackageRepo(buildDir, globalRepoMetadataAbs, blobsDirRel, sharedRepoRoot, poolDir string, pool map[string]struct{}, poolMu *sync.Mutex, emitAttestation bool, deliveryBlobToolPath string) error {
+	localRepoRel := fmt.Sprintf("repo_%s", url.PathEscape(s.Name))
+	localRepo := filepath.Join(buildDir, localRepoRel)
+	if err := os.RemoveAll(localRepo); err != nil {
+		return err
+	}
+
+	localRepoMetadata := filepath.Join(localRepo, metadataDirName)
+	if err := os.MkdirAll(localRepoMetadata, os.ModePerm); err != nil {
+		return err
+	}
+	if err := linkRepoMetadata(globalRepoMetadataAbs, localRepoMetadata); err != nil {
+		return err
+	}
+
+	pkgManifestsPerTest, err := s.packageManifestsPerTest(buildDir)
+	if err != nil {
+		return err
+	}
+
+	shardBlobs := make(map[string]struct{})
+	for testName, pkgManifests := range pkgManifestsPerTest {
+		for _, p := range pkgManifests {
+			if err := prepareBlobsForPackage(p, testName, pool, poolMu, shardBlobs, buildDir, globalRepoMetadataAbs, blobsDirRel, poolDir, sharedRepoRoot, s.DeliveryBlobType, deliveryBlobToolPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	// blobsDirRel is rooted at "blobs", the same root deliveryBlobSubdir
+	// nests non-default delivery-blob types under, so linking that root
+	// once here exposes both the pool and any typed blobs
+	// ensureDeliveryBlob wrote under sharedRepoRoot.
+	blobsDir := filepath.Join(localRepo, "blobs")
+	if err := symlinkBlobsDir(filepath.Join(sharedRepoRoot, "blobs"), blobsDir); err != nil {
+		return fmt.Errorf("failed to link shared blob pool: %w", err)
+	}
+	if err := writeAllowlist(localRepo, shardBlobs); err != nil {
+		return fmt.Errorf("failed to write allowlist: %w", err)
+	}
+
+	if emitAttestation {
+		if err := s.writeAttestation(localRepo, pkgManifestsPerTest, shardBlobs); err != nil {
+			return fmt.Errorf("failed to write attestation: %w", err)
+		}
+	}
+
+	s.PkgRepo = localRepoRel
+	s.AddDeps([]string{localRepoRel})
+	return nil
+}
+
+// packageManifestsPerTest returns, for each of the shard's tests, the list
+// of package manifest paths it's expected to pull blobs from, resolving
+// PackageManifestDepsFile if set.
+func (s *Shard) packageManifestsPerTest(buildDir string) (map[string][]string, error) {
+	pkgManifestsPerTest := make(map[string][]string)
+	for _, t := range s.Tests {
+		pkgManifests := t.PackageManifests
+		if t.PackageManifestDepsFile != "" {
+			var pkgManifestDeps []string
+			if err := jsonutil.ReadFromFile(filepath.Join(buildDir, t.PackageManifestDepsFile), &pkgManifestDeps); err != nil {
+				return nil, err
+			}
+			pkgManifests = append(pkgManifests, pkgManifestDeps...)
+		}
+		pkgManifestsPerTest[t.Name] = pkgManifests
+	}
+	return pkgManifestsPerTest, nil
+}
+
+// writeAllowlist writes the merkles of blobs, sorted, one per line, to
+// localRepo/allowlist.
+func writeAllowlist(localRepo string, blobs map[string]struct{}) error {
+	merkles := maps.Keys(blobs)
+	sort.Strings(merkles)
+	f, err := os.Create(filepath.Join(localRepo, allowlistFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, merkle := range merkles {
+		if _, err := fmt.Fprintln(f, merkle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// symlinkBlobsDir links blobsDir to poolDir so a shard's repository can
+// resolve blobs from the shared pool without copying them. On POSIX this
+// is a plain relative symlink; on Windows, where creating a symlink to a
+// directory requires elevated privilege, it creates a directory junction
+// instead, which doesn't.
+func symlinkBlobsDir(poolDir, blobsDir string) error {
+	if err := os.MkdirAll(filepath.Dir(blobsDir), os.ModePerm); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/c", "mklink", "/J", blobsDir, poolDir).Run()
+	}
+	target, err := filepath.Rel(filepath.Dir(blobsDir), poolDir)
+	if err != nil {
+		target = poolDir
+	}
+	return os.Symlink(target, blobsDir)
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForEachShardReturnsFirstError(t *testing.T) {
+	shards := []*Shard{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	wantErr := errors.New("boom")
+
+	err := forEachShard(shards, func(s *Shard) error {
+		if s.Name == "b" {
+			return wantErr
+		}
+		return nil
+	})
+	if err == nil || !errors.Is(err, wantErr) {
+		t.Errorf("forEachShard() = %v, want an error wrapping %v", err, wantErr)
+	}
+}
+
+func TestWriteAllowlistSortsMerkles(t *testing.T) {
+	dir := t.TempDir()
+	blobs := map[string]struct{}{"bbbb": {}, "aaaa": {}, "cccc": {}}
+	if err := writeAllowlist(dir, blobs); err != nil {
+		t.Fatalf("writeAllowlist() = %v", err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(dir, allowlistFileName))
+	if err != nil {
+		t.Fatalf("failed to read allowlist: %v", err)
+	}
+	want := "aaaa\nbbbb\ncccc\n"
+	if string(contents) != want {
+		t.Errorf("allowlist contents = %q, want %q", contents, want)
+	}
+}
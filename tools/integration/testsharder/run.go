@@ -0,0 +1,85 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"context"
+	"fmt"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder/metadata"
+)
+
+// Request captures the full set of inputs to the testsharder pipeline, so
+// that sharding can be driven as a library call by an in-process caller
+// (e.g. fx) rather than only by exec-ing the testsharder command and
+// reparsing its JSON output.
+type Request struct {
+	// TestSpecs is the build's full test-spec list (tests.json).
+	TestSpecs []build.TestSpec
+
+	// TestListEntries supplements TestSpecs with the per-test data in
+	// test-list.json (e.g. expected run tags), keyed by test name.
+	TestListEntries map[string]build.TestListEntry
+
+	// TestMetadata supplements TestSpecs with maintainer-supplied
+	// per-test metadata (e.g. flake policy), keyed by test name.
+	TestMetadata map[string]metadata.TestMetadata
+
+	// ShardOptions parametrizes how MakeShards groups and orders tests
+	// into shards, including tag filtering and, if TimingData is set,
+	// duration-aware balancing.
+	ShardOptions ShardOptions
+
+	// BuildDir is the path to the Fuchsia build directory.
+	BuildDir string
+
+	// GlobalRepoMetadata, relative to BuildDir, is the full build's TUF
+	// repository, from which per-shard repositories are carved. Leave
+	// empty to skip creating package repositories entirely.
+	GlobalRepoMetadata string
+
+	// RepoOptions parametrizes how package repositories are
+	// materialized for each shard. Ignored if GlobalRepoMetadata is
+	// empty.
+	RepoOptions RepoOptions
+}
+
+// Response is the result of running a Request through the testsharder
+// pipeline.
+type Response struct {
+	// Shards is the final list of shards, after MakeShards, package repo
+	// creation, and name deduplication.
+	Shards []*Shard `json:"shards"`
+}
+
+// Run executes the full testsharder pipeline described by req: it shards
+// req.TestSpecs by environment (and, if req.ShardOptions.TimingData is
+// set, by historical duration), then, if req.GlobalRepoMetadata is set,
+// materializes each shard's package repository per req.RepoOptions.
+//
+// This is the library equivalent of the testsharder command; the command
+// itself is expected to be a thin wrapper that loads its flag-specified
+// inputs into a Request and serializes the resulting Response's Shards to
+// JSON.
+func Run(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opts := req.ShardOptions
+	shards := MakeShards(req.TestSpecs, req.TestListEntries, &opts, req.TestMetadata)
+
+	if req.GlobalRepoMetadata != "" {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := MakePackageRepos(shards, req.BuildDir, req.GlobalRepoMetadata, req.RepoOptions); err != nil {
+			return nil, fmt.Errorf("failed to create package repos: %w", err)
+		}
+	}
+
+	return &Response{Shards: shards}, nil
+}
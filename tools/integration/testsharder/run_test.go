@@ -0,0 +1,47 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"context"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+)
+
+func TestRunShardsWithoutRepoMetadata(t *testing.T) {
+	req := Request{
+		TestSpecs: []build.TestSpec{
+			{
+				Test: build.Test{Name: "foo-test", OS: "fuchsia"},
+				Envs: []build.Environment{{}},
+			},
+		},
+	}
+
+	resp, err := Run(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if len(resp.Shards) != 1 {
+		t.Fatalf("Run() produced %d shards, want 1: %v", len(resp.Shards), resp.Shards)
+	}
+	if len(resp.Shards[0].Tests) != 1 || resp.Shards[0].Tests[0].Name != "foo-test" {
+		t.Errorf("unexpected shard tests: %+v", resp.Shards[0].Tests)
+	}
+	// PkgRepo should remain unset since no GlobalRepoMetadata was given.
+	if resp.Shards[0].PkgRepo != "" {
+		t.Errorf("PkgRepo = %q, want empty", resp.Shards[0].PkgRepo)
+	}
+}
+
+func TestRunRespectsCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Run(ctx, Request{}); err == nil {
+		t.Error("Run() with a canceled context = nil error, want non-nil")
+	}
+}
@@ -13,14 +13,15 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 
 	"go.fuchsia.dev/fuchsia/tools/build"
 	fintpb "go.fuchsia.dev/fuchsia/tools/integration/fint/proto"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder/attestation"
 	"go.fuchsia.dev/fuchsia/tools/integration/testsharder/metadata"
-	"go.fuchsia.dev/fuchsia/tools/lib/jsonutil"
 	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
 )
 
@@ -29,6 +30,9 @@ const (
 	metadataDirName = "repository"
 	// The delivery blob config.
 	deliveryBlobConfigName = "delivery_blob_config.json"
+	// The name of the in-toto attestation file emitted when
+	// CreatePackageRepo is asked to emit one.
+	attestationFileName = "attestation.intoto.json"
 )
 
 // Shard represents a set of tests with a common execution environment.
@@ -82,6 +86,14 @@ type Shard struct {
 	// `-deps-file` flag is provided meaning that local artifacts will be used and
 	// thus the builder itself won't have the fint set artifacts available.
 	BuildMetadata fintpb.SetArtifacts_Metadata `json:"build_metadata,omitempty"`
+
+	// DeliveryBlobType, if non-nil, overrides the delivery blob type this
+	// shard's package repository should be populated with (e.g. type 1,
+	// ZSTD-chunked), rather than the build-wide default encoded in
+	// delivery_blob_config.json. This lets a single build produce shards
+	// that exercise more than one delivery-blob format without a
+	// separate build for each.
+	DeliveryBlobType *int `json:"delivery_blob_type,omitempty"`
 }
 
 // CIPDPackage describes the CIPD package, version and subdir to download the package to
@@ -120,8 +132,17 @@ func (s *Shard) HostCPU() string {
 	return "x64"
 }
 
-// CreatePackageRepo creates a package repository for the given shard.
-func (s *Shard) CreatePackageRepo(buildDir string, globalRepoMetadata string, cacheTestPackages bool) error {
+// CreatePackageRepo creates a package repository for the given shard. If
+// emitAttestation is set (and cacheTestPackages is too, since there'd be no
+// blobs to attest to otherwise), an in-toto provenance statement describing
+// the repo's blobs is written to <localRepo>/attestation.intoto.json.
+//
+// If s.DeliveryBlobType is set, every blob is additionally encoded in that
+// delivery-blob type and placed in its own subtree of localRepo, generating
+// it via deliveryBlobToolPath if it isn't already present in
+// globalRepoMetadata in that form. deliveryBlobToolPath may be empty if no
+// shard is expected to request a non-default delivery-blob type.
+func (s *Shard) CreatePackageRepo(buildDir string, globalRepoMetadata string, cacheTestPackages bool, emitAttestation bool, deliveryBlobToolPath string) error {
 	globalRepoMetadata = filepath.Join(buildDir, globalRepoMetadata)
 
 	// The path to the package repository should be unique so as to not
@@ -138,35 +159,15 @@ func (s *Shard) CreatePackageRepo(buildDir string, globalRepoMetadata string, ca
 	if err := os.MkdirAll(localRepoMetadata, os.ModePerm); err != nil {
 		return err
 	}
-	entries, err := os.ReadDir(globalRepoMetadata)
-	if err != nil {
+	if err := linkRepoMetadata(globalRepoMetadata, localRepoMetadata); err != nil {
 		return err
 	}
-	for _, e := range entries {
-		filename := e.Name()
-		if filepath.Ext(filename) == ".json" {
-			src := filepath.Join(globalRepoMetadata, filename)
-			dst := filepath.Join(localRepoMetadata, filename)
-			if err := os.Link(src, dst); err != nil {
-				return err
-			}
-		}
-	}
 	// Add the blobs we expect the shard to access if the caller wants us to
 	// set up a local package cache.
 	if cacheTestPackages {
-		pkgManifestsPerTest := make(map[string][]string)
-		for _, t := range s.Tests {
-			pkgManifests := t.PackageManifests
-			if t.PackageManifestDepsFile != "" {
-				var pkgManifestDeps []string
-				if err := jsonutil.ReadFromFile(filepath.Join(buildDir, t.PackageManifestDepsFile), &pkgManifestDeps); err != nil {
-					return err
-				} else {
-					pkgManifests = append(pkgManifests, pkgManifestDeps...)
-				}
-			}
-			pkgManifestsPerTest[t.Name] = pkgManifests
+		pkgManifestsPerTest, err := s.packageManifestsPerTest(buildDir)
+		if err != nil {
+			return err
 		}
 
 		// Use delivery blobs if the config exists.
@@ -181,11 +182,17 @@ func (s *Shard) CreatePackageRepo(buildDir string, globalRepoMetadata string, ca
 		}
 		for testName, pkgManifests := range pkgManifestsPerTest {
 			for _, p := range pkgManifests {
-				if err := prepareBlobsForPackage(p, testName, addedBlobs, buildDir, globalRepoMetadata, blobsDirRel, blobsDir); err != nil {
+				if err := prepareBlobsForPackage(p, testName, addedBlobs, nil, addedBlobs, buildDir, globalRepoMetadata, blobsDirRel, blobsDir, localRepo, s.DeliveryBlobType, deliveryBlobToolPath); err != nil {
 					return err
 				}
 			}
 		}
+
+		if emitAttestation {
+			if err := s.writeAttestation(localRepo, pkgManifestsPerTest, addedBlobs); err != nil {
+				return fmt.Errorf("failed to write attestation: %w", err)
+			}
+		}
 	}
 
 	s.PkgRepo = localRepoRel
@@ -193,18 +200,73 @@ func (s *Shard) CreatePackageRepo(buildDir string, globalRepoMetadata string, ca
 	return nil
 }
 
+// writeAttestation builds an in-toto provenance statement for the blobs
+// added to localRepo and writes it to <localRepo>/attestation.intoto.json.
+// It reuses the merkles already computed by prepareBlobsForPackage rather
+// than rehashing blob bytes.
+func (s *Shard) writeAttestation(localRepo string, pkgManifestsPerTest map[string][]string, addedBlobs map[string]struct{}) error {
+	blobMerkles := maps.Keys(addedBlobs)
+	sort.Strings(blobMerkles)
+	stmt := attestation.New(s.Name, s.Env.Dimensions, s.ProductBundle, pkgManifestsPerTest, blobMerkles)
+
+	f, err := os.Create(filepath.Join(localRepo, attestationFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stmt)
+}
+
+// linkRepoMetadata hardlinks every JSON file (TUF metadata) directly within
+// globalRepoMetadata into localRepoMetadata.
+func linkRepoMetadata(globalRepoMetadata, localRepoMetadata string) error {
+	entries, err := os.ReadDir(globalRepoMetadata)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		filename := e.Name()
+		if filepath.Ext(filename) == ".json" {
+			src := filepath.Join(globalRepoMetadata, filename)
+			dst := filepath.Join(localRepoMetadata, filename)
+			if err := os.Link(src, dst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // prepareBlobsForPackage loads the given manifest path and ensures that all
 // blobs it references, either directly or via subpackages, are copied or
-// linked from globalRepoMetadata/blobsDirRel into blobsDir and enumerated in
-// addedBlobs.
+// linked from globalRepoMetadata/blobsDirRel into blobsDir, enumerated in
+// pool, and recorded in shardBlobs. pool and shardBlobs are allowed to be
+// the same map (the non-pooled case, where every shard gets its own copy
+// of the blobs it needs), or distinct (the shared-pool case, where pool is
+// deduplicated globally across shards under poolMu while shardBlobs
+// records only the blobs this particular shard's tests pulled in, for its
+// allowlist). poolMu may be nil if pool is not shared with other
+// goroutines.
+//
+// If blobType is non-nil, every blob is additionally ensured in that
+// delivery-blob type under repoRoot (see ensureDeliveryBlob), generating it
+// via deliveryBlobToolPath if needed.
 func prepareBlobsForPackage(
 	manifestPath string,
 	testName string,
-	addedBlobs map[string]struct{},
+	pool map[string]struct{},
+	poolMu *sync.Mutex,
+	shardBlobs map[string]struct{},
 	buildDir string,
 	globalRepoMetadata string,
 	blobsDirRel string,
 	blobsDir string,
+	repoRoot string,
+	blobType *int,
+	deliveryBlobToolPath string,
 ) error {
 	manifestAbsPath := manifestPath
 	if !filepath.IsAbs(manifestAbsPath) {
@@ -215,23 +277,41 @@ func prepareBlobsForPackage(
 		return err
 	}
 
-	// Ensure all blobs directly referenced are added
+	// Ensure all blobs directly referenced are added.
 	for _, blob := range manifest.Blobs {
-		if _, exists := addedBlobs[blob.Merkle.String()]; !exists {
+		merkle := blob.Merkle.String()
+		shardBlobs[merkle] = struct{}{}
+
+		needsCopy := false
+		if poolMu != nil {
+			poolMu.Lock()
+		}
+		if _, exists := pool[merkle]; !exists {
+			pool[merkle] = struct{}{}
+			needsCopy = true
+		}
+		if poolMu != nil {
+			poolMu.Unlock()
+		}
+		if needsCopy {
 			// Use the blobs from the blobs dir instead of blob.SourcePath
 			// since SourcePath only points to uncompressed blobs.
-			src := filepath.Join(globalRepoMetadata, blobsDirRel, blob.Merkle.String())
-			dst := filepath.Join(blobsDir, blob.Merkle.String())
+			src := filepath.Join(globalRepoMetadata, blobsDirRel, merkle)
+			dst := filepath.Join(blobsDir, merkle)
 			if err := linkOrCopy(src, dst); err != nil {
 				return fmt.Errorf("failed to copy blob %s from %s for %s: %w", blob.SourcePath, manifestPath, testName, err)
 			}
-			addedBlobs[blob.Merkle.String()] = struct{}{}
+		}
+		if blobType != nil {
+			if err := ensureDeliveryBlob(merkle, blob.SourcePath, *blobType, globalRepoMetadata, repoRoot, deliveryBlobToolPath); err != nil {
+				return fmt.Errorf("failed to prepare delivery blob %s from %s for %s: %w", merkle, manifestPath, testName, err)
+			}
 		}
 	}
 
 	// Walk all subpackages and ensure their blobs are added too.
 	for _, subpackage := range manifest.Subpackages {
-		if err := prepareBlobsForPackage(subpackage.ManifestPath, testName, addedBlobs, buildDir, globalRepoMetadata, blobsDirRel, blobsDir); err != nil {
+		if err := prepareBlobsForPackage(subpackage.ManifestPath, testName, pool, poolMu, shardBlobs, buildDir, globalRepoMetadata, blobsDirRel, blobsDir, repoRoot, blobType, deliveryBlobToolPath); err != nil {
 			return err
 		}
 	}
@@ -264,6 +344,37 @@ type ShardOptions struct {
 	// Tags is the list of tags that the sharded Environments must match; those
 	// that don't match all tags will be ignored.
 	Tags []string
+
+	// TimingData, if non-nil, enables duration-aware sharding: rather
+	// than grouping every non-isolated test for an environment/product
+	// bundle into a single shard, MakeShards bin-packs them across as
+	// many shards as needed to keep each one's expected total runtime
+	// near TargetShardDurationSecs, using the historical per-test
+	// durations in TimingData (see LoadTimingData).
+	TimingData TimingData
+
+	// TargetShardDurationSecs is the expected wall-clock duration, in
+	// seconds, that duration-aware sharding fills a shard up to: a new
+	// shard is opened only once every existing one's expected total meets
+	// or exceeds it, so a shard's total can end up above it. Ignored if
+	// TimingData is nil.
+	TargetShardDurationSecs int
+
+	// DurationSafetyFactor scales each test's expected duration as
+	// mean + DurationSafetyFactor*stddev before packing, to leave
+	// headroom for slower-than-average runs. Ignored if TimingData is
+	// nil.
+	DurationSafetyFactor float64
+
+	// DefaultTestDurationSecs is the expected duration assumed for tests
+	// absent from TimingData. Ignored if TimingData is nil.
+	DefaultTestDurationSecs int
+
+	// ShardTimeoutOverheadSecs is added to the sum of a shard's tests'
+	// expected durations to produce Shard.TimeoutSecs, when TimingData
+	// is set, to account for fixed per-shard overhead like booting.
+	// Ignored if TimingData is nil.
+	ShardTimeoutOverheadSecs int
 }
 
 // MakeShards returns the list of shards associated with a given build.
@@ -343,7 +454,12 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 			}
 		}
 		for _, shard := range shardForProductBundle {
-			if len(shard.Tests) > 0 {
+			if len(shard.Tests) == 0 {
+				continue
+			}
+			if opts.TimingData != nil {
+				shards = append(shards, splitShardByDuration(shard, opts)...)
+			} else {
 				shards = append(shards, shard)
 			}
 		}
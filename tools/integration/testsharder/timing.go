@@ -0,0 +1,123 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"fmt"
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/jsonutil"
+)
+
+// TestDurationStats summarizes a test's historical wall-clock duration, in
+// the same mean/stddev shape as the summary statistics the Go dashboard
+// builder computes over prior perf-result/benchmark logs.
+type TestDurationStats struct {
+	MeanDurationSecs   float64 `json:"mean_duration_secs"`
+	StddevDurationSecs float64 `json:"stddev_duration_secs"`
+}
+
+// TimingData maps test name to its historical duration stats, as loaded
+// from the file passed via -timing-data.
+type TimingData map[string]TestDurationStats
+
+// LoadTimingData reads per-test historical duration stats from the JSON
+// file at path.
+func LoadTimingData(path string) (TimingData, error) {
+	var data TimingData
+	if err := jsonutil.ReadFromFile(path, &data); err != nil {
+		return nil, fmt.Errorf("failed to load timing data from %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// expectedDurationSecs returns the duration to assign a test for
+// bin-packing purposes: its historical mean plus a safety-factor multiple
+// of its stddev, or opts.DefaultTestDurationSecs if it has no history.
+func expectedDurationSecs(testName string, opts *ShardOptions) float64 {
+	stats, ok := opts.TimingData[testName]
+	if !ok {
+		return float64(opts.DefaultTestDurationSecs)
+	}
+	return stats.MeanDurationSecs + opts.DurationSafetyFactor*stats.StddevDurationSecs
+}
+
+// packTestsByDuration bins tests using a Longest-Processing-Time-first
+// heuristic: tests are considered in descending order of expected
+// duration, and each is assigned to the currently least-loaded bin,
+// opening a new bin only once every existing bin's total already meets or
+// exceeds opts.TargetShardDurationSecs. This bounds, without strictly
+// minimizing, the expected runtime of the busiest resulting shard.
+func packTestsByDuration(tests []Test, opts *ShardOptions) [][]Test {
+	type bin struct {
+		tests     []Test
+		totalSecs float64
+	}
+
+	durations := make(map[string]float64, len(tests))
+	for _, t := range tests {
+		durations[t.Name] = expectedDurationSecs(t.Name, opts)
+	}
+	sorted := make([]Test, len(tests))
+	copy(sorted, tests)
+	sort.Slice(sorted, func(i, j int) bool {
+		return durations[sorted[i].Name] > durations[sorted[j].Name]
+	})
+
+	target := float64(opts.TargetShardDurationSecs)
+	var bins []*bin
+	for _, t := range sorted {
+		var chosen *bin
+		for _, b := range bins {
+			if chosen == nil || b.totalSecs < chosen.totalSecs {
+				chosen = b
+			}
+		}
+		if chosen == nil || chosen.totalSecs >= target {
+			chosen = &bin{}
+			bins = append(bins, chosen)
+		}
+		chosen.tests = append(chosen.tests, t)
+		chosen.totalSecs += durations[t.Name]
+	}
+
+	groups := make([][]Test, len(bins))
+	for i, b := range bins {
+		groups[i] = b.tests
+	}
+	return groups
+}
+
+// shardTimeoutSecs sums the expected durations of tests and adds the
+// configured per-shard overhead, for use as Shard.TimeoutSecs when
+// duration-aware sharding is enabled.
+func shardTimeoutSecs(tests []Test, opts *ShardOptions) int {
+	total := float64(opts.ShardTimeoutOverheadSecs)
+	for _, t := range tests {
+		total += expectedDurationSecs(t.Name, opts)
+	}
+	return int(total)
+}
+
+// splitShardByDuration re-partitions a single shard's tests into one or
+// more shards balanced by historical runtime, per opts.TimingData, rather
+// than left as the single shard MakeShards would otherwise produce. Each
+// resulting shard's TimeoutSecs is the sum of its tests' expected
+// durations plus opts.ShardTimeoutOverheadSecs; if more than one shard
+// results, each is given a numeric suffix to keep names unique.
+func splitShardByDuration(shard *Shard, opts *ShardOptions) []*Shard {
+	groups := packTestsByDuration(shard.Tests, opts)
+	result := make([]*Shard, len(groups))
+	for i, tests := range groups {
+		s := *shard
+		s.Tests = tests
+		s.TimeoutSecs = shardTimeoutSecs(tests, opts)
+		if len(groups) > 1 {
+			s.Name = fmt.Sprintf("%s-%d", shard.Name, i)
+		}
+		result[i] = &s
+	}
+	return result
+}
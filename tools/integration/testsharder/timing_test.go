@@ -0,0 +1,49 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+)
+
+func TestPackTestsByDurationBalancesAgainstTarget(t *testing.T) {
+	tests := []Test{
+		{Test: build.Test{Name: "slow-a"}},
+		{Test: build.Test{Name: "slow-b"}},
+		{Test: build.Test{Name: "tiny"}},
+	}
+	opts := &ShardOptions{
+		TimingData: TimingData{
+			"slow-a": {MeanDurationSecs: 90},
+			"slow-b": {MeanDurationSecs: 80},
+			"tiny":   {MeanDurationSecs: 5},
+		},
+		TargetShardDurationSecs: 100,
+	}
+
+	// slow-a (90) opens the first shard. slow-b (80) still goes into that
+	// same shard, since its total (90) doesn't yet exceed the 100s
+	// target; only once that shard's total (170) exceeds the target does
+	// tiny (5) open a second shard.
+	groups := packTestsByDuration(tests, opts)
+	if len(groups) != 2 {
+		t.Fatalf("packTestsByDuration() produced %d groups, want 2: %v", len(groups), groups)
+	}
+	if len(groups[0]) != 2 || groups[0][0].Name != "slow-a" || groups[0][1].Name != "slow-b" {
+		t.Errorf("first group = %v, want [slow-a slow-b]", groups[0])
+	}
+	if len(groups[1]) != 1 || groups[1][0].Name != "tiny" {
+		t.Errorf("second group = %v, want [tiny]", groups[1])
+	}
+}
+
+func TestExpectedDurationSecsFallsBackToDefault(t *testing.T) {
+	opts := &ShardOptions{DefaultTestDurationSecs: 42}
+	if got := expectedDurationSecs("unknown-test", opts); got != 42 {
+		t.Errorf("expectedDurationSecs() = %v, want 42", got)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package serial provides a small framing layer over a raw serial
+// connection, so that a test's own output can be told apart from whatever
+// else happens to be sharing the same UART (kernel logs, boot banners,
+// driver chatter).
+package serial
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Nonce identifies a single framed invocation, so that a stale retry's
+// output can never be mistaken for the current one's.
+type Nonce [16]byte
+
+// NewNonce returns a fresh, random Nonce.
+func NewNonce() (Nonce, error) {
+	var n Nonce
+	if _, err := rand.Read(n[:]); err != nil {
+		return Nonce{}, fmt.Errorf("generating frame nonce: %w", err)
+	}
+	return n, nil
+}
+
+func (n Nonce) String() string { return hex.EncodeToString(n[:]) }
+
+const (
+	startMarkerPrefix = "==FRAME-START:"
+	endMarkerPrefix   = "==FRAME-END:"
+	markerSuffix      = "==\n"
+
+	// maxUnresolvedBuffer bounds how much of the stream FrameDemux will hold
+	// onto while looking for a complete frame, so a connection that never
+	// sends a valid frame (or sends a corrupt length) can't grow this
+	// buffer without bound.
+	maxUnresolvedBuffer = 1 << 20
+)
+
+// WriteFrame writes payload to w as a single sentinel-delimited record: a
+// start marker carrying nonce and the payload's length, the payload itself,
+// and an end marker carrying nonce again plus a CRC32 of the payload.
+func WriteFrame(w io.Writer, nonce Nonce, payload []byte) error {
+	if _, err := fmt.Fprintf(w, "%s%s:%d%s", startMarkerPrefix, nonce, len(payload), markerSuffix); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	crc := crc32.ChecksumIEEE(payload)
+	_, err := fmt.Fprintf(w, "%s%s:%08x%s", endMarkerPrefix, nonce, crc, markerSuffix)
+	return err
+}
+
+// Frame is a single payload recovered by FrameDemux, along with the nonce it
+// was sent under.
+type Frame struct {
+	Nonce   Nonce
+	Payload []byte
+}
+
+// FrameDemux reads a serial stream containing sentinel-framed records
+// interleaved with unframed bytes. The unframed bytes are assumed to be
+// kernel-log noise or other unsolicited UART output; they're forwarded to
+// Unframed (e.g. a testrunner.KlogDemux) rather than dropped.
+type FrameDemux struct {
+	Reader   io.Reader
+	Unframed io.Writer
+
+	buf bytes.Buffer
+}
+
+// NewFrameDemux returns a FrameDemux reading from r. Bytes not part of any
+// frame are written to unframed, which may be nil to discard them.
+func NewFrameDemux(r io.Reader, unframed io.Writer) *FrameDemux {
+	return &FrameDemux{Reader: r, Unframed: unframed}
+}
+
+// Next blocks until a complete, checksum-valid frame has been read,
+// forwarding any intervening unframed bytes to d.Unframed as it goes. It
+// returns io.EOF once the underlying reader is exhausted and no complete
+// frame is left in the buffer; whatever is still buffered then, including
+// an incomplete frame, is forwarded to d.Unframed first.
+func (d *FrameDemux) Next() (Frame, error) {
+	for {
+		if frame, ok, err := d.tryParse(); err != nil || ok {
+			return frame, err
+		}
+		if d.buf.Len() > maxUnresolvedBuffer {
+			d.flushUnframed(d.buf.Len() - len(startMarkerPrefix))
+		}
+		chunk := make([]byte, 4096)
+		n, err := d.Reader.Read(chunk)
+		if n > 0 {
+			d.buf.Write(chunk[:n])
+		}
+		if err != nil {
+			if n > 0 {
+				// The last read may carry a complete frame along with err.
+				if frame, ok, perr := d.tryParse(); perr != nil || ok {
+					return frame, perr
+				}
+			}
+			if err == io.EOF && d.buf.Len() > 0 {
+				d.flushUnframed(d.buf.Len())
+			}
+			return Frame{}, err
+		}
+	}
+}
+
+// flushUnframed writes the first n bytes of d.buf to d.Unframed (if set) and
+// discards them from the buffer.
+func (d *FrameDemux) flushUnframed(n int) {
+	if n <= 0 {
+		return
+	}
+	if n > d.buf.Len() {
+		n = d.buf.Len()
+	}
+	b := d.buf.Next(n)
+	if d.Unframed != nil {
+		d.Unframed.Write(b)
+	}
+}
+
+// tryParse attempts to extract one complete frame from d.buf without
+// blocking. ok is false if more bytes are needed before progress can be
+// made.
+func (d *FrameDemux) tryParse() (frame Frame, ok bool, err error) {
+	raw := d.buf.Bytes()
+	startIdx := bytes.Index(raw, []byte(startMarkerPrefix))
+	if startIdx < 0 {
+		// No start marker yet. Keep enough of the tail that a marker split
+		// across two reads isn't missed, and treat the rest as unframed.
+		if keep := len(startMarkerPrefix) - 1; d.buf.Len() > keep {
+			d.flushUnframed(d.buf.Len() - keep)
+		}
+		return Frame{}, false, nil
+	}
+	if startIdx > 0 {
+		d.flushUnframed(startIdx)
+		raw = d.buf.Bytes()
+	}
+
+	headerEnd := bytes.Index(raw, []byte(markerSuffix))
+	if headerEnd < 0 {
+		return Frame{}, false, nil
+	}
+	header := string(raw[len(startMarkerPrefix):headerEnd])
+	nonceHex, lengthStr, hasSep := strings.Cut(header, ":")
+	length, lenErr := strconv.Atoi(lengthStr)
+	nonceBytes, decErr := hex.DecodeString(nonceHex)
+	if !hasSep || lenErr != nil || length < 0 || decErr != nil || len(nonceBytes) != len(Nonce{}) {
+		// Not a parseable header; treat the marker byte itself as noise
+		// and keep scanning for the next one.
+		d.flushUnframed(1)
+		return Frame{}, false, nil
+	}
+	var nonce Nonce
+	copy(nonce[:], nonceBytes)
+
+	payloadStart := headerEnd + len(markerSuffix)
+	if len(raw) < payloadStart+length {
+		return Frame{}, false, nil
+	}
+	payload := make([]byte, length)
+	copy(payload, raw[payloadStart:payloadStart+length])
+
+	endMarker := fmt.Sprintf("%s%s:", endMarkerPrefix, nonce)
+	endIdx := bytes.Index(raw[payloadStart+length:], []byte(endMarker))
+	if endIdx < 0 {
+		if len(raw)-payloadStart-length > maxUnresolvedBuffer {
+			// The expected end marker never showed up; give up on this
+			// frame and resync on the next start marker instead.
+			d.flushUnframed(payloadStart + length)
+			return Frame{}, false, nil
+		}
+		return Frame{}, false, nil
+	}
+	endHeaderStart := payloadStart + length + endIdx
+	endHeaderEnd := bytes.Index(raw[endHeaderStart:], []byte(markerSuffix))
+	if endHeaderEnd < 0 {
+		return Frame{}, false, nil
+	}
+	crcHex := string(raw[endHeaderStart+len(endMarker) : endHeaderStart+endHeaderEnd])
+	var crc uint32
+	if _, scanErr := fmt.Sscanf(crcHex, "%08x", &crc); scanErr != nil {
+		d.flushUnframed(1)
+		return Frame{}, false, nil
+	}
+
+	totalLen := endHeaderStart + endHeaderEnd + len(markerSuffix)
+	d.buf.Next(totalLen)
+
+	if crc32.ChecksumIEEE(payload) != crc {
+		return Frame{}, false, fmt.Errorf("serial: frame %s failed CRC check", nonce)
+	}
+	return Frame{Nonce: nonce, Payload: payload}, true, nil
+}
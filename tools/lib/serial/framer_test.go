@@ -0,0 +1,82 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package serial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriteFrameThenParse(t *testing.T) {
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	wire.WriteString("some kernel noise before the frame\n")
+	if err := WriteFrame(&wire, nonce, []byte("hello, frame")); err != nil {
+		t.Fatal(err)
+	}
+	wire.WriteString("some kernel noise after the frame\n")
+
+	var unframed bytes.Buffer
+	demux := NewFrameDemux(&wire, &unframed)
+	frame, err := demux.Next()
+	if err != nil {
+		t.Fatalf("Next() failed: %s", err)
+	}
+	if frame.Nonce != nonce {
+		t.Errorf("Nonce = %s, want %s", frame.Nonce, nonce)
+	}
+	if string(frame.Payload) != "hello, frame" {
+		t.Errorf("Payload = %q, want %q", frame.Payload, "hello, frame")
+	}
+	if !bytes.Contains(unframed.Bytes(), []byte("some kernel noise before the frame")) {
+		t.Errorf("unframed bytes missing leading noise: %q", unframed.String())
+	}
+
+	if _, err := demux.Next(); err != io.EOF {
+		t.Errorf("Next() after the only frame = %v, want io.EOF", err)
+	}
+	if !bytes.Contains(unframed.Bytes(), []byte("some kernel noise after the frame")) {
+		t.Errorf("unframed bytes missing trailing noise: %q", unframed.String())
+	}
+}
+
+func TestFrameDemuxDetectsCorruption(t *testing.T) {
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	if err := WriteFrame(&wire, nonce, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := bytes.Replace(wire.Bytes(), []byte("hello"), []byte("HELLO"), 1)
+
+	demux := NewFrameDemux(bytes.NewReader(corrupted), nil)
+	if _, err := demux.Next(); err == nil {
+		t.Error("expected a CRC failure, got nil error")
+	}
+}
+
+func TestMultipleFramesKeyedByNonce(t *testing.T) {
+	n1, _ := NewNonce()
+	n2, _ := NewNonce()
+	var wire bytes.Buffer
+	WriteFrame(&wire, n1, []byte("first"))
+	WriteFrame(&wire, n2, []byte("second"))
+
+	demux := NewFrameDemux(&wire, nil)
+	f1, err := demux.Next()
+	if err != nil || string(f1.Payload) != "first" || f1.Nonce != n1 {
+		t.Errorf("first frame = %+v, err = %v", f1, err)
+	}
+	f2, err := demux.Next()
+	if err != nil || string(f2.Payload) != "second" || f2.Nonce != n2 {
+		t.Errorf("second frame = %+v, err = %v", f2, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ffx "go.fuchsia.dev/fuchsia/tools/orchestrate/ffx"
+)
+
+const (
+	// debugDataDir and debugDataDirEarlyBoot are the on-target directories
+	// test_manager mounts a v2 test's coverage/profile output, and its
+	// early-boot (kernel) coverage output, under.
+	debugDataDir          = "/tmp/test_manager:0/data/debug"
+	debugDataDirEarlyBoot = "/tmp/test_manager:0/data/kernel_debug"
+)
+
+// dataSinkKind labels what kind of artifact a dataSink refers to, so
+// consumers like covargs and resultdb can tell a coverage profile apart
+// from a plain diagnostic snapshot without inspecting the path.
+type dataSinkKind string
+
+const (
+	dataSinkSnapshot dataSinkKind = "snapshot"
+	dataSinkInspect  dataSinkKind = "inspect"
+	dataSinkProfile  dataSinkKind = "profile"
+	dataSinkArtifact dataSinkKind = "artifact"
+)
+
+// dataSink records one artifact an ArtifactCollector pulled off the target
+// (or matched on the host), for inclusion in summary.json's data_sinks so
+// covargs and resultdb ingest it without extra glue.
+type dataSink struct {
+	Kind dataSinkKind `json:"kind"`
+	Path string       `json:"path"`
+}
+
+// ArtifactCollector gathers post-run diagnostic and profile data into
+// outDir after a test command returns, independent of whether the test
+// itself passed. Each kind of artifact is collected best-effort: a failure
+// collecting one (e.g. no debug-data directory on a host-only build)
+// doesn't prevent the others from being attempted.
+type ArtifactCollector struct {
+	outDir string
+}
+
+// newArtifactCollector creates an ArtifactCollector that writes into outDir.
+func newArtifactCollector(outDir string) *ArtifactCollector {
+	return &ArtifactCollector{outDir: outDir}
+}
+
+// Collect pulls a target snapshot, inspect data, coverage/profile data, and
+// any user-declared artifact globs, returning a dataSink for each one it
+// successfully collected.
+func (a *ArtifactCollector) Collect(ctx context.Context, f *ffx.Ffx, in *RunInput) []dataSink {
+	var sinks []dataSink
+	if sink, ok := a.collectSnapshot(ctx, f); ok {
+		sinks = append(sinks, sink)
+	}
+	if sink, ok := a.collectInspect(ctx, f); ok {
+		sinks = append(sinks, sink)
+	}
+	if sink, ok := a.collectProfileDir(ctx, f, debugDataDir, "debug"); ok {
+		sinks = append(sinks, sink)
+	}
+	if sink, ok := a.collectProfileDir(ctx, f, debugDataDirEarlyBoot, "kernel_debug"); ok {
+		sinks = append(sinks, sink)
+	}
+	sinks = append(sinks, a.collectArtifactGlobs(in)...)
+	return sinks
+}
+
+// collectSnapshot pulls an `ffx target snapshot` zip into outDir, replacing
+// the bare `target snapshot -d` call orchestrate used to make directly from
+// test().
+func (a *ArtifactCollector) collectSnapshot(ctx context.Context, f *ffx.Ffx) (dataSink, bool) {
+	if out, err := f.RunCmdSync("target", "snapshot", "-d", a.outDir); err != nil {
+		fmt.Printf("ArtifactCollector: target snapshot: %v out: %s\n", err, out)
+		return dataSink{}, false
+	}
+	return dataSink{Kind: dataSinkSnapshot, Path: filepath.Join(a.outDir, "snapshot.zip")}, true
+}
+
+// collectInspect dumps `ffx inspect show --machine json` to inspect.json in
+// outDir.
+func (a *ArtifactCollector) collectInspect(ctx context.Context, f *ffx.Ffx) (dataSink, bool) {
+	out, err := f.RunCmdSync("inspect", "show", "--machine", "json")
+	if err != nil {
+		fmt.Printf("ArtifactCollector: ffx inspect show: %v\n", err)
+		return dataSink{}, false
+	}
+	inspectPath := filepath.Join(a.outDir, "inspect.json")
+	if err := os.WriteFile(inspectPath, []byte(out), 0644); err != nil {
+		fmt.Printf("ArtifactCollector: os.WriteFile(%q): %v\n", inspectPath, err)
+		return dataSink{}, false
+	}
+	return dataSink{Kind: dataSinkInspect, Path: inspectPath}, true
+}
+
+// collectProfileDir copies remoteDir (one of the test_manager debug-data
+// directories) off the target into a label subdirectory of outDir using
+// `ffx component storage copy`.
+func (a *ArtifactCollector) collectProfileDir(ctx context.Context, f *ffx.Ffx, remoteDir, label string) (dataSink, bool) {
+	destDir := filepath.Join(a.outDir, label)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		fmt.Printf("ArtifactCollector: os.MkdirAll(%q): %v\n", destDir, err)
+		return dataSink{}, false
+	}
+	if out, err := f.RunCmdSync("component", "storage", "copy", remoteDir, destDir); err != nil {
+		fmt.Printf("ArtifactCollector: ffx component storage copy %s: %v out: %s\n", remoteDir, err, out)
+		return dataSink{}, false
+	}
+	return dataSink{Kind: dataSinkProfile, Path: destDir}, true
+}
+
+// collectArtifactGlobs matches in.Target().ArtifactGlobs on the host
+// running orchestrate, for artifacts the test command itself writes
+// alongside its other outputs rather than leaving on the target.
+func (a *ArtifactCollector) collectArtifactGlobs(in *RunInput) []dataSink {
+	if !in.IsTarget() {
+		return nil
+	}
+	var sinks []dataSink
+	for _, pattern := range in.Target().ArtifactGlobs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			fmt.Printf("ArtifactCollector: filepath.Glob(%q): %v\n", pattern, err)
+			continue
+		}
+		for _, match := range matches {
+			sinks = append(sinks, dataSink{Kind: dataSinkArtifact, Path: match})
+		}
+	}
+	return sinks
+}
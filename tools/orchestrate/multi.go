@@ -0,0 +1,159 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// testCmdTemplateData is substituted into a shard's test command via
+// text/template before it's handed to that shard's TestOrchestrator. This
+// lets the same test binary invocation be dispatched across every shard in
+// a MultiTestOrchestrator run, each pointed at its own target.
+type testCmdTemplateData struct {
+	// TargetName is the ffx target name assigned to this shard's device or
+	// emulator instance.
+	TargetName string
+	// SSHAddress is the shard's device network address, when known ahead of
+	// time (hardware shards configured with a DeviceConfig).
+	SSHAddress string
+}
+
+// shardResult carries the per-shard outcome back to the caller of Run so
+// that a partial failure in one shard doesn't obscure which shard it came
+// from.
+type shardResult struct {
+	index int
+	err   error
+}
+
+// MultiTestOrchestrator fans a single orchestrate invocation out over
+// multiple devices or emulators, running one TestOrchestrator per shard in
+// parallel. This mirrors the way botanist's RunCommand fans `targets.Target`
+// instances out across a shard group, and lets CI reuse a single orchestrate
+// process for a whole shard group instead of spawning N sibling processes
+// that all compete for the same ffx daemon.
+type MultiTestOrchestrator struct {
+	// deviceConfigs holds one entry per shard. A nil entry means the shard
+	// runs against an emulator rather than a specific hardware device.
+	deviceConfigs []*DeviceConfig
+}
+
+// NewMultiTestOrchestrator creates a MultiTestOrchestrator with one shard per
+// entry in deviceConfigs. Pass a nil entry for shards that should run
+// against an on-demand emulator instead of a fixed hardware device.
+func NewMultiTestOrchestrator(deviceConfigs []*DeviceConfig) *MultiTestOrchestrator {
+	return &MultiTestOrchestrator{deviceConfigs: deviceConfigs}
+}
+
+// Run executes in, testCmdTemplate once per shard, each in its own
+// goroutine with its own ffx isolate dir, repository name, and
+// TEST_UNDECLARED_OUTPUTS_DIR subdirectory. testCmdTemplate elements may
+// reference {{.TargetName}} and {{.SSHAddress}}, which are resolved
+// per-shard before the command is passed to that shard's Run.
+func (m *MultiTestOrchestrator) Run(ctx context.Context, in *RunInput, testCmdTemplate []string) error {
+	if len(m.deviceConfigs) == 0 {
+		return fmt.Errorf("MultiTestOrchestrator: no shards configured")
+	}
+
+	baseOutDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+
+	// Deliberately use a plain errgroup.Group rather than
+	// errgroup.WithContext: the latter cancels every other shard's context
+	// as soon as one shard's goroutine returns an error, which would hide
+	// whether the other shards' tests themselves passed. Each shard still
+	// observes the caller's ctx directly for cancellation/deadlines.
+	var eg errgroup.Group
+	results := make([]shardResult, len(m.deviceConfigs))
+	for i, dc := range m.deviceConfigs {
+		i, dc := i, dc
+		eg.Go(func() error {
+			err := m.runShard(ctx, i, dc, in, testCmdTemplate, baseOutDir)
+			results[i] = shardResult{index: i, err: err}
+			return err
+		})
+	}
+
+	// Wait for every shard rather than bailing out on the first error, so
+	// that a fastboot hiccup on shard 2 doesn't hide a real test failure on
+	// shard 0; errgroup.Group already collects only the first error, so
+	// gather the rest here for a fuller report.
+	firstErr := eg.Wait()
+	if firstErr == nil {
+		return nil
+	}
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("shard-%d: %v", r.index, r.err))
+		}
+	}
+	return fmt.Errorf("%d/%d shards failed: %s", len(failed), len(m.deviceConfigs), strings.Join(failed, "; "))
+}
+
+// runShard runs a single shard's TestOrchestrator with shard-local isolation:
+// its own ffx isolate dir, its own repository name, and its own subdirectory
+// under TEST_UNDECLARED_OUTPUTS_DIR.
+func (m *MultiTestOrchestrator) runShard(ctx context.Context, index int, dc *DeviceConfig, in *RunInput, testCmdTemplate []string, baseOutDir string) error {
+	shardOutDir := filepath.Join(baseOutDir, fmt.Sprintf("shard-%d", index))
+	if err := os.MkdirAll(shardOutDir, 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll(%q): %w", shardOutDir, err)
+	}
+
+	isolateDir := filepath.Join(shardOutDir, "ffx-isolate")
+	if err := os.MkdirAll(isolateDir, 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll(%q): %w", isolateDir, err)
+	}
+	if err := os.Setenv("FFX_ISOLATE_DIR", isolateDir); err != nil {
+		return fmt.Errorf("os.Setenv(FFX_ISOLATE_DIR): %w", err)
+	}
+	if err := os.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", shardOutDir); err != nil {
+		return fmt.Errorf("os.Setenv(TEST_UNDECLARED_OUTPUTS_DIR): %w", err)
+	}
+
+	orch := NewTestOrchestrator(dc)
+	orch.repoName = fmt.Sprintf("repo-shard-%d-%d", index, os.Getpid())
+
+	data := testCmdTemplateData{
+		TargetName: fmt.Sprintf("fuchsia-emulator-shard-%d-%d", index, os.Getpid()),
+	}
+	if dc != nil {
+		data.SSHAddress = dc.Network.IPv4
+	}
+	testCmd, err := renderTestCmd(testCmdTemplate, data)
+	if err != nil {
+		return fmt.Errorf("renderTestCmd: %w", err)
+	}
+
+	if err := orch.RunWithContext(ctx, in, testCmd); err != nil {
+		return fmt.Errorf("shard-%d Run: %w", index, err)
+	}
+	return nil
+}
+
+// renderTestCmd expands {{.TargetName}} / {{.SSHAddress}} references in each
+// element of testCmdTemplate against data.
+func renderTestCmd(testCmdTemplate []string, data testCmdTemplateData) ([]string, error) {
+	rendered := make([]string, len(testCmdTemplate))
+	for i, arg := range testCmdTemplate {
+		tmpl, err := template.New("arg").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("template.Parse(%q): %w", arg, err)
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("template.Execute(%q): %w", arg, err)
+		}
+		rendered[i] = buf.String()
+	}
+	return rendered, nil
+}
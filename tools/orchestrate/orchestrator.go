@@ -5,6 +5,8 @@
 package orchestrate
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,30 +15,125 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	ffx "go.fuchsia.dev/fuchsia/tools/orchestrate/ffx"
 	utils "go.fuchsia.dev/fuchsia/tools/orchestrate/utils"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+	"go.fuchsia.dev/fuchsia/tools/testing/testparser"
 )
 
 // TestOrchestrator uses FFX to run Fuchsia component tests.
 type TestOrchestrator struct {
-	ffx           *ffx.Ffx
-	deviceConfig  *DeviceConfig
-	ffxLogProc    *os.Process
-	targetLogFile *os.File
-	repoName      string
+	ffx            *ffx.Ffx
+	deviceConfig   *DeviceConfig
+	ffxLogProc     *os.Process
+	targetLogFile  *os.File
+	serialPort     io.ReadCloser
+	serialLogFile  *os.File
+	serialDone     chan struct{}
+	serialPanicMu  sync.Mutex
+	serialPanicked bool
+	repoName       string
+	summaryFormat  SummaryFormat
+	packageServer  PackageServer
+	retryPolicy    *RetryPolicy
+	// provisioningAttempts records every attempt at a retried provisioning
+	// step (see withRetry in retry.go), for inclusion in the run's summary.
+	provisioningAttempts []provisioningAttempt
+	// dataSinks records every artifact an ArtifactCollector pulled after the
+	// test command returned (see artifacts.go), for inclusion in the run's
+	// summary.
+	dataSinks []dataSink
+}
+
+// SetRetryPolicy configures how flashDevice, startEmulator, reachDevice, and
+// the package server start are retried on classified, transient failures.
+// The zero value (i.e. never calling this) behaves like DefaultRetryPolicy.
+func (r *TestOrchestrator) SetRetryPolicy(policy *RetryPolicy) {
+	r.retryPolicy = policy
+}
+
+// SummaryFormat selects which summary.json schema writeTestSummary emits.
+type SummaryFormat string
+
+const (
+	// SummaryFormatLegacy writes the original `{"success": bool}` file.
+	// Kept for callers that haven't migrated to the richer schema yet.
+	SummaryFormatLegacy SummaryFormat = "legacy"
+	// SummaryFormatRuntests writes a runtests.TestSummary, the same schema
+	// botanist emits, so resultdb uploaders and covargs can consume
+	// orchestrate output the same way they consume botanist's.
+	SummaryFormatRuntests SummaryFormat = "runtests"
+)
+
+// SetSummaryFormat configures which summary.json schema Run emits. The zero
+// value (i.e. never calling this) behaves like SummaryFormatRuntests.
+func (r *TestOrchestrator) SetSummaryFormat(format SummaryFormat) error {
+	switch format {
+	case SummaryFormatLegacy, SummaryFormatRuntests:
+		r.summaryFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unknown summary format %q, want %q or %q", format, SummaryFormatLegacy, SummaryFormatRuntests)
+	}
 }
 
 var (
-	ffxDaemonLog  = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "ffx_daemon.log")
-	ffxConfigDump = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "ffx_config.txt")
-	subrunnerLog  = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "subrunner.log")
-	targetLog     = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.log")
-	targetSymLog  = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.symbolized.log")
-	summaryPath   = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "summary.json")
+	ffxDaemonLog       = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "ffx_daemon.log")
+	ffxConfigDump      = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "ffx_config.txt")
+	subrunnerLog       = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "subrunner.log")
+	targetLog          = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.log")
+	targetSymLog       = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.symbolized.log")
+	targetSerialLog    = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.serial.log")
+	targetSerialSymLog = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "target.serial.symbolized.log")
+	summaryPath        = filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), "summary.json")
 )
 
+// serialPanicMarkers are substrings that, when seen on the target's serial
+// console, indicate the kernel has panicked or a process has crashed badly
+// enough that ffx log (which depends on a live network stack) will likely
+// never see it. This mirrors botanist's serial-first crash detection.
+var serialPanicMarkers = []string{
+	"KERNEL PANIC",
+	"ZIRCON KERNEL PANIC",
+	"{{{reset}}}",
+}
+
+// runCmdContext runs cmd, killing it if ctx is canceled or its deadline
+// expires before cmd finishes on its own. This is used for the handful of
+// *exec.Cmd instances built by the ffx package (via r.ffx.Cmd), which - since
+// they come from outside this package - can't be constructed with
+// exec.CommandContext directly.
+func runCmdContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := cmd.Process.Kill(); err != nil {
+			fmt.Printf("runCmdContext Kill: %v\n", err)
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// waitForLogFlush pauses for up to d to let subprocess log buffers flush
+// before the next step reads them, returning early if ctx is canceled so a
+// SIGTERM doesn't have to wait out the full pause.
+func waitForLogFlush(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
 // NewTestOrchestrator creates a TestOrchestrator with default dependencies.
 func NewTestOrchestrator(deviceConfig *DeviceConfig) *TestOrchestrator {
 	return &TestOrchestrator{
@@ -45,7 +142,7 @@ func NewTestOrchestrator(deviceConfig *DeviceConfig) *TestOrchestrator {
 	}
 }
 
-func (r *TestOrchestrator) instantiateFfx(in *RunInput) error {
+func (r *TestOrchestrator) instantiateFfx(ctx context.Context, in *RunInput) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("os.Getwd: %w", err)
@@ -62,17 +159,27 @@ func (r *TestOrchestrator) instantiateFfx(in *RunInput) error {
 	return nil
 }
 
-// Run executes tests.
+// Run executes tests, without any cancellation or deadline beyond the
+// process's own lifetime. See RunWithContext.
 func (r *TestOrchestrator) Run(in *RunInput, testCmd []string) error {
+	return r.RunWithContext(context.Background(), in, testCmd)
+}
+
+// RunWithContext executes tests, honoring ctx's cancellation and deadline
+// throughout every step: a canceled ctx (e.g. from a caller's SIGTERM
+// handler) stops in-flight ffx/test subprocesses and still runs cleanup
+// (stop emulator, stop daemon, stop package server, stop log capture) in
+// reverse-defer order so no daemon or repo is leaked across CI reruns.
+func (r *TestOrchestrator) RunWithContext(ctx context.Context, in *RunInput, testCmd []string) error {
 	if len(in.Cipd()) > 0 {
 		fmt.Println("=== orchestrate - Downloading CIPD packages (0/6) ===")
-		if err := r.cipdEnsure(in); err != nil {
+		if err := r.cipdEnsure(ctx, in); err != nil {
 			return fmt.Errorf("cipdEnsure: %w", err)
 		}
 	}
 	if in.IsTarget() {
 		fmt.Println("=== orchestrate - Setting up ffx (1/6) ===")
-		if err := r.instantiateFfx(in); err != nil {
+		if err := r.instantiateFfx(ctx, in); err != nil {
 			return fmt.Errorf("instantiateFfx: %w", err)
 		}
 		defer func() {
@@ -80,15 +187,15 @@ func (r *TestOrchestrator) Run(in *RunInput, testCmd []string) error {
 				fmt.Printf("ffx.Close: %v\n", err)
 			}
 		}()
-		if err := r.setupFfx(); err != nil {
+		if err := r.setupFfx(ctx); err != nil {
 			return fmt.Errorf("setupFfx: %w", err)
 		}
-		defer r.stopDaemon()
+		defer r.stopDaemon(ctx)
 		productDir := ""
 		if in.Target().TransferURL != "" {
 			fmt.Println("=== orchestrate - Downloading Product Bundle (2/6) ===")
 			var err error
-			productDir, err = r.downloadProductBundle(in)
+			productDir, err = r.downloadProductBundle(ctx, in)
 			if err != nil {
 				return fmt.Errorf("downloadProductBundle: %w", err)
 			}
@@ -98,38 +205,42 @@ func (r *TestOrchestrator) Run(in *RunInput, testCmd []string) error {
 		}
 		if in.IsHardware() {
 			fmt.Println("=== orchestrate - Flashing Device (3/6) ===")
-			if err := r.flashDevice(productDir); err != nil {
+			if err := r.withRetry("flashDevice", nil, func() error { return r.flashDevice(ctx, productDir) }); err != nil {
 				return fmt.Errorf("flashDevice: %w", err)
 			}
 		} else if in.IsEmulator() {
 			fmt.Println("=== orchestrate - Starting Emulator (3/6) ===")
-			if err := r.startEmulator(productDir); err != nil {
+			teardown := func() { r.stopEmulator(ctx) }
+			if err := r.withRetry("startEmulator", teardown, func() error { return r.startEmulator(ctx, productDir) }); err != nil {
 				return fmt.Errorf("startEmulator: %w", err)
 			}
-			defer r.stopEmulator()
+			defer r.stopEmulator(ctx)
 		}
 		fmt.Println("=== orchestrate - Serving Packages (4/6) ===")
-		if err := r.servePackages(in, productDir); err != nil {
+		teardown := func() { r.stopPackageServer(ctx) }
+		if err := r.withRetry("servePackages", teardown, func() error { return r.servePackages(ctx, in, productDir) }); err != nil {
 			return fmt.Errorf("servePackages: %w", err)
 		}
-		defer r.stopPackageServer()
+		defer r.stopPackageServer(ctx)
 		fmt.Println("=== orchestrate - Reach Device (5/6) ===")
-		if err := r.reachDevice(); err != nil {
+		reachTeardown := func() { r.stopFfxLog(ctx); r.stopSerialLog(ctx) }
+		if err := r.withRetry("reachDevice", reachTeardown, func() error { return r.reachDevice(ctx) }); err != nil {
 			return fmt.Errorf("reachDevice: %w", err)
 		}
-		defer r.stopFfxLog()
+		defer r.stopFfxLog(ctx)
+		defer r.stopSerialLog(ctx)
 	} else {
 		fmt.Println("=== orchestrate - Skipped Target Provisioning (1-5/6) ===")
 	}
 	fmt.Println("=== orchestrate - Test (6/6) ===")
-	if err := r.test(testCmd, in); err != nil {
+	if err := r.test(ctx, testCmd, in); err != nil {
 		return fmt.Errorf("test: %w", err)
 	}
 	return nil
 }
 
 /* Step 0 - Downloading CIPD packages. */
-func (r *TestOrchestrator) cipdEnsure(in *RunInput) error {
+func (r *TestOrchestrator) cipdEnsure(ctx context.Context, in *RunInput) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("os.Getwd: %w", err)
@@ -148,7 +259,7 @@ func (r *TestOrchestrator) cipdEnsure(in *RunInput) error {
 			":gce",
 		}
 		fmt.Printf("Running command: %+v stdin: %s", cipdCmd, ensureLine)
-		cmd := exec.Command(cipdCmd[0], cipdCmd[1:]...)
+		cmd := exec.CommandContext(ctx, cipdCmd[0], cipdCmd[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Stdin = strings.NewReader(ensureLine)
@@ -161,7 +272,7 @@ func (r *TestOrchestrator) cipdEnsure(in *RunInput) error {
 }
 
 /* Step 1 - Setting up ffx. */
-func (r *TestOrchestrator) setupFfx() error {
+func (r *TestOrchestrator) setupFfx(ctx context.Context) error {
 	cmds := [][]string{
 		{"config", "set", "log.level", "Debug"},
 		{"config", "set", "test.experimental_json_input", "true"},
@@ -192,19 +303,19 @@ func (r *TestOrchestrator) setupFfx() error {
 		}
 	}
 
-	if err := r.dumpFfxConfig(); err != nil {
+	if err := r.dumpFfxConfig(ctx); err != nil {
 		return fmt.Errorf("dumpFfxConfig: %w", err)
 	}
-	if err := r.daemonStart(); err != nil {
+	if err := r.daemonStart(ctx); err != nil {
 		return fmt.Errorf("ffx daemon start: %w", err)
 	}
-	if err := r.ffx.WaitForDaemon(context.Background()); err != nil {
+	if err := r.ffx.WaitForDaemon(ctx); err != nil {
 		return fmt.Errorf("ffx daemon wait: %w", err)
 	}
 	return nil
 }
 
-func (r *TestOrchestrator) dumpFfxConfig() error {
+func (r *TestOrchestrator) dumpFfxConfig(ctx context.Context) error {
 	logFile, err := os.Create(ffxConfigDump)
 	if err != nil {
 		return fmt.Errorf("os.Create: %w", err)
@@ -220,10 +331,13 @@ func (r *TestOrchestrator) dumpFfxConfig() error {
 	}
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
-	return cmd.Run()
+	return runCmdContext(ctx, cmd)
 }
 
-func (r *TestOrchestrator) daemonStart() error {
+func (r *TestOrchestrator) daemonStart(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	logFile, err := os.Create(ffxDaemonLog)
 	if err != nil {
 		return fmt.Errorf("os.Create: %w", err)
@@ -238,7 +352,7 @@ func (r *TestOrchestrator) daemonStart() error {
 }
 
 /* Step 2 - Downloading product bundle. */
-func (r *TestOrchestrator) downloadProductBundle(in *RunInput) (string, error) {
+func (r *TestOrchestrator) downloadProductBundle(ctx context.Context, in *RunInput) (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("os.Getwd: %w", err)
@@ -261,14 +375,20 @@ func (r *TestOrchestrator) downloadProductBundle(in *RunInput) (string, error) {
 }
 
 /* Step 3 - Flashing device OR Starting emulator. */
-func (r *TestOrchestrator) flashDevice(productDir string) error {
+func (r *TestOrchestrator) flashDevice(ctx context.Context, productDir string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if err := r.ffx.Flash(r.deviceConfig.FastbootSerial, productDir, ""); err != nil {
 		return fmt.Errorf("ffx flash: %w", err)
 	}
 	return nil
 }
 
-func (r *TestOrchestrator) startEmulator(productDir string) error {
+func (r *TestOrchestrator) startEmulator(ctx context.Context, productDir string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	emu_name := fmt.Sprintf("fuchsia-emulator-%d", os.Getpid())
 
 	if _, err := r.ffx.RunCmdSync(
@@ -307,16 +427,14 @@ Serving packages requires:
 * Package servers are managed by name. or if using product bundles, the product bundle directory.
 
 */
-func (r *TestOrchestrator) servePackages(in *RunInput, productDir string) error {
-	// It is important to always publish, even if there is nothing in
-	// in.Target().PackageArchives, because it will force the package metadata
-	// to be refreshed (see b/309847820).
-	publishArgs := []string{"repository", "publish", productDir}
-	for _, far := range in.Target().PackageArchives {
-		publishArgs = append(publishArgs, "--package-archive", far)
-	}
-	if out, err := r.ffx.RunCmdSync(publishArgs...); err != nil {
-		return fmt.Errorf("ffx %v: %w out: %v", publishArgs, err, out)
+func (r *TestOrchestrator) servePackages(ctx context.Context, in *RunInput, productDir string) error {
+	r.packageServer = newPackageServer(in.Target().PackageServerConfig, productDir)
+
+	// It is important to always publish, even if there is nothing to publish,
+	// because it will force the package metadata to be refreshed (see
+	// b/309847820).
+	if err := r.packageServer.Publish(ctx, r.ffx, in.Target().PackageArchives); err != nil {
+		return fmt.Errorf("Publish: %w", err)
 	}
 	for _, buildID := range in.Target().BuildIds {
 		if out, err := r.ffx.RunCmdSync("debug", "symbol-index", "add", buildID); err != nil {
@@ -324,8 +442,8 @@ func (r *TestOrchestrator) servePackages(in *RunInput, productDir string) error
 		}
 	}
 
-	if err := r.serveAndWait(productDir); err != nil {
-		return fmt.Errorf("serveAndWait: %w", err)
+	if err := r.packageServer.Start(ctx, r.ffx, r.repoName); err != nil {
+		return fmt.Errorf("Start: %w", err)
 	}
 
 	if _, err := r.ffx.RunCmdSync("repository", "server", "list"); err != nil {
@@ -334,41 +452,8 @@ func (r *TestOrchestrator) servePackages(in *RunInput, productDir string) error
 	return nil
 }
 
-func (r *TestOrchestrator) serveAndWait(productDir string) error {
-	port := os.Getenv("FUCHSIA_PACKAGE_SERVER_PORT")
-	if port == "" {
-		// Use a dynamic port unless the environment is specific.
-		port = "0"
-	}
-	addr := fmt.Sprintf("[::]:%s", port)
-	args := []string{
-		"repository", "server", "start",
-		"--background", "--no-device",
-		"--address", addr,
-		// TODO(https://fxbug.dev/335008631): Handle publishing to a product-bundle repo
-		// until then use the product bundle as a repo_path.
-		"--repo-path", productDir,
-		"--repository", r.repoName,
-		"--refresh-metadata",
-	}
-	if _, err := r.ffx.RunCmdSync(args...); err != nil {
-		return fmt.Errorf("ffx repository server start: %w", err)
-	}
-
-	// The server start command when using `--background` waits for the server
-	// to actually start before exiting, so this check is a double check.
-	running, err := r.ffx.IsPackageServerRunning(r.repoName)
-	if err != nil {
-		return fmt.Errorf("ffx isPackageServerRunning: %w", err)
-	}
-	if !running {
-		return fmt.Errorf("repository %s is not running", r.repoName)
-	}
-	return nil
-}
-
 /* Step 5 - Reach Device */
-func (r *TestOrchestrator) reachDevice() error {
+func (r *TestOrchestrator) reachDevice(ctx context.Context) error {
 	if r.deviceConfig != nil {
 		addr := r.deviceConfig.Network.IPv4
 		if _, err := r.ffx.RunCmdSync("target", "add", addr, "--nowait"); err != nil {
@@ -386,28 +471,25 @@ func (r *TestOrchestrator) reachDevice() error {
 	if _, err := r.ffx.RunCmdSync("--machine", "json-pretty", "target", "show"); err != nil {
 		return fmt.Errorf("ffx target show: %w", err)
 	}
-	if err := r.dumpFfxLog(); err != nil {
+	if err := r.dumpFfxLog(ctx); err != nil {
 		return fmt.Errorf("dumpFfxLog: %w", err)
 	}
+	if r.deviceConfig != nil && r.deviceConfig.SerialPath != "" {
+		if err := r.startSerialLog(ctx); err != nil {
+			// Serial is a fallback log source, not a hard requirement: ffx
+			// log may still work, so don't fail reachDevice over it.
+			fmt.Printf("startSerialLog: %v\n", err)
+		}
+	}
 
 	// Register the repo server using the aliases configured with the running server.
-	if out, err := r.ffx.RunCmdSync(
-		"target",
-		"repository",
-		"register",
-		"--repository",
-		r.repoName,
-		"--alias",
-		"fuchsia.com",
-		"--alias",
-		"chromium.org",
-	); err != nil {
-		return fmt.Errorf("ffx target repository register: %w out: %s", err, out)
+	if err := r.packageServer.RegisterOnTarget(ctx, r.ffx, r.repoName); err != nil {
+		return fmt.Errorf("RegisterOnTarget: %w", err)
 	}
 	return nil
 }
 
-func (r *TestOrchestrator) dumpFfxLog() error {
+func (r *TestOrchestrator) dumpFfxLog(ctx context.Context) error {
 	logFile, err := os.Create(targetLog)
 	if err != nil {
 		return fmt.Errorf("os.Create: %w", err)
@@ -422,17 +504,92 @@ func (r *TestOrchestrator) dumpFfxLog() error {
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("cmd.Start: %w", err)
 	}
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		if err := cmd.Wait(); err != nil {
 			fmt.Printf("cmd.Wait: %v", err)
 		}
 	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := cmd.Process.Kill(); err != nil {
+				fmt.Printf("ffx log Kill: %v\n", err)
+			}
+		case <-done:
+		}
+	}()
 	r.ffxLogProc = cmd.Process
 	return nil
 }
 
+// startSerialLog opens the target's serial device in parallel with ffx log
+// and tees the byte stream to targetSerialLog, so there's still a log source
+// if networking (and therefore ffx log) dies mid-test. It also scans each
+// line for a kernel-panic marker and records an early failure signal so
+// writeTestSummary can surface it even if the test command itself hangs.
+func (r *TestOrchestrator) startSerialLog(ctx context.Context) error {
+	port, err := os.OpenFile(r.deviceConfig.SerialPath, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile(%q): %w", r.deviceConfig.SerialPath, err)
+	}
+	logFile, err := os.Create(targetSerialLog)
+	if err != nil {
+		port.Close()
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	r.serialPort = port
+	r.serialLogFile = logFile
+	r.serialDone = make(chan struct{})
+
+	go func() {
+		defer close(r.serialDone)
+		scanner := bufio.NewScanner(io.TeeReader(port, logFile))
+		for scanner.Scan() {
+			line := scanner.Text()
+			for _, marker := range serialPanicMarkers {
+				if strings.Contains(line, marker) {
+					r.serialPanicMu.Lock()
+					r.serialPanicked = true
+					r.serialPanicMu.Unlock()
+					break
+				}
+			}
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock the scanner's blocking Read so serialDone closes
+			// promptly instead of leaking the goroutine past cancellation.
+			r.serialPort.Close()
+		case <-r.serialDone:
+		}
+	}()
+	return nil
+}
+
+func (r *TestOrchestrator) stopSerialLog(ctx context.Context) {
+	if r.serialPort == nil {
+		return
+	}
+	if err := r.serialPort.Close(); err != nil {
+		fmt.Printf("serialPort.Close: %v\n", err)
+	}
+	<-r.serialDone
+	if err := r.serialLogFile.Close(); err != nil {
+		fmt.Printf("serialLogFile.Close: %v\n", err)
+	}
+	cleanupCtx, cancel := cleanupContext()
+	defer cancel()
+	if err := r.Symbolize(cleanupCtx, targetSerialLog, targetSerialSymLog); err != nil {
+		fmt.Printf("Symbolize: %v\n", err)
+	}
+}
+
 /* Step 6 - Test */
-func (r *TestOrchestrator) test(testCmd []string, in *RunInput) error {
+func (r *TestOrchestrator) test(ctx context.Context, testCmd []string, in *RunInput) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("os.Getwd: %w", err)
@@ -467,24 +624,28 @@ func (r *TestOrchestrator) test(testCmd []string, in *RunInput) error {
 	}
 
 	// Create cmd AFTER setting the PATH so that it will correctly resolve testCmd[0]
-	cmd := exec.Command(testCmd[0], testCmd[1:]...)
+	cmd := exec.CommandContext(ctx, testCmd[0], testCmd[1:]...)
 	cmd.Env = env
 
-	// Setup pipes to forward subcmd stdout and stderr to logFile and os.Stdout.
-	pipeOut := io.MultiWriter(logFile, os.Stdout)
+	// Setup pipes to forward subcmd stdout and stderr to logFile and
+	// os.Stdout, and to a buffer that's handed to testparser so the
+	// structured summary can populate per-test-case results.
+	var stdoutForParsing bytes.Buffer
+	pipeOut := io.MultiWriter(logFile, os.Stdout, &stdoutForParsing)
 	cmd.Stdout = pipeOut
 	cmd.Stderr = pipeOut
 
 	fmt.Printf("Running test: %+v\n", cmd.Args)
+	startTime := time.Now()
 	testErr := cmd.Run()
-	fmt.Printf("Pausing 10 seconds for log flush...\n")
-	time.Sleep(10 * time.Second)
+	duration := time.Since(startTime)
+	fmt.Printf("Pausing up to 10 seconds for log flush...\n")
+	waitForLogFlush(ctx, 10*time.Second)
 	if in.IsTarget() {
-		if _, err := r.ffx.RunCmdSync("target", "snapshot", "-d", os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")); err != nil {
-			fmt.Printf("target snapshot: %v\n", err)
-		}
+		collector := newArtifactCollector(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"))
+		r.dataSinks = collector.Collect(ctx, r.ffx, in)
 	}
-	if err := r.writeTestSummary(testErr); err != nil {
+	if err := r.writeTestSummary(testCmd, testErr, duration, stdoutForParsing.Bytes()); err != nil {
 		return fmt.Errorf("writeTestSummary: %w", err)
 	}
 	// TODO(b/322928092): Disable and remove this once `orchestrate` is the
@@ -495,21 +656,97 @@ func (r *TestOrchestrator) test(testCmd []string, in *RunInput) error {
 	return nil
 }
 
-// testSummary determines the data for out/summary.json
+// testSummary is the legacy out/summary.json schema, kept for
+// SummaryFormatLegacy callers that haven't migrated to runtests.TestSummary.
 type testSummary struct {
 	Success bool `json:"success"`
+	// SerialPanicDetected is true when startSerialLog saw a kernel-panic
+	// marker on the target's serial console. It's reported even when
+	// Success is true, since a panic seen after the test command exits
+	// (e.g. during teardown) can indicate a real bug the test itself missed.
+	SerialPanicDetected bool `json:"serial_panic_detected,omitempty"`
+	// ProvisioningAttempts records every attempt at a retried provisioning
+	// step, so infra can distinguish provisioning flakes from real test
+	// failures.
+	ProvisioningAttempts []provisioningAttempt `json:"provisioning_attempts,omitempty"`
+	// DataSinks records every artifact an ArtifactCollector pulled after the
+	// test command returned, so covargs and resultdb can ingest it without
+	// extra glue.
+	DataSinks []dataSink `json:"data_sinks,omitempty"`
 }
 
-func (r *TestOrchestrator) writeTestSummary(testErr error) error {
+func (r *TestOrchestrator) writeTestSummary(testCmd []string, testErr error, duration time.Duration, stdout []byte) error {
 	if testErr != nil {
 		fmt.Printf("Tests failed: %v\n", testErr)
 	}
-	summary := &testSummary{
-		Success: testErr == nil,
+	r.serialPanicMu.Lock()
+	panicked := r.serialPanicked
+	r.serialPanicMu.Unlock()
+	if panicked {
+		fmt.Printf("Kernel panic detected on serial console\n")
 	}
+
 	if err := os.MkdirAll(filepath.Dir(summaryPath), 0755); err != nil {
 		return fmt.Errorf("os.MkdirAll: %w", err)
 	}
+
+	if r.summaryFormat == SummaryFormatLegacy {
+		summary := &testSummary{
+			Success:              testErr == nil,
+			SerialPanicDetected:  panicked,
+			ProvisioningAttempts: r.provisioningAttempts,
+			DataSinks:            r.dataSinks,
+		}
+		if err := writeJSON(summaryPath, summary); err != nil {
+			return fmt.Errorf("writeJSON: %w", err)
+		}
+		return nil
+	}
+
+	result := runtests.TestSuccess
+	switch {
+	case panicked:
+		result = runtests.TestAborted
+	case testErr != nil:
+		result = runtests.TestFailure
+	}
+
+	outputsDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	details := runtests.TestDetails{
+		Name:                 strings.Join(testCmd, " "),
+		GNLabel:              os.Getenv("TEST_TARGET_LABEL"),
+		OutputFiles:          []string{filepath.Base(subrunnerLog)},
+		Result:               result,
+		Cases:                testparser.Parse(stdout),
+		DurationMilliseconds: duration.Milliseconds(),
+	}
+	if panicked {
+		details.OutputFiles = append(details.OutputFiles, filepath.Base(targetSerialLog))
+	}
+
+	summary := &runtests.TestSummary{
+		Tests: []runtests.TestDetails{details},
+		Outputs: map[string]string{
+			"output_dir": outputsDir,
+		},
+	}
+	// runtests.TestSummary doesn't have provisioning_attempts or data_sinks
+	// fields of its own, since it's shared with botanist; fold them into the
+	// serialized object as extra top-level keys so infra can still read them
+	// off summary.json without orchestrate forking the schema.
+	extras := map[string]any{}
+	if len(r.provisioningAttempts) > 0 {
+		extras["provisioning_attempts"] = r.provisioningAttempts
+	}
+	if len(r.dataSinks) > 0 {
+		extras["data_sinks"] = r.dataSinks
+	}
+	if len(extras) > 0 {
+		if err := writeJSONWithExtras(summaryPath, summary, extras); err != nil {
+			return fmt.Errorf("writeJSONWithExtras: %w", err)
+		}
+		return nil
+	}
 	if err := writeJSON(summaryPath, summary); err != nil {
 		return fmt.Errorf("writeJSON: %w", err)
 	}
@@ -527,26 +764,69 @@ func writeJSON(filename string, data any) error {
 	return nil
 }
 
+// writeJSONWithExtras marshals data, then splices in additional top-level
+// key/value pairs, for adding fields to a JSON schema owned by another
+// package without forking that schema.
+func writeJSONWithExtras(filename string, data any, extras map[string]any) error {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(rawData, &merged); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	for key, value := range extras {
+		extraRaw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("json.Marshal(%s): %w", key, err)
+		}
+		merged[key] = extraRaw
+	}
+	return writeJSON(filename, merged)
+}
+
 /* Cleanup */
-func (r *TestOrchestrator) stopPackageServer() {
-	if _, err := r.ffx.RunCmdSync("repository", "server", "stop", r.repoName); err != nil {
-		fmt.Printf("ffx repository server stop: %v", err)
+//
+// Cleanup runs in reverse-defer order from RunWithContext regardless of
+// whether the run's ctx is canceled, so that a caller's SIGTERM handler
+// doesn't leak the package server, the emulator, the daemon, or an `ffx log`
+// subprocess across CI reruns. Each step takes its own short-lived,
+// always-fresh context (rather than the (possibly already-canceled) run
+// ctx) so cleanup itself isn't cut short by the same cancellation it's
+// responding to.
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), testTimeoutGracePeriod)
+}
+
+// testTimeoutGracePeriod bounds how long any single cleanup step is allowed
+// to run for once the main run ctx has ended.
+const testTimeoutGracePeriod = 10 * time.Second
+
+func (r *TestOrchestrator) stopPackageServer(ctx context.Context) {
+	if r.packageServer == nil {
+		return
+	}
+	cleanupCtx, cancel := cleanupContext()
+	defer cancel()
+	if err := r.packageServer.Stop(cleanupCtx, r.ffx, r.repoName); err != nil {
+		fmt.Printf("packageServer.Stop: %v\n", err)
 	}
 }
 
-func (r *TestOrchestrator) stopEmulator() {
+func (r *TestOrchestrator) stopEmulator(ctx context.Context) {
 	if _, err := r.ffx.RunCmdSync("emu", "stop", "--all"); err != nil {
 		fmt.Printf("ffx emu stop: %v", err)
 	}
 }
 
-func (r *TestOrchestrator) stopDaemon() {
+func (r *TestOrchestrator) stopDaemon(ctx context.Context) {
 	if _, err := r.ffx.RunCmdSync("daemon", "stop", "--no-wait"); err != nil {
 		fmt.Printf("ffx daemon stop: %v", err)
 	}
 }
 
-func (r *TestOrchestrator) stopFfxLog() {
+func (r *TestOrchestrator) stopFfxLog(ctx context.Context) {
 	if r.ffxLogProc == nil {
 		return
 	}
@@ -557,13 +837,15 @@ func (r *TestOrchestrator) stopFfxLog() {
 		fmt.Printf("targetLogFile.Close: %v\n", err)
 	}
 	// Symbolize logs
-	if err := r.Symbolize(targetLog, targetSymLog); err != nil {
+	cleanupCtx, cancel := cleanupContext()
+	defer cancel()
+	if err := r.Symbolize(cleanupCtx, targetLog, targetSymLog); err != nil {
 		fmt.Printf("Symbolize: %v\n", err)
 	}
 }
 
 // Symbolize uses ffx to symbolize the log output.
-func (r *TestOrchestrator) Symbolize(input, output string) error {
+func (r *TestOrchestrator) Symbolize(ctx context.Context, input, output string) error {
 	logFile, err := os.Open(input)
 	if err != nil {
 		return fmt.Errorf("os.Open(%q): %w", input, err)
@@ -589,5 +871,5 @@ func (r *TestOrchestrator) Symbolize(input, output string) error {
 	cmd.Stdin = logFile
 	cmd.Stdout = symbolizedFile
 	cmd.Stderr = symbolizedFile
-	return cmd.Run()
+	return runCmdContext(ctx, cmd)
 }
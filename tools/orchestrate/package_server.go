@@ -0,0 +1,252 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package orchestrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ffx "go.fuchsia.dev/fuchsia/tools/orchestrate/ffx"
+)
+
+// PackageServerMode selects how orchestrate serves packages to the target.
+// This mirrors the `repository.server.fserve-mode` concept used elsewhere in
+// the ffx ecosystem.
+type PackageServerMode string
+
+const (
+	// PackageServerModeProductBundle serves packages out of the downloaded
+	// or local product bundle's repository, as orchestrate has always done.
+	// This is the default when PackageServerConfig is nil.
+	PackageServerModeProductBundle PackageServerMode = "product-bundle"
+	// PackageServerModePM builds a repository on the fly from a directory of
+	// `.far` archives plus a blobs directory, for workflows (e.g. iterative
+	// SDK development) that don't have a product bundle at all.
+	PackageServerModePM PackageServerMode = "pm"
+	// PackageServerModeExternal points at an already-running package server
+	// whose URL is supplied out of band; orchestrate doesn't start or stop
+	// it, only registers it on the target.
+	PackageServerModeExternal PackageServerMode = "external"
+)
+
+// PackageServerConfig selects and configures the PackageServer used to serve
+// packages to the target for a run.
+type PackageServerConfig struct {
+	// Mode selects which PackageServer implementation to use. The zero value
+	// behaves like PackageServerModeProductBundle.
+	Mode PackageServerMode
+	// RepoPath is the directory of `.far` package archives to build a
+	// repository from. Only used in PackageServerModePM.
+	RepoPath string
+	// BlobsPath is the directory of loose content-addressed blobs backing
+	// RepoPath. Only used in PackageServerModePM.
+	BlobsPath string
+	// Aliases are the hostnames the target should resolve against this
+	// repository, e.g. "fuchsia.com". Defaults to the orchestrate's usual
+	// ["fuchsia.com", "chromium.org"] if empty.
+	Aliases []string
+	// ExternalURL is the URL of an already-running package server. Only used
+	// in PackageServerModeExternal.
+	ExternalURL string
+}
+
+// defaultPackageAliases are the repository aliases orchestrate has always
+// registered on the target.
+var defaultPackageAliases = []string{"fuchsia.com", "chromium.org"}
+
+// PackageServer abstracts how orchestrate publishes packages, serves them,
+// and registers the resulting repository on the target, so that orchestrate
+// can serve tests that have a downloaded product bundle, a loose directory
+// of package archives, or an already-running external server, through the
+// same call sites.
+type PackageServer interface {
+	// Publish refreshes the repository's package metadata, optionally
+	// importing the given package archives.
+	Publish(ctx context.Context, f *ffx.Ffx, packageArchives []string) error
+	// Start brings the repository up under the given repository name, ready
+	// to be registered on a target.
+	Start(ctx context.Context, f *ffx.Ffx, repoName string) error
+	// RegisterOnTarget registers the repository on the currently-connected
+	// target using the configured aliases.
+	RegisterOnTarget(ctx context.Context, f *ffx.Ffx, repoName string) error
+	// Stop tears down the repository, if orchestrate owns its lifecycle.
+	Stop(ctx context.Context, f *ffx.Ffx, repoName string) error
+}
+
+// newPackageServer selects a PackageServer implementation for cfg. A nil
+// cfg preserves orchestrate's original behavior: serve out of productDir.
+func newPackageServer(cfg *PackageServerConfig, productDir string) PackageServer {
+	if cfg == nil {
+		return &productBundlePackageServer{productDir: productDir, aliases: defaultPackageAliases}
+	}
+	aliases := cfg.Aliases
+	if len(aliases) == 0 {
+		aliases = defaultPackageAliases
+	}
+	switch cfg.Mode {
+	case PackageServerModePM:
+		return &pmPackageServer{repoPath: cfg.RepoPath, blobsPath: cfg.BlobsPath, aliases: aliases}
+	case PackageServerModeExternal:
+		return &externalPackageServer{url: cfg.ExternalURL, aliases: aliases}
+	default:
+		return &productBundlePackageServer{productDir: productDir, aliases: aliases}
+	}
+}
+
+func registerRepository(ctx context.Context, f *ffx.Ffx, repoName string, aliases []string) error {
+	args := []string{"target", "repository", "register", "--repository", repoName}
+	for _, alias := range aliases {
+		args = append(args, "--alias", alias)
+	}
+	if out, err := f.RunCmdSync(args...); err != nil {
+		return fmt.Errorf("ffx target repository register: %w out: %s", err, out)
+	}
+	return nil
+}
+
+// productBundlePackageServer is the original orchestrate behavior: serve
+// packages directly out of a downloaded or local product bundle's
+// repository.
+type productBundlePackageServer struct {
+	productDir string
+	aliases    []string
+}
+
+func (p *productBundlePackageServer) Publish(ctx context.Context, f *ffx.Ffx, packageArchives []string) error {
+	args := []string{"repository", "publish", p.productDir}
+	for _, far := range packageArchives {
+		args = append(args, "--package-archive", far)
+	}
+	if out, err := f.RunCmdSync(args...); err != nil {
+		return fmt.Errorf("ffx %v: %w out: %v", args, err, out)
+	}
+	return nil
+}
+
+func (p *productBundlePackageServer) Start(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	return startRepoServer(ctx, f, repoName, p.productDir)
+}
+
+func (p *productBundlePackageServer) RegisterOnTarget(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	return registerRepository(ctx, f, repoName, p.aliases)
+}
+
+func (p *productBundlePackageServer) Stop(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	if _, err := f.RunCmdSync("repository", "server", "stop", repoName); err != nil {
+		return fmt.Errorf("ffx repository server stop: %w", err)
+	}
+	return nil
+}
+
+// pmPackageServer builds a repository on the fly out of a directory of
+// `.far` package archives plus a blobs directory, for workflows that don't
+// have a product bundle at all, e.g. iterative SDK development.
+type pmPackageServer struct {
+	repoPath  string
+	blobsPath string
+	aliases   []string
+}
+
+func (p *pmPackageServer) Publish(ctx context.Context, f *ffx.Ffx, packageArchives []string) error {
+	args := []string{"repository", "publish", p.repoPath, "--blobs-dir", p.blobsPath}
+	localArchives, err := filepath.Glob(filepath.Join(p.repoPath, "*.far"))
+	if err != nil {
+		return fmt.Errorf("filepath.Glob: %w", err)
+	}
+	for _, far := range append(localArchives, packageArchives...) {
+		args = append(args, "--package-archive", far)
+	}
+	if out, err := f.RunCmdSync(args...); err != nil {
+		return fmt.Errorf("ffx %v: %w out: %v", args, err, out)
+	}
+	return nil
+}
+
+func (p *pmPackageServer) Start(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	return startRepoServer(ctx, f, repoName, p.repoPath)
+}
+
+func (p *pmPackageServer) RegisterOnTarget(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	return registerRepository(ctx, f, repoName, p.aliases)
+}
+
+func (p *pmPackageServer) Stop(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	if _, err := f.RunCmdSync("repository", "server", "stop", repoName); err != nil {
+		return fmt.Errorf("ffx repository server stop: %w", err)
+	}
+	return nil
+}
+
+// externalPackageServer registers an already-running package server on the
+// target without orchestrate owning its lifecycle.
+type externalPackageServer struct {
+	url     string
+	aliases []string
+}
+
+func (e *externalPackageServer) Publish(ctx context.Context, f *ffx.Ffx, packageArchives []string) error {
+	// The caller is responsible for keeping an external server's metadata
+	// up to date; orchestrate has no repository to publish into.
+	return nil
+}
+
+func (e *externalPackageServer) Start(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	if e.url == "" {
+		return fmt.Errorf("externalPackageServer: ExternalURL must be set")
+	}
+	if out, err := f.RunCmdSync("repository", "add-from-pm", "--repo-url", e.url, repoName); err != nil {
+		return fmt.Errorf("ffx repository add-from-pm: %w out: %s", err, out)
+	}
+	return nil
+}
+
+func (e *externalPackageServer) RegisterOnTarget(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	return registerRepository(ctx, f, repoName, e.aliases)
+}
+
+func (e *externalPackageServer) Stop(ctx context.Context, f *ffx.Ffx, repoName string) error {
+	// orchestrate doesn't own an external server's lifecycle, so there's
+	// nothing to stop; just drop the local repository registration ffx
+	// keeps for it.
+	if _, err := f.RunCmdSync("repository", "remove", repoName); err != nil {
+		return fmt.Errorf("ffx repository remove: %w", err)
+	}
+	return nil
+}
+
+func startRepoServer(ctx context.Context, f *ffx.Ffx, repoName, repoPath string) error {
+	port := os.Getenv("FUCHSIA_PACKAGE_SERVER_PORT")
+	if port == "" {
+		// Use a dynamic port unless the environment is specific.
+		port = "0"
+	}
+	addr := fmt.Sprintf("[::]:%s", port)
+	args := []string{
+		"repository", "server", "start",
+		"--background", "--no-device",
+		"--address", addr,
+		// TODO(https://fxbug.dev/335008631): Handle publishing to a product-bundle repo
+		// until then use the product bundle (or pm repo dir) as a repo_path.
+		"--repo-path", repoPath,
+		"--repository", repoName,
+		"--refresh-metadata",
+	}
+	if _, err := f.RunCmdSync(args...); err != nil {
+		return fmt.Errorf("ffx repository server start: %w", err)
+	}
+
+	// The server start command when using `--background` waits for the server
+	// to actually start before exiting, so this check is a double check.
+	running, err := f.IsPackageServerRunning(repoName)
+	if err != nil {
+		return fmt.Errorf("ffx isPackageServerRunning: %w", err)
+	}
+	if !running {
+		return fmt.Errorf("repository %s is not running", repoName)
+	}
+	return nil
+}
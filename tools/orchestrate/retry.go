@@ -0,0 +1,155 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package orchestrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errorClass categorizes a provisioning failure so RetryPolicy can decide
+// whether retrying is likely to help.
+type errorClass string
+
+const (
+	// errorClassFastbootUSB covers fastboot losing the USB connection to the
+	// device mid-flash, which is usually transient.
+	errorClassFastbootUSB errorClass = "fastboot_usb_drop"
+	// errorClassEmulatorStartup covers the emulator failing to come up, e.g.
+	// a KVM stall on an overloaded host.
+	errorClassEmulatorStartup errorClass = "emulator_startup_stall"
+	// errorClassTargetUnreachable covers `ffx target wait` timing out.
+	errorClassTargetUnreachable errorClass = "target_wait_timeout"
+	// errorClassPortConflict covers `ffx repository server start` failing to
+	// bind its port.
+	errorClassPortConflict errorClass = "repository_server_port_conflict"
+	// errorClassUnknown is the fallback for errors that don't match a known,
+	// retryable pattern.
+	errorClassUnknown errorClass = "unknown"
+)
+
+// classifyError maps a raw step error to an errorClass using substring
+// matches against the known fastboot, emulator, target-wait, and
+// repository-server failure modes. This is necessarily heuristic, since the
+// underlying errors come from ffx subprocess output rather than typed Go
+// errors.
+func classifyError(err error) errorClass {
+	if err == nil {
+		return errorClassUnknown
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "usb") && (strings.Contains(msg, "fastboot") || strings.Contains(msg, "flash")):
+		return errorClassFastbootUSB
+	case strings.Contains(msg, "emu") && (strings.Contains(msg, "kvm") || strings.Contains(msg, "startup-timeout") || strings.Contains(msg, "timed out")):
+		return errorClassEmulatorStartup
+	case strings.Contains(msg, "target wait"):
+		return errorClassTargetUnreachable
+	case strings.Contains(msg, "repository server start") && (strings.Contains(msg, "address already in use") || strings.Contains(msg, "bind")):
+		return errorClassPortConflict
+	default:
+		return errorClassUnknown
+	}
+}
+
+// retryableErrorClasses are the error classes RetryPolicy will retry by
+// default; anything else is assumed to be a real test/infra failure rather
+// than a provisioning flake, and is not worth retrying.
+var retryableErrorClasses = map[errorClass]bool{
+	errorClassFastbootUSB:       true,
+	errorClassEmulatorStartup:   true,
+	errorClassTargetUnreachable: true,
+	errorClassPortConflict:      true,
+}
+
+// RetryPolicy configures how orchestrate retries flaky provisioning steps
+// (flashing, emulator startup, reaching the target, starting the package
+// server) before giving up and failing the run.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a step is attempted,
+	// including the first attempt. A value <= 1 disables retries.
+	MaxAttempts int
+	// Backoff is the fixed delay between attempts.
+	Backoff time.Duration
+	// Steps restricts retrying to this whitelist of step names (as passed to
+	// withRetry). A nil or empty Steps retries every step whose classified
+	// error is in retryableErrorClasses.
+	Steps map[string]bool
+}
+
+// DefaultRetryPolicy returns the RetryPolicy orchestrate uses when the
+// caller doesn't configure one: up to 3 attempts with a 5 second backoff,
+// applied to every step.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3, Backoff: 5 * time.Second}
+}
+
+// provisioningAttempt records a single attempt at a provisioning step, for
+// inclusion in the run's summary so infra can distinguish provisioning
+// flakes from real test failures.
+type provisioningAttempt struct {
+	Step       string `json:"step"`
+	Attempt    int    `json:"attempt"`
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Succeeded  bool   `json:"succeeded"`
+}
+
+func (r *TestOrchestrator) retryPolicyOrDefault() *RetryPolicy {
+	if r.retryPolicy == nil {
+		return DefaultRetryPolicy()
+	}
+	return r.retryPolicy
+}
+
+// withRetry runs step (named by stepName for classification and reporting),
+// retrying it up to the configured RetryPolicy's MaxAttempts when its error
+// classifies as retryable. teardown is invoked between attempts, before
+// retrying, to tear down any partial state (e.g. stop the emulator, stop the
+// daemon, free a port) so the next attempt starts clean.
+func (r *TestOrchestrator) withRetry(stepName string, teardown func(), step func() error) error {
+	policy := r.retryPolicyOrDefault()
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if len(policy.Steps) > 0 && !policy.Steps[stepName] {
+		maxAttempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := step()
+		class := classifyError(err)
+		r.provisioningAttempts = append(r.provisioningAttempts, provisioningAttempt{
+			Step:       stepName,
+			Attempt:    attempt,
+			ErrorClass: string(class),
+			Error:      errString(err),
+			Succeeded:  err == nil,
+		})
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if attempt == maxAttempts || !retryableErrorClasses[class] {
+			break
+		}
+		fmt.Printf("%s attempt %d/%d failed (%s), retrying after %s: %v\n", stepName, attempt, maxAttempts, class, policy.Backoff, err)
+		if teardown != nil {
+			teardown()
+		}
+		time.Sleep(policy.Backoff)
+	}
+	return fmt.Errorf("%s: %w", stepName, lastErr)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
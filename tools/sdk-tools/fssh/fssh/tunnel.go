@@ -0,0 +1,816 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package fssh implements the `fssh` subcommands for tunneling a Fuchsia
+// device's ports through a remote host.
+package fssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+	"go.fuchsia.dev/fuchsia/tools/sdk-tools/sdkcommon"
+)
+
+const (
+	remoteHostFlag    = "remote-host"
+	deviceIPFlag      = "device-ip"
+	deviceNameFlag    = "device-name"
+	tunnelPortsFlag   = "tunnel-ports"
+	remoteForwardFlag = "remote-forward"
+	sshConfigFlag     = "sshconfig"
+	printSSHConfig    = "print-ssh-config"
+	repoPortFlag      = "repo-port"
+	diagnoseFlag      = "diagnose"
+	keepaliveFlag     = "keepalive"
+	maxRetriesFlag    = "max-retries"
+	maxBackoffFlag    = "max-backoff"
+	allDiscoveredFlag = "all-discovered"
+
+	defaultRepoPort = 8083
+
+	// devicePortOffset is added to the base repo/tunnel ports for every
+	// device after the first a multi-device tunnel covers, so two
+	// devices tunneled through the same remote host are never asked to
+	// forward the same port.
+	devicePortOffset = 100
+
+	// defaultMaxBackoff caps the exponential backoff KeepAlive applies
+	// between reconnect attempts, so a persistently down corp network
+	// doesn't leave a user waiting arbitrarily long for the next retry.
+	defaultMaxBackoff = 30 * time.Second
+
+	// portFailureWindow and portFailureThreshold bound how many
+	// "connect_to ... port NNNN: failed." lines KeepAlive tolerates
+	// within a short window before it tears down and re-establishes the
+	// session on its own, even though the ssh process itself hasn't
+	// exited.
+	portFailureWindow    = 10 * time.Second
+	portFailureThreshold = 3
+
+	// remoteHostCacheFile caches the last -remote-host value under the
+	// SDK's data directory, so a user doesn't have to pass -remote-host
+	// on every invocation once they've used it once.
+	remoteHostCacheFile = ".fssh-remote-host"
+
+	// firstUnprotectedPort is the lowest port fssh will forward without
+	// complaint. Anything below it needs root to bind on most systems,
+	// which a tunnel session running as a normal user can't grant.
+	firstUnprotectedPort = 1024
+)
+
+// sdkProvider is the subset of sdkcommon.SDKProperties TunnelCmd depends
+// on, so tests can supply a fake instead of a real SDK checkout.
+type sdkProvider interface {
+	ResolveTargetAddress(deviceIP string, deviceName string) (sdkcommon.DeviceConfig, error)
+	GetSDKDataPath() string
+}
+
+// intSlice is a flag.Value parsing a comma-separated list of ints, used
+// by -tunnel-ports to accept a variable number of ports on one flag.
+type intSlice []int
+
+func (s *intSlice) String() string {
+	if s == nil {
+		return ""
+	}
+	parts := make([]string, len(*s))
+	for i, v := range *s {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *intSlice) Set(value string) error {
+	var parsed intSlice
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("invalid port %q: %w", part, err)
+		}
+		parsed = append(parsed, v)
+	}
+	*s = parsed
+	return nil
+}
+
+// stringSliceFlag is a flag.Value collecting every occurrence of a flag,
+// in the order given, e.g. multiple -device-name flags for a
+// multi-device tunnel.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// remoteForward is one -remote-forward=host:port:remoteport entry:
+// expose host:port, as reachable from the Fuchsia-device side of the
+// tunnel, to remoteHost on remoteport.
+type remoteForward struct {
+	Host       string
+	Port       int
+	RemotePort int
+}
+
+// remoteForwardList is a flag.Value collecting every -remote-forward
+// occurrence, in the order given.
+type remoteForwardList []remoteForward
+
+func (l *remoteForwardList) String() string {
+	if l == nil {
+		return ""
+	}
+	parts := make([]string, len(*l))
+	for i, f := range *l {
+		parts[i] = fmt.Sprintf("%s:%d:%d", f.Host, f.Port, f.RemotePort)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *remoteForwardList) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid -%s value %q, want host:port:remoteport", remoteForwardFlag, value)
+	}
+	port, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid -%s port %q: %w", remoteForwardFlag, parts[1], err)
+	}
+	remotePort, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid -%s remote port %q: %w", remoteForwardFlag, parts[2], err)
+	}
+	if !validHostname(parts[0]) {
+		return fmt.Errorf("invalid -%s host %q: not a valid hostname", remoteForwardFlag, parts[0])
+	}
+	*l = append(*l, remoteForward{Host: parts[0], Port: port, RemotePort: remotePort})
+	return nil
+}
+
+// TunnelCmd implements `fssh tunnel`: it builds (or reuses) an SSH config
+// that forwards a Fuchsia package repository and other local ports
+// through remoteHost, so a remote workstation can reach the device as if
+// it were local, plus RemoteForward entries exposing services running on
+// the local side back to remoteHost.
+type TunnelCmd struct {
+	remoteHost     string
+	deviceIP       string
+	deviceName     string
+	sshConfig      string
+	printSSHConfig bool
+	repoPort       int
+	tunnelPorts    intSlice
+	remoteForwards remoteForwardList
+	diagnose       bool
+	keepalive      bool
+	maxRetries     int
+	maxBackoff     time.Duration
+
+	// deviceNames is populated by repeated -device-name flags; when it
+	// has more than one entry (or allDiscovered is set), parseFlags
+	// takes the multi-device path instead of the legacy single-device
+	// one driven by deviceIP/deviceName above.
+	deviceNames   stringSliceFlag
+	allDiscovered bool
+
+	// userSSHConfig overrides the path genDefaultSSHConfig reads the
+	// user's own SSH config from; tests set it to a seeded fake config,
+	// production code leaves it empty to use defaultUserSSHConfigPath.
+	userSSHConfig string
+
+	// lookupHost resolves a hostname to its addresses for runDiagnostics.
+	// Tests override it to avoid depending on real DNS; production code
+	// leaves it nil and runDiagnostics falls back to net.LookupHost.
+	lookupHost func(host string) ([]string, error)
+
+	// runSSH invokes the ssh client with args and returns its combined
+	// output. Tests override it with a fake that plays back captured ssh
+	// output instead of spawning a real client; production code leaves
+	// it nil and runDiagnostics falls back to exec.CommandContext.
+	runSSH func(ctx context.Context, args ...string) (string, error)
+
+	// sshSession runs one tunnel session and blocks until it exits,
+	// invoking onLine for every line of output. Tests override it with a
+	// fake that fails a fixed number of times before succeeding;
+	// production code leaves it nil and KeepAlive falls back to
+	// runSSHSession.
+	sshSession func(ctx context.Context, sshConfigPath string, onLine func(line string)) error
+
+	// now returns the current time, used by KeepAlive's port-failure
+	// rate tracking. Tests override it for deterministic windows;
+	// production code leaves it nil and falls back to time.Now.
+	now func() time.Time
+}
+
+// SetFlags registers TunnelCmd's command-line flags on f.
+func (cmd *TunnelCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.remoteHost, remoteHostFlag, "", "Remote host to tunnel to, e.g. a corp workstation.")
+	f.StringVar(&cmd.deviceIP, deviceIPFlag, "", "IP address of the target Fuchsia device.")
+	f.Var(&cmd.deviceNames, deviceNameFlag, "Name of the target Fuchsia device; may be repeated to tunnel multiple devices through the same remote host.")
+	f.BoolVar(&cmd.allDiscovered, allDiscoveredFlag, false, "Tunnel every discovered Fuchsia device instead of specific -device-name values.")
+	f.StringVar(&cmd.sshConfig, sshConfigFlag, "", "Path to an existing SSH config to use instead of generating one.")
+	f.BoolVar(&cmd.printSSHConfig, printSSHConfig, false, "Print the generated SSH config and exit.")
+	f.IntVar(&cmd.repoPort, repoPortFlag, defaultRepoPort, "Port to forward for the package repository.")
+	f.Var(&cmd.tunnelPorts, tunnelPortsFlag, "Comma-separated list of additional local ports to forward.")
+	f.Var(&cmd.remoteForwards, remoteForwardFlag, "host:port:remoteport to forward from the device side back to remoteHost; may be repeated.")
+	f.BoolVar(&cmd.diagnose, diagnoseFlag, false, "Run pre-flight connectivity checks against remoteHost and the requested ports instead of opening a tunnel.")
+	f.BoolVar(&cmd.keepalive, keepaliveFlag, false, "Automatically re-establish the tunnel with exponential backoff if the SSH session drops.")
+	f.IntVar(&cmd.maxRetries, maxRetriesFlag, 0, "Maximum number of reconnect attempts under -keepalive; 0 means retry forever.")
+	f.DurationVar(&cmd.maxBackoff, maxBackoffFlag, defaultMaxBackoff, "Ceiling on the exponential backoff delay between reconnect attempts under -keepalive.")
+}
+
+// parseFlags resolves the target device and remote host, validates the
+// requested ports, and returns the contents of the SSH config TunnelCmd
+// will tunnel with, generating one under cmd.sshConfig if the caller
+// didn't supply one.
+func (cmd *TunnelCmd) parseFlags(ctx context.Context, sdk sdkProvider) ([]byte, error) {
+	cachePath := filepath.Join(sdk.GetSDKDataPath(), remoteHostCacheFile)
+	if cmd.remoteHost == "" {
+		cached, err := os.ReadFile(cachePath)
+		if err != nil || len(strings.TrimSpace(string(cached))) == 0 {
+			return nil, fmt.Errorf("No remote host provided. Please add the '-%s' flag", remoteHostFlag)
+		}
+		cmd.remoteHost = strings.TrimSpace(string(cached))
+	} else if err := os.WriteFile(cachePath, []byte(cmd.remoteHost), 0o600); err != nil {
+		return nil, fmt.Errorf("could not cache remote host: %w", err)
+	}
+
+	devices, err := cmd.resolveDevices(sdk)
+	if err != nil {
+		return nil, err
+	}
+	cmd.deviceIP = devices[0].DeviceIP
+	cmd.deviceName = devices[0].DeviceName
+
+	if cmd.sshConfig != "" {
+		return os.ReadFile(cmd.sshConfig)
+	}
+
+	var contents []byte
+	var path string
+	if len(devices) == 1 {
+		contents, path, err = genDefaultSSHConfig(cmd)
+	} else {
+		contents, path, err = genMultiDeviceSSHConfig(cmd, devices)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not generate default SSH config: %s", err)
+	}
+	cmd.sshConfig = path
+	return contents, nil
+}
+
+// deviceDiscoverer is implemented by sdkProvider values that can list
+// every Fuchsia device discovered on the local network. It's checked
+// with a type assertion rather than folded into sdkProvider itself, so
+// existing sdkProvider fakes that don't support -all-discovered keep
+// compiling unchanged.
+type deviceDiscoverer interface {
+	ListDiscoveredDevices() ([]sdkcommon.DeviceConfig, error)
+}
+
+// resolveDevices returns the set of devices this tunnel should cover. If
+// cmd.deviceNames has zero or one entries and -all-discovered wasn't
+// set, it resolves exactly the single legacy-compatible device named by
+// cmd.deviceIP/cmd.deviceName. Otherwise it resolves one device per
+// cmd.deviceNames entry, plus every discovered device if -all-discovered
+// was set, de-duplicating by device name.
+func (cmd *TunnelCmd) resolveDevices(sdk sdkProvider) ([]sdkcommon.DeviceConfig, error) {
+	if len(cmd.deviceNames) <= 1 && !cmd.allDiscovered {
+		name := cmd.deviceName
+		if len(cmd.deviceNames) == 1 {
+			name = cmd.deviceNames[0]
+		}
+		device, err := sdk.ResolveTargetAddress(cmd.deviceIP, name)
+		if err != nil {
+			return nil, err
+		}
+		return []sdkcommon.DeviceConfig{device}, nil
+	}
+
+	var devices []sdkcommon.DeviceConfig
+	seen := make(map[string]bool)
+	addDevice := func(device sdkcommon.DeviceConfig) {
+		if seen[device.DeviceName] {
+			return
+		}
+		seen[device.DeviceName] = true
+		devices = append(devices, device)
+	}
+
+	if cmd.allDiscovered {
+		discoverer, ok := sdk.(deviceDiscoverer)
+		if !ok {
+			return nil, fmt.Errorf("-%s requires an SDK provider that can list discovered devices", allDiscoveredFlag)
+		}
+		discovered, err := discoverer.ListDiscoveredDevices()
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range discovered {
+			addDevice(device)
+		}
+	}
+	for _, name := range cmd.deviceNames {
+		device, err := sdk.ResolveTargetAddress("", name)
+		if err != nil {
+			return nil, err
+		}
+		addDevice(device)
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices resolved for tunnel")
+	}
+	return devices, nil
+}
+
+// protectedPorts returns, in order, every port in ports that falls below
+// firstUnprotectedPort.
+func protectedPorts(ports ...int) []int {
+	var protected []int
+	for _, p := range ports {
+		if p > 0 && p < firstUnprotectedPort {
+			protected = append(protected, p)
+		}
+	}
+	return protected
+}
+
+// genDefaultSSHConfig validates cmd's requested ports and writes a fresh
+// SSH config forwarding them through cmd.remoteHost, returning both its
+// contents and the temp file path it was written to.
+func genDefaultSSHConfig(cmd *TunnelCmd) ([]byte, string, error) {
+	ports := append([]int{cmd.repoPort}, cmd.tunnelPorts...)
+	for _, rf := range cmd.remoteForwards {
+		ports = append(ports, rf.Port, rf.RemotePort)
+	}
+	if protected := protectedPorts(ports...); len(protected) > 0 {
+		strs := make([]string, len(protected))
+		for i, p := range protected {
+			strs[i] = strconv.Itoa(p)
+		}
+		return nil, "", fmt.Errorf("Cannot create SSH config with protected ports: %s", strings.Join(strs, ","))
+	}
+
+	userConfigPath := cmd.userSSHConfig
+	if userConfigPath == "" {
+		p, err := defaultUserSSHConfigPath()
+		if err != nil {
+			return nil, "", err
+		}
+		userConfigPath = p
+	}
+	directives, err := userSSHConfigDirectives(userConfigPath, cmd.remoteHost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Host %s\n", cmd.remoteHost)
+	fmt.Fprintf(&buf, "  HostName %s\n", cmd.remoteHost)
+	for _, d := range directives {
+		fmt.Fprintf(&buf, "  %s\n", d)
+	}
+	fmt.Fprintf(&buf, "  LocalForward %d localhost:%d\n", cmd.repoPort, cmd.repoPort)
+	for _, port := range cmd.tunnelPorts {
+		fmt.Fprintf(&buf, "  LocalForward %d localhost:%d\n", port, port)
+	}
+	for _, rf := range cmd.remoteForwards {
+		fmt.Fprintf(&buf, "  RemoteForward %d %s:%d\n", rf.RemotePort, rf.Host, rf.Port)
+	}
+
+	path, err := sdkcommon.WriteTempFile(buf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), path, nil
+}
+
+// devicePortAllocation is the disjoint block of ports
+// genMultiDeviceSSHConfig assigns to one device: the repo port and every
+// requested tunnel port, each offset from cmd's base values by the
+// device's position among the resolved devices.
+type devicePortAllocation struct {
+	Device      sdkcommon.DeviceConfig
+	RepoPort    int
+	TunnelPorts []int
+}
+
+// allocateDevicePorts assigns each resolved device a disjoint block of
+// ports, offset from cmd's base repoPort/tunnelPorts by devicePortOffset
+// times the device's index, so no two devices ask the remote host to
+// forward the same port.
+func allocateDevicePorts(cmd *TunnelCmd, devices []sdkcommon.DeviceConfig) []devicePortAllocation {
+	allocations := make([]devicePortAllocation, len(devices))
+	for i, device := range devices {
+		offset := i * devicePortOffset
+		tunnelPorts := make([]int, len(cmd.tunnelPorts))
+		for j, port := range cmd.tunnelPorts {
+			tunnelPorts[j] = port + offset
+		}
+		allocations[i] = devicePortAllocation{
+			Device:      device,
+			RepoPort:    cmd.repoPort + offset,
+			TunnelPorts: tunnelPorts,
+		}
+	}
+	return allocations
+}
+
+// genMultiDeviceSSHConfig validates the per-device port blocks
+// allocateDevicePorts assigns and writes a fresh SSH config with one
+// Host stanza per device, each under a "fuchsia-<nodename>" alias
+// forwarding its own disjoint port block through cmd.remoteHost.
+func genMultiDeviceSSHConfig(cmd *TunnelCmd, devices []sdkcommon.DeviceConfig) ([]byte, string, error) {
+	allocations := allocateDevicePorts(cmd, devices)
+
+	for _, a := range allocations {
+		if !deviceNameRegexp.MatchString(a.Device.DeviceName) {
+			// DeviceName can come from mDNS discovery, i.e. from
+			// whatever else is on the network segment, and is about to
+			// be embedded verbatim in a "Host fuchsia-<name>" line of
+			// an ssh_config file that gets passed straight to `ssh -F`.
+			// Reject anything that isn't a plain alphanumeric-and-hyphen
+			// label so it can't inject a newline-delimited directive
+			// (e.g. ProxyCommand) into the generated config.
+			return nil, "", fmt.Errorf("device name %q is not safe to use in an SSH config", a.Device.DeviceName)
+		}
+	}
+
+	var allPorts []int
+	assignedTo := make(map[int]string)
+	for _, a := range allocations {
+		for _, port := range append([]int{a.RepoPort}, a.TunnelPorts...) {
+			if other, ok := assignedTo[port]; ok {
+				return nil, "", fmt.Errorf("port %d is allocated to both %s and %s", port, other, a.Device.DeviceName)
+			}
+			assignedTo[port] = a.Device.DeviceName
+			allPorts = append(allPorts, port)
+		}
+	}
+	for _, rf := range cmd.remoteForwards {
+		allPorts = append(allPorts, rf.Port, rf.RemotePort)
+	}
+	if protected := protectedPorts(allPorts...); len(protected) > 0 {
+		strs := make([]string, len(protected))
+		for i, p := range protected {
+			strs[i] = strconv.Itoa(p)
+		}
+		return nil, "", fmt.Errorf("Cannot create SSH config with protected ports: %s", strings.Join(strs, ","))
+	}
+
+	userConfigPath := cmd.userSSHConfig
+	if userConfigPath == "" {
+		p, err := defaultUserSSHConfigPath()
+		if err != nil {
+			return nil, "", err
+		}
+		userConfigPath = p
+	}
+	directives, err := userSSHConfigDirectives(userConfigPath, cmd.remoteHost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	for _, a := range allocations {
+		fmt.Fprintf(&buf, "Host fuchsia-%s\n", a.Device.DeviceName)
+		fmt.Fprintf(&buf, "  HostName %s\n", cmd.remoteHost)
+		for _, d := range directives {
+			fmt.Fprintf(&buf, "  %s\n", d)
+		}
+		fmt.Fprintf(&buf, "  LocalForward %d localhost:%d\n", a.RepoPort, a.RepoPort)
+		for _, port := range a.TunnelPorts {
+			fmt.Fprintf(&buf, "  LocalForward %d localhost:%d\n", port, port)
+		}
+		for _, rf := range cmd.remoteForwards {
+			fmt.Fprintf(&buf, "  RemoteForward %d %s:%d\n", rf.RemotePort, rf.Host, rf.Port)
+		}
+	}
+
+	path, err := sdkcommon.WriteTempFile(buf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), path, nil
+}
+
+// managedSSHConfigKeys are the directives genDefaultSSHConfig sets itself;
+// userSSHConfigDirectives drops them from the user's own config so our
+// forwarding lines are the only source of truth for them.
+var managedSSHConfigKeys = map[string]bool{
+	"hostname":      true,
+	"localforward":  true,
+	"remoteforward": true,
+}
+
+// defaultUserSSHConfigPath is the real SSH config a logged-in user edits
+// by hand: $HOME/.ssh/config.
+func defaultUserSSHConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// userSSHConfigDirectives reads the SSH config at path and returns every
+// directive line, verbatim, from the Host stanzas that match host, other
+// than the ones genDefaultSSHConfig manages itself. This is how a user's
+// own ProxyJump, User, IdentityFile or HostKeyAlgorithms lines for
+// remoteHost end up applied to the generated tunnel config. A missing
+// config file is not an error: most hosts that have never touched
+// ~/.ssh/config still work fine with one we generate wholesale.
+func userSSHConfigDirectives(path, host string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ssh_config.DecodeBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	var directives []string
+	for _, h := range cfg.Hosts {
+		matched := false
+		for _, p := range h.Patterns {
+			if p.Match(host) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, node := range h.Nodes {
+			kv, ok := node.(*ssh_config.KV)
+			if !ok || managedSSHConfigKeys[strings.ToLower(kv.Key)] {
+				continue
+			}
+			directives = append(directives, fmt.Sprintf("%s %s", kv.Key, kv.Value))
+		}
+	}
+	return directives, nil
+}
+
+// failedConnectionPortRegexp matches the ssh client's "connect_to ... port
+// NNNN: failed." diagnostic for a port it couldn't reach, as emitted with
+// -v when a forwarded port is refused on the remote side.
+var failedConnectionPortRegexp = regexp.MustCompile(`port (\d+): failed\.`)
+
+// isThisFailedConnectionPortMessage reports whether message is an ssh
+// "connect_to ... port NNNN: failed." line.
+func isThisFailedConnectionPortMessage(message string) bool {
+	return failedConnectionPortRegexp.MatchString(message)
+}
+
+// PortDiagnostic describes why one requested tunnel port failed during a
+// -diagnose run, as parsed out of the ssh client's verbose log.
+type PortDiagnostic struct {
+	Port   int    `json:"port"`
+	Reason string `json:"reason"`
+}
+
+// Diagnosis is the JSON-serializable result of a -diagnose run: whether
+// remoteHost resolved, whether ssh itself considers the generated config
+// valid, and which requested ports the remote side refused.
+type Diagnosis struct {
+	RemoteHost      string           `json:"remote_host"`
+	ResolvedAddrs   []string         `json:"resolved_addrs"`
+	SSHConfigValid  bool             `json:"ssh_config_valid"`
+	PortDiagnostics []PortDiagnostic `json:"port_diagnostics,omitempty"`
+}
+
+// runDiagnostics resolves cmd.remoteHost, validates the SSH config at
+// sshConfigPath with a `ssh -G` dry run, then opens a real connection
+// through it and reports every port the remote side refused to forward,
+// as listed in the ssh client's verbose output. It is the implementation behind -diagnose: a
+// pre-flight check that surfaces port collisions before a user commits
+// to a long-running tunnel session.
+func (cmd *TunnelCmd) runDiagnostics(ctx context.Context, sshConfigPath string) (*Diagnosis, error) {
+	lookupHost := cmd.lookupHost
+	if lookupHost == nil {
+		lookupHost = net.LookupHost
+	}
+	runSSH := cmd.runSSH
+	if runSSH == nil {
+		runSSH = runSSHCommand
+	}
+
+	addrs, err := lookupHost(cmd.remoteHost)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", cmd.remoteHost, err)
+	}
+
+	diagnosis := &Diagnosis{
+		RemoteHost:    cmd.remoteHost,
+		ResolvedAddrs: addrs,
+	}
+
+	if _, err := runSSH(ctx, "-G", "-F", sshConfigPath, cmd.remoteHost); err != nil {
+		diagnosis.SSHConfigValid = false
+		return diagnosis, nil
+	}
+	diagnosis.SSHConfigValid = true
+
+	output, err := runSSH(ctx, "-v", "-F", sshConfigPath, cmd.remoteHost, "true")
+	if err != nil {
+		return nil, fmt.Errorf("could not open SSH connection to %s: %w", cmd.remoteHost, err)
+	}
+	diagnosis.PortDiagnostics = parsePortDiagnostics(output)
+	return diagnosis, nil
+}
+
+// parsePortDiagnostics scans the verbose output of an ssh client
+// invocation for "connect_to ... port NNNN: failed." lines and turns
+// each into a PortDiagnostic.
+func parsePortDiagnostics(output string) []PortDiagnostic {
+	var diagnostics []PortDiagnostic
+	for _, line := range strings.Split(output, "\n") {
+		if !isThisFailedConnectionPortMessage(line) {
+			continue
+		}
+		match := failedConnectionPortRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		port, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		diagnostics = append(diagnostics, PortDiagnostic{
+			Port:   port,
+			Reason: "remote side refused or could not bind this port",
+		})
+	}
+	return diagnostics
+}
+
+// runSSHCommand runs the real ssh client with args and returns its
+// combined stdout and stderr, the source runDiagnostics parses forwarding
+// failures out of.
+func runSSHCommand(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "ssh", args...).CombinedOutput()
+	return string(out), err
+}
+
+// DiagnoseJSON runs runDiagnostics against the SSH config at
+// sshConfigPath and marshals the result as indented JSON, ready to print
+// to the user running `fssh tunnel -diagnose`.
+func (cmd *TunnelCmd) DiagnoseJSON(ctx context.Context, sshConfigPath string) ([]byte, error) {
+	diagnosis, err := cmd.runDiagnostics(ctx, sshConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(diagnosis, "", "  ")
+}
+
+// portFailureTracker counts isThisFailedConnectionPortMessage hits
+// within a rolling window and reports once there have been too many,
+// so KeepAlive can treat a session that's alive but failing every
+// forwarded port as unhealthy.
+type portFailureTracker struct {
+	now    func() time.Time
+	window time.Duration
+	times  []time.Time
+}
+
+// record notes a port failure at the current time and reports whether
+// portFailureThreshold failures have now landed within the window.
+func (t *portFailureTracker) record() bool {
+	now := t.now()
+	cutoff := now.Add(-t.window)
+	kept := t.times[:0]
+	for _, ts := range t.times {
+		if ts.After(cutoff) {
+			kept = append(kept, ts)
+		}
+	}
+	t.times = append(kept, now)
+	return len(t.times) >= portFailureThreshold
+}
+
+// runSSHSession execs `ssh -N -F sshConfigPath remoteHost` to bring up
+// the tunnel, streaming its combined output to onLine one line at a
+// time, and blocks until the process exits.
+func runSSHSession(ctx context.Context, sshConfigPath, remoteHost string, onLine func(line string)) error {
+	c := exec.CommandContext(ctx, "ssh", "-N", "-F", sshConfigPath, remoteHost)
+	pipe, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	c.Stderr = c.Stdout
+	if err := c.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(pipe)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	return c.Wait()
+}
+
+// KeepAlive is the implementation behind -keepalive: it runs a tunnel
+// session and, whenever the underlying ssh process exits non-zero or
+// isThisFailedConnectionPortMessage fires too often within
+// portFailureWindow, tears the session down and re-establishes it,
+// re-resolving the device address via sdk.ResolveTargetAddress on every
+// retry in case the target rebooted onto a new link-local IP. Retries
+// back off exponentially up to cmd.maxBackoff, stopping after
+// cmd.maxRetries attempts if set, or running forever if it's 0.
+func (cmd *TunnelCmd) KeepAlive(ctx context.Context, sdk sdkProvider) error {
+	session := cmd.sshSession
+	if session == nil {
+		session = func(ctx context.Context, sshConfigPath string, onLine func(line string)) error {
+			return runSSHSession(ctx, sshConfigPath, cmd.remoteHost, onLine)
+		}
+	}
+	now := cmd.now
+	if now == nil {
+		now = time.Now
+	}
+
+	initialDelay := time.Second
+	if cmd.maxBackoff < initialDelay {
+		initialDelay = cmd.maxBackoff
+	}
+	var backoff retry.Backoff = retry.NewExponentialBackoff(initialDelay, cmd.maxBackoff, 2)
+	if cmd.maxRetries > 0 {
+		backoff = retry.WithMaxAttempts(backoff, uint64(cmd.maxRetries))
+	}
+
+	return retry.Retry(ctx, backoff, func() error {
+		// parseFlags re-resolves the device address via
+		// sdk.ResolveTargetAddress on every call, which is exactly the
+		// re-resolution KeepAlive needs on each retry.
+		if _, err := cmd.parseFlags(ctx, sdk); err != nil {
+			return err
+		}
+
+		sessionCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		tracker := &portFailureTracker{now: now, window: portFailureWindow}
+		return session(sessionCtx, cmd.sshConfig, func(line string) {
+			if isThisFailedConnectionPortMessage(line) && tracker.record() {
+				cancel()
+			}
+		})
+	}, nil)
+}
+
+// deviceNameRegexp matches the characters genMultiDeviceSSHConfig allows in
+// a device name before embedding it in a "Host fuchsia-<name>" line: plain
+// alphanumerics and hyphens, nothing that ssh_config would parse as
+// whitespace or a new directive.
+var deviceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// hostnameLabelRegexp matches a single dot-separated hostname label:
+// alphanumeric, optionally containing hyphens/underscores in the middle,
+// but never starting or ending with one.
+var hostnameLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_-]*[A-Za-z0-9])?$`)
+
+// validHostname reports whether name is a syntactically valid hostname:
+// non-empty dot-separated labels with no user@ prefix.
+func validHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabelRegexp.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -5,11 +5,13 @@ package fssh
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/tools/sdk-tools/sdkcommon"
 )
@@ -70,14 +72,28 @@ func TestParseFlags(t *testing.T) {
 		t.Fatalf("could not create temporary SSH config file: %s", err)
 	}
 	defer os.Remove(fakeSSHConfigPath)
+	fakeUserSSHConfigPath, err := sdkcommon.WriteTempFile([]byte(
+		"Host fake.remote.host\n" +
+			"  User alice\n" +
+			"  IdentityFile ~/.ssh/id_alice\n" +
+			"  ProxyJump jumpbox\n" +
+			"  HostName should-not-override-ours\n",
+	))
+	if err != nil {
+		t.Fatalf("could not create temporary user SSH config file: %s", err)
+	}
+	defer os.Remove(fakeUserSSHConfigPath)
+
 	var tests = []struct {
-		TunnelCmd              *TunnelCmd
-		expectedRemoteHost     string
-		expectedDeviceIP       string
-		expectedDeviceName     string
-		expectedSSHConfig      string
-		expectedPrintSSHConfig bool
-		sdk                    testSDKProperties
+		TunnelCmd               *TunnelCmd
+		expectedRemoteHost      string
+		expectedDeviceIP        string
+		expectedDeviceName      string
+		expectedSSHConfig       string
+		expectedPrintSSHConfig  bool
+		expectedConfigContains  []string
+		unexpectedConfigStrings []string
+		sdk                     testSDKProperties
 	}{
 		{
 			TunnelCmd: &TunnelCmd{
@@ -233,10 +249,40 @@ func TestParseFlags(t *testing.T) {
 				DeviceName: fakeFoundName,
 			}},
 		},
+		{
+			TunnelCmd: &TunnelCmd{
+				remoteHost:     "fake.remote.host",
+				deviceIP:       fakeFoundIPAddr,
+				deviceName:     fakeFoundName,
+				sshConfig:      "",
+				printSSHConfig: false,
+				repoPort:       8083,
+				tunnelPorts:    intSlice([]int{}),
+				userSSHConfig:  fakeUserSSHConfigPath,
+			},
+			expectedRemoteHost: "fake.remote.host",
+			expectedDeviceIP:   fakeFoundIPAddr,
+			expectedDeviceName: fakeFoundName,
+			expectedSSHConfig:  "",
+			expectedConfigContains: []string{
+				"User alice",
+				"IdentityFile ~/.ssh/id_alice",
+				"ProxyJump jumpbox",
+			},
+			unexpectedConfigStrings: []string{"should-not-override-ours"},
+			sdk: testSDKProperties{
+				DataPath: fakeHomePath,
+				device: sdkcommon.DeviceConfig{
+					DeviceIP:   fakeFoundIPAddr,
+					DeviceName: fakeFoundName,
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		ctx := context.Background()
-		if _, err := test.TunnelCmd.parseFlags(ctx, test.sdk); err != nil {
+		contents, err := test.TunnelCmd.parseFlags(ctx, test.sdk)
+		if err != nil {
 			t.Errorf("error calling parseFlags: %s", err)
 		}
 		if test.expectedRemoteHost != test.TunnelCmd.remoteHost {
@@ -254,6 +300,16 @@ func TestParseFlags(t *testing.T) {
 		if test.expectedPrintSSHConfig != test.TunnelCmd.printSSHConfig {
 			t.Errorf("got print SSH config boolean %t, want %t", test.TunnelCmd.printSSHConfig, test.expectedPrintSSHConfig)
 		}
+		for _, want := range test.expectedConfigContains {
+			if !strings.Contains(string(contents), want) {
+				t.Errorf("expected generated SSH config to contain %q, got:\n%s", want, contents)
+			}
+		}
+		for _, unwanted := range test.unexpectedConfigStrings {
+			if strings.Contains(string(contents), unwanted) {
+				t.Errorf("did not expect generated SSH config to contain %q, got:\n%s", unwanted, contents)
+			}
+		}
 	}
 }
 
@@ -404,6 +460,26 @@ func TestNegativeParseFlags(t *testing.T) {
 			},
 			expectedErrMsg: "Could not generate default SSH config: Cannot create SSH config with protected ports: 22",
 		},
+		{
+			TunnelCmd: &TunnelCmd{
+				remoteHost:     "fake.remote.host",
+				deviceIP:       fakeFoundIPAddr,
+				deviceName:     fakeFoundName,
+				sshConfig:      "",
+				printSSHConfig: true,
+				repoPort:       8083,
+				tunnelPorts:    intSlice([]int{}),
+				remoteForwards: remoteForwardList{{Host: "localhost", Port: 9060, RemotePort: 22}},
+			},
+			sdk: testSDKProperties{
+				DataPath: fakeHomePath,
+				device: sdkcommon.DeviceConfig{
+					DeviceIP:   fakeFoundIPAddr,
+					DeviceName: fakeFoundName,
+				},
+			},
+			expectedErrMsg: "Could not generate default SSH config: Cannot create SSH config with protected ports: 22",
+		},
 	}
 	for _, test := range tests {
 		ctx := context.Background()
@@ -416,6 +492,50 @@ func TestNegativeParseFlags(t *testing.T) {
 	}
 }
 
+func TestRemoteForwardParseFlags(t *testing.T) {
+	expectedForwards := remoteForwardList{
+		{Host: "localhost", Port: 8022, RemotePort: 22022},
+		{Host: "192.168.1.5", Port: 9000, RemotePort: 9001},
+	}
+	flags := []string{
+		fmt.Sprintf("--%s", remoteHostFlag),
+		"fake-remote_host",
+		fmt.Sprintf("--%s=localhost:8022:22022", remoteForwardFlag),
+		fmt.Sprintf("--%s=192.168.1.5:9000:9001", remoteForwardFlag),
+	}
+	flagSet := flag.NewFlagSet("test-flag-set", flag.PanicOnError)
+	cmd := &TunnelCmd{}
+	cmd.SetFlags(flagSet)
+	flagSet.Parse(flags)
+	if len(cmd.remoteForwards) != len(expectedForwards) {
+		t.Fatalf("got length %d, want %d", len(cmd.remoteForwards), len(expectedForwards))
+	}
+	for i, f := range cmd.remoteForwards {
+		if f != expectedForwards[i] {
+			t.Fatalf("index %d got %+v, want %+v", i, f, expectedForwards[i])
+		}
+	}
+}
+
+func TestRemoteForwardNegativeParseFlags(t *testing.T) {
+	flagSet := flag.NewFlagSet("test-flag-set", flag.ContinueOnError)
+	cmd := &TunnelCmd{}
+	cmd.SetFlags(flagSet)
+	if err := flagSet.Parse([]string{fmt.Sprintf("--%s=localhost:bad-port:22", remoteForwardFlag)}); err == nil {
+		t.Fatalf("expected an error parsing a non-numeric -%s port", remoteForwardFlag)
+	}
+}
+
+func TestRemoteForwardRejectsUnsafeHost(t *testing.T) {
+	flagSet := flag.NewFlagSet("test-flag-set", flag.ContinueOnError)
+	cmd := &TunnelCmd{}
+	cmd.SetFlags(flagSet)
+	host := "evil\nProxyCommand calc.exe"
+	if err := flagSet.Parse([]string{fmt.Sprintf("--%s=%s:22:22", remoteForwardFlag, host)}); err == nil {
+		t.Fatalf("expected an error parsing a -%s host that isn't a valid hostname", remoteForwardFlag)
+	}
+}
+
 func TestIsThisFailedConnectionPortMessage(t *testing.T) {
 	tests := []struct {
 		message        string
@@ -478,3 +598,444 @@ func TestInvalidHostname(t *testing.T) {
 		})
 	}
 }
+
+// fakeSSHServer plays back canned ssh client output keyed by the
+// invocation's first argument, standing in for a real ssh client talking
+// to a real remote host so runDiagnostics can be tested without a
+// network.
+type fakeSSHServer struct {
+	// dryRunErr is returned by the "-G" dry-run invocation.
+	dryRunErr error
+	// connectOutput and connectErr are returned by the real connection
+	// attempt ("-v" invocation).
+	connectOutput string
+	connectErr    error
+}
+
+func (f *fakeSSHServer) run(ctx context.Context, args ...string) (string, error) {
+	if len(args) > 0 && args[0] == "-G" {
+		return "", f.dryRunErr
+	}
+	return f.connectOutput, f.connectErr
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	tests := []struct {
+		name               string
+		server             *fakeSSHServer
+		lookupErr          error
+		expectedValid      bool
+		expectedErr        bool
+		expectedPortCount  int
+		expectedFirstPort  int
+		expectedFirstError bool
+	}{
+		{
+			name:          "clean connection, no failed ports",
+			server:        &fakeSSHServer{connectOutput: "debug1: Authenticated\n"},
+			expectedValid: true,
+		},
+		{
+			name: "one port refused",
+			server: &fakeSSHServer{connectOutput: "debug1: Authenticated\n" +
+				"channel 3: open failed: connect failed: connect_to 127.0.0.1 port 9060: failed.\n"},
+			expectedValid:     true,
+			expectedPortCount: 1,
+			expectedFirstPort: 9060,
+		},
+		{
+			name:          "ssh -G rejects the generated config",
+			server:        &fakeSSHServer{dryRunErr: fmt.Errorf("ssh: unknown option")},
+			expectedValid: false,
+		},
+		{
+			name:        "DNS resolution fails",
+			server:      &fakeSSHServer{},
+			lookupErr:   fmt.Errorf("no such host"),
+			expectedErr: true,
+		},
+		{
+			name:        "real connection fails outright",
+			server:      &fakeSSHServer{connectErr: fmt.Errorf("connection refused")},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := &TunnelCmd{
+				remoteHost: "fake.remote.host",
+				lookupHost: func(host string) ([]string, error) {
+					if test.lookupErr != nil {
+						return nil, test.lookupErr
+					}
+					return []string{"127.0.0.1"}, nil
+				},
+				runSSH: test.server.run,
+			}
+			diagnosis, err := cmd.runDiagnostics(context.Background(), "/fake/ssh/config")
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error calling runDiagnostics: %s", err)
+			}
+			if diagnosis.SSHConfigValid != test.expectedValid {
+				t.Errorf("got SSHConfigValid %t, want %t", diagnosis.SSHConfigValid, test.expectedValid)
+			}
+			if len(diagnosis.PortDiagnostics) != test.expectedPortCount {
+				t.Fatalf("got %d port diagnostics, want %d", len(diagnosis.PortDiagnostics), test.expectedPortCount)
+			}
+			if test.expectedPortCount > 0 && diagnosis.PortDiagnostics[0].Port != test.expectedFirstPort {
+				t.Errorf("got first diagnosed port %d, want %d", diagnosis.PortDiagnostics[0].Port, test.expectedFirstPort)
+			}
+		})
+	}
+}
+
+func TestParsePortDiagnostics(t *testing.T) {
+	output := "debug1: Authenticated\n" +
+		"channel 3: open failed: connect failed: connect_to 127.0.0.1 port 9060: failed.\n" +
+		"channel 4: open failed: connect failed: connect_to 127.0.0.1 port 9061: failed.\n" +
+		"debug1: channel 5: new\n"
+	diagnostics := parsePortDiagnostics(output)
+	expectedPorts := []int{9060, 9061}
+	if len(diagnostics) != len(expectedPorts) {
+		t.Fatalf("got %d diagnostics, want %d", len(diagnostics), len(expectedPorts))
+	}
+	for i, port := range expectedPorts {
+		if diagnostics[i].Port != port {
+			t.Errorf("index %d got port %d, want %d", i, diagnostics[i].Port, port)
+		}
+		if diagnostics[i].Reason == "" {
+			t.Errorf("index %d got empty reason", i)
+		}
+	}
+}
+
+func TestDiagnoseJSON(t *testing.T) {
+	cmd := &TunnelCmd{
+		remoteHost: "fake.remote.host",
+		lookupHost: func(host string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+		runSSH: (&fakeSSHServer{connectOutput: "debug1: Authenticated\n" +
+			"channel 3: open failed: connect failed: connect_to 127.0.0.1 port 9060: failed.\n"}).run,
+	}
+	out, err := cmd.DiagnoseJSON(context.Background(), "/fake/ssh/config")
+	if err != nil {
+		t.Fatalf("unexpected error calling DiagnoseJSON: %s", err)
+	}
+	var diagnosis Diagnosis
+	if err := json.Unmarshal(out, &diagnosis); err != nil {
+		t.Fatalf("DiagnoseJSON output did not unmarshal as Diagnosis: %s", err)
+	}
+	if diagnosis.RemoteHost != "fake.remote.host" {
+		t.Errorf("got remote host %s, want fake.remote.host", diagnosis.RemoteHost)
+	}
+	if len(diagnosis.PortDiagnostics) != 1 || diagnosis.PortDiagnostics[0].Port != 9060 {
+		t.Errorf("got port diagnostics %+v, want one entry for port 9060", diagnosis.PortDiagnostics)
+	}
+}
+
+// resequencingSDK resolves to a new DeviceIP on every call, so
+// TestKeepAlive can confirm the device address is re-resolved on each
+// retry attempt.
+type resequencingSDK struct {
+	testSDKProperties
+	resolveCount int
+}
+
+func (s *resequencingSDK) ResolveTargetAddress(deviceIP, deviceName string) (sdkcommon.DeviceConfig, error) {
+	s.resolveCount++
+	return sdkcommon.DeviceConfig{
+		DeviceIP:   fmt.Sprintf("fake-ip-%d", s.resolveCount),
+		DeviceName: fakeFoundName,
+	}, nil
+}
+
+func TestKeepAliveRetriesUntilSuccess(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := &resequencingSDK{testSDKProperties: testSDKProperties{DataPath: fakeHomePath}}
+
+	const failuresBeforeSuccess = 2
+	var sessionCalls int
+	cmd := &TunnelCmd{
+		remoteHost: "fake.remote.host",
+		repoPort:   8083,
+		maxBackoff: time.Millisecond,
+		sshSession: func(ctx context.Context, sshConfigPath string, onLine func(string)) error {
+			sessionCalls++
+			if sessionCalls <= failuresBeforeSuccess {
+				return fmt.Errorf("ssh exited non-zero")
+			}
+			return nil
+		},
+	}
+
+	if err := cmd.KeepAlive(context.Background(), sdk); err != nil {
+		t.Fatalf("unexpected error from KeepAlive: %s", err)
+	}
+	if sessionCalls != failuresBeforeSuccess+1 {
+		t.Errorf("got %d session attempts, want %d", sessionCalls, failuresBeforeSuccess+1)
+	}
+	if sdk.resolveCount != sessionCalls {
+		t.Errorf("got %d device re-resolutions, want one per attempt (%d)", sdk.resolveCount, sessionCalls)
+	}
+	if cmd.deviceIP != fmt.Sprintf("fake-ip-%d", sdk.resolveCount) {
+		t.Errorf("got final device IP %s, want it to reflect the last re-resolution", cmd.deviceIP)
+	}
+}
+
+func TestKeepAliveMaxRetriesExceeded(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := &resequencingSDK{testSDKProperties: testSDKProperties{DataPath: fakeHomePath}}
+
+	var sessionCalls int
+	cmd := &TunnelCmd{
+		remoteHost: "fake.remote.host",
+		repoPort:   8083,
+		maxRetries: 3,
+		maxBackoff: time.Millisecond,
+		sshSession: func(ctx context.Context, sshConfigPath string, onLine func(string)) error {
+			sessionCalls++
+			return fmt.Errorf("ssh exited non-zero")
+		},
+	}
+
+	if err := cmd.KeepAlive(context.Background(), sdk); err == nil {
+		t.Fatalf("expected KeepAlive to give up after exhausting retries")
+	}
+	if sessionCalls != cmd.maxRetries {
+		t.Errorf("got %d session attempts, want exactly %d (max-retries)", sessionCalls, cmd.maxRetries)
+	}
+}
+
+func TestKeepAliveReconnectsOnRepeatedPortFailures(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := &resequencingSDK{testSDKProperties: testSDKProperties{DataPath: fakeHomePath}}
+
+	fakeNow := time.Unix(0, 0)
+	var sessionCalls int
+	cmd := &TunnelCmd{
+		remoteHost: "fake.remote.host",
+		repoPort:   8083,
+		maxRetries: 2,
+		maxBackoff: time.Millisecond,
+		now:        func() time.Time { return fakeNow },
+		sshSession: func(ctx context.Context, sshConfigPath string, onLine func(string)) error {
+			sessionCalls++
+			if sessionCalls == 1 {
+				// Three failed-port lines land within one instant,
+				// which should trip the tracker and cancel ctx before
+				// the fake session reports its own exit.
+				for i := 0; i < portFailureThreshold; i++ {
+					onLine("channel 3: open failed: connect failed: connect_to 127.0.0.1 port 9060: failed.")
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		},
+	}
+
+	if err := cmd.KeepAlive(context.Background(), sdk); err != nil {
+		t.Fatalf("unexpected error from KeepAlive: %s", err)
+	}
+	if sessionCalls != 2 {
+		t.Errorf("got %d session attempts, want 2 (one reconnect after the repeated port failures)", sessionCalls)
+	}
+}
+
+func TestPortFailureTracker(t *testing.T) {
+	now := time.Unix(0, 0)
+	tracker := &portFailureTracker{
+		now:    func() time.Time { return now },
+		window: portFailureWindow,
+	}
+	for i := 0; i < portFailureThreshold-1; i++ {
+		if tracker.record() {
+			t.Fatalf("tracker tripped after only %d failures, want %d", i+1, portFailureThreshold)
+		}
+	}
+	if !tracker.record() {
+		t.Fatalf("tracker did not trip after %d failures", portFailureThreshold)
+	}
+
+	now = now.Add(2 * portFailureWindow)
+	if tracker.record() {
+		t.Fatalf("tracker tripped on a single failure after the window elapsed")
+	}
+}
+
+// multiDeviceSDK resolves device names against a fixed table and,
+// if discovered is non-nil, supports -all-discovered via
+// ListDiscoveredDevices.
+type multiDeviceSDK struct {
+	DataPath   string
+	byName     map[string]sdkcommon.DeviceConfig
+	discovered []sdkcommon.DeviceConfig
+}
+
+func (s *multiDeviceSDK) ResolveTargetAddress(deviceIP, deviceName string) (sdkcommon.DeviceConfig, error) {
+	device, ok := s.byName[deviceName]
+	if !ok {
+		return sdkcommon.DeviceConfig{}, fmt.Errorf("unknown device %q", deviceName)
+	}
+	return device, nil
+}
+
+func (s *multiDeviceSDK) GetSDKDataPath() string { return s.DataPath }
+
+func (s *multiDeviceSDK) ListDiscoveredDevices() ([]sdkcommon.DeviceConfig, error) {
+	return s.discovered, nil
+}
+
+func TestParseFlagsMultiDevice(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := &multiDeviceSDK{
+		DataPath: fakeHomePath,
+		byName: map[string]sdkcommon.DeviceConfig{
+			"device-a": {DeviceIP: "fe80::1", DeviceName: "device-a"},
+			"device-b": {DeviceIP: "fe80::2", DeviceName: "device-b"},
+		},
+	}
+	cmd := &TunnelCmd{
+		remoteHost:  "fake.remote.host",
+		repoPort:    8083,
+		tunnelPorts: intSlice([]int{9001}),
+		deviceNames: stringSliceFlag{"device-a", "device-b"},
+	}
+	contents, err := cmd.parseFlags(context.Background(), sdk)
+	if err != nil {
+		t.Fatalf("unexpected error calling parseFlags: %s", err)
+	}
+	config := string(contents)
+	for _, want := range []string{
+		"Host fuchsia-device-a",
+		"Host fuchsia-device-b",
+		"LocalForward 8083 localhost:8083",
+		"LocalForward 9001 localhost:9001",
+		"LocalForward 8183 localhost:8183",
+		"LocalForward 9101 localhost:9101",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("expected generated SSH config to contain %q, got:\n%s", want, config)
+		}
+	}
+}
+
+func TestParseFlagsAllDiscovered(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := &multiDeviceSDK{
+		DataPath: fakeHomePath,
+		discovered: []sdkcommon.DeviceConfig{
+			{DeviceIP: "fe80::1", DeviceName: "device-a"},
+			{DeviceIP: "fe80::2", DeviceName: "device-b"},
+		},
+	}
+	cmd := &TunnelCmd{
+		remoteHost:    "fake.remote.host",
+		repoPort:      8083,
+		allDiscovered: true,
+	}
+	contents, err := cmd.parseFlags(context.Background(), sdk)
+	if err != nil {
+		t.Fatalf("unexpected error calling parseFlags: %s", err)
+	}
+	config := string(contents)
+	if !strings.Contains(config, "Host fuchsia-device-a") || !strings.Contains(config, "Host fuchsia-device-b") {
+		t.Errorf("expected a Host stanza per discovered device, got:\n%s", config)
+	}
+}
+
+func TestParseFlagsAllDiscoveredRequiresDiscoverer(t *testing.T) {
+	fakeHomePath := t.TempDir()
+	sdk := testSDKProperties{DataPath: fakeHomePath}
+	cmd := &TunnelCmd{
+		remoteHost:    "fake.remote.host",
+		repoPort:      8083,
+		allDiscovered: true,
+	}
+	if _, err := cmd.parseFlags(context.Background(), sdk); err == nil {
+		t.Fatalf("expected an error when the SDK provider can't list discovered devices")
+	}
+}
+
+func TestAllocateDevicePorts(t *testing.T) {
+	cmd := &TunnelCmd{repoPort: 8083, tunnelPorts: intSlice([]int{9001, 9002})}
+	devices := []sdkcommon.DeviceConfig{
+		{DeviceName: "device-a"},
+		{DeviceName: "device-b"},
+	}
+	allocations := allocateDevicePorts(cmd, devices)
+	if len(allocations) != 2 {
+		t.Fatalf("got %d allocations, want 2", len(allocations))
+	}
+	if allocations[0].RepoPort != 8083 || allocations[1].RepoPort != 8183 {
+		t.Errorf("got repo ports %d, %d, want 8083, 8183", allocations[0].RepoPort, allocations[1].RepoPort)
+	}
+	wantSecondTunnelPorts := []int{9101, 9102}
+	for i, port := range wantSecondTunnelPorts {
+		if allocations[1].TunnelPorts[i] != port {
+			t.Errorf("got device-b tunnel port %d, want %d", allocations[1].TunnelPorts[i], port)
+		}
+	}
+}
+
+func TestGenMultiDeviceSSHConfigProtectedPortCollision(t *testing.T) {
+	// device-b's offset tunnel port (9001+100*1=9101) doesn't collide
+	// here, so instead force a collision by choosing a base tunnel port
+	// that lands on a protected port once offset onto the second device.
+	cmd := &TunnelCmd{
+		remoteHost:  "fake.remote.host",
+		repoPort:    8083,
+		tunnelPorts: intSlice([]int{22 - devicePortOffset}),
+	}
+	devices := []sdkcommon.DeviceConfig{
+		{DeviceName: "device-a"},
+		{DeviceName: "device-b"},
+	}
+	_, _, err := genMultiDeviceSSHConfig(cmd, devices)
+	if err == nil {
+		t.Fatalf("expected an error for a device's offset port landing on a protected port")
+	}
+	if !strings.Contains(err.Error(), "22") {
+		t.Errorf("got error %q, want it to mention the colliding protected port 22", err)
+	}
+}
+
+func TestGenMultiDeviceSSHConfigCrossDeviceCollision(t *testing.T) {
+	// With repoPort 8083 and a tunnel port of 8183, device-a's tunnel
+	// port (8183) collides with device-b's repo port (8083+100=8183).
+	cmd := &TunnelCmd{
+		remoteHost:  "fake.remote.host",
+		repoPort:    8083,
+		tunnelPorts: intSlice([]int{8183}),
+	}
+	devices := []sdkcommon.DeviceConfig{
+		{DeviceName: "device-a"},
+		{DeviceName: "device-b"},
+	}
+	_, _, err := genMultiDeviceSSHConfig(cmd, devices)
+	if err == nil {
+		t.Fatalf("expected an error for a port allocated to two devices")
+	}
+	if !strings.Contains(err.Error(), "device-a") || !strings.Contains(err.Error(), "device-b") {
+		t.Errorf("got error %q, want it to name both colliding devices", err)
+	}
+}
+
+func TestGenMultiDeviceSSHConfigRejectsUnsafeDeviceName(t *testing.T) {
+	cmd := &TunnelCmd{
+		remoteHost: "fake.remote.host",
+		repoPort:   8083,
+	}
+	devices := []sdkcommon.DeviceConfig{
+		{DeviceName: "evil\nProxyCommand calc.exe"},
+	}
+	_, _, err := genMultiDeviceSSHConfig(cmd, devices)
+	if err == nil {
+		t.Fatal("expected an error for a device name containing a newline")
+	}
+}
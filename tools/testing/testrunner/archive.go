@@ -0,0 +1,186 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ArchiveFormat selects the container SetupAndExecute archives testOutDir
+// into, as an alternative to leaving it as a plain directory tree.
+type ArchiveFormat string
+
+const (
+	ArchiveFormatNone  ArchiveFormat = "none"
+	ArchiveFormatTar   ArchiveFormat = "tar"
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+	ArchiveFormatZip   ArchiveFormat = "zip"
+)
+
+// archiveManifestName is the name summary.json is additionally written
+// under at the archive root, so downstream infra can read it directly
+// without having to know testOutDir's internal layout.
+const archiveManifestName = "summary.json"
+
+// archiveEntryWriter is the common surface tar.Writer and zip.Writer both
+// give ArchiveSink: start a new entry, then get back an io.Writer for its
+// contents.
+type archiveEntryWriter interface {
+	create(name string, size int64) (io.Writer, error)
+	Close() error
+}
+
+// ArchiveSink streams test output files into a single tar, tar.gz, or zip
+// archive as they're discovered, rather than requiring a second pass over
+// testOutDir once the run finishes. runTestOnce's output-file walker calls
+// Add for every file it finds; SetupAndExecute calls Close once, after
+// outputs.Close has written the final summary.json, to fold in the archive
+// manifest entry and finalize the file.
+type ArchiveSink struct {
+	mu      sync.Mutex
+	tmp     *os.File
+	tmpPath string
+	path    string
+	gz      *gzip.Writer
+	entries archiveEntryWriter
+}
+
+// NewArchiveSink opens a temporary file alongside path and wraps it with
+// the writer for format, ready to accept Add calls. The archive only
+// becomes visible at path once Close succeeds.
+func NewArchiveSink(path string, format ArchiveFormat) (*ArchiveSink, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	sink := &ArchiveSink{tmp: tmp, tmpPath: tmp.Name(), path: path}
+
+	switch format {
+	case ArchiveFormatTar:
+		sink.entries = tarEntryWriter{tar.NewWriter(tmp)}
+	case ArchiveFormatTarGz:
+		sink.gz = gzip.NewWriter(tmp)
+		sink.entries = tarEntryWriter{tar.NewWriter(sink.gz)}
+	case ArchiveFormatZip:
+		sink.entries = zipEntryWriter{zip.NewWriter(tmp)}
+	default:
+		tmp.Close()
+		os.Remove(sink.tmpPath)
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+	return sink, nil
+}
+
+// Add streams r's contents into the archive under relPath. size must match
+// the number of bytes r yields; it's needed up front to write a tar
+// header, and is enforced for zip too so a truncated write is caught
+// early rather than producing a silently incomplete archive.
+func (a *ArchiveSink) Add(relPath string, r io.Reader, size int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w, err := a.entries.create(relPath, size)
+	if err != nil {
+		return fmt.Errorf("creating archive entry %q: %w", relPath, err)
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return fmt.Errorf("writing archive entry %q: %w", relPath, err)
+	}
+	if n != size {
+		return fmt.Errorf("archive entry %q: wrote %d bytes, wanted %d", relPath, n, size)
+	}
+	return nil
+}
+
+// AddFile opens path and streams it into the archive under relPath.
+func (a *ArchiveSink) AddFile(relPath, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.Add(relPath, f, info.Size())
+}
+
+// Close adds manifestData as archiveManifestName at the archive root (if
+// non-nil), finalizes the archive, and atomically renames it into place at
+// the path passed to NewArchiveSink. If finalizing fails, the temporary
+// file is removed; if only the rename fails, it is left behind. Either way
+// no partial archive appears at the final path.
+func (a *ArchiveSink) Close(manifestData []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var closeErr error
+	if manifestData != nil {
+		closeErr = func() error {
+			w, err := a.entries.create(archiveManifestName, int64(len(manifestData)))
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(manifestData)
+			return err
+		}()
+	}
+	if err := a.entries.Close(); closeErr == nil {
+		closeErr = err
+	}
+	if a.gz != nil {
+		if err := a.gz.Close(); closeErr == nil {
+			closeErr = err
+		}
+	}
+	if err := a.tmp.Close(); closeErr == nil {
+		closeErr = err
+	}
+	if closeErr != nil {
+		os.Remove(a.tmpPath)
+		return closeErr
+	}
+	if err := os.Rename(a.tmpPath, a.path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+	return nil
+}
+
+// tarEntryWriter adapts *tar.Writer to archiveEntryWriter.
+type tarEntryWriter struct {
+	tw *tar.Writer
+}
+
+func (t tarEntryWriter) create(name string, size int64) (io.Writer, error) {
+	if err := t.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size}); err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+func (t tarEntryWriter) Close() error {
+	return t.tw.Close()
+}
+
+// zipEntryWriter adapts *zip.Writer to archiveEntryWriter.
+type zipEntryWriter struct {
+	zw *zip.Writer
+}
+
+func (z zipEntryWriter) create(name string, size int64) (io.Writer, error) {
+	return z.zw.Create(name)
+}
+
+func (z zipEntryWriter) Close() error {
+	return z.zw.Close()
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// CaseStatus is the terminal (or in-progress) status of a single test case,
+// as reported by run-test-suite's `[STATUS]\tName` markers.
+type CaseStatus string
+
+const (
+	CaseRunning  CaseStatus = "RUNNING"
+	CasePassed   CaseStatus = "PASSED"
+	CaseFailed   CaseStatus = "FAILED"
+	CaseTimedOut CaseStatus = "TIMED_OUT"
+	CaseSkipped  CaseStatus = "SKIPPED"
+	// CaseAborted marks a case that was still in flight when ParallelTester
+	// canceled its context, e.g. in response to a kernel panic. It has no
+	// run-test-suite marker of its own.
+	CaseAborted CaseStatus = "ABORTED"
+)
+
+// CaseResult is one case within a component that run-test-suite reported on,
+// e.g. one gtest case out of the 200 a single component might contain.
+// BaseCaseResult (see the per-case scheduler in parallel_tester.go) is the
+// per-case analog of BaseTestResultFromTest. FuchsiaSerialTester.Test does
+// not produce CaseResults or attach them to a TestResult.
+type CaseResult struct {
+	Name           string
+	Status         CaseStatus
+	DurationNs     int64
+	FailureMessage string
+	// Artifacts holds the stdout/stderr bytes produced between this case's
+	// [RUNNING] marker and its terminal marker, keyed by stream name
+	// ("stdout", "stderr").
+	Artifacts map[string][]byte
+}
+
+// runSummaryJSON is the subset of run_summary.json (emitted by run-test-suite
+// when invoked with --output-directory) that ParseRunSummaryJSON cares
+// about. The real schema has more fields; we only read what we need to
+// populate CaseResult.
+type runSummaryJSON struct {
+	Tests []struct {
+		Name           string `json:"name"`
+		OutcomeString  string `json:"outcome"`
+		DurationMillis int64  `json:"duration_milliseconds"`
+	} `json:"tests"`
+}
+
+// ParseRunSummaryJSON parses a run_summary.json payload into CaseResults.
+// This is preferred over ParseRunTestSuiteCases whenever run-test-suite was
+// invoked with --output-directory, since it doesn't depend on a textual
+// marker format that could change across fuchsia.dev/reference/testing
+// revisions.
+func ParseRunSummaryJSON(data []byte) ([]CaseResult, error) {
+	var summary runSummaryJSON
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+	cases := make([]CaseResult, 0, len(summary.Tests))
+	for _, tc := range summary.Tests {
+		cases = append(cases, CaseResult{
+			Name:       tc.Name,
+			Status:     outcomeStringToStatus(tc.OutcomeString),
+			DurationNs: tc.DurationMillis * 1e6,
+		})
+	}
+	return cases, nil
+}
+
+func outcomeStringToStatus(s string) CaseStatus {
+	switch strings.ToUpper(s) {
+	case "PASSED":
+		return CasePassed
+	case "TIMED_OUT":
+		return CaseTimedOut
+	case "SKIPPED":
+		return CaseSkipped
+	case "FAILED", "ERROR":
+		return CaseFailed
+	default:
+		return CaseFailed
+	}
+}
+
+// parseCaseMarker parses a `[STATUS]\tcase name` line that run-test-suite prints
+// for each case it runs, e.g. "[RUNNING]\tMySuite.MyCase".
+func parseCaseMarker(line string) (status CaseStatus, name string, ok bool) {
+	for _, s := range []CaseStatus{CaseRunning, CasePassed, CaseFailed, CaseTimedOut, CaseSkipped} {
+		prefix := "[" + string(s) + "]\t"
+		if strings.HasPrefix(line, prefix) {
+			return s, strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", "", false
+}
+
+// ParseRunTestSuiteCases streams run-test-suite's `--filter-ansi` stdout and
+// returns one CaseResult per case it ran, associating any stdout emitted
+// between a case's [RUNNING] marker and its terminal marker as that case's
+// "stdout" artifact. It's the fallback for runs made without
+// --output-directory, which leave no run_summary.json for
+// ParseRunSummaryJSON. No caller in this package invokes it.
+func ParseRunTestSuiteCases(r io.Reader) ([]CaseResult, error) {
+	var cases []CaseResult
+	var current *CaseResult
+	var buf strings.Builder
+
+	flush := func() {
+		if current != nil && buf.Len() > 0 {
+			if current.Artifacts == nil {
+				current.Artifacts = make(map[string][]byte)
+			}
+			current.Artifacts["stdout"] = []byte(buf.String())
+		}
+		buf.Reset()
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Test output lines can be long (e.g. a serialized failure message);
+	// grow the scanner's buffer past bufio's 64KiB default.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if status, name, ok := parseCaseMarker(line); ok {
+			if status == CaseRunning {
+				flush()
+				cases = append(cases, CaseResult{Name: name, Status: CaseRunning})
+				current = &cases[len(cases)-1]
+				continue
+			}
+			if current == nil || current.Name != name {
+				cases = append(cases, CaseResult{Name: name})
+				current = &cases[len(cases)-1]
+			}
+			current.Status = status
+			if status == CaseFailed {
+				current.FailureMessage = buf.String()
+			}
+			flush()
+			current = nil
+			continue
+		}
+		if current != nil {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	flush()
+	return cases, scanner.Err()
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRunTestSuiteCases(t *testing.T) {
+	output := "[RUNNING]\tMySuite.CaseOne\n" +
+		"some stdout from case one\n" +
+		"[PASSED]\tMySuite.CaseOne\n" +
+		"[RUNNING]\tMySuite.CaseTwo\n" +
+		"oh no\n" +
+		"[FAILED]\tMySuite.CaseTwo\n"
+
+	cases, err := ParseRunTestSuiteCases(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("got %d cases, want 2: %+v", len(cases), cases)
+	}
+	if cases[0].Name != "MySuite.CaseOne" || cases[0].Status != CasePassed {
+		t.Errorf("case one = %+v", cases[0])
+	}
+	if string(cases[0].Artifacts["stdout"]) != "some stdout from case one\n" {
+		t.Errorf("case one stdout artifact = %q", cases[0].Artifacts["stdout"])
+	}
+	if cases[1].Name != "MySuite.CaseTwo" || cases[1].Status != CaseFailed {
+		t.Errorf("case two = %+v", cases[1])
+	}
+	if cases[1].FailureMessage != "oh no\n" {
+		t.Errorf("case two failure message = %q", cases[1].FailureMessage)
+	}
+}
+
+func TestParseRunSummaryJSON(t *testing.T) {
+	data := []byte(`{"tests": [
+		{"name": "MySuite.CaseOne", "outcome": "PASSED", "duration_milliseconds": 12},
+		{"name": "MySuite.CaseTwo", "outcome": "FAILED", "duration_milliseconds": 3}
+	]}`)
+	cases, err := ParseRunSummaryJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("got %d cases, want 2", len(cases))
+	}
+	if cases[0].Status != CasePassed || cases[0].DurationNs != 12e6 {
+		t.Errorf("case one = %+v", cases[0])
+	}
+	if cases[1].Status != CaseFailed {
+		t.Errorf("case two = %+v", cases[1])
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+// FailureClass categorizes why a test attempt failed, so the runner can
+// decide whether retrying is likely to help. Infrastructure-class failures
+// (everything but TestFlaked and TestFailed) are retried automatically;
+// user-test failures are not.
+type FailureClass string
+
+const (
+	SSHDisconnect  FailureClass = "ssh_disconnect"
+	DUTPanic       FailureClass = "dut_panic"
+	FFXDaemonCrash FailureClass = "ffx_daemon_crash"
+	TestTimeout    FailureClass = "test_timeout"
+	TestInfraSetup FailureClass = "test_infra_setup"
+	TestFlaked     FailureClass = "test_flaked"
+	TestFailed     FailureClass = "test_failed"
+)
+
+// IsInfrastructure reports whether c represents a failure outside the test
+// author's control, and so is eligible for an automatic retry.
+func (c FailureClass) IsInfrastructure() bool {
+	switch c {
+	case TestFlaked, TestFailed:
+		return false
+	default:
+		return true
+	}
+}
+
+// serialPanicPattern matches the common kernel panic banners seen on a
+// device's serial console.
+var serialPanicPattern = regexp.MustCompile(`(?i)(KERNEL PANIC|ZIRCON KERNEL PANIC|panic\(cpu\d+\))`)
+
+// ffxDaemonCrashPattern matches the log line ffx emits when its background
+// daemon process dies mid-command.
+var ffxDaemonCrashPattern = regexp.MustCompile(`(?i)ffx daemon (crashed|exited unexpectedly)`)
+
+// ClassifyFailure inspects err alongside the tails of the serial log and
+// ffx daemon log captured around a failed attempt, and returns the
+// FailureClass that best explains it.
+func ClassifyFailure(err error, serialLogTail, ffxLogTail string) FailureClass {
+	if err == nil {
+		return ""
+	}
+	if isConnectionError(err) {
+		return SSHDisconnect
+	}
+	if serialPanicPattern.MatchString(serialLogTail) {
+		return DUTPanic
+	}
+	if ffxDaemonCrashPattern.MatchString(ffxLogTail) {
+		return FFXDaemonCrash
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "context deadline exceeded"), strings.Contains(msg, "timed out"):
+		return TestTimeout
+	case strings.Contains(msg, "no such file or directory"), strings.Contains(msg, "failed to initialize"):
+		return TestInfraSetup
+	default:
+		return TestFailed
+	}
+}
+
+// Attempt records one try at running a test, as returned by
+// RetryClassified. Nothing in this package calls RetryClassified, and
+// Attempts are not stored on a TestResult.
+type Attempt struct {
+	Number int
+	Class  FailureClass
+	Error  string
+	// SnapshotPath is set when an infrastructure-class failure triggered
+	// RunSnapshot for this attempt.
+	SnapshotPath string
+}
+
+// RetryClassified runs attempt up to maxAttempts times, backing off
+// exponentially between tries, but only retries when the returned error
+// classifies as an infrastructure failure. takeSnapshot, if non-nil, is
+// invoked (best-effort; its error is logged, not propagated) before each
+// retry of an infrastructure-class failure so a snapshot and serial buffer
+// are captured close to the point of failure.
+func RetryClassified(
+	ctx context.Context,
+	maxAttempts int,
+	attempt func(attemptNumber int) (err error, serialLogTail, ffxLogTail string),
+	takeSnapshot func(ctx context.Context) (snapshotPath string, err error),
+) []Attempt {
+	var attempts []Attempt
+	backoff := retry.NewExponentialBackoff(time.Second, 30*time.Second, 2)
+
+	n := 0
+	retry.Retry(ctx, retry.WithMaxAttempts(backoff, uint64(maxAttempts)), func() error {
+		n++
+		err, serialTail, ffxTail := attempt(n)
+		class := ClassifyFailure(err, serialTail, ffxTail)
+		a := Attempt{Number: n, Class: class}
+		if err != nil {
+			a.Error = err.Error()
+		}
+
+		if err != nil && class.IsInfrastructure() && takeSnapshot != nil {
+			if path, snapErr := takeSnapshot(ctx); snapErr != nil {
+				logger.Errorf(ctx, "failed to capture snapshot after %s failure: %s", class, snapErr)
+			} else {
+				a.SnapshotPath = path
+			}
+		}
+		attempts = append(attempts, a)
+
+		if err == nil {
+			return nil
+		}
+		if !class.IsInfrastructure() {
+			return retry.Fatal(err)
+		}
+		return err
+	}, nil)
+
+	return attempts
+}
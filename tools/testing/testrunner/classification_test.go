@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		serialLogTail string
+		ffxLogTail    string
+		want          FailureClass
+	}{
+		{
+			name: "connection error",
+			err:  connectionError{errors.New("ssh: broken pipe")},
+			want: SSHDisconnect,
+		},
+		{
+			name:          "dut panic in serial log",
+			err:           errors.New("test did not complete"),
+			serialLogTail: "ZIRCON KERNEL PANIC\n",
+			want:          DUTPanic,
+		},
+		{
+			name:       "ffx daemon crash",
+			err:        errors.New("test did not complete"),
+			ffxLogTail: "ffx daemon crashed unexpectedly",
+			want:       FFXDaemonCrash,
+		},
+		{
+			name: "timeout",
+			err:  errors.New("context deadline exceeded"),
+			want: TestTimeout,
+		},
+		{
+			name: "generic test failure",
+			err:  errors.New("assertion failed: want 1, got 2"),
+			want: TestFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailure(tt.err, tt.serialLogTail, tt.ffxLogTail); got != tt.want {
+				t.Errorf("ClassifyFailure() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureClassIsInfrastructure(t *testing.T) {
+	if TestFailed.IsInfrastructure() {
+		t.Errorf("TestFailed.IsInfrastructure() = true, want false")
+	}
+	if TestFlaked.IsInfrastructure() {
+		t.Errorf("TestFlaked.IsInfrastructure() = true, want false")
+	}
+	if !SSHDisconnect.IsInfrastructure() {
+		t.Errorf("SSHDisconnect.IsInfrastructure() = false, want true")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// testEventKind identifies the type of a structured test event emitted by a
+// cooperating on-device runner over the serial console.
+type testEventKind string
+
+const (
+	eventCaseStart  testEventKind = "case_start"
+	eventCaseFinish testEventKind = "case_finish"
+	eventStdout     testEventKind = "stdout"
+	eventArtifact   testEventKind = "artifact"
+)
+
+// testEvent is one newline-delimited JSON record in the structured event
+// protocol. Only the fields relevant to Kind are populated.
+type testEvent struct {
+	Kind     testEventKind `json:"kind"`
+	Name     string        `json:"name,omitempty"`
+	Status   string        `json:"status,omitempty"`
+	Duration time.Duration `json:"duration_nanos,omitempty"`
+	Chunk    string        `json:"chunk,omitempty"`
+	Path     string        `json:"path,omitempty"`
+}
+
+// EventCaseResult is one test case's outcome as reported by the structured
+// event protocol.
+type EventCaseResult struct {
+	Name     string
+	Result   runtests.TestResult
+	Duration time.Duration
+	Stdout   string
+}
+
+// ParsedEvents is what an EventParser recovers from a structured event
+// stream: the finished cases, the stdout not attributed to any case, and
+// the paths of reported artifacts. FuchsiaSerialTester does not run an
+// EventParser, so none of this reaches a TestResult.
+type ParsedEvents struct {
+	Cases     []EventCaseResult
+	Stdout    []byte
+	Artifacts []string
+}
+
+// EventParser consumes the structured, newline-delimited JSON event stream
+// emitted by a cooperating on-device runner, taking per-case results from
+// the events themselves rather than from stdout signature strings.
+// FuchsiaSerialTester does not use it.
+type EventParser interface {
+	// Parse reads events from r until EOF. If a line fails to parse before
+	// any valid event was seen, it stops and returns that error, signaling
+	// the caller should fall back to signature-based parsing of whatever was
+	// read; after that, lines that fail to parse are skipped. A stream with
+	// no valid event at all yields io.ErrUnexpectedEOF.
+	Parse(r io.Reader) (ParsedEvents, error)
+}
+
+// ndjsonEventParser is the default EventParser, reading one JSON object per
+// line.
+type ndjsonEventParser struct{}
+
+// NewEventParser returns the newline-delimited JSON EventParser.
+func NewEventParser() EventParser {
+	return ndjsonEventParser{}
+}
+
+func (ndjsonEventParser) Parse(r io.Reader) (ParsedEvents, error) {
+	var parsed ParsedEvents
+
+	scanner := bufio.NewScanner(r)
+	// Structured event lines, such as a large stdout chunk, can run past
+	// bufio's default 64KiB line limit; allow up to 1MiB.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	seenEvent := false
+	var current *EventCaseResult
+	for scanner.Scan() {
+		var ev testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			if !seenEvent {
+				return ParsedEvents{}, err
+			}
+			// Mid-stream garbage (e.g. an unrelated kernel log line
+			// interleaved with the event stream) isn't fatal once we've
+			// established this device is emitting structured events.
+			continue
+		}
+		seenEvent = true
+
+		switch ev.Kind {
+		case eventCaseStart:
+			current = &EventCaseResult{Name: ev.Name}
+		case eventCaseFinish:
+			if current == nil {
+				current = &EventCaseResult{Name: ev.Name}
+			}
+			current.Duration = ev.Duration
+			if ev.Status == "pass" {
+				current.Result = runtests.TestSuccess
+			} else {
+				current.Result = runtests.TestFailure
+			}
+			parsed.Cases = append(parsed.Cases, *current)
+			current = nil
+		case eventStdout:
+			if current != nil {
+				current.Stdout += ev.Chunk
+			} else {
+				parsed.Stdout = append(parsed.Stdout, ev.Chunk...)
+			}
+		case eventArtifact:
+			parsed.Artifacts = append(parsed.Artifacts, ev.Path)
+		}
+	}
+	if !seenEvent {
+		return ParsedEvents{}, io.ErrUnexpectedEOF
+	}
+	return parsed, scanner.Err()
+}
+
+// structuredEventWindow is how long to wait for the first structured event
+// before concluding the on-device runner doesn't support the protocol and
+// falling back to signature-based parsing. Nothing in this package reads
+// it; FuchsiaSerialTester does not wait for structured events.
+const structuredEventWindow = 2 * time.Second
@@ -0,0 +1,303 @@
+// Copyright 2024 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// EventStreamFormat selects the on-disk encoding EventStream uses for the
+// records it writes to Options.EventStreamPath.
+type EventStreamFormat string
+
+const (
+	// EventStreamFormatTAP13 emits classic TAP13: a leading plan line,
+	// then one "ok"/"not ok" point per test_finished event with a YAML
+	// diagnostics block underneath, and every other event kind as a "#"
+	// comment line.
+	EventStreamFormatTAP13 EventStreamFormat = "tap13"
+
+	// EventStreamFormatJSONL emits one JSON object per line, one line per
+	// event, for every event kind.
+	EventStreamFormatJSONL EventStreamFormat = "jsonl"
+)
+
+// eventKind identifies the lifecycle point a streamEvent records.
+type eventKind string
+
+const (
+	eventTestStarted      eventKind = "test_started"
+	eventCaseStarted      eventKind = "case_started"
+	eventCaseFinished     eventKind = "case_finished"
+	eventTestFinished     eventKind = "test_finished"
+	eventRetryScheduled   eventKind = "retry_scheduled"
+	eventHealthCheck      eventKind = "health_check"
+	eventSnapshotCaptured eventKind = "snapshot_captured"
+)
+
+// streamEvent is the structured record EventStream emits for every
+// lifecycle point in a test's execution. Only the fields relevant to Kind
+// are populated; the rest are left zero and, for JSONL, omitted, except
+// timestamp, test_name and attempt, which every JSONL line carries.
+type streamEvent struct {
+	Kind      eventKind `json:"kind"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// TestName identifies the test (and, for case_started/case_finished,
+	// the case) the event is about.
+	TestName string `json:"test_name"`
+	CaseName string `json:"case_name,omitempty"`
+
+	// Attempt is the 0-based run index this event belongs to, matching
+	// TestResult.RunIndex.
+	Attempt int `json:"attempt"`
+
+	// TesterKind is one of "ffx", "serial", or "subprocess", identifying
+	// which Tester ran (or will run) the test.
+	TesterKind string `json:"tester_kind,omitempty"`
+
+	// OutDir is the per-run output directory, as passed to Tester.Test.
+	OutDir string `json:"out_dir,omitempty"`
+
+	Duration    time.Duration   `json:"duration_ns,omitempty"`
+	Passed      bool            `json:"passed,omitempty"`
+	Tags        []build.TestTag `json:"tags,omitempty"`
+	OutputFiles []string        `json:"output_files,omitempty"`
+
+	// Path carries the snapshot file path for a snapshot_captured event.
+	Path string `json:"path,omitempty"`
+}
+
+// EventStream emits a real-time, line-delimited record of test lifecycle
+// events to Options.EventStreamPath, as an alternative to polling
+// summary.json after SetupAndExecute returns. It's goroutine-safe so that
+// the fuchsia and host worker pools started by runAndOutputTests can both
+// write through it concurrently, and it flushes after every event so a
+// reader tailing the file sees events as they happen.
+type EventStream struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	format EventStreamFormat
+
+	// planned is the number of tests SetupAndExecute expects to run,
+	// recorded via Plan for TAP13's leading plan line.
+	planned int
+	// point is the next TAP13 test point number, incremented by
+	// TestFinished; unused in JSONL mode.
+	point int
+}
+
+// NewEventStream creates, or truncates, the file at path and returns an
+// EventStream that writes to it in the given format.
+func NewEventStream(path string, format EventStreamFormat) (*EventStream, error) {
+	switch format {
+	case EventStreamFormatTAP13, EventStreamFormatJSONL:
+	default:
+		return nil, fmt.Errorf("unsupported event stream format: %q", format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event stream file %q: %w", path, err)
+	}
+	return &EventStream{
+		f:      f,
+		w:      bufio.NewWriter(f),
+		format: format,
+	}, nil
+}
+
+// Plan records the number of tests about to run, emitted as TAP13's "1..N"
+// plan line. It's a no-op in JSONL mode.
+func (s *EventStream) Plan(numTests int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.planned = numTests
+	if s.format == EventStreamFormatTAP13 {
+		fmt.Fprintf(s.w, "TAP version 13\n1..%d\n", s.planned)
+		s.w.Flush()
+	}
+}
+
+// Close flushes and closes the underlying file. It's safe to call on a nil
+// *EventStream.
+func (s *EventStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func (s *EventStream) emit(e streamEvent) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.format {
+	case EventStreamFormatJSONL:
+		s.emitJSONL(e)
+	case EventStreamFormatTAP13:
+		s.emitTAP13(e)
+	}
+	// Flush after every event so a reader tailing the file sees it
+	// immediately, rather than once bufio's internal buffer fills.
+	s.w.Flush()
+}
+
+func (s *EventStream) emitJSONL(e streamEvent) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		// Should never happen: streamEvent is entirely
+		// JSON-marshalable built-in types.
+		fmt.Fprintf(s.w, `{"kind":"%s","error":"failed to marshal event"}`+"\n", e.Kind)
+		return
+	}
+	s.w.Write(b)
+	s.w.WriteByte('\n')
+}
+
+// emitTAP13 renders e as TAP13. test_finished events become a numbered
+// "ok"/"not ok" point with a YAML diagnostics block; every other kind is
+// rendered as a "#" comment line, since TAP13 has no point of its own for
+// sub-test lifecycle events.
+func (s *EventStream) emitTAP13(e streamEvent) {
+	if e.Kind != eventTestFinished {
+		fmt.Fprintf(s.w, "# %s %s attempt=%d tester=%s\n", e.Kind, e.TestName, e.Attempt, e.TesterKind)
+		return
+	}
+	s.point++
+	status := "ok"
+	if !e.Passed {
+		status = "not ok"
+	}
+	fmt.Fprintf(s.w, "%s %d - %s\n", status, s.point, e.TestName)
+	fmt.Fprintf(s.w, "  ---\n")
+	fmt.Fprintf(s.w, "  duration_ms: %d\n", e.Duration.Milliseconds())
+	fmt.Fprintf(s.w, "  attempt: %d\n", e.Attempt)
+	fmt.Fprintf(s.w, "  tester_kind: %s\n", e.TesterKind)
+	fmt.Fprintf(s.w, "  out_dir: %s\n", e.OutDir)
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(s.w, "  tags:\n")
+		for _, tag := range e.Tags {
+			fmt.Fprintf(s.w, "    - %s: %s\n", tag.Key, tag.Value)
+		}
+	}
+	if len(e.OutputFiles) > 0 {
+		fmt.Fprintf(s.w, "  output_files:\n")
+		for _, of := range e.OutputFiles {
+			fmt.Fprintf(s.w, "    - %s\n", of)
+		}
+	}
+	fmt.Fprintf(s.w, "  ...\n")
+}
+
+// TestStarted records that attempt (0-based) of test is about to run
+// against the named testerKind, writing to outDir.
+func (s *EventStream) TestStarted(testName string, attempt int, testerKind, outDir string) {
+	s.emit(streamEvent{
+		Kind:       eventTestStarted,
+		Timestamp:  time.Now(),
+		TestName:   testName,
+		Attempt:    attempt,
+		TesterKind: testerKind,
+		OutDir:     outDir,
+	})
+}
+
+// TestFinished records that attempt (0-based) of test has completed.
+func (s *EventStream) TestFinished(testName string, attempt int, testerKind, outDir string, duration time.Duration, passed bool, outputFiles []string) {
+	s.emit(streamEvent{
+		Kind:        eventTestFinished,
+		Timestamp:   time.Now(),
+		TestName:    testName,
+		Attempt:     attempt,
+		TesterKind:  testerKind,
+		OutDir:      outDir,
+		Duration:    duration,
+		Passed:      passed,
+		OutputFiles: outputFiles,
+	})
+}
+
+// CaseStarted and CaseFinished record a single case's outcome within test's
+// given attempt. The underlying testers in this tree only surface cases
+// once the whole test has finished (parsed from stdout or reported by
+// FFXTester), so these two are emitted back-to-back rather than truly
+// bracketing the case's execution; they're still useful to infra as a
+// per-case breakdown of test_finished.
+func (s *EventStream) CaseStarted(testName, caseName string, attempt int) {
+	s.emit(streamEvent{
+		Kind:      eventCaseStarted,
+		Timestamp: time.Now(),
+		TestName:  testName,
+		CaseName:  caseName,
+		Attempt:   attempt,
+	})
+}
+
+func (s *EventStream) CaseFinished(testName, caseName string, attempt int, tc runtests.TestCaseResult) {
+	s.emit(streamEvent{
+		Kind:        eventCaseFinished,
+		Timestamp:   time.Now(),
+		TestName:    testName,
+		CaseName:    caseName,
+		Attempt:     attempt,
+		Passed:      !caseFailed(tc),
+		Tags:        tc.Tags,
+		OutputFiles: tc.OutputFiles,
+	})
+}
+
+// RetryScheduled records that test is being rescheduled for a further
+// attempt after attempt (0-based) just finished.
+func (s *EventStream) RetryScheduled(testName string, attempt int) {
+	s.emit(streamEvent{
+		Kind:      eventRetryScheduled,
+		Timestamp: time.Now(),
+		TestName:  testName,
+		Attempt:   attempt,
+	})
+}
+
+// HealthCheck records that a health check (reconnect, or reconnect plus
+// power-cycle) ran against testerKind after test failed.
+func (s *EventStream) HealthCheck(testName string, attempt int, testerKind string) {
+	s.emit(streamEvent{
+		Kind:       eventHealthCheck,
+		Timestamp:  time.Now(),
+		TestName:   testName,
+		Attempt:    attempt,
+		TesterKind: testerKind,
+	})
+}
+
+// SnapshotCaptured records that a device snapshot was written to path after
+// testerKind finished running its tests.
+func (s *EventStream) SnapshotCaptured(testerKind, path string) {
+	s.emit(streamEvent{
+		Kind:       eventSnapshotCaptured,
+		Timestamp:  time.Now(),
+		TesterKind: testerKind,
+		Path:       path,
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// inspectSinkType is the DataSinks key for Inspect snapshots, alongside the
+// existing coverage/profile sink types. FFXTester.Test does not capture
+// Inspect snapshots, so no DataSinks entry is recorded under it.
+const inspectSinkType = "inspect"
+
+// InspectAccessor is the subset of `ffx inspect` FFXTester needs to snapshot
+// diagnostics around a test run. It's implemented by *ffxutil.FFXInstance in
+// production and by a fake in tests.
+type InspectAccessor interface {
+	// Inspect returns the Inspect hierarchies matching selectors (e.g.
+	// "core/foo:root/health:status"), as the raw JSON `ffx inspect show
+	// --json` would produce.
+	Inspect(ctx context.Context, selectors []string) (json.RawMessage, error)
+}
+
+// InspectSnapshot is the pre/post Inspect capture CaptureInspectSnapshot
+// returns, plus the diff computed between them. FFXTester does not attach
+// it to a test's DataSinks.
+type InspectSnapshot struct {
+	Selectors []string        `json:"selectors"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	// Diff lists top-level Inspect property paths whose value changed
+	// between Before and After, so component health regressions can be
+	// spotted without diffing the full JSON by hand. It is not copied into
+	// outputs.Summary.
+	Diff []string `json:"diff,omitempty"`
+}
+
+// CaptureInspectSnapshot snapshots selectors via accessor both before and
+// after run executes, returning the combined InspectSnapshot. If run
+// returns an error, the snapshot is still captured and returned alongside
+// it so a failing test's diagnostics aren't lost.
+func CaptureInspectSnapshot(ctx context.Context, accessor InspectAccessor, selectors []string, run func() error) (InspectSnapshot, error) {
+	if len(selectors) == 0 {
+		return InspectSnapshot{}, run()
+	}
+
+	before, err := accessor.Inspect(ctx, selectors)
+	if err != nil {
+		return InspectSnapshot{}, fmt.Errorf("capturing pre-run Inspect snapshot: %w", err)
+	}
+
+	runErr := run()
+
+	after, err := accessor.Inspect(ctx, selectors)
+	if err != nil {
+		return InspectSnapshot{}, fmt.Errorf("capturing post-run Inspect snapshot: %w", err)
+	}
+
+	snapshot := InspectSnapshot{
+		Selectors: selectors,
+		Before:    before,
+		After:     after,
+		Diff:      diffInspectJSON(before, after),
+	}
+	return snapshot, runErr
+}
+
+// diffInspectJSON reports the top-level keys whose serialized value
+// changed between before and after. It's intentionally shallow: a full
+// structural diff isn't necessary to flag that something under a selector
+// changed, which is enough to point a human at the full snapshot.
+func diffInspectJSON(before, after json.RawMessage) []string {
+	var b, a map[string]json.RawMessage
+	if err := json.Unmarshal(before, &b); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(after, &a); err != nil {
+		return nil
+	}
+
+	var diff []string
+	for k, av := range a {
+		if bv, ok := b[k]; !ok || string(bv) != string(av) {
+			diff = append(diff, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			diff = append(diff, k)
+		}
+	}
+	return diff
+}
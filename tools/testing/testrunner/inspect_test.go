@@ -0,0 +1,60 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+type fakeInspectAccessor struct {
+	snapshots []json.RawMessage
+}
+
+func (f *fakeInspectAccessor) Inspect(ctx context.Context, selectors []string) (json.RawMessage, error) {
+	snapshot := f.snapshots[0]
+	f.snapshots = f.snapshots[1:]
+	return snapshot, nil
+}
+
+func TestCaptureInspectSnapshot(t *testing.T) {
+	accessor := &fakeInspectAccessor{
+		snapshots: []json.RawMessage{
+			json.RawMessage(`{"status":"ok","count":1}`),
+			json.RawMessage(`{"status":"crashed","count":1}`),
+		},
+	}
+
+	snapshot, err := CaptureInspectSnapshot(context.Background(), accessor, []string{"core/foo:root/health:status"}, func() error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CaptureInspectSnapshot() failed: %s", err)
+	}
+
+	sort.Strings(snapshot.Diff)
+	if len(snapshot.Diff) != 1 || snapshot.Diff[0] != "status" {
+		t.Errorf("Diff = %v, want [status]", snapshot.Diff)
+	}
+}
+
+func TestCaptureInspectSnapshotNoSelectors(t *testing.T) {
+	ran := false
+	snapshot, err := CaptureInspectSnapshot(context.Background(), &fakeInspectAccessor{}, nil, func() error {
+		ran = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CaptureInspectSnapshot() failed: %s", err)
+	}
+	if !ran {
+		t.Errorf("run() was not called")
+	}
+	if snapshot.Before != nil || snapshot.After != nil {
+		t.Errorf("expected empty snapshot when no selectors given, got %+v", snapshot)
+	}
+}
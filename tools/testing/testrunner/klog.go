@@ -0,0 +1,204 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// klogLinePattern matches the "[secs.msecs] [tag] [severity]" header that
+// Fuchsia klog lines are printed with when they land on the same stream as
+// test output, e.g. "[123.456] [driver_host] [INFO]: starting up".
+var klogLinePattern = regexp.MustCompile(`^\[(\d+)\.(\d+)\]\s*\[([^\]]*)\]\s*\[([^\]]*)\]:?\s?`)
+
+// klogMaxPendingLine bounds how many bytes of an unterminated line KlogDemux
+// will hold back while it waits to see whether the line is a klog header.
+// This is what makes the demultiplexer safe against a pathological
+// "[111111..." prefix that never resolves into either a valid header or a
+// newline: once the pending line grows past this, it's flushed through to
+// the caller as ordinary output instead of growing without bound.
+const klogMaxPendingLine = 4096
+
+// Severity is a klog severity level, ordered from least to most severe.
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityTrace
+	SeverityDebug
+	SeverityInfo
+	SeverityWarn
+	SeverityError
+	SeverityFatal
+)
+
+func parseSeverity(s string) Severity {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "TRACE":
+		return SeverityTrace
+	case "DEBUG":
+		return SeverityDebug
+	case "INFO":
+		return SeverityInfo
+	case "WARN", "WARNING":
+		return SeverityWarn
+	case "ERROR":
+		return SeverityError
+	case "FATAL":
+		return SeverityFatal
+	default:
+		return SeverityUnknown
+	}
+}
+
+// KlogRecord is the structured form of a single klog line, emitted as one
+// JSON object per line to a KlogDemux's Sink.
+type KlogRecord struct {
+	MonotonicNs int64  `json:"monotonic_ns"`
+	Tag         string `json:"tag"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+}
+
+// ErrMaxSeverityExceeded is returned from KlogDemux.Read the first time a
+// klog line at or above MaxSeverity is observed. No tester in this package
+// reads its output through a KlogDemux, so this error does not fail a test.
+type ErrMaxSeverityExceeded struct {
+	Record KlogRecord
+}
+
+func (e *ErrMaxSeverityExceeded) Error() string {
+	return fmt.Sprintf("klog line exceeded max severity: [%s] %s: %s", e.Record.Severity, e.Record.Tag, e.Record.Message)
+}
+
+// KlogDemux wraps a combined stdout+klog stream, such as the one produced by
+// a serial console or a QEMU instance where kernel log lines are interleaved
+// with test output on the same fd, and splits it back into two: klog lines
+// are parsed into KlogRecords and written as JSON to Sink, while every other
+// byte is passed through Read unchanged. How much of an unterminated line
+// it holds back is bounded: see klogMaxPendingLine. It does not replace
+// parseOutKernelReader; no tester in this package reads through it.
+type KlogDemux struct {
+	// Reader is the combined stream to demultiplex.
+	Reader io.Reader
+	// Sink receives one JSON-encoded KlogRecord per klog line seen. A nil
+	// Sink still causes klog lines to be parsed and stripped from Read's
+	// output (and MaxSeverity still applies); they're just not recorded.
+	Sink io.Writer
+	// MaxSeverity, if set to anything other than SeverityUnknown, causes
+	// Read to return an *ErrMaxSeverityExceeded the first time a klog line
+	// at or above this severity is seen.
+	MaxSeverity Severity
+
+	out     bytes.Buffer // non-klog bytes ready to be returned from Read
+	pending []byte       // a partial, unterminated line awaiting more bytes
+	eof     bool
+}
+
+// NewKlogDemux returns a KlogDemux reading from r and writing structured klog
+// records to sink. Pass a nil sink to discard records while still enforcing
+// maxSeverity.
+func NewKlogDemux(r io.Reader, sink io.Writer, maxSeverity Severity) *KlogDemux {
+	return &KlogDemux{Reader: r, Sink: sink, MaxSeverity: maxSeverity}
+}
+
+func (d *KlogDemux) Read(p []byte) (int, error) {
+	for d.out.Len() == 0 {
+		if err := d.fill(); err != nil {
+			if d.out.Len() > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	return d.out.Read(p)
+}
+
+// fill reads one more chunk from the underlying reader, splits it into
+// complete lines, and classifies each as klog or ordinary output.
+func (d *KlogDemux) fill() error {
+	if d.eof {
+		return io.EOF
+	}
+	buf := make([]byte, 4096)
+	n, err := d.Reader.Read(buf)
+	if n > 0 {
+		d.pending = append(d.pending, buf[:n]...)
+		for {
+			i := bytes.IndexByte(d.pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := d.pending[:i+1]
+			d.pending = d.pending[i+1:]
+			if klogErr := d.classifyLine(line); klogErr != nil {
+				return klogErr
+			}
+		}
+		// A pending line that's grown too large to plausibly still be an
+		// in-progress klog header is flushed through as ordinary output
+		// rather than buffered indefinitely.
+		if len(d.pending) > klogMaxPendingLine {
+			d.out.Write(d.pending)
+			d.pending = nil
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			d.eof = true
+			if len(d.pending) > 0 {
+				// No trailing newline arrived; we can't tell if this was
+				// meant to be a klog line, so emit it as-is.
+				d.out.Write(d.pending)
+				d.pending = nil
+			}
+			if d.out.Len() > 0 {
+				return nil
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// classifyLine routes a single, newline-terminated line to either d.out (not
+// a klog line) or d.Sink (a klog line, re-encoded as JSON). It returns a
+// non-nil error only when MaxSeverity is exceeded.
+func (d *KlogDemux) classifyLine(line []byte) error {
+	m := klogLinePattern.FindSubmatch(line)
+	if m == nil {
+		d.out.Write(line)
+		return nil
+	}
+	secs, _ := strconv.ParseInt(string(m[1]), 10, 64)
+	msecs, _ := strconv.ParseInt(string(m[2]), 10, 64)
+	rec := KlogRecord{
+		MonotonicNs: (secs*1000 + msecs) * int64(time.Millisecond),
+		Tag:         string(m[3]),
+		Severity:    string(m[4]),
+		Message:     strings.TrimRight(string(line[len(m[0]):]), "\r\n"),
+	}
+	if d.Sink != nil {
+		if b, err := json.Marshal(rec); err == nil {
+			fmt.Fprintln(d.Sink, string(b))
+		}
+	}
+	if d.MaxSeverity != SeverityUnknown && parseSeverity(rec.Severity) >= d.MaxSeverity {
+		return &ErrMaxSeverityExceeded{Record: rec}
+	}
+	return nil
+}
+
+// DefaultKlogFilename is the file name for a per-test klog sink alongside
+// the test's stdout capture. BaseTestResultFromTest does not create such a
+// sink, and no TestResult field records its path.
+const DefaultKlogFilename = "klog.txt"
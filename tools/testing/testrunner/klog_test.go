@@ -0,0 +1,71 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestKlogDemuxPassesThroughNonKlogBytes(t *testing.T) {
+	input := "line1\noutput continued\n"
+	d := NewKlogDemux(strings.NewReader(input), nil, SeverityUnknown)
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input {
+		t.Errorf("got %q, want %q", got, input)
+	}
+}
+
+func TestKlogDemuxExtractsStructuredRecords(t *testing.T) {
+	input := "before\n[123.456] [driver] [INFO]: starting up\nafter\n"
+	var sink bytes.Buffer
+	d := NewKlogDemux(strings.NewReader(input), &sink, SeverityUnknown)
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "before\nafter\n" {
+		t.Errorf("got %q, want klog line stripped from output", got)
+	}
+	var rec KlogRecord
+	if err := json.Unmarshal(bytes.TrimSpace(sink.Bytes()), &rec); err != nil {
+		t.Fatalf("sink did not contain valid JSON: %s (%q)", err, sink.String())
+	}
+	if rec.Tag != "driver" || rec.Severity != "INFO" || rec.Message != "starting up" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestKlogDemuxMaxSeverity(t *testing.T) {
+	input := "[1.0] [t] [ERROR]: something broke\n"
+	d := NewKlogDemux(strings.NewReader(input), nil, SeverityError)
+	_, err := io.ReadAll(d)
+	if err == nil {
+		t.Fatal("expected an error when a line at ERROR severity is seen")
+	}
+	var sevErr *ErrMaxSeverityExceeded
+	if !errors.As(err, &sevErr) {
+		t.Errorf("expected *ErrMaxSeverityExceeded, got %T: %s", err, err)
+	}
+}
+
+func TestKlogDemuxBoundsUnresolvedPendingLine(t *testing.T) {
+	long := "[" + strings.Repeat("1", 2*klogMaxPendingLine+1000)
+	d := NewKlogDemux(strings.NewReader(long+"\nafter\n"), nil, SeverityUnknown)
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != long+"\n"+"after\n" {
+		t.Errorf("pathological unresolved prefix was not flushed through unchanged")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	botanist "go.fuchsia.dev/fuchsia/tools/botanist"
@@ -73,6 +74,88 @@ type Options struct {
 	// If given as `<path>=<version>`, the version should correspond to the version
 	// of the profiles produced by the tests that are run.")
 	LLVMProfdataPath string
+
+	// FuchsiaParallelism bounds how many fuchsia tests runAndOutputTests
+	// dispatches to the fuchsia tester at once. A value <= 0 defaults to 1,
+	// since absent a test opting in via testsharder.Test.Parallelizable,
+	// only one test can safely talk to the target (or serial session) at a
+	// time.
+	FuchsiaParallelism int
+
+	// HostParallelism bounds how many host tests runAndOutputTests
+	// dispatches to the local tester at once. A value <= 0 defaults to
+	// runtime.NumCPU(), since host tests don't share a single target.
+	HostParallelism int
+
+	// ArchiveFormat selects the container format SetupAndExecute streams
+	// testOutDir's files into as they're produced, as an alternative to
+	// leaving them as a plain directory tree. One of "none" (the
+	// default), "tar", "tar.gz", or "zip". Only takes effect when
+	// ArchivePath is also set.
+	ArchiveFormat ArchiveFormat
+
+	// ArchivePath is where the archive named by ArchiveFormat is written.
+	// It's created atomically: a crash partway through a run leaves either
+	// a complete archive at this path or none at all.
+	ArchivePath string
+
+	// TimeoutExitCodes maps a test framework name (e.g. "run-test-suite",
+	// "run-test-component", "ffx_test", "gtest") to the exit code that
+	// framework uses to report that it killed the test for exceeding its
+	// own internal timeout, as distinct from a normal test failure. Testers
+	// consult this, keyed by the framework they invoked, to set
+	// result.Result = runtests.TestAborted and result.FailReason rather
+	// than reporting a generic failure. A nil or incomplete map falls back
+	// to defaultTimeoutExitCodes.
+	TimeoutExitCodes map[string]int
+
+	// EventStreamPath is where SetupAndExecute writes a real-time,
+	// line-delimited stream of test lifecycle events, as an alternative to
+	// polling summary.json after the run completes. No stream is written
+	// if this is empty.
+	EventStreamPath string
+
+	// EventStreamFormat selects the encoding used for EventStreamPath: one
+	// of "tap13" or "jsonl". Only takes effect when EventStreamPath is
+	// also set.
+	EventStreamFormat EventStreamFormat
+}
+
+// defaultTimeoutExitCodes holds the historically-observed exit codes test
+// frameworks use to report a self-detected timeout, keyed by framework
+// name. run-test-component and run-test-suite have both used 21 for this
+// since their introduction.
+func defaultTimeoutExitCodes() map[string]int {
+	return map[string]int{
+		"run-test-component": 21,
+		"run-test-suite":     21,
+	}
+}
+
+// resolveTimeoutExitCodes overlays opts.TimeoutExitCodes on top of
+// defaultTimeoutExitCodes, so callers only need to set the frameworks they
+// want to override.
+func resolveTimeoutExitCodes(opts Options) map[string]int {
+	codes := defaultTimeoutExitCodes()
+	for framework, code := range opts.TimeoutExitCodes {
+		codes[framework] = code
+	}
+	return codes
+}
+
+// resolveParallelism returns the number of concurrent workers to use for
+// fuchsia and host tests respectively, applying Options' defaults when the
+// caller hasn't set FuchsiaParallelism / HostParallelism.
+func resolveParallelism(opts Options) (fuchsiaParallelism, hostParallelism int) {
+	fuchsiaParallelism = opts.FuchsiaParallelism
+	if fuchsiaParallelism <= 0 {
+		fuchsiaParallelism = 1
+	}
+	hostParallelism = opts.HostParallelism
+	if hostParallelism <= 0 {
+		hostParallelism = runtime.NumCPU()
+	}
+	return fuchsiaParallelism, hostParallelism
 }
 
 // ScaleTestTimeout multiplies the timeout by a factor set by the TEST_TIMEOUT_SCALE_FACTOR
@@ -141,13 +224,46 @@ func SetupAndExecute(ctx context.Context, opts Options, testsPath string) error
 		return fmt.Errorf("failed to create test outputs: %w", err)
 	}
 
-	execErr := execute(ctx, tests, outputs, addr, sshKeyFile, serialSocketPath, testOutDir, opts)
+	var archive *ArchiveSink
+	if opts.ArchivePath != "" && opts.ArchiveFormat != "" && opts.ArchiveFormat != ArchiveFormatNone {
+		archive, err = NewArchiveSink(opts.ArchivePath, opts.ArchiveFormat)
+		if err != nil {
+			return fmt.Errorf("failed to create archive sink: %w", err)
+		}
+	}
+
+	var events *EventStream
+	if opts.EventStreamPath != "" {
+		events, err = NewEventStream(opts.EventStreamPath, opts.EventStreamFormat)
+		if err != nil {
+			return fmt.Errorf("failed to create event stream: %w", err)
+		}
+		events.Plan(len(tests))
+		defer events.Close()
+	}
+
+	execErr := execute(ctx, tests, outputs, addr, sshKeyFile, serialSocketPath, testOutDir, opts, archive, events)
 	if err := outputs.Close(); err != nil {
 		if execErr == nil {
-			return err
+			execErr = err
 		}
 		logger.Warningf(ctx, "Failed to save test outputs: %s", err)
 	}
+	if archive != nil {
+		// summary.json is only finalized by outputs.Close above, so the
+		// manifest entry is added here rather than streamed earlier.
+		manifest, err := os.ReadFile(filepath.Join(testOutDir, archiveManifestName))
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warningf(ctx, "Failed to read %s for archive manifest: %s", archiveManifestName, err)
+		}
+		if err := archive.Close(manifest); err != nil {
+			if execErr == nil {
+				execErr = fmt.Errorf("failed to finalize archive: %w", err)
+			} else {
+				logger.Warningf(ctx, "Failed to finalize archive: %s", err)
+			}
+		}
+	}
 	return execErr
 }
 
@@ -196,6 +312,8 @@ func execute(
 	serialSocketPath,
 	outDir string,
 	opts Options,
+	archive *ArchiveSink,
+	events *EventStream,
 ) error {
 	var fuchsiaSinks, localSinks []runtests.DataSinkReference
 	var fuchsiaTester, localTester Tester
@@ -205,13 +323,15 @@ func execute(
 		"RUST_BACKTRACE=1",
 	)
 
+	timeoutExitCodes := resolveTimeoutExitCodes(opts)
+
 	if !opts.UseSerial && sshKeyFile != "" {
 		ffx, err := ffxInstance(ctx, opts.FFX, opts.Experiments)
 		if err != nil {
 			return err
 		}
 		if ffx != nil {
-			ffxTester, err := NewFFXTester(ctx, ffx, outputs.OutDir, opts.Experiments, opts.LLVMProfdataPath)
+			ffxTester, err := NewFFXTester(ctx, ffx, outputs.OutDir, opts.Experiments, opts.LLVMProfdataPath, timeoutExitCodes)
 			if err != nil {
 				return fmt.Errorf("failed to initialize ffx tester: %w", err)
 			}
@@ -255,7 +375,7 @@ func execute(
 			}
 			if localTester == nil {
 				var err error
-				localTester, err = NewSubprocessTester(opts.LocalWD, localEnv, outputs.OutDir, opts.NsjailPath, opts.NsjailRoot)
+				localTester, err = NewSubprocessTester(opts.LocalWD, localEnv, outputs.OutDir, opts.NsjailPath, opts.NsjailRoot, timeoutExitCodes)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -267,7 +387,7 @@ func execute(
 	}
 
 	var finalError error
-	if err := runAndOutputTests(ctx, tests, testerForTest, outputs, outDir, fuchsiaTester); err != nil {
+	if err := runAndOutputTests(ctx, tests, testerForTest, outputs, outDir, fuchsiaTester, opts, archive, events); err != nil {
 		finalError = err
 	}
 
@@ -293,6 +413,8 @@ func execute(
 				// This error usually has a different root cause that gets masked when we
 				// return this error. Log it so we can keep track of it, but don't fail.
 				logger.Errorf(snapshotCtx, err.Error())
+			} else if opts.SnapshotFile != "" {
+				events.SnapshotCaptured(testerKind(t), filepath.Join(outputs.OutDir, opts.SnapshotFile))
 			}
 			if ctx.Err() != nil {
 				// If the original context was cancelled, just return the context error.
@@ -326,7 +448,7 @@ func validateTest(test testsharder.Test) error {
 	}
 	if test.Runs > 1 {
 		switch test.RunAlgorithm {
-		case testsharder.KeepGoing, testsharder.StopOnFailure, testsharder.StopOnSuccess:
+		case testsharder.KeepGoing, testsharder.StopOnFailure, testsharder.StopOnSuccess, testsharder.RetryFailedCases:
 		default:
 			return fmt.Errorf("one or more tests with invalid `run_algorithm` field")
 		}
@@ -371,10 +493,140 @@ type testToRun struct {
 	previousRuns int
 	// The sum of the durations of all the test's previous runs.
 	totalDuration time.Duration
+	// cases accumulates per-case outcomes across reruns for a
+	// testsharder.RetryFailedCases test. It's nil for every other
+	// RunAlgorithm.
+	cases *caseHistory
+}
+
+// healthCheckGate coordinates pausing every fuchsia worker so a single
+// runHealthCheck call can power-cycle the target without racing a worker
+// that's mid-test against the same device. Workers hold the gate for
+// reading while a test runs; requesting a health check takes the gate for
+// writing, which blocks until every in-flight fuchsia test finishes before
+// running the check, then releases the drained workers.
+type healthCheckGate struct {
+	mu sync.RWMutex
+}
+
+func (g *healthCheckGate) runTest(run func()) {
+	if g == nil {
+		run()
+		return
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	run()
+}
+
+func (g *healthCheckGate) drainAndCheck(ctx context.Context, t Tester) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return runHealthCheck(ctx, t)
+}
+
+// laneGate enforces mutual exclusion between runOS's two lanes so that a
+// test which declared itself unsafe to run alongside anything else
+// (the serialized lane) really does run alone: the parallel lane's workers
+// hold the gate for reading while a test runs, and the serialized lane's
+// single worker takes it for writing, which blocks until every in-flight
+// parallel test finishes and keeps new ones from starting until the
+// serialized test completes.
+type laneGate struct {
+	mu sync.RWMutex
 }
 
-// runAndOutputTests runs all the tests, possibly with retries, and records the
-// results to `outputs`.
+func (g *laneGate) runParallel(run func()) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	run()
+}
+
+func (g *laneGate) runSerialized(run func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	run()
+}
+
+// runLane drains initial through a pool of parallelism worker goroutines,
+// each calling process on every test it pulls off the lane's queue.
+// process returns a non-nil *testToRun to reschedule that test onto the
+// same lane's queue (e.g. because shouldKeepGoing said to run it again),
+// or an error to abort the whole lane. runLane waits for every worker and
+// every rescheduled test to finish before returning.
+func runLane(initial []testToRun, parallelism int, process func(testToRun) (*testToRun, error)) error {
+	if len(initial) == 0 {
+		return nil
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	// pending tracks tests that are either sitting in queue or being
+	// processed by a worker; once it reaches zero, no worker can possibly
+	// produce another item, so it's safe to close queue.
+	var pending sync.WaitGroup
+	queue := make(chan testToRun, 2*len(initial)+parallelism)
+	for _, test := range initial {
+		pending.Add(1)
+		queue <- test
+	}
+	go func() {
+		pending.Wait()
+		close(queue)
+	}()
+
+	var firstErr error
+	var errMu sync.Mutex
+	var workers sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for test := range queue {
+				next, err := process(test)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+				}
+				if next != nil {
+					pending.Add(1)
+					queue <- *next
+				}
+				pending.Done()
+			}
+		}()
+	}
+	workers.Wait()
+	return firstErr
+}
+
+// splitByParallelizable partitions tests into those that declared
+// Test.Parallelizable (safe to run concurrently with one another) and
+// those that didn't (the default), which runAndOutputTests pins to a
+// single-worker serialized lane.
+func splitByParallelizable(tests []testsharder.Test) (parallelizable, serialized []testToRun) {
+	for _, test := range tests {
+		if test.Parallelizable {
+			parallelizable = append(parallelizable, testToRun{Test: test})
+		} else {
+			serialized = append(serialized, testToRun{Test: test})
+		}
+	}
+	return parallelizable, serialized
+}
+
+// runAndOutputTests runs all the tests, possibly with retries, and records
+// the results to `outputs`. Fuchsia and host tests are each dispatched to
+// their own pool of worker goroutines, sized by opts.FuchsiaParallelism and
+// opts.HostParallelism: within a pool, tests that set Test.Parallelizable
+// run concurrently, while every other test is pinned to a single
+// serialized lane so it never overlaps another test on the same tester.
+// This relies on FFXTester and SubprocessTester's Test methods being safe
+// to call concurrently from multiple goroutines.
 func runAndOutputTests(
 	ctx context.Context,
 	tests []testsharder.Test,
@@ -382,51 +634,132 @@ func runAndOutputTests(
 	outputs *TestOutputs,
 	globalOutDir string,
 	fuchsiaTester Tester,
+	opts Options,
+	archive *ArchiveSink,
+	events *EventStream,
 ) error {
-	// Since only a single goroutine writes to and reads from the queue it would
-	// be more appropriate to use a true Queue data structure, but we'd need to
-	// implement that ourselves so it's easier to just use a channel. Make the
-	// channel double the necessary size just to be safe and avoid potential
-	// deadlocks.
-	testQueue := make(chan testToRun, 2*len(tests))
+	fuchsiaParallelism, hostParallelism := resolveParallelism(opts)
 
+	var fuchsiaTests, hostTests []testsharder.Test
 	for _, test := range tests {
-		testQueue <- testToRun{Test: test}
+		if test.OS == "fuchsia" {
+			fuchsiaTests = append(fuchsiaTests, test)
+		} else {
+			hostTests = append(hostTests, test)
+		}
+	}
+
+	var recordMu, sinksMu sync.Mutex
+	var nextIndex int32 = -1
+	nextTestIndex := func() int {
+		return int(atomic.AddInt32(&nextIndex, 1))
 	}
 
-	// `for test := range testQueue` might seem simpler, but it would block
-	// instead of exiting once the queue becomes empty. To exit the loop we
-	// would need to close the channel when it became empty. That would require
-	// a length check within the loop body anyway, and it's more robust to put
-	// the length check in the for loop condition.
-	testIndex := 0
-	shouldRunHealthCheck := false
 	againstDevice := (os.Getenv(botanistconstants.NodenameEnvKey) != targets.DefaultEmulatorNodename &&
 		os.Getenv(botanistconstants.NodenameEnvKey) != "")
-	for len(testQueue) > 0 {
-		if shouldRunHealthCheck && fuchsiaTester != nil {
-			if err := runHealthCheck(ctx, fuchsiaTester); err != nil {
-				// Device is in a bad state and cannot run any more tests,
-				// so fail and return early.
-				return fmt.Errorf("failed to run health check: %w", err)
-			}
-			shouldRunHealthCheck = false
+
+	var gate *healthCheckGate
+	if fuchsiaTester != nil {
+		gate = &healthCheckGate{}
+	}
+
+	runOS := func(osTests []testsharder.Test, parallelism int, gate *healthCheckGate) error {
+		parallelizable, serialized := splitByParallelizable(osTests)
+
+		process := func(test testToRun) (*testToRun, error) {
+			return runQueuedTest(ctx, test, testerForTest, outputs, globalOutDir, &recordMu, &sinksMu, nextTestIndex, againstDevice, gate, fuchsiaTester, archive, events)
 		}
-		test := <-testQueue
 
-		t, sinks, err := testerForTest(test.Test)
-		if err != nil {
-			return err
+		// lanes keeps the serialized lane from overlapping the parallel
+		// lane: without it, the two lanes are just two independent
+		// goroutines and a test that opted out of Parallelizable would
+		// still run concurrently with the parallel lane's tests.
+		lanes := &laneGate{}
+		parallelProcess := func(test testToRun) (*testToRun, error) {
+			var next *testToRun
+			var err error
+			lanes.runParallel(func() { next, err = process(test) })
+			return next, err
+		}
+		serialProcess := func(test testToRun) (*testToRun, error) {
+			var next *testToRun
+			var err error
+			lanes.runSerialized(func() { next, err = process(test) })
+			return next, err
+		}
+
+		var wg sync.WaitGroup
+		var parallelErr, serialErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			parallelErr = runLane(parallelizable, parallelism, parallelProcess)
+		}()
+		go func() {
+			defer wg.Done()
+			serialErr = runLane(serialized, 1, serialProcess)
+		}()
+		wg.Wait()
+		if parallelErr != nil {
+			return parallelErr
 		}
+		return serialErr
+	}
+
+	var wg sync.WaitGroup
+	var fuchsiaErr, hostErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		fuchsiaErr = runOS(fuchsiaTests, fuchsiaParallelism, gate)
+	}()
+	go func() {
+		defer wg.Done()
+		hostErr = runOS(hostTests, hostParallelism, nil)
+	}()
+	wg.Wait()
+
+	if fuchsiaErr != nil {
+		return fuchsiaErr
+	}
+	return hostErr
+}
+
+// runQueuedTest runs a single queued test, including its connection-failure
+// retries, records the result, and — for fuchsia tests run against a real
+// device — drains gate to run a health check if the test failed. It
+// returns a copy of test advanced to its next run if shouldKeepGoing says
+// to run it again, for runLane to reschedule onto the same lane's queue.
+func runQueuedTest(
+	ctx context.Context,
+	test testToRun,
+	testerForTest func(testsharder.Test) (Tester, *[]runtests.DataSinkReference, error),
+	outputs *TestOutputs,
+	globalOutDir string,
+	recordMu, sinksMu *sync.Mutex,
+	nextTestIndex func() int,
+	againstDevice bool,
+	gate *healthCheckGate,
+	fuchsiaTester Tester,
+	archive *ArchiveSink,
+	events *EventStream,
+) (*testToRun, error) {
+	t, sinks, err := testerForTest(test.Test)
+	if err != nil {
+		return nil, err
+	}
+	kind := testerKind(t)
 
-		var result *TestResult
-		var outDir string
-		if err := retryOnConnectionFailure(ctx, t, func() error {
+	var result *TestResult
+	var runErr error
+	gate.runTest(func() {
+		runErr = retryOnConnectionFailure(ctx, t, func() error {
 			runIndex := test.previousRuns
 
-			outDir = filepath.Join(globalOutDir, url.PathEscape(strings.ReplaceAll(test.Name, ":", "")), strconv.Itoa(runIndex))
+			outDir := filepath.Join(globalOutDir, url.PathEscape(strings.ReplaceAll(test.Name, ":", "")), strconv.Itoa(runIndex))
+			archiveRelDir, _ := filepath.Rel(globalOutDir, outDir)
 			var testErr error
-			result, testErr = runTestOnce(ctx, test.Test, t, outDir, testIndex)
+			result, testErr = runTestOnce(ctx, test.Test, t, outDir, nextTestIndex(), archive, archiveRelDir, events, runIndex, kind)
 			if result == nil {
 				return testErr
 			}
@@ -439,27 +772,79 @@ func runAndOutputTests(
 			test.previousRuns++
 			test.totalDuration += result.Duration()
 			return testErr
-		}); err != nil {
-			return err
-		}
+		})
+	})
+	if runErr != nil {
+		return nil, runErr
+	}
 
-		if err := outputs.Record(ctx, *result); err != nil {
-			return err
+	retryingFailedCases := test.Test.RunAlgorithm == testsharder.RetryFailedCases
+	if retryingFailedCases {
+		if test.cases == nil {
+			test.cases = newCaseHistory()
 		}
-		testIndex++
+		test.cases.merge(result.Cases)
+	}
 
-		if againstDevice && !result.Passed() {
-			shouldRunHealthCheck = true
-		}
-		if shouldKeepGoing(test.Test, result, test.totalDuration) {
-			// Schedule the test to be run again.
-			testQueue <- test
+	keepGoing := shouldKeepGoing(test.Test, result, test.totalDuration)
+	if retryingFailedCases && !keepGoing {
+		// This was the last attempt: replace this attempt's cases with the
+		// merged, best-outcome view across every attempt so the recorded
+		// result reads the same as a single all-passing run would have.
+		result.Cases = test.cases.merged()
+	}
+
+	recordMu.Lock()
+	recordErr := outputs.Record(ctx, *result)
+	recordMu.Unlock()
+	if recordErr != nil {
+		return nil, recordErr
+	}
+
+	if gate != nil && againstDevice && !result.Passed() {
+		events.HealthCheck(test.Name, result.RunIndex, testerKind(fuchsiaTester))
+		if err := gate.drainAndCheck(ctx, fuchsiaTester); err != nil {
+			// Device is in a bad state and cannot run any more tests, so
+			// fail and return early.
+			return nil, fmt.Errorf("failed to run health check: %w", err)
 		}
-		// TODO(olivernewman): Add a unit test to make sure data sinks are
-		// recorded correctly.
-		*sinks = append(*sinks, result.DataSinks)
 	}
-	return nil
+
+	// TODO(olivernewman): Add a unit test to make sure data sinks are
+	// recorded correctly.
+	sinksMu.Lock()
+	*sinks = append(*sinks, result.DataSinks)
+	sinksMu.Unlock()
+
+	if !keepGoing {
+		return nil, nil
+	}
+	events.RetryScheduled(test.Name, result.RunIndex)
+	next := test
+	if retryingFailedCases {
+		// Restrict the next attempt to only the cases that failed this
+		// time, rather than rerunning the whole (possibly thousand-case)
+		// suite. FFXTester translates CaseFilter into --test-filter args;
+		// SubprocessTester appends --gtest_filter= or -run depending on
+		// its TestFramework hint.
+		next.Test.CaseFilter = failedCaseNames(result)
+	}
+	return &next, nil
+}
+
+// testerKind returns the short identifier an EventStream records for which
+// concrete Tester ran a test: "ffx", "serial", or "subprocess".
+func testerKind(t Tester) string {
+	switch t.(type) {
+	case *FFXTester:
+		return "ffx"
+	case *FuchsiaSerialTester:
+		return "serial"
+	case *SubprocessTester:
+		return "subprocess"
+	default:
+		return "unknown"
+	}
 }
 
 type connectionError struct {
@@ -528,10 +913,80 @@ func shouldKeepGoing(test testsharder.Test, lastResult *TestResult, testTotalDur
 		return false
 	} else if test.RunAlgorithm == testsharder.StopOnFailure && !lastResult.Passed() {
 		return false
+	} else if test.RunAlgorithm == testsharder.RetryFailedCases && len(failedCaseNames(lastResult)) == 0 {
+		return false
 	}
 	return true
 }
 
+// caseFailed reports whether tc represents a failed case, reusing the same
+// TestResult enum TestDetails.Result uses rather than a case-specific one.
+func caseFailed(tc runtests.TestCaseResult) bool {
+	return tc.Status != runtests.TestSuccess
+}
+
+// failedCaseNames returns the display names of every case in result.Cases
+// that didn't succeed, for a testsharder.RetryFailedCases test to pass as
+// its next attempt's CaseFilter.
+func failedCaseNames(result *TestResult) []string {
+	var names []string
+	for _, tc := range result.Cases {
+		if caseFailed(tc) {
+			names = append(names, tc.DisplayName)
+		}
+	}
+	return names
+}
+
+// caseAttemptRecord tracks a single case's best (most successful) outcome
+// and how many times it's been attempted, across a RetryFailedCases test's
+// reruns.
+type caseAttemptRecord struct {
+	best     runtests.TestCaseResult
+	attempts int
+}
+
+// caseHistory accumulates caseAttemptRecords, keyed by DisplayName, across
+// a RetryFailedCases test's reruns, preserving the order in which cases
+// were first seen so the merged result reads the same as a single-attempt
+// run would have.
+type caseHistory struct {
+	records map[string]*caseAttemptRecord
+	order   []string
+}
+
+func newCaseHistory() *caseHistory {
+	return &caseHistory{records: make(map[string]*caseAttemptRecord)}
+}
+
+// merge folds one attempt's case results into h, keeping each case's best
+// outcome: once a case has passed in any attempt, later failing reruns of
+// the cases that did pass don't override that.
+func (h *caseHistory) merge(cases []runtests.TestCaseResult) {
+	for _, tc := range cases {
+		rec, ok := h.records[tc.DisplayName]
+		if !ok {
+			rec = &caseAttemptRecord{}
+			h.records[tc.DisplayName] = rec
+			h.order = append(h.order, tc.DisplayName)
+		}
+		rec.attempts++
+		if rec.attempts == 1 || !caseFailed(tc) || caseFailed(rec.best) {
+			rec.best = tc
+		}
+	}
+}
+
+// merged returns the merged case results in first-seen order, each case's
+// best attempt, for replacing a RetryFailedCases test's final TestResult.Cases.
+func (h *caseHistory) merged() []runtests.TestCaseResult {
+	cases := make([]runtests.TestCaseResult, 0, len(h.order))
+	for _, name := range h.order {
+		cases = append(cases, h.records[name].best)
+	}
+	return cases
+}
+
 // stdioBuffer is a simple thread-safe wrapper around bytes.Buffer. It
 // implements the io.Writer interface.
 type stdioBuffer struct {
@@ -556,7 +1011,13 @@ func runTestOnce(
 	t Tester,
 	outDir string,
 	testIndex int,
+	archive *ArchiveSink,
+	archiveRelDir string,
+	events *EventStream,
+	attempt int,
+	testerKind string,
 ) (*TestResult, error) {
+	events.TestStarted(origTest.Name, attempt, testerKind, outDir)
 	// The test case parser specifically uses stdout, so we need to have a
 	// dedicated stdout buffer.
 	stdoutForParsing := new(bytes.Buffer)
@@ -680,6 +1141,11 @@ func runTestOnce(
 			if err != nil {
 				return err
 			}
+			if archive != nil {
+				if err := archive.AddFile(filepath.Join(archiveRelDir, relPath), path); err != nil {
+					logger.Debugf(ctx, "unable to archive output file: %s", err)
+				}
+			}
 			// Don't include the file if it's already recorded as a test case output file.
 			if !strings.Contains(strings.Join(caseOutputFiles, " "), path) {
 				result.OutputFiles = append(result.OutputFiles, relPath)
@@ -709,5 +1175,12 @@ func runTestOnce(
 	result.StartTime = startTime
 	result.EndTime = endTime
 	result.Affected = test.Affected
+
+	for _, tc := range result.Cases {
+		events.CaseStarted(test.Name, tc.DisplayName, attempt)
+		events.CaseFinished(test.Name, tc.DisplayName, attempt, tc)
+	}
+	events.TestFinished(test.Name, attempt, testerKind, outDir, result.Duration(), result.Passed(), result.OutputFiles)
+
 	return result, err
 }
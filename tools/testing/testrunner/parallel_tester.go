@@ -0,0 +1,171 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+// ParallelDefault is the default number of cases ParallelTester dispatches
+// concurrently, matching the Fuchsia gotests test_server's PARALLEL_DEFAULT.
+const ParallelDefault = 10
+
+// AbortReason describes why a batch of in-flight cases was aborted, e.g. a
+// kernel panic observed on the serial klog stream (see KlogDemux).
+type AbortReason struct {
+	Message string
+}
+
+// CaseRunner runs a single case of a test component, returning its result.
+// FuchsiaSerialTester/FFXTester would implement this over one of their
+// pooled SSH sessions.
+type CaseRunner interface {
+	RunCase(ctx context.Context, test testsharder.Test, caseName string) (*CaseResult, error)
+}
+
+// CaseLister enumerates the cases within a single test component, e.g. via
+// `run-test-suite --list-cases` or `ffx test list-cases`.
+type CaseLister interface {
+	ListCases(ctx context.Context, test testsharder.Test) ([]string, error)
+}
+
+// BaseCaseResult is the per-case analog of BaseTestResultFromTest: it seeds
+// a CaseResult that defaults to CaseFailed, so a case that's interrupted
+// before its runner can report a real outcome is reported as a failure
+// rather than silently dropped.
+func BaseCaseResult(test testsharder.Test, caseName string) CaseResult {
+	return CaseResult{Name: caseName, Status: CaseFailed}
+}
+
+// ParallelTester dispatches the cases of a single test component
+// concurrently across pooled sessions, as an alternative to the default
+// one-test-at-a-time flow in runAndOutputTests. When a panic is signaled
+// through Run's panicSignal channel, every in-flight case's context is
+// canceled and the still-running cases are reported as CaseAborted so the
+// caller can retry them on a fresh boot.
+type ParallelTester struct {
+	Runner CaseRunner
+	Lister CaseLister
+
+	// Concurrency bounds how many cases run at once. Zero means
+	// ParallelDefault.
+	Concurrency int
+
+	// MaxRetries bounds how many times an aborted case is retried (on a
+	// fresh boot, via Reboot) before it's reported as a terminal failure.
+	MaxRetries int
+	// Reboot is called before each retry of an aborted case; it's the
+	// caller's responsibility to actually cycle the device. Run waits for
+	// it to return before retrying.
+	Reboot func(ctx context.Context) error
+}
+
+// Run dispatches every entry of cases concurrently, up to Concurrency at a
+// time, deriving each case's context from ctx. If panicSignal delivers an
+// AbortReason while cases are still running, every case still in flight is
+// canceled and reported as CaseAborted with that reason.
+func (p *ParallelTester) Run(ctx context.Context, test testsharder.Test, cases []string, panicSignal <-chan AbortReason) []CaseResult {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = ParallelDefault
+	}
+
+	runCtx, cancelAll := context.WithCancel(ctx)
+	defer cancelAll()
+
+	var abortMu sync.Mutex
+	var abortReason *AbortReason
+	if panicSignal != nil {
+		go func() {
+			select {
+			case reason, ok := <-panicSignal:
+				if !ok {
+					return
+				}
+				abortMu.Lock()
+				abortReason = &reason
+				abortMu.Unlock()
+				cancelAll()
+			case <-runCtx.Done():
+			}
+		}()
+	}
+
+	results := make([]CaseResult, len(cases))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range cases {
+		i, name := i, name
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.runWithRetries(runCtx, test, name)
+		}()
+	}
+	wg.Wait()
+
+	abortMu.Lock()
+	reason := abortReason
+	abortMu.Unlock()
+	if reason != nil {
+		for i, r := range results {
+			// Prefer the real AbortReason over whatever generic
+			// ctx.Err() message runWithRetries synthesized when it
+			// noticed the cancellation, so a case killed by a
+			// sibling's kernel panic reports why rather than just
+			// "context canceled".
+			if r.Status == CaseAborted {
+				results[i].FailureMessage = reason.Message
+			}
+		}
+	}
+	return results
+}
+
+// runWithRetries runs a single case, retrying it (after rebooting, if
+// p.Reboot is set) up to p.MaxRetries times if it comes back CaseAborted.
+func (p *ParallelTester) runWithRetries(ctx context.Context, test testsharder.Test, caseName string) CaseResult {
+	result := BaseCaseResult(test, caseName)
+	for attempt := 0; attempt <= p.MaxRetries; attempt++ {
+		if ctx.Err() != nil {
+			result.Status = CaseAborted
+			result.FailureMessage = ctx.Err().Error()
+			return result
+		}
+		if attempt > 0 && p.Reboot != nil {
+			if err := p.Reboot(ctx); err != nil {
+				result.FailureMessage = fmt.Sprintf("rebooting before retry %d: %s", attempt, err)
+				return result
+			}
+		}
+		r, err := p.Runner.RunCase(ctx, test, caseName)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The context was canceled out from under RunCase
+				// (e.g. a sibling case's kernel panic), rather than
+				// RunCase itself failing, so this is an abort, not
+				// an ordinary failure, even though the retry budget
+				// may otherwise be exhausted here.
+				result.Status = CaseAborted
+				result.FailureMessage = ctx.Err().Error()
+				return result
+			}
+			result.Status = CaseFailed
+			result.FailureMessage = err.Error()
+			continue
+		}
+		result = *r
+		if result.Status != CaseAborted {
+			return result
+		}
+	}
+	return result
+}
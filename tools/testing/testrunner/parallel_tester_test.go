@@ -0,0 +1,126 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+// fakeCaseRunner runs cases by looking up canned results/errors by name,
+// blocking on hold (if set) until release is signaled or its context is
+// canceled.
+type fakeCaseRunner struct {
+	mu      sync.Mutex
+	results map[string]*CaseResult
+	errs    map[string]error
+	hold    map[string]chan struct{}
+}
+
+func (f *fakeCaseRunner) RunCase(ctx context.Context, test testsharder.Test, caseName string) (*CaseResult, error) {
+	f.mu.Lock()
+	hold := f.hold[caseName]
+	f.mu.Unlock()
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err, ok := f.errs[caseName]; ok {
+		return nil, err
+	}
+	if r, ok := f.results[caseName]; ok {
+		return r, nil
+	}
+	return &CaseResult{Name: caseName, Status: CasePassed}, nil
+}
+
+func TestParallelTesterRunsAllCases(t *testing.T) {
+	runner := &fakeCaseRunner{
+		results: map[string]*CaseResult{
+			"CaseA": {Name: "CaseA", Status: CasePassed},
+			"CaseB": {Name: "CaseB", Status: CaseFailed},
+		},
+	}
+	p := &ParallelTester{Runner: runner, Concurrency: 2}
+	results := p.Run(context.Background(), testsharder.Test{}, []string{"CaseA", "CaseB"}, nil)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Status != CasePassed || results[1].Status != CaseFailed {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestParallelTesterAbortsOnPanicSignal(t *testing.T) {
+	hold := make(chan struct{})
+	runner := &fakeCaseRunner{hold: map[string]chan struct{}{"Stuck": hold}}
+	p := &ParallelTester{Runner: runner, Concurrency: 1}
+
+	panicSignal := make(chan AbortReason, 1)
+	panicSignal <- AbortReason{Message: "kernel panic"}
+
+	results := p.Run(context.Background(), testsharder.Test{}, []string{"Stuck"}, panicSignal)
+	close(hold)
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if results[0].Status != CaseAborted {
+		t.Errorf("Status = %s, want CaseAborted", results[0].Status)
+	}
+	if results[0].FailureMessage == "" {
+		t.Error("expected a non-empty failure message explaining the abort")
+	}
+}
+
+func TestParallelTesterRetriesAbortedCases(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	// firstThenSucceed aborts on its first call and succeeds thereafter, to
+	// exercise the retry-after-reboot path.
+	firstThenSucceed := caseRunnerFunc(func(ctx context.Context, test testsharder.Test, caseName string) (*CaseResult, error) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 1 {
+			return &CaseResult{Name: caseName, Status: CaseAborted}, nil
+		}
+		return &CaseResult{Name: caseName, Status: CasePassed}, nil
+	})
+
+	var rebootCalls int
+	p := &ParallelTester{
+		Runner:      firstThenSucceed,
+		MaxRetries:  1,
+		Concurrency: 1,
+		Reboot: func(ctx context.Context) error {
+			rebootCalls++
+			return nil
+		},
+	}
+	results := p.Run(context.Background(), testsharder.Test{}, []string{"Flaky"}, nil)
+	if results[0].Status != CasePassed {
+		t.Errorf("Status = %s, want CasePassed after retry", results[0].Status)
+	}
+	if rebootCalls != 1 {
+		t.Errorf("rebootCalls = %d, want 1", rebootCalls)
+	}
+}
+
+// caseRunnerFunc adapts a function to the CaseRunner interface.
+type caseRunnerFunc func(ctx context.Context, test testsharder.Test, caseName string) (*CaseResult, error)
+
+func (f caseRunnerFunc) RunCase(ctx context.Context, test testsharder.Test, caseName string) (*CaseResult, error) {
+	return f(ctx, test, caseName)
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// ProfileMerger streams raw profiles (llvm-profile/**/*.profraw) in as they
+// are produced by SubprocessTester and FFXTester runs, shards them by the
+// build-id of the binary they came from, and merges each shard
+// incrementally. FFXTester.moveProfileToOutputDir streams into one of
+// these instead of just copying files to the output directory.
+type ProfileMerger interface {
+	// AddProfile registers profrawPath as contributing to testName's
+	// coverage, attributing it to the binary identified by buildID.
+	AddProfile(testName, buildID, profrawPath string) error
+	// Finish merges every shard and returns the resulting manifest. Shards
+	// that fail to merge are recorded in FailedBuildIDs rather than
+	// aborting the whole pipeline.
+	Finish() (ProfileManifest, error)
+}
+
+// ProfileManifest maps each successfully merged binary's build-id to its
+// merged profdata path and the tests that contributed to it, plus any
+// build-ids whose shard failed to merge.
+type ProfileManifest struct {
+	// Profdata maps build-id -> path to that binary's merged default.profdata.
+	Profdata map[string]string
+	// Contributors maps build-id -> the names of tests that contributed a
+	// profraw to it.
+	Contributors map[string][]string
+	// FailedBuildIDs lists build-ids whose shard merge failed; the
+	// remaining, successful entries are still reported.
+	FailedBuildIDs []string
+}
+
+// shardedProfileMerger is the default ProfileMerger. It bounds concurrent
+// `llvm-profdata merge` invocations via maxOpenFiles, since each merge
+// holds every profraw in the shard open at once.
+type shardedProfileMerger struct {
+	llvmProfdataPath string
+	outDir           string
+	maxOpenFiles     int
+
+	mu           sync.Mutex
+	shards       map[string][]string // build-id -> profraw paths
+	contributors map[string][]string // build-id -> test names
+}
+
+// NewProfileMerger returns a ProfileMerger that shards by build-id and
+// merges each shard with llvmProfdataPath, writing merged output under
+// outDir. No more than maxOpenFiles profraws are open at once across all
+// in-flight merges.
+func NewProfileMerger(llvmProfdataPath, outDir string, maxOpenFiles int) ProfileMerger {
+	return &shardedProfileMerger{
+		llvmProfdataPath: llvmProfdataPath,
+		outDir:           outDir,
+		maxOpenFiles:     maxOpenFiles,
+		shards:           make(map[string][]string),
+		contributors:     make(map[string][]string),
+	}
+}
+
+func (m *shardedProfileMerger) AddProfile(testName, buildID, profrawPath string) error {
+	if buildID == "" {
+		return fmt.Errorf("profile %q has no build-id; cannot shard it", profrawPath)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shards[buildID] = append(m.shards[buildID], profrawPath)
+	m.contributors[buildID] = append(m.contributors[buildID], testName)
+	return nil
+}
+
+func (m *shardedProfileMerger) Finish() (ProfileManifest, error) {
+	manifest := ProfileManifest{
+		Profdata:     make(map[string]string),
+		Contributors: make(map[string][]string),
+	}
+
+	type job struct {
+		buildID  string
+		profraws []string
+	}
+	jobs := make(chan job)
+	results := make(chan struct {
+		buildID string
+		out     string
+		err     error
+	})
+
+	workers := m.maxOpenFiles
+	if workers <= 0 {
+		workers = 1
+	}
+	// Each merge opens every profraw in its shard at once; cap concurrent
+	// merges so the total open files across them stays under
+	// m.maxOpenFiles.
+	maxShardSize := 1
+	for _, profraws := range m.shards {
+		if len(profraws) > maxShardSize {
+			maxShardSize = len(profraws)
+		}
+	}
+	if concurrent := workers / maxShardSize; concurrent > 0 {
+		workers = concurrent
+	} else {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				out, err := m.mergeShard(j.buildID, j.profraws)
+				results <- struct {
+					buildID string
+					out     string
+					err     error
+				}{j.buildID, out, err}
+			}
+		}()
+	}
+
+	go func() {
+		for buildID, profraws := range m.shards {
+			jobs <- job{buildID: buildID, profraws: profraws}
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		if r.err != nil {
+			manifest.FailedBuildIDs = append(manifest.FailedBuildIDs, r.buildID)
+			continue
+		}
+		manifest.Profdata[r.buildID] = r.out
+		manifest.Contributors[r.buildID] = m.contributors[r.buildID]
+	}
+
+	return manifest, nil
+}
+
+func (m *shardedProfileMerger) mergeShard(buildID string, profraws []string) (string, error) {
+	out := filepath.Join(m.outDir, buildID, "default.profdata")
+	args := append([]string{"merge", "-sparse", "-o", out}, profraws...)
+	cmd := exec.Command(m.llvmProfdataPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("merging profiles for build-id %s: %w: %s", buildID, err, output)
+	}
+	return out, nil
+}
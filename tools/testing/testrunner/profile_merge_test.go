@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeLLVMProfdata is a script standing in for llvm-profdata: it fails
+// whenever one of its input paths contains "bad", and otherwise touches
+// the -o path so the merge appears to have produced output.
+func writeFakeLLVMProfdata(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "llvm-profdata")
+	contents := `#!/bin/sh
+for arg in "$@"; do
+  case "$arg" in
+    *bad*) exit 1 ;;
+  esac
+done
+out=""
+prev=""
+for arg in "$@"; do
+  if [ "$prev" = "-o" ]; then
+    out="$arg"
+  fi
+  prev="$arg"
+done
+mkdir -p "$(dirname "$out")"
+touch "$out"
+`
+	if err := os.WriteFile(script, []byte(contents), 0755); err != nil {
+		t.Fatalf("writing fake llvm-profdata: %s", err)
+	}
+	return script
+}
+
+func TestProfileMergerDegradesGracefullyOnFailingShard(t *testing.T) {
+	llvmProfdata := writeFakeLLVMProfdata(t)
+	outDir := t.TempDir()
+
+	profrawDir := t.TempDir()
+	good1 := filepath.Join(profrawDir, "good1.profraw")
+	good2 := filepath.Join(profrawDir, "good2.profraw")
+	bad := filepath.Join(profrawDir, "bad.profraw")
+	for _, p := range []string{good1, good2, bad} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("writing fake profraw: %s", err)
+		}
+	}
+
+	merger := NewProfileMerger(llvmProfdata, outDir, 8)
+	if err := merger.AddProfile("test-a", "buildid-good", good1); err != nil {
+		t.Fatalf("AddProfile() failed: %s", err)
+	}
+	if err := merger.AddProfile("test-b", "buildid-good", good2); err != nil {
+		t.Fatalf("AddProfile() failed: %s", err)
+	}
+	if err := merger.AddProfile("test-c", "buildid-bad", bad); err != nil {
+		t.Fatalf("AddProfile() failed: %s", err)
+	}
+
+	manifest, err := merger.Finish()
+	if err != nil {
+		t.Fatalf("Finish() failed: %s", err)
+	}
+
+	if _, ok := manifest.Profdata["buildid-good"]; !ok {
+		t.Errorf("manifest missing successful shard buildid-good: %+v", manifest)
+	}
+	if len(manifest.Contributors["buildid-good"]) != 2 {
+		t.Errorf("Contributors[buildid-good] = %v, want 2 entries", manifest.Contributors["buildid-good"])
+	}
+
+	foundFailed := false
+	for _, id := range manifest.FailedBuildIDs {
+		if id == "buildid-bad" {
+			foundFailed = true
+		}
+	}
+	if !foundFailed {
+		t.Errorf("FailedBuildIDs = %v, want it to include buildid-bad", manifest.FailedBuildIDs)
+	}
+}
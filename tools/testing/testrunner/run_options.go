@@ -0,0 +1,95 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import "fmt"
+
+// RunOptions carries the run-test-suite flags that go beyond what
+// commandForTest already threads through (--filter-ansi, --parallel,
+// --timeout, --realm). It's meant to be embedded on testsharder.Test once
+// that type picks it up, the same way Tags and Metadata are today.
+type RunOptions struct {
+	// MaxSeverityLogs and MinSeverityLogs map to --max-severity-logs and
+	// --min-severity-logs.
+	MaxSeverityLogs string
+	MinSeverityLogs string
+	// NoCasesEqualsSuccess maps to --no-cases-equals-success.
+	NoCasesEqualsSuccess bool
+	// TestFilters maps to one or more repeated --test-filter flags.
+	TestFilters []string
+	// AlsoRunDisabledTests maps to --also-run-disabled-tests.
+	AlsoRunDisabledTests bool
+	// BreakOnFailure maps to --break-on-failure.
+	BreakOnFailure bool
+	// TestArgs maps to --test-args, followed by every element verbatim.
+	TestArgs []string
+}
+
+// ErrUnsupportedOnSerial is returned by AppendRunTestSuiteArgs when opts
+// requests a flag that serial's `runtests` has no equivalent for. Callers
+// (see commandForTest) can use this to either fall back to SSH or fail the
+// shard outright, rather than silently dropping the flag.
+type ErrUnsupportedOnSerial struct {
+	Flag string
+}
+
+func (e *ErrUnsupportedOnSerial) Error() string {
+	return fmt.Sprintf("%s is not supported when running over serial", e.Flag)
+}
+
+// AppendRunTestSuiteArgs appends opts' flags to a run-test-suite command
+// line already built by commandForTest for the non-serial case. It returns
+// *ErrUnsupportedOnSerial without modifying args if useSerial is true and
+// opts requests anything serial's `runtests` can't express.
+func AppendRunTestSuiteArgs(args []string, opts RunOptions, useSerial bool) ([]string, error) {
+	if useSerial {
+		if opts.MaxSeverityLogs != "" {
+			return args, &ErrUnsupportedOnSerial{Flag: "--max-severity-logs"}
+		}
+		if opts.MinSeverityLogs != "" {
+			return args, &ErrUnsupportedOnSerial{Flag: "--min-severity-logs"}
+		}
+		if opts.NoCasesEqualsSuccess {
+			return args, &ErrUnsupportedOnSerial{Flag: "--no-cases-equals-success"}
+		}
+		if len(opts.TestFilters) > 0 {
+			return args, &ErrUnsupportedOnSerial{Flag: "--test-filter"}
+		}
+		if opts.AlsoRunDisabledTests {
+			return args, &ErrUnsupportedOnSerial{Flag: "--also-run-disabled-tests"}
+		}
+		if opts.BreakOnFailure {
+			return args, &ErrUnsupportedOnSerial{Flag: "--break-on-failure"}
+		}
+		if len(opts.TestArgs) > 0 {
+			return args, &ErrUnsupportedOnSerial{Flag: "--test-args"}
+		}
+		return args, nil
+	}
+
+	if opts.MaxSeverityLogs != "" {
+		args = append(args, "--max-severity-logs", opts.MaxSeverityLogs)
+	}
+	if opts.MinSeverityLogs != "" {
+		args = append(args, "--min-severity-logs", opts.MinSeverityLogs)
+	}
+	if opts.NoCasesEqualsSuccess {
+		args = append(args, "--no-cases-equals-success")
+	}
+	for _, filter := range opts.TestFilters {
+		args = append(args, "--test-filter", filter)
+	}
+	if opts.AlsoRunDisabledTests {
+		args = append(args, "--also-run-disabled-tests")
+	}
+	if opts.BreakOnFailure {
+		args = append(args, "--break-on-failure")
+	}
+	if len(opts.TestArgs) > 0 {
+		args = append(args, "--test-args")
+		args = append(args, opts.TestArgs...)
+	}
+	return args, nil
+}
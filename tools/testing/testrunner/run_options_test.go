@@ -0,0 +1,82 @@
+// Copyright 2023 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAppendRunTestSuiteArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		opts      RunOptions
+		useSerial bool
+		expected  []string
+		wantErr   bool
+	}{
+		{
+			name: "every flag over ssh",
+			opts: RunOptions{
+				MaxSeverityLogs:      "ERROR",
+				MinSeverityLogs:      "INFO",
+				NoCasesEqualsSuccess: true,
+				TestFilters:          []string{"*Foo*", "*Bar*"},
+				AlsoRunDisabledTests: true,
+				BreakOnFailure:       true,
+				TestArgs:             []string{"--flag", "value"},
+			},
+			expected: []string{
+				"base",
+				"--max-severity-logs", "ERROR",
+				"--min-severity-logs", "INFO",
+				"--no-cases-equals-success",
+				"--test-filter", "*Foo*",
+				"--test-filter", "*Bar*",
+				"--also-run-disabled-tests",
+				"--break-on-failure",
+				"--test-args", "--flag", "value",
+			},
+		},
+		{
+			name:     "no options",
+			opts:     RunOptions{},
+			expected: []string{"base"},
+		},
+		{
+			name:      "incompatible flag over serial",
+			opts:      RunOptions{MaxSeverityLogs: "ERROR"},
+			useSerial: true,
+			expected:  []string{"base"},
+			wantErr:   true,
+		},
+		{
+			name:      "compatible (empty) options over serial",
+			opts:      RunOptions{},
+			useSerial: true,
+			expected:  []string{"base"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := AppendRunTestSuiteArgs([]string{"base"}, c.opts, c.useSerial)
+			if gotErr := err != nil; gotErr != c.wantErr {
+				t.Errorf("got err: %v, want err: %t", err, c.wantErr)
+			}
+			if c.wantErr {
+				var unsupported *ErrUnsupportedOnSerial
+				if !errors.As(err, &unsupported) {
+					t.Errorf("expected *ErrUnsupportedOnSerial, got %T", err)
+				}
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("unexpected args (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+// SandboxPolicy declaratively describes the nsjail sandbox SubprocessTester
+// should construct for a test, replacing what used to be a fixed list of
+// bindmounts, env clears, and rlimits baked into Go code.
+type SandboxPolicy struct {
+	Name string `json:"name"`
+	// ReadOnlyMounts and ReadWriteMounts are host paths bind-mounted into
+	// the sandbox; RWMounts are mounted --bindmount_rw, ROMounts are
+	// mounted --bindmount_ro.
+	ReadOnlyMounts  []string `json:"read_only_mounts,omitempty"`
+	ReadWriteMounts []string `json:"read_write_mounts,omitempty"`
+	// TmpfsMounts are paths inside the sandbox to mount as empty tmpfs.
+	TmpfsMounts []string `json:"tmpfs_mounts,omitempty"`
+	// EnvAllowlist lists environment variable names passed through from
+	// the host into the sandbox; everything else is cleared.
+	EnvAllowlist []string `json:"env_allowlist,omitempty"`
+	// Rlimits maps an nsjail rlimit flag name (e.g. "rlimit_as") to its
+	// value in the units nsjail expects.
+	Rlimits map[string]string `json:"rlimits,omitempty"`
+	// SeccompPolicyPath, if set, is passed to nsjail's --seccomp_string or
+	// --seccomp_policy flag.
+	SeccompPolicyPath string `json:"seccomp_policy_path,omitempty"`
+}
+
+// LoadSandboxPolicy reads a SandboxPolicy from a JSON file.
+func LoadSandboxPolicy(path string) (SandboxPolicy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return SandboxPolicy{}, fmt.Errorf("reading sandbox policy %q: %w", path, err)
+	}
+	var p SandboxPolicy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return SandboxPolicy{}, fmt.Errorf("parsing sandbox policy %q: %w", path, err)
+	}
+	return p, nil
+}
+
+// sandboxOverrideTagPrefix tags on a testsharder.Test add mounts to the
+// base policy, e.g. a tag {Key: "sandbox_rw_mount", Value: "/dev/kvm"}.
+const (
+	sandboxROMountTag = "sandbox_ro_mount"
+	sandboxRWMountTag = "sandbox_rw_mount"
+	sandboxEnvTag     = "sandbox_env"
+)
+
+// MergeTestOverrides returns a copy of base with any per-test additions
+// declared via test's tags layered on top. The base policy's fields are
+// never removed, only added to: a test can ask for more access, not less.
+func (base SandboxPolicy) MergeTestOverrides(test testsharder.Test) SandboxPolicy {
+	merged := base
+	merged.ReadOnlyMounts = append(append([]string{}, base.ReadOnlyMounts...))
+	merged.ReadWriteMounts = append(append([]string{}, base.ReadWriteMounts...))
+	merged.EnvAllowlist = append(append([]string{}, base.EnvAllowlist...))
+
+	for _, tag := range test.Tags {
+		switch tag.Key {
+		case sandboxROMountTag:
+			merged.ReadOnlyMounts = append(merged.ReadOnlyMounts, tag.Value)
+		case sandboxRWMountTag:
+			merged.ReadWriteMounts = append(merged.ReadWriteMounts, tag.Value)
+		case sandboxEnvTag:
+			merged.EnvAllowlist = append(merged.EnvAllowlist, tag.Value)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+func TestLoadSandboxPolicy(t *testing.T) {
+	p, err := LoadSandboxPolicy("sandbox_policies/default-host-linux.json")
+	if err != nil {
+		t.Fatalf("LoadSandboxPolicy() failed: %s", err)
+	}
+	if p.Name != "default-host-linux" {
+		t.Errorf("Name = %q, want %q", p.Name, "default-host-linux")
+	}
+	if len(p.ReadOnlyMounts) == 0 {
+		t.Errorf("ReadOnlyMounts is empty, want the default host bindmounts")
+	}
+}
+
+func TestMergeTestOverridesAddsWithoutRemoving(t *testing.T) {
+	base, err := LoadSandboxPolicy("sandbox_policies/hermetic-min.json")
+	if err != nil {
+		t.Fatalf("LoadSandboxPolicy() failed: %s", err)
+	}
+
+	test := testsharder.Test{
+		Test: build.Test{Name: "needs-kvm-test"},
+		Tags: []build.TestTag{
+			{Key: sandboxRWMountTag, Value: "/dev/kvm"},
+		},
+	}
+
+	merged := base.MergeTestOverrides(test)
+	found := false
+	for _, m := range merged.ReadWriteMounts {
+		if m == "/dev/kvm" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ReadWriteMounts = %v, want it to include /dev/kvm", merged.ReadWriteMounts)
+	}
+	if len(merged.ReadWriteMounts) != len(base.ReadWriteMounts)+1 {
+		t.Errorf("merge should only add to base mounts, not replace them")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+// Resource tag keys a test declares via testsharder.Test.Tags to describe
+// what it needs from the host running it.
+const (
+	tagCPUSlots     = "cpu_slots"
+	tagMemoryMB     = "memory_mb"
+	tagExclusive    = "exclusive"
+	tagNeedsKVM     = "needs_kvm"
+	tagNeedsNetwork = "needs_network"
+)
+
+// resourceDemand is a test's parsed resource declaration.
+type resourceDemand struct {
+	CPUSlots int
+	MemoryMB int
+	// Exclusive, if non-empty, is a tag this test must hold exclusively:
+	// no other test bearing the same Exclusive tag may run concurrently
+	// with it.
+	Exclusive    string
+	NeedsKVM     bool
+	NeedsNetwork bool
+}
+
+func parseResourceDemand(test testsharder.Test) resourceDemand {
+	d := resourceDemand{CPUSlots: 1}
+	for _, tag := range test.Tags {
+		switch tag.Key {
+		case tagCPUSlots:
+			if n, err := strconv.Atoi(tag.Value); err == nil {
+				d.CPUSlots = n
+			}
+		case tagMemoryMB:
+			if n, err := strconv.Atoi(tag.Value); err == nil {
+				d.MemoryMB = n
+			}
+		case tagExclusive:
+			d.Exclusive = tag.Value
+		case tagNeedsKVM:
+			d.NeedsKVM = true
+		case tagNeedsNetwork:
+			d.NeedsNetwork = true
+		}
+	}
+	return d
+}
+
+// HostCapacity describes what the scheduler has available to hand out.
+type HostCapacity struct {
+	CPUSlots int
+	MemoryMB int
+	HasKVM   bool
+}
+
+// ScheduleEvent is one entry in the scheduler's machine-readable trace,
+// useful for debugging why a test ran when it did.
+type ScheduleEvent struct {
+	Test   string
+	Action string // "dispatched" or "completed"
+	// InFlight is the number of tests running immediately after Action.
+	InFlight int
+}
+
+// Scheduler dispatches tests to worker goroutines with parallelism bounded
+// by HostCapacity and each test's resourceDemand, enforcing mutual
+// exclusion between tests that share an Exclusive tag.
+type Scheduler struct {
+	capacity HostCapacity
+
+	mu            sync.Mutex
+	usedCPU       int
+	usedMemMB     int
+	heldExclusive map[string]bool
+	trace         []ScheduleEvent
+	cond          *sync.Cond
+}
+
+// NewScheduler returns a Scheduler bounded by capacity.
+func NewScheduler(capacity HostCapacity) *Scheduler {
+	s := &Scheduler{capacity: capacity, heldExclusive: make(map[string]bool)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *Scheduler) fits(d resourceDemand) bool {
+	if d.Exclusive != "" && s.heldExclusive[d.Exclusive] {
+		return false
+	}
+	if d.NeedsKVM && !s.capacity.HasKVM {
+		// No amount of waiting will satisfy the KVM requirement itself;
+		// the caller is responsible for filtering these out ahead of
+		// scheduling. Treat that part as always-fits here so a
+		// misconfigured environment fails the test itself, rather than
+		// hanging the scheduler forever. Exclusivity above is still
+		// satisfiable by waiting, so it's checked regardless.
+		return s.usedCPU+d.CPUSlots <= s.capacity.CPUSlots
+	}
+	if s.capacity.CPUSlots > 0 && s.usedCPU+d.CPUSlots > s.capacity.CPUSlots {
+		return false
+	}
+	if s.capacity.MemoryMB > 0 && d.MemoryMB > 0 && s.usedMemMB+d.MemoryMB > s.capacity.MemoryMB {
+		return false
+	}
+	return true
+}
+
+// Acquire blocks until test can run without exceeding capacity or
+// violating exclusivity, then reserves its resources and returns a release
+// function the caller must call when the test finishes.
+func (s *Scheduler) Acquire(test testsharder.Test) func() {
+	d := parseResourceDemand(test)
+
+	s.mu.Lock()
+	for !s.fits(d) {
+		s.cond.Wait()
+	}
+	s.usedCPU += d.CPUSlots
+	s.usedMemMB += d.MemoryMB
+	if d.Exclusive != "" {
+		s.heldExclusive[d.Exclusive] = true
+	}
+	s.trace = append(s.trace, ScheduleEvent{Test: test.Name, Action: "dispatched", InFlight: s.inFlightLocked()})
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		s.usedCPU -= d.CPUSlots
+		s.usedMemMB -= d.MemoryMB
+		if d.Exclusive != "" {
+			delete(s.heldExclusive, d.Exclusive)
+		}
+		s.trace = append(s.trace, ScheduleEvent{Test: test.Name, Action: "completed", InFlight: s.inFlightLocked()})
+		s.mu.Unlock()
+		s.cond.Broadcast()
+	}
+}
+
+// inFlightLocked must be called with s.mu held.
+func (s *Scheduler) inFlightLocked() int {
+	if s.capacity.CPUSlots == 0 {
+		return 0
+	}
+	return s.usedCPU
+}
+
+// Trace returns the schedule trace accumulated so far.
+func (s *Scheduler) Trace() []ScheduleEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduleEvent(nil), s.trace...)
+}
+
+// Parallelism returns how many tests could run at once given an even split
+// of capacity.CPUSlots across single-slot tests; used to size the fixed
+// `--experimental-parallel-execution` knob passed to ffx when the caller
+// doesn't want per-test scheduling.
+func Parallelism(capacity HostCapacity) int {
+	if capacity.CPUSlots <= 0 {
+		return 1
+	}
+	return capacity.CPUSlots
+}
+
+func validateExclusiveTag(d resourceDemand) error {
+	if d.Exclusive == "" {
+		return nil
+	}
+	if d.CPUSlots > 1 {
+		return fmt.Errorf("test declares both %q and multiple CPU slots; exclusive tests are assumed single-slot", tagExclusive)
+	}
+	return nil
+}
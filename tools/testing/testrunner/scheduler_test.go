@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+)
+
+func testWithTags(name string, tags ...build.TestTag) testsharder.Test {
+	return testsharder.Test{Test: build.Test{Name: name}, Tags: tags}
+}
+
+func TestSchedulerRespectsTotalCPUCap(t *testing.T) {
+	s := NewScheduler(HostCapacity{CPUSlots: 2})
+
+	var inFlight int32
+	var maxInFlight int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := s.Acquire(testWithTags("t"))
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				cur := atomic.LoadInt32(&maxInFlight)
+				if n <= cur || atomic.CompareAndSwapInt32(&maxInFlight, cur, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("max concurrent tests = %d, want <= 2", maxInFlight)
+	}
+}
+
+func TestSchedulerRespectsExclusiveTag(t *testing.T) {
+	s := NewScheduler(HostCapacity{CPUSlots: 8})
+
+	var inFlight int32
+	var maxInFlight int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := s.Acquire(testWithTags("serial-test", build.TestTag{Key: tagExclusive, Value: "serial-console"}))
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				cur := atomic.LoadInt32(&maxInFlight)
+				if n <= cur || atomic.CompareAndSwapInt32(&maxInFlight, cur, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 1 {
+		t.Errorf("max concurrent exclusive tests = %d, want <= 1", maxInFlight)
+	}
+}
+
+func TestSchedulerFitsChecksExclusiveEvenWithoutKVM(t *testing.T) {
+	s := NewScheduler(HostCapacity{CPUSlots: 8})
+	s.heldExclusive["serial-console"] = true
+
+	d := resourceDemand{CPUSlots: 1, NeedsKVM: true, Exclusive: "serial-console"}
+	if s.fits(d) {
+		t.Errorf("fits(%+v) = true, want false: a held Exclusive tag should block scheduling regardless of NeedsKVM", d)
+	}
+}